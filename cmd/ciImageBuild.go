@@ -3,6 +3,7 @@ package cmd
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"os/exec"
@@ -20,6 +21,37 @@ import (
 var ciImageBuildCmd = &cobra.Command{
 	Use:   "build",
 	Short: "Build and push container image",
+	Long: `Build and push container image
+
+	Image tag is a hash of build path content and dockerfile unless it's set 
+	with "--image-tag". Existing images are reused (see "--image-reuse").
+
+	Files ignored by .dockerignore (or <dockerfile>.dockerignore) are left out 
+	of the hash. Patterns are applied like tar exclude patterns, i.e. patterns 
+	without a slash ("node_modules", "*.log") match at any depth and "!" 
+	exclusions are not supported, so tags stay the same as in earlier 
+	versions. With "--dockerignore-semantics" (or "dockerignore: true" in the 
+	image build file), patterns are applied the same way docker build leaves 
+	files out of build context. Tags of builds with nested matches change 
+	when switching.
+
+	* With "--all", images listed in the image build file (see "--images-file")
+	are built. Tags are calculated and existing images are checked for all 
+	images at the same time, missing images are built "--concurrency" images 
+	at a time. Image build file example:
+
+	  images:
+	    - identifier: php
+	      dockerfile: silta/php.Dockerfile
+	      buildPath: .
+	    - identifier: nginx
+	      dockerfile: silta/nginx.Dockerfile
+	      buildPath: web
+	      tagPrefix: v2
+
+	Image urls are printed as a JSON object of image identifier and image url, 
+	or written to "--image-urls-file" that can be passed to 
+	"silta ci release deploy --image-urls-file".`,
 	Run: func(cmd *cobra.Command, args []string) {
 
 		imageRepoHost, _ := cmd.Flags().GetString("image-repo-host")
@@ -32,6 +64,11 @@ var ciImageBuildCmd = &cobra.Command{
 		dockerfile, _ := cmd.Flags().GetString("dockerfile")
 		reuseExisting, _ := cmd.Flags().GetBool("image-reuse")
 		buildPath, _ := cmd.Flags().GetString("build-path")
+		all, _ := cmd.Flags().GetBool("all")
+		imagesFile, _ := cmd.Flags().GetString("images-file")
+		concurrency, _ := cmd.Flags().GetInt("concurrency")
+		imageUrlsFile, _ := cmd.Flags().GetString("image-urls-file")
+		dockerignore, _ := cmd.Flags().GetBool("dockerignore-semantics")
 
 		// Use environment variables as fallback
 		if useEnv == true {
@@ -49,58 +86,6 @@ var ciImageBuildCmd = &cobra.Command{
 			}
 		}
 
-		imageUrl := fmt.Sprintf("%s/%s/%s-%s", imageRepoHost, imageRepoProject, namespace, imageIdentifier)
-
-		// Only use .dockerignore files if they exist
-		excludeDockerignore := ""
-		if _, err := os.Stat(fmt.Sprintf("%s/.dockerignore", buildPath)); err == nil {
-			excludeDockerignore = fmt.Sprintf("--exclude-from='%s'/.dockerignore", buildPath)
-		}
-		// use <dockerfile>.dockerignore if exists, later takes precedence
-		if _, err := os.Stat(fmt.Sprintf("%s.dockerignore", dockerfile)); err == nil {
-			excludeDockerignore = fmt.Sprintf("--exclude-from='%s.dockerignore'", dockerfile)
-		}
-
-		// If no path is specified, build from an empty directory
-		if len(buildPath) == 0 {
-			// Create kubeconfig folder
-			if _, err := os.Stat("/tmp/empty"); os.IsNotExist(err) {
-				_ = os.Mkdir("/tmp/empty", 0775)
-			}
-			buildPath = "/tmp/empty"
-		}
-
-		// No tag has been defined
-		// Calculate a hash sum of files in the folder except those ignored by docker.
-		// Also make sure modification time or order play no role.
-		if len(imageTag) == 0 {
-			command := fmt.Sprintf(`tar \
-				--sort=name %s \
-				--absolute-names \
-				--exclude='vendor/composer' \
-				--exclude='vendor/autoload.php' \
-				--mtime='2000-01-01 00:00Z' \
-				--clamp-mtime \
-				-cf - '%s' '%s' | sha1sum | cut -c 1-40 | tr -d $'\n'`,
-				excludeDockerignore, buildPath, dockerfile)
-
-			fileListing, err := exec.Command("bash", "-c", command).CombinedOutput()
-			if err != nil {
-				log.Fatal("Error (file checksum): ", err)
-			}
-			// Unless golang calculates checksum itself, passing plain output uses just too much memory.
-			imageTag = string(fileListing)
-
-			// Add prefix if it is specified
-			if len(imageTagPrefix) > 0 {
-				imageTag = imageTagPrefix + string('-') + imageTag
-			}
-
-			// Calculate hash sum
-			// sha1_hash := fmt.Sprintf("%x", sha1.Sum([]byte(fileListing)))
-			// imageTag = sha1_hash[0:40]
-		}
-
 		// Add extra image tag for image identification
 		extraImageTag := ""
 		if len(branchName) > 0 {
@@ -111,142 +96,301 @@ var ciImageBuildCmd = &cobra.Command{
 			extraImageTag = fmt.Sprintf("branch--%s", branchName)
 		}
 
-		// Reuse existing image if it exists
-		if !debug {
-			if reuseExisting {
-				_, useGCloud := os.LookupEnv("SILTA_USE_GCLOUD")
-
-				if useGCloud && (imageRepoHost == "gcr.io" || strings.HasSuffix(imageRepoHost, ".gcr.io") || strings.HasSuffix(imageRepoHost, ".pkg.dev")) {
-
-					// Get image tags via gcloud
-					command := fmt.Sprintf("gcloud container images list-tags '%s' --filter='tags:%s' --format=json", imageUrl, imageTag)
-					output, err := exec.Command("bash", "-c", command).CombinedOutput()
-					if err != nil {
-						log.Println("Error (gcloud list-tags): ", err)
-						log.Println("command:", command)
-						log.Println("response:", string(output))
-
-					} else {
-						// Unmarshal or Decode the JSON to the interface.
-						type TagList struct {
-							Digest string   `json:"digest"`
-							Tags   []string `json:"tags"`
-						}
-						var taglist []TagList
-						err = json.Unmarshal([]byte(output), &taglist)
-						if err != nil {
-							if strings.Contains(string(output), "WARNING: The following filter keys were not present in any resource : tags") {
-								log.Println("Image not found in container registry.")
-							} else {
-								log.Println("Error (json unmarshal):", err)
-								log.Println("response:", string(output))
-							}
-						}
-						var tagExists bool = false
-						var extraTagExists bool = false
-						if len(taglist) > 0 {
-							for _, tag := range taglist {
-								for _, t := range tag.Tags {
-									if t == imageTag {
-										tagExists = true
-									}
-									if len(extraImageTag) > 0 && t == extraImageTag {
-										extraTagExists = true
-									}
-								}
-							}
-						}
-						// If tag exists in taglist, return and don't rebuild.
-						if tagExists {
-							fmt.Printf("Image %s:%s already exists, existing image will be used.\n", imageUrl, imageTag)
-							// Add extra tag if it does not exist yet
-							if len(extraImageTag) > 0 && !extraTagExists {
-								fmt.Printf("Image %s:%s already exists, but extra tag %s:%s does not exist yet, it will be added.\n", imageUrl, imageTag, imageUrl, extraImageTag)
-								command := fmt.Sprintf("gcloud container images add-tag '%s:%s' '%s:%s'", imageUrl, imageTag, imageUrl, extraImageTag)
-								err = exec.Command("bash", "-c", command).Run()
-								if err != nil {
-									log.Fatal("Error (gcloud add-tag): ", err)
-								}
-							}
-							return
-						}
-					}
-				} else {
-					// Generic docker registry, e.g. docker.io
-					// Supports ACR, AR, GCR and ECR
-
-					// Reuse docker cli credentials
-					authenticator := remote.WithAuthFromKeychain(authn.DefaultKeychain)
-
-					imageTag_digest := common.GetImageTagDigest(authenticator, imageUrl, imageTag)
-
-					if imageTag_digest != "" {
-						fmt.Printf("Image %s:%s already exists, existing image will be used.\n", imageUrl, imageTag)
-
-						// Add extra tag (branch name) if it does not exist yet
-						if len(extraImageTag) > 0 {
-
-							extraImageTag_digest := common.GetImageTagDigest(authenticator, imageUrl, extraImageTag)
-
-							imageTag_digest := common.GetImageTagDigest(authenticator, imageUrl, imageTag)
-							if extraImageTag_digest == "" || extraImageTag_digest != imageTag_digest {
-								// Have to pull images, manifest creation is unreliable due to digest differences
-								// https://github.com/docker/hub-feedback/issues/1925
-								fmt.Printf("Image tag %s:%s already exists, but extra tag %s:%s does not exist yet, it will be added.\n", imageUrl, imageTag, imageUrl, extraImageTag)
-								// Pull image, tag it and push it
-								err := exec.Command("bash", "-c", fmt.Sprintf("docker pull '%s:%s'", imageUrl, imageTag)).Run()
-								if err != nil {
-									log.Fatal("Error (docker pull): ", err)
-								}
-								err = exec.Command("bash", "-c", fmt.Sprintf("docker tag '%s:%s' '%s:%s'", imageUrl, imageTag, imageUrl, extraImageTag)).Run()
-								if err != nil {
-									log.Fatal("Error (docker tag): ", err)
-								}
-								err = exec.Command("bash", "-c", fmt.Sprintf("docker push '%s:%s'", imageUrl, extraImageTag)).Run()
-								if err != nil {
-									log.Fatal("Error (docker push): ", err)
-								}
-							}
-						}
-						return
-					}
+		if all {
+			specs, err := common.ReadImageBuildFile(imagesFile)
+			if err != nil {
+				log.Fatalf("Error: %s", err)
+			}
+			if dockerignore {
+				for i := range specs {
+					specs[i].Dockerignore = true
+				}
+			}
+			results := buildImages(specs, imageRepoHost, imageRepoProject, namespace, extraImageTag, reuseExisting, concurrency)
+			fmt.Println()
+			common.PrintImageBuildSummary(os.Stdout, results)
+			for _, r := range results {
+				if r.Err != nil {
+					os.Exit(1)
 				}
 			}
-		}
 
-		// Run docker build
-		extraImageTagString := ""
-		if len(extraImageTag) > 0 {
-			extraImageTagString = fmt.Sprintf("--tag '%s:%s'", imageUrl, extraImageTag)
+			// Image urls for release deployment
+			out := os.Stdout
+			if len(imageUrlsFile) > 0 {
+				out, err = os.Create(imageUrlsFile)
+				if err != nil {
+					log.Fatalf("Error: %s", err)
+				}
+				defer out.Close()
+			} else {
+				fmt.Println()
+			}
+			err = common.WriteImageUrls(out, common.ImageUrls(results))
+			if err != nil {
+				log.Fatalf("Error: %s", err)
+			}
+			return
 		}
-		command := fmt.Sprintf("docker build --tag '%s:%s' %s -f '%s' %s", imageUrl, imageTag, extraImageTagString, dockerfile, buildPath)
-		pipedExec(command, "", "", debug)
 
-		// Create AWS/ECR repository (ECR requires a dedicated repository per project)
-		if strings.HasSuffix(imageRepoHost, ".amazonaws.com") {
+		spec := common.ImageBuildSpec{Identifier: imageIdentifier, Dockerfile: dockerfile, BuildPath: buildPath, TagPrefix: imageTagPrefix, Dockerignore: dockerignore}
+		build, err := newImageBuild(spec, imageRepoHost, imageRepoProject, namespace, imageTag, extraImageTag)
+		if err != nil {
+			log.Fatal("Error (file checksum): ", err)
+		}
 
-			command = fmt.Sprintf("aws ecr describe-repositories --repository-name '%s/%s-%s'", imageRepoProject, namespace, imageIdentifier)
-			err := exec.Command("bash", "-c", command).Run()
+		// Reuse existing image if it exists
+		if !debug && reuseExisting {
+			exists, err := build.reuseExisting(os.Stdout)
 			if err != nil {
+				log.Fatal(err)
+			}
+			if exists {
+				return
+			}
+		}
 
-				command = fmt.Sprintf("aws ecr create-repository --repository-name '%s/%s-%s'", imageRepoProject, namespace, imageIdentifier)
-				err = exec.Command("bash", "-c", command).Run()
-				if err != nil {
-					log.Fatal("Error (aws ecr create-repository): ", err)
+		err = build.buildAndPush(os.Stdout)
+		if err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+// imageBuild is a container image to build and push
+type imageBuild struct {
+	repoHost    string
+	repoProject string
+	namespace   string
+	identifier  string
+	dockerfile  string
+	buildPath   string
+	// Image url without tag
+	url      string
+	tag      string
+	extraTag string
+}
+
+// newImageBuild returns image build of spec, image tag is calculated from build content unless it's set
+func newImageBuild(spec common.ImageBuildSpec, repoHost, repoProject, namespace, imageTag, extraImageTag string) (imageBuild, error) {
+	build := imageBuild{
+		repoHost:    repoHost,
+		repoProject: repoProject,
+		namespace:   namespace,
+		identifier:  spec.Identifier,
+		dockerfile:  spec.Dockerfile,
+		buildPath:   spec.BuildPath,
+		url:         fmt.Sprintf("%s/%s/%s-%s", repoHost, repoProject, namespace, spec.Identifier),
+		tag:         imageTag,
+		extraTag:    extraImageTag,
+	}
+
+	// If no path is specified, build from an empty directory
+	build.buildPath = common.ImageBuildPath(build.buildPath)
+
+	// No tag has been defined
+	// Calculate a hash sum of files in the folder except those ignored by .dockerignore.
+	// Also make sure modification time or order play no role.
+	if len(build.tag) == 0 {
+		tag, err := common.ImageContentTag(build.buildPath, build.dockerfile, spec.TagPrefix, spec.Dockerignore)
+		if err != nil {
+			return build, err
+		}
+		build.tag = tag
+	}
+	return build, nil
+}
+
+// reuseExisting returns true if image with the same tag exists in remote, extra tag is added to existing image
+func (b imageBuild) reuseExisting(out io.Writer) (bool, error) {
+	imageUrl, imageTag, extraImageTag := b.url, b.tag, b.extraTag
+	_, useGCloud := os.LookupEnv("SILTA_USE_GCLOUD")
+
+	if useGCloud && (b.repoHost == "gcr.io" || strings.HasSuffix(b.repoHost, ".gcr.io") || strings.HasSuffix(b.repoHost, ".pkg.dev")) {
+
+		// Get image tags via gcloud
+		command := fmt.Sprintf("gcloud container images list-tags '%s' --filter='tags:%s' --format=json", imageUrl, imageTag)
+		output, err := exec.Command("bash", "-c", command).CombinedOutput()
+		if err != nil {
+			fmt.Fprintln(out, "Error (gcloud list-tags): ", err)
+			fmt.Fprintln(out, "command:", command)
+			fmt.Fprintln(out, "response:", string(output))
+			return false, nil
+		}
+
+		// Unmarshal or Decode the JSON to the interface.
+		type TagList struct {
+			Digest string   `json:"digest"`
+			Tags   []string `json:"tags"`
+		}
+		var taglist []TagList
+		err = json.Unmarshal([]byte(output), &taglist)
+		if err != nil {
+			if strings.Contains(string(output), "WARNING: The following filter keys were not present in any resource : tags") {
+				fmt.Fprintln(out, "Image not found in container registry.")
+			} else {
+				fmt.Fprintln(out, "Error (json unmarshal):", err)
+				fmt.Fprintln(out, "response:", string(output))
+			}
+		}
+		var tagExists bool = false
+		var extraTagExists bool = false
+		for _, tag := range taglist {
+			for _, t := range tag.Tags {
+				if t == imageTag {
+					tagExists = true
+				}
+				if len(extraImageTag) > 0 && t == extraImageTag {
+					extraTagExists = true
 				}
 			}
 		}
+		// If tag exists in taglist, return and don't rebuild.
+		if !tagExists {
+			return false, nil
+		}
+		fmt.Fprintf(out, "Image %s:%s already exists, existing image will be used.\n", imageUrl, imageTag)
+		// Add extra tag if it does not exist yet
+		if len(extraImageTag) > 0 && !extraTagExists {
+			fmt.Fprintf(out, "Image %s:%s already exists, but extra tag %s:%s does not exist yet, it will be added.\n", imageUrl, imageTag, imageUrl, extraImageTag)
+			command := fmt.Sprintf("gcloud container images add-tag '%s:%s' '%s:%s'", imageUrl, imageTag, imageUrl, extraImageTag)
+			err = exec.Command("bash", "-c", command).Run()
+			if err != nil {
+				return false, fmt.Errorf("Error (gcloud add-tag): %s", err)
+			}
+		}
+		return true, nil
+	}
+
+	// Generic docker registry, e.g. docker.io
+	// Supports ACR, AR, GCR and ECR
+
+	// Reuse docker cli credentials
+	authenticator := remote.WithAuthFromKeychain(authn.DefaultKeychain)
+
+	imageTag_digest := common.GetImageTagDigest(authenticator, imageUrl, imageTag)
+	if imageTag_digest == "" {
+		return false, nil
+	}
+	fmt.Fprintf(out, "Image %s:%s already exists, existing image will be used.\n", imageUrl, imageTag)
+
+	// Add extra tag (branch name) if it does not exist yet
+	if len(extraImageTag) > 0 {
+		extraImageTag_digest := common.GetImageTagDigest(authenticator, imageUrl, extraImageTag)
+		if extraImageTag_digest == "" || extraImageTag_digest != imageTag_digest {
+			// Have to pull images, manifest creation is unreliable due to digest differences
+			// https://github.com/docker/hub-feedback/issues/1925
+			fmt.Fprintf(out, "Image tag %s:%s already exists, but extra tag %s:%s does not exist yet, it will be added.\n", imageUrl, imageTag, imageUrl, extraImageTag)
+			// Pull image, tag it and push it
+			err := exec.Command("bash", "-c", fmt.Sprintf("docker pull '%s:%s'", imageUrl, imageTag)).Run()
+			if err != nil {
+				return false, fmt.Errorf("Error (docker pull): %s", err)
+			}
+			err = exec.Command("bash", "-c", fmt.Sprintf("docker tag '%s:%s' '%s:%s'", imageUrl, imageTag, imageUrl, extraImageTag)).Run()
+			if err != nil {
+				return false, fmt.Errorf("Error (docker tag): %s", err)
+			}
+			err = exec.Command("bash", "-c", fmt.Sprintf("docker push '%s:%s'", imageUrl, extraImageTag)).Run()
+			if err != nil {
+				return false, fmt.Errorf("Error (docker push): %s", err)
+			}
+		}
+	}
+	return true, nil
+}
 
-		// Image push
-		command = fmt.Sprintf("docker push '%s:%s'", imageUrl, imageTag)
-		pipedExec(command, "", "ERROR: ", debug)
+// buildAndPush builds the image and pushes it with the extra tag
+func (b imageBuild) buildAndPush(out io.Writer) error {
+	// Run docker build
+	extraImageTagString := ""
+	if len(b.extraTag) > 0 {
+		extraImageTagString = fmt.Sprintf("--tag '%s:%s'", b.url, b.extraTag)
+	}
+	command := fmt.Sprintf("docker build --tag '%s:%s' %s -f '%s' %s", b.url, b.tag, extraImageTagString, b.dockerfile, b.buildPath)
+	err := pipedExecOutput(out, command, "", "", debug)
+	if err != nil {
+		return err
+	}
+
+	// Create AWS/ECR repository (ECR requires a dedicated repository per project)
+	if strings.HasSuffix(b.repoHost, ".amazonaws.com") {
+
+		command = fmt.Sprintf("aws ecr describe-repositories --repository-name '%s/%s-%s'", b.repoProject, b.namespace, b.identifier)
+		err := exec.Command("bash", "-c", command).Run()
+		if err != nil {
+
+			command = fmt.Sprintf("aws ecr create-repository --repository-name '%s/%s-%s'", b.repoProject, b.namespace, b.identifier)
+			err = exec.Command("bash", "-c", command).Run()
+			if err != nil {
+				return fmt.Errorf("Error (aws ecr create-repository): %s", err)
+			}
+		}
+	}
+
+	// Image push
+	command = fmt.Sprintf("docker push '%s:%s'", b.url, b.tag)
+	err = pipedExecOutput(out, command, "", "ERROR: ", debug)
+	if err != nil {
+		return err
+	}
+
+	// Push extra tags
+	if len(b.extraTag) > 0 {
+		command = fmt.Sprintf("docker push '%s:%s'", b.url, b.extraTag)
+		return pipedExecOutput(out, command, "", "ERROR: ", debug)
+	}
+	return nil
+}
 
-		// Push extra tags
-		if len(branchName) > 0 {
-			command = fmt.Sprintf("docker push '%s:%s'", imageUrl, extraImageTag)
-			pipedExec(command, "", "ERROR: ", debug)
+// buildImages calculates tags and checks existing images of all images at the same time, then builds missing
+// images "concurrency" images at a time. Results are returned in the order of specs.
+func buildImages(specs []common.ImageBuildSpec, repoHost, repoProject, namespace, extraImageTag string, reuseExisting bool, concurrency int) []common.ImageBuildResult {
+	results := make([]common.ImageBuildResult, len(specs))
+	builds := make([]imageBuild, len(specs))
+	index := map[string]int{}
+	for i, spec := range specs {
+		index[spec.Identifier] = i
+		results[i].Identifier = spec.Identifier
+	}
+
+	errs := common.RunImageBuilds(specs, len(specs), os.Stdout, func(spec common.ImageBuildSpec, out io.Writer) error {
+		i := index[spec.Identifier]
+		build, err := newImageBuild(spec, repoHost, repoProject, namespace, "", extraImageTag)
+		if err != nil {
+			return fmt.Errorf("Error (file checksum): %s", err)
 		}
-	},
+		builds[i] = build
+		results[i].Image = build.url + ":" + build.tag
+
+		if !debug && reuseExisting {
+			exists, err := build.reuseExisting(out)
+			if err != nil {
+				return err
+			}
+			if exists {
+				results[i].Status = "reused"
+			}
+		}
+		return nil
+	})
+
+	missing := []common.ImageBuildSpec{}
+	for i, spec := range specs {
+		results[i].Err = errs[i]
+		if errs[i] == nil && results[i].Status == "" {
+			missing = append(missing, spec)
+		}
+	}
+
+	errs = common.RunImageBuilds(missing, concurrency, os.Stdout, func(spec common.ImageBuildSpec, out io.Writer) error {
+		return builds[index[spec.Identifier]].buildAndPush(out)
+	})
+	for j, spec := range missing {
+		i := index[spec.Identifier]
+		results[i].Status = "built"
+		results[i].Err = errs[j]
+	}
+	return results
 }
 
 func init() {
@@ -262,10 +406,20 @@ func init() {
 	ciImageBuildCmd.Flags().String("dockerfile", "", "Dockerfile (relative path)")
 	ciImageBuildCmd.Flags().String("build-path", "", "Docker image build path")
 	ciImageBuildCmd.Flags().Bool("image-reuse", true, "Do not rebuild image if identical image:tag exists in remote")
+	ciImageBuildCmd.Flags().Bool("all", false, "Build all images listed in the image build file")
+	ciImageBuildCmd.Flags().String("images-file", common.DefaultImageBuildFile, "Image build file, used with --all")
+	ciImageBuildCmd.Flags().Int("concurrency", 2, "Number of images built at the same time, used with --all")
+	ciImageBuildCmd.Flags().String("image-urls-file", "", "Write image urls to a JSON file instead of printing them, used with --all")
+	ciImageBuildCmd.Flags().Bool("dockerignore-semantics", false, "Apply .dockerignore patterns the same way as docker build when calculating image tag")
 
 	ciImageBuildCmd.MarkFlagRequired("image-repo-host")
 	ciImageBuildCmd.MarkFlagRequired("image-repo-project")
 	ciImageBuildCmd.MarkFlagRequired("namespace")
-	ciImageBuildCmd.MarkFlagRequired("image-identifier")
-	ciImageBuildCmd.MarkFlagRequired("dockerfile")
+	ciImageBuildCmd.MarkFlagsOneRequired("image-identifier", "all")
+	ciImageBuildCmd.MarkFlagsOneRequired("dockerfile", "all")
+	ciImageBuildCmd.MarkFlagsMutuallyExclusive("all", "image-identifier")
+	ciImageBuildCmd.MarkFlagsMutuallyExclusive("all", "dockerfile")
+	ciImageBuildCmd.MarkFlagsMutuallyExclusive("all", "build-path")
+	ciImageBuildCmd.MarkFlagsMutuallyExclusive("all", "image-tag")
+	ciImageBuildCmd.MarkFlagsMutuallyExclusive("all", "image-tag-prefix")
 }
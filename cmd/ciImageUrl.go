@@ -4,15 +4,28 @@ import (
 	"fmt"
 	"log"
 	"os"
-	"os/exec"
 
 	"github.com/spf13/cobra"
+	"github.com/wunderio/silta-cli/internal/common"
 )
 
 // buildCmd represents the build command
 var ciImageUrlCmd = &cobra.Command{
 	Use:   "url",
 	Short: "Calculate container image url based on build content",
+	Long: `Calculate container image url based on build content
+
+	Image tag is a hash of build path content and dockerfile unless it's set 
+	with "--image-tag". Files ignored by .dockerignore (or 
+	<dockerfile>.dockerignore) are left out of the hash. Patterns are applied 
+	like tar exclude patterns, i.e. patterns without a slash ("node_modules", 
+	"*.log") match at any depth and "!" exclusions are not supported, so tags 
+	stay the same as in earlier versions. With "--dockerignore-semantics", 
+	patterns are applied the same way docker build leaves files out of build 
+	context. Tags of builds with nested matches change when switching.
+
+	Use "--explain" to list files included in the hash and "--compare" to find 
+	files that changed the tag since a saved manifest.`,
 	Run: func(cmd *cobra.Command, args []string) {
 
 		// Calculate docker image tag
@@ -25,6 +38,9 @@ var ciImageUrlCmd = &cobra.Command{
 		imageTagPrefix, _ := cmd.Flags().GetString("image-tag-prefix")
 		dockerfile, _ := cmd.Flags().GetString("dockerfile")
 		buildPath, _ := cmd.Flags().GetString("build-path")
+		explain, _ := cmd.Flags().GetBool("explain")
+		compare, _ := cmd.Flags().GetString("compare")
+		dockerignore, _ := cmd.Flags().GetBool("dockerignore-semantics")
 
 		// Use environment variables as fallback
 		if useEnv == true {
@@ -44,55 +60,54 @@ var ciImageUrlCmd = &cobra.Command{
 
 		imageUrl := fmt.Sprintf("%s/%s/%s-%s", imageRepoHost, imageRepoProject, namespace, imageIdentifier)
 
-		// Only use .dockerignore files if they exist
-		excludeDockerignore := ""
-		if _, err := os.Stat(fmt.Sprintf("%s/.dockerignore", buildPath)); err == nil {
-			excludeDockerignore = fmt.Sprintf("--exclude-from='%s'/.dockerignore", buildPath)
-		}
-		// use <dockerfile>.dockerignore if exists, later takes precedence
-		if _, err := os.Stat(fmt.Sprintf("%s.dockerignore", dockerfile)); err == nil {
-			excludeDockerignore = fmt.Sprintf("--exclude-from='%s.dockerignore'", dockerfile)
-		}
-
 		// If no path is specified, build from an empty directory
-		if len(buildPath) == 0 {
-			// Create kubeconfig folder
-			if _, err := os.Stat("/tmp/empty"); os.IsNotExist(err) {
-				_ = os.Mkdir("/tmp/empty", 0775)
+		buildPath = common.ImageBuildPath(buildPath)
+
+		// List or compare files included in the hash
+		if explain || len(compare) > 0 {
+			contentHash, manifest, err := common.ImageContentManifest(buildPath, dockerfile, dockerignore)
+			if err != nil {
+				log.Fatal("Error (imageTag): ", err)
+			}
+			contentHash = common.PrefixImageTag(imageTagPrefix, contentHash)
+
+			if explain {
+				err = common.WriteImageManifest(os.Stdout, fmt.Sprintf("%s:%s", imageUrl, contentHash), manifest)
+				if err != nil {
+					log.Fatalf("Error: %s", err)
+				}
+				return
+			}
+
+			f, err := os.Open(compare)
+			if err != nil {
+				log.Fatalf("Error: %s", err)
+			}
+			previous, err := common.ReadImageManifest(f)
+			f.Close()
+			if err != nil {
+				log.Fatalf("Error: %s", err)
+			}
+			changes := common.CompareImageManifests(previous, manifest)
+			if len(changes) == 0 {
+				fmt.Println("No changes")
+				return
+			}
+			for _, change := range changes {
+				fmt.Printf("%-18s %s\n", change.Change, change.Name)
 			}
-			buildPath = "/tmp/empty"
+			return
 		}
 
 		// No tag has been defined
-		// Calculate a hash sum of files in the folder except those ignored by docker.
+		// Calculate a hash sum of files in the folder except those ignored by .dockerignore.
 		// Also make sure modification time or order play no role.
 		if len(imageTag) == 0 {
-			command := fmt.Sprintf(`tar \
-				--sort=name %s \
-				--absolute-names \
-				--exclude='vendor/composer' \
-				--exclude='vendor/autoload.php' \
-				--mtime='2000-01-01 00:00Z' \
-				--clamp-mtime \
-				-cf - '%s' '%s' | sha1sum | cut -c 1-40 | tr -d $'\n'`,
-				excludeDockerignore, buildPath, dockerfile)
-
-			fileListing, err := exec.Command("bash", "-c", command).CombinedOutput()
+			var err error
+			imageTag, err = common.ImageContentTag(buildPath, dockerfile, imageTagPrefix, dockerignore)
 			if err != nil {
 				log.Fatal("Error (imageTag): ", err)
 			}
-
-			// Unless golang calculates checksum itself, passing plain output uses just too much memory.
-			imageTag = string(fileListing)
-
-			// Add prefix if it is specified
-			if len(imageTagPrefix) > 0 {
-				imageTag = imageTagPrefix + string('-') + imageTag
-			}
-
-			// Calculate hash sum
-			// sha1_hash := fmt.Sprintf("%x", sha1.Sum([]byte(fileListing)))
-			// imageTag = sha1_hash[0:40]
 		}
 
 		// Return Image url and tag
@@ -112,6 +127,9 @@ func init() {
 	ciImageUrlCmd.Flags().String("image-tag-prefix", "", "Prefix for Docker image tag (optional)")
 	ciImageUrlCmd.Flags().String("dockerfile", "", "Dockerfile (relative path)")
 	ciImageUrlCmd.Flags().String("build-path", "", "Docker image build path")
+	ciImageUrlCmd.Flags().Bool("explain", false, "Print a manifest of files included in image content hash, with a digest of each file")
+	ciImageUrlCmd.Flags().String("compare", "", "Compare image content with a manifest saved with --explain, print added, removed and changed (content or mode/owner) files")
+	ciImageUrlCmd.Flags().Bool("dockerignore-semantics", false, "Apply .dockerignore patterns the same way as docker build when calculating image tag")
 
 	ciImageUrlCmd.MarkFlagRequired("image-repo-host")
 	ciImageUrlCmd.MarkFlagRequired("image-repo-project")
@@ -119,4 +137,5 @@ func init() {
 	ciImageUrlCmd.MarkFlagRequired("image-identifier")
 	ciImageUrlCmd.MarkFlagRequired("dockerfile")
 	ciImageUrlCmd.MarkFlagRequired("image-repo-host")
+	ciImageUrlCmd.MarkFlagsMutuallyExclusive("explain", "compare")
 }
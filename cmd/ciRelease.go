@@ -1,9 +1,15 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
+	"github.com/wunderio/silta-cli/internal/common"
 )
 
 var ciReleaseCmd = &cobra.Command{
@@ -14,6 +20,195 @@ var ciReleaseCmd = &cobra.Command{
 	},
 }
 
+// releaseChartProfile loads chart profile files and returns the chart profile matching chart name, nil if there is none
+func releaseChartProfile(cmd *cobra.Command, chartName string) common.ChartProfile {
+	chartProfiles, _ := cmd.Flags().GetString("chart-profile")
+	if useEnv && len(chartProfiles) == 0 {
+		chartProfiles = os.Getenv("SILTA_CHART_PROFILES")
+	}
+	err := common.LoadChartProfiles(common.ChartValueFiles(chartProfiles))
+	if err != nil {
+		log.Fatalf("Error: %s", err)
+	}
+	return common.GetChartProfile(chartName)
+}
+
+// releaseImageUrls returns image urls by image identifier. Values of "--<identifier>-image-url" flags
+// take precedence over "--image-url <identifier>=<url>", which take precedence over "--image-urls-file".
+func releaseImageUrls(cmd *cobra.Command) map[string]string {
+	images := map[string]string{}
+	imageUrlsFile, _ := cmd.Flags().GetString("image-urls-file")
+	if len(imageUrlsFile) > 0 {
+		fileUrls, err := common.ReadImageUrlsFile(imageUrlsFile)
+		if err != nil {
+			log.Fatalf("Error: %s", err)
+		}
+		for identifier, imageUrl := range fileUrls {
+			images[identifier] = imageUrl
+		}
+	}
+	imageUrls, _ := cmd.Flags().GetStringToString("image-url")
+	for identifier, imageUrl := range imageUrls {
+		images[identifier] = imageUrl
+	}
+	for _, identifier := range []string{"php", "nginx", "shell"} {
+		imageUrl, _ := cmd.Flags().GetString(identifier + "-image-url")
+		if len(imageUrl) > 0 {
+			images[identifier] = imageUrl
+		}
+	}
+	return images
+}
+
+// releaseHelmFlags parses "--helm-flags" value of a deployment and applies --timeout and --version flags to it.
+// Flags that are not supported in-process are reported on stderr (stdout may be parsed) and left out.
+func releaseHelmFlags(deployment *common.HelmReleaseDeployment) common.HelmFlags {
+	helmFlags, err := common.ParseHelmFlags(deployment.HelmFlags)
+	if err != nil {
+		log.Fatalf("Error: %s", err)
+	}
+	for _, flag := range helmFlags.Ignored {
+		fmt.Fprintf(os.Stderr, "Warning: helm flag %s is not supported and was ignored\n", flag)
+	}
+	*deployment = deployment.WithHelmFlags(helmFlags)
+	return helmFlags
+}
+
+// helmLog returns helm debug output function, helm output is only printed with "--helm-flags --debug"
+func helmLog(helmFlags common.HelmFlags) func(format string, v ...interface{}) {
+	if helmFlags.Debug {
+		return log.Printf
+	}
+	return common.HelmQuietLog
+}
+
+// requireChartImages exits if any image required by chart profile is missing
+func requireChartImages(profile common.ChartProfile, images map[string]string) {
+	for _, image := range common.MissingChartImages(profile, images) {
+		flag := fmt.Sprintf("image-url %s=<url>", image.Identifier)
+		if image.Identifier == "php" || image.Identifier == "nginx" || image.Identifier == "shell" {
+			flag = image.Identifier + "-image-url"
+		}
+		log.Fatalf("%s image url required (%s)", image.ImageTitle(), flag)
+	}
+}
+
+// unknownChartMessage describes a chart that has no registered chart profile
+func unknownChartMessage(chartName string, step string) string {
+	return fmt.Sprintf("Chart name %s does not match registered chart profiles (%s), %s step was skipped\n", chartName, strings.Join(common.ChartProfileNames(), ", "), step)
+}
+
+// addReleaseBatchFlags adds flags for running a release command on many releases at once
+func addReleaseBatchFlags(cmd *cobra.Command) {
+	cmd.Flags().Bool("all", false, "All releases in the namespace")
+	cmd.Flags().String("selector", "", "Releases with deployments or statefulsets matching a label selector (i.e. \"app=drupal\")")
+	cmd.Flags().Bool("all-namespaces", false, "Look for releases in all namespaces, except kube-system and silta-cluster")
+	cmd.Flags().Int("concurrency", 5, "Number of releases processed at the same time")
+
+	cmd.MarkFlagsOneRequired("release-name", "all", "selector")
+	cmd.MarkFlagsMutuallyExclusive("release-name", "all", "selector")
+	cmd.MarkFlagsOneRequired("namespace", "all-namespaces")
+	cmd.MarkFlagsMutuallyExclusive("namespace", "all-namespaces")
+}
+
+// releaseBatch runs fn on all releases matching "--all" or "--selector" flags, prints a summary table and exits
+// with an error if any release failed
+func releaseBatch(cmd *cobra.Command, title string, fn common.ReleaseBatchFunc) {
+	namespace, _ := cmd.Flags().GetString("namespace")
+	selector, _ := cmd.Flags().GetString("selector")
+	concurrency, _ := cmd.Flags().GetInt("concurrency")
+
+	if debug {
+		if len(namespace) == 0 {
+			namespace = "(all namespaces)"
+		}
+		fmt.Printf(`%s (not executed):
+NAMESPACE: %s
+SELECTOR: %s
+CONCURRENCY: %d
+`, title, namespace, selector, concurrency)
+		return
+	}
+
+	clientset, err := common.GetKubeClient()
+	if err != nil {
+		log.Fatalf("failed to get kube client: %v", err)
+	}
+
+	// Candidates are helm releases, system namespaces are only searched when named explicitly
+	_, actionConfig, err := common.InitHelmActionConfig(namespace, common.HelmQuietLog)
+	if err != nil {
+		log.Fatalf("%+v", err)
+	}
+	helmReleases, err := common.ListHelmReleases(actionConfig, namespace)
+	if err != nil {
+		log.Fatalf("Error: %s", err)
+	}
+	releases, err := common.FindReleases(context.TODO(), clientset, helmReleases, selector)
+	if err != nil {
+		log.Fatalf("Error: %s", err)
+	}
+	if len(releases) == 0 {
+		fmt.Println("No matching releases found")
+		return
+	}
+
+	results := common.RunReleaseBatch(context.TODO(), clientset, releases, concurrency, os.Stdout, fn)
+	fmt.Println()
+	common.PrintReleaseBatchSummary(os.Stdout, results)
+
+	for _, r := range results {
+		if r.Err != nil {
+			os.Exit(1)
+		}
+	}
+}
+
+// addVerifyUrlsFlags adds flags for checking that release urls answer
+func addVerifyUrlsFlags(cmd *cobra.Command) {
+	cmd.Flags().Bool("verify-urls", false, "Verify that release ingress hostnames answer over https")
+	cmd.Flags().String("expected-status", "200-399", "Accepted response status codes for url verification (i.e. \"200-399,401\")")
+	cmd.Flags().String("basic-auth-username", "", "Basic auth username for url verification")
+	cmd.Flags().String("basic-auth-password", "", "Basic auth password for url verification")
+	cmd.Flags().Int("verify-retries", 5, "Url verification retries")
+	cmd.Flags().Duration("verify-backoff", 5*time.Second, "Delay before the first url verification retry, doubled after each retry")
+	cmd.Flags().Duration("verify-timeout", 30*time.Second, "Url verification request timeout")
+}
+
+// releaseUrlVerification returns url verification parameters, false if "--verify-urls" is not set
+func releaseUrlVerification(cmd *cobra.Command) (common.URLVerification, bool) {
+	verifyUrls, _ := cmd.Flags().GetBool("verify-urls")
+	expectedStatus, _ := cmd.Flags().GetString("expected-status")
+	username, _ := cmd.Flags().GetString("basic-auth-username")
+	password, _ := cmd.Flags().GetString("basic-auth-password")
+	retries, _ := cmd.Flags().GetInt("verify-retries")
+	backoff, _ := cmd.Flags().GetDuration("verify-backoff")
+	timeout, _ := cmd.Flags().GetDuration("verify-timeout")
+
+	// Use environment variables as fallback
+	if useEnv {
+		if len(username) == 0 {
+			username = os.Getenv("BASIC_AUTH_USERNAME")
+		}
+		if len(password) == 0 {
+			password = os.Getenv("BASIC_AUTH_PASSWORD")
+		}
+	}
+
+	if _, err := common.ParseStatusCodes(expectedStatus); err != nil {
+		log.Fatalf("Error: %s", err)
+	}
+
+	return common.URLVerification{
+		ExpectedStatus: expectedStatus,
+		Username:       username,
+		Password:       password,
+		Retries:        retries,
+		Backoff:        backoff,
+		Timeout:        timeout,
+	}, verifyUrls
+}
+
 func init() {
 	ciCmd.AddCommand(ciReleaseCmd)
 }
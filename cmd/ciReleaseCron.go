@@ -0,0 +1,19 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+var ciReleaseCronCmd = &cobra.Command{
+	Use:   "cron",
+	Short: "Release cronjob commands",
+	Run: func(cmd *cobra.Command, args []string) {
+		fmt.Println(cmd.Usage())
+	},
+}
+
+func init() {
+	ciReleaseCmd.AddCommand(ciReleaseCronCmd)
+}
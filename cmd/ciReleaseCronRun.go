@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/wunderio/silta-cli/internal/common"
+)
+
+var ciReleaseCronRunCmd = &cobra.Command{
+	Use:   "run",
+	Short: "Run a release cronjob now",
+	Long: `Run a release cronjob now, same as "kubectl create job --from=cronjob/...". 
+Logs of job pods are streamed until the job finishes, command fails when the 
+job fails (i.e. to verify cron after deployment).
+
+	* "--cronjob" selects a cronjob by name, with or without release prefix 
+	(i.e. "drupal" for "<release-name>-cron-drupal"). It can be omitted when 
+	release has a single cronjob.
+
+	* Job runs even if the cronjob is suspended (i.e. a downscaled release). 
+	The job is removed with the rest of cronjob history.
+	`,
+	Run: func(cmd *cobra.Command, args []string) {
+		releaseName, _ := cmd.Flags().GetString("release-name")
+		namespace, _ := cmd.Flags().GetString("namespace")
+		cronjobName, _ := cmd.Flags().GetString("cronjob")
+		timeout, _ := cmd.Flags().GetDuration("timeout")
+
+		if debug {
+			fmt.Printf(`Release cronjob run (not executed):
+RELEASE_NAME: %s
+NAMESPACE: %s
+CRONJOB: %s
+`, releaseName, namespace, cronjobName)
+			return
+		}
+
+		clientset, err := common.GetKubeClient()
+		if err != nil {
+			log.Fatalf("failed to get kube client: %v", err)
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+
+		cronjob, err := common.ReleaseCronJob(ctx, clientset, namespace, releaseName, cronjobName)
+		if err != nil {
+			log.Fatalf("Error: %s", err)
+		}
+		err = common.RunJob(ctx, clientset, common.JobFromCronJob(cronjob, time.Now()), os.Stdout)
+		if errors.Is(err, context.DeadlineExceeded) {
+			log.Fatalf("Error: timed out waiting for the job to finish")
+		}
+		if err != nil {
+			log.Fatalf("Error: %s", err)
+		}
+		fmt.Println("Job completed")
+	},
+}
+
+func init() {
+	ciReleaseCronCmd.AddCommand(ciReleaseCronRunCmd)
+
+	ciReleaseCronRunCmd.Flags().String("release-name", "", "Release name")
+	ciReleaseCronRunCmd.Flags().String("namespace", "", "Project name (namespace, i.e. \"drupal-project\")")
+	ciReleaseCronRunCmd.Flags().String("cronjob", "", "Cronjob name (i.e. \"drupal\")")
+	ciReleaseCronRunCmd.Flags().Duration("timeout", time.Hour, "Time to wait for the job to finish")
+
+	ciReleaseCronRunCmd.MarkFlagRequired("release-name")
+	ciReleaseCronRunCmd.MarkFlagRequired("namespace")
+}
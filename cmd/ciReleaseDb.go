@@ -0,0 +1,22 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+var ciReleaseDbCmd = &cobra.Command{
+	Use:   "db",
+	Short: "Release database commands",
+	Long: `Release database commands. Commands are run in a ready release pod 
+("shell" or "php" component) with database client tools, connection details 
+are read from container environment (DB_HOST, DB_USER, DB_PASS, DB_NAME).`,
+	Run: func(cmd *cobra.Command, args []string) {
+		fmt.Println(cmd.Usage())
+	},
+}
+
+func init() {
+	ciReleaseCmd.AddCommand(ciReleaseDbCmd)
+}
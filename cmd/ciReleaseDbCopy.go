@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/spf13/cobra"
+	"github.com/wunderio/silta-cli/internal/common"
+)
+
+var ciReleaseDbCopyCmd = &cobra.Command{
+	Use:   "copy",
+	Short: "Copy database from another release",
+	Long: `Copy database of another release (i.e. "main") to this release (i.e. a 
+feature branch environment). Dump is streamed between release pods without 
+storing it locally. Tables in the dump replace existing ones.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		releaseName, _ := cmd.Flags().GetString("release-name")
+		namespace, _ := cmd.Flags().GetString("namespace")
+		fromRelease, _ := cmd.Flags().GetString("from-release")
+		fromNamespace, _ := cmd.Flags().GetString("from-namespace")
+
+		if len(fromNamespace) == 0 {
+			fromNamespace = namespace
+		}
+		if fromRelease == releaseName && fromNamespace == namespace {
+			log.Fatal("Error: --from-release can't be the same as --release-name")
+		}
+
+		if debug {
+			fmt.Printf(`Release database copy (not executed):
+FROM_RELEASE: %s
+FROM_NAMESPACE: %s
+RELEASE_NAME: %s
+NAMESPACE: %s
+`, fromRelease, fromNamespace, releaseName, namespace)
+			return
+		}
+
+		config, err := common.GetKubeConfig()
+		if err != nil {
+			log.Fatalf("failed to get kube config: %v", err)
+		}
+		clientset, err := common.GetKubeClient()
+		if err != nil {
+			log.Fatalf("failed to get kube client: %v", err)
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		err = common.CopyReleaseDatabase(ctx, config, clientset, fromNamespace, fromRelease, namespace, releaseName, os.Stderr)
+		if err != nil {
+			log.Fatalf("Error: %s", err)
+		}
+		fmt.Fprintf(os.Stderr, "Database copied from %s to %s\n", fromRelease, releaseName)
+	},
+}
+
+func init() {
+	ciReleaseDbCmd.AddCommand(ciReleaseDbCopyCmd)
+
+	ciReleaseDbCopyCmd.Flags().String("release-name", "", "Target release name")
+	ciReleaseDbCopyCmd.Flags().String("namespace", "", "Target project name (namespace, i.e. \"drupal-project\")")
+	ciReleaseDbCopyCmd.Flags().String("from-release", "", "Source release name (i.e. \"main\")")
+	ciReleaseDbCopyCmd.Flags().String("from-namespace", "", "Source project name, defaults to --namespace")
+
+	ciReleaseDbCopyCmd.MarkFlagRequired("release-name")
+	ciReleaseDbCopyCmd.MarkFlagRequired("namespace")
+	ciReleaseDbCopyCmd.MarkFlagRequired("from-release")
+}
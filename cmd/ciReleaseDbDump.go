@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/spf13/cobra"
+	"github.com/wunderio/silta-cli/internal/common"
+)
+
+var ciReleaseDbDumpCmd = &cobra.Command{
+	Use:   "dump",
+	Short: "Dump release database",
+	Long: `Stream a gzip compressed SQL dump of the release database to a file 
+(default "<release-name>.sql.gz"). Use "--output-file -" to write the dump 
+to stdout. Progress is printed to stderr.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		releaseName, _ := cmd.Flags().GetString("release-name")
+		namespace, _ := cmd.Flags().GetString("namespace")
+		outputFile, _ := cmd.Flags().GetString("output-file")
+
+		if len(outputFile) == 0 {
+			outputFile = releaseName + ".sql.gz"
+		}
+
+		if debug {
+			fmt.Printf(`Release database dump (not executed):
+RELEASE_NAME: %s
+NAMESPACE: %s
+OUTPUT_FILE: %s
+`, releaseName, namespace, outputFile)
+			return
+		}
+
+		config, err := common.GetKubeConfig()
+		if err != nil {
+			log.Fatalf("failed to get kube config: %v", err)
+		}
+		clientset, err := common.GetKubeClient()
+		if err != nil {
+			log.Fatalf("failed to get kube client: %v", err)
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		if outputFile == "-" {
+			err = common.DumpReleaseDatabase(ctx, config, clientset, namespace, releaseName, os.Stdout, os.Stderr)
+			if err != nil {
+				log.Fatalf("Error: %s", err)
+			}
+			return
+		}
+
+		// Dump is written to a temporary file, so a failed dump doesn't replace an existing file
+		partFile := outputFile + ".part"
+		f, err := os.Create(partFile)
+		if err != nil {
+			log.Fatalf("Error: %s", err)
+		}
+		err = common.DumpReleaseDatabase(ctx, config, clientset, namespace, releaseName, f, os.Stderr)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err == nil {
+			err = os.Rename(partFile, outputFile)
+		}
+		if err != nil {
+			os.Remove(partFile)
+			log.Fatalf("Error: %s", err)
+		}
+		fmt.Fprintf(os.Stderr, "Database dump written to %s\n", outputFile)
+	},
+}
+
+func init() {
+	ciReleaseDbCmd.AddCommand(ciReleaseDbDumpCmd)
+
+	ciReleaseDbDumpCmd.Flags().String("release-name", "", "Release name")
+	ciReleaseDbDumpCmd.Flags().String("namespace", "", "Project name (namespace, i.e. \"drupal-project\")")
+	ciReleaseDbDumpCmd.Flags().String("output-file", "", "Dump file (default \"<release-name>.sql.gz\", \"-\" for stdout)")
+
+	ciReleaseDbDumpCmd.MarkFlagRequired("release-name")
+	ciReleaseDbDumpCmd.MarkFlagRequired("namespace")
+}
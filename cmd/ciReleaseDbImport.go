@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/spf13/cobra"
+	"github.com/wunderio/silta-cli/internal/common"
+)
+
+var ciReleaseDbImportCmd = &cobra.Command{
+	Use:   "import",
+	Short: "Import a database dump to release",
+	Long: `Import an SQL dump (plain or gzip compressed) to the release database. 
+Dump is streamed compressed to the release pod. Tables in the dump replace 
+existing ones. Use "--input-file -" to read the dump from stdin. Progress 
+is printed to stderr.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		releaseName, _ := cmd.Flags().GetString("release-name")
+		namespace, _ := cmd.Flags().GetString("namespace")
+		inputFile, _ := cmd.Flags().GetString("input-file")
+
+		if debug {
+			fmt.Printf(`Release database import (not executed):
+RELEASE_NAME: %s
+NAMESPACE: %s
+INPUT_FILE: %s
+`, releaseName, namespace, inputFile)
+			return
+		}
+
+		var in io.Reader = os.Stdin
+		var size int64
+		if inputFile != "-" {
+			f, err := os.Open(inputFile)
+			if err != nil {
+				log.Fatalf("Error: %s", err)
+			}
+			defer f.Close()
+			info, err := f.Stat()
+			if err != nil {
+				log.Fatalf("Error: %s", err)
+			}
+			in, size = f, info.Size()
+		}
+
+		config, err := common.GetKubeConfig()
+		if err != nil {
+			log.Fatalf("failed to get kube config: %v", err)
+		}
+		clientset, err := common.GetKubeClient()
+		if err != nil {
+			log.Fatalf("failed to get kube client: %v", err)
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		err = common.ImportReleaseDatabase(ctx, config, clientset, namespace, releaseName, in, size, os.Stderr)
+		if err != nil {
+			log.Fatalf("Error: %s", err)
+		}
+		fmt.Fprintln(os.Stderr, "Database imported")
+	},
+}
+
+func init() {
+	ciReleaseDbCmd.AddCommand(ciReleaseDbImportCmd)
+
+	ciReleaseDbImportCmd.Flags().String("release-name", "", "Release name")
+	ciReleaseDbImportCmd.Flags().String("namespace", "", "Project name (namespace, i.e. \"drupal-project\")")
+	ciReleaseDbImportCmd.Flags().String("input-file", "", "Dump file, plain or gzip compressed (\"-\" for stdin)")
+
+	ciReleaseDbImportCmd.MarkFlagRequired("release-name")
+	ciReleaseDbImportCmd.MarkFlagRequired("namespace")
+	ciReleaseDbImportCmd.MarkFlagRequired("input-file")
+}
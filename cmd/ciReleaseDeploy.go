@@ -2,17 +2,21 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
-	"os/exec"
 	"strings"
 	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/wunderio/silta-cli/internal/common"
+	"gopkg.in/yaml.v2"
 	v1core "k8s.io/api/core/v1"
 	v1meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	helmRelease "helm.sh/helm/v3/pkg/release"
 )
 
 // ciReleaseDeployCmd represents the ciReleaseDeploy command
@@ -27,6 +31,50 @@ var ciReleaseDeployCmd = &cobra.Command{
 
 	* If IMAGE_PULL_SECRET is set (base64 encoded), it will be added to the 
 	release values as imagePullSecret.
+
+	* Chart specific values, required images, pre-deploy migrations and 
+	readiness checks are defined by chart profiles. Builtin profiles are 
+	"drupal", "frontend" and "simple", extra profiles can be loaded from YAML 
+	files via "--chart-profile" flag or "SILTA_CHART_PROFILES" environment 
+	variable. Profile file example:
+
+	  name: my-chart
+	  images:
+	    - identifier: app
+	      title: App
+	      value: app.image
+	  values:
+	    app.repository: repositoryUrl
+	  optionalValues:
+	    app.db.password: dbUserPassword
+	  migrations: [failed-release-cleanup]
+	  readiness:
+	    postReleaseLogs: true
+	    rollout: true
+	  openValues: [app.cron, app.env]
+
+	Images are passed with "--image-url app=<url>" or with "--image-urls-file"
+	that "silta ci image build --all" writes. Open values are maps that accept 
+	user defined keys, they are not reported as unknown by validation.
+
+	* Post-release job logs are streamed as soon as the job pod starts and 
+	deployment and statefulset rollout progress is reported as it happens. 
+	Deployment fails right away when a new release pod is stuck in 
+	CrashLoopBackOff or ImagePullBackOff state.
+
+	* Release is deployed in-process using helm SDK, helm, kubectl and jq 
+	binaries are not required. "--helm-flags" supports value flags (--set, 
+	--set-string, --set-file, --set-json, --set-literal, --values / -f) and 
+	--atomic, --force, --wait-for-jobs, --history-max, --timeout (overrides 
+	"--deployment-timeout"), --version (overrides "--chart-version") and 
+	--debug. --kube-context, --kubeconfig and --namespace are rejected, other 
+	flags are ignored with a warning.
+
+	* With "--verify-urls" flag release ingress hostnames are requested after
+	deployment until they answer with an expected status code
+	("--expected-status"), with retries and backoff. Basic auth credentials
+	can be passed with flags or BASIC_AUTH_USERNAME and BASIC_AUTH_PASSWORD
+	environment variables. Deployment fails if any url does not answer.
 	`,
 	Run: func(cmd *cobra.Command, args []string) {
 
@@ -41,9 +89,6 @@ var ciReleaseDeployCmd = &cobra.Command{
 		vpcNative, _ := cmd.Flags().GetString("vpc-native")
 		clusterType, _ := cmd.Flags().GetString("cluster-type")
 		chartVersion, _ := cmd.Flags().GetString("chart-version")
-		phpImageUrl, _ := cmd.Flags().GetString("php-image-url")
-		nginxImageUrl, _ := cmd.Flags().GetString("nginx-image-url")
-		shellImageUrl, _ := cmd.Flags().GetString("shell-image-url")
 		repositoryUrl, _ := cmd.Flags().GetString("repository-url")
 		gitAuthUsername, _ := cmd.Flags().GetString("gitauth-username")
 		gitAuthPassword, _ := cmd.Flags().GetString("gitauth-password")
@@ -53,6 +98,7 @@ var ciReleaseDeployCmd = &cobra.Command{
 		siltaConfig, _ := cmd.Flags().GetString("silta-config")
 		helmFlags, _ := cmd.Flags().GetString("helm-flags")
 		deploymentTimeout, _ := cmd.Flags().GetString("deployment-timeout")
+		verification, verifyUrls := releaseUrlVerification(cmd)
 
 		// Use environment variables as fallback
 		if useEnv {
@@ -91,6 +137,8 @@ var ciReleaseDeployCmd = &cobra.Command{
 			}
 		}
 
+		chartProfile := releaseChartProfile(cmd, chartName)
+
 		// Uses PrependChartConfigOverrides from "SILTA_<CHART_NAME>_CONFIG_VALUES"
 		// environment variable and prepends it to configuration
 		chartOverrideFile := common.CreateChartConfigurationFile(chartName)
@@ -102,53 +150,58 @@ var ciReleaseDeployCmd = &cobra.Command{
 		if len(deploymentTimeout) == 0 {
 			deploymentTimeout = "15m"
 		}
-		// Convert deploymentTimeout to integer of seconds
-		deploymentTimeoutSeconds := 900
 		deploymentTimeoutDuration, err := time.ParseDuration(deploymentTimeout)
 		if err != nil {
 			log.Println("Invalid deployment timeout duration, using default 15m.")
-		} else {
-			deploymentTimeoutSeconds = int(deploymentTimeoutDuration.Seconds())
-		}
-
-		// Chart value overrides
-
-		// Override Database credentials if specified
-		dbRootPassOverride := ""
-		if len(dbRootPass) > 0 {
-			dbRootPassOverride = fmt.Sprintf("--set mariadb.rootUser.password='%s'", dbRootPass)
-		}
-		dbUserPassOverride := ""
-		if len(dbUserPass) > 0 {
-			dbUserPassOverride = fmt.Sprintf("--set mariadb.db.password='%s'", dbUserPass)
+			deploymentTimeoutDuration = 15 * time.Minute
 		}
 
-		// Skip basic auth for internal VPN if defined in environment
-		extraNoAuthIPs := ""
-		if len(vpnIP) > 0 {
-			extraNoAuthIPs = fmt.Sprintf("--set nginx.noauthips.vpn='%s/32'", vpnIP)
+		if chartProfile == nil {
+			fmt.Print(unknownChartMessage(chartName, "helm release"))
+			return
 		}
 
-		// Pass VPC-native setting if defined in environment
-		vpcNativeOverride := ""
-		if len(vpcNative) > 0 {
-			vpcNativeOverride = fmt.Sprintf("--set cluster.vpcNative='%s'", vpcNative)
-		}
+		images := releaseImageUrls(cmd)
+		requireChartImages(chartProfile, images)
 
-		// Add cluster type if defined in environment
-		extraClusterType := ""
-		if len(clusterType) > 0 {
-			extraClusterType = fmt.Sprintf("--set cluster.type='%s'", clusterType)
+		// Chart value overrides
+		values, err := common.ChartReleaseValues(chartProfile, common.ReleaseParameters{
+			ReleaseName:     releaseName,
+			Namespace:       namespace,
+			EnvironmentName: siltaEnvironmentName,
+			BranchName:      branchname,
+			ClusterDomain:   clusterDomain,
+			ClusterType:     clusterType,
+			VpcNative:       vpcNative,
+			VpnIP:           vpnIP,
+			RepositoryUrl:   repositoryUrl,
+			GitAuthUsername: gitAuthUsername,
+			GitAuthPassword: gitAuthPassword,
+			DBRootPassword:  dbRootPass,
+			DBUserPassword:  dbUserPass,
+			ImagePullSecret: os.Getenv("IMAGE_PULL_SECRET"),
+			Images:          images,
+		})
+		if err != nil {
+			log.Fatalf("Error: %s", err)
 		}
 
-		// Allow pinning a specific chart version
-		chartVersionOverride := ""
-		if len(chartVersion) > 0 {
-			chartVersionOverride = fmt.Sprintf("--version '%s'", chartVersion)
+		deployment := common.HelmReleaseDeployment{
+			ReleaseName:     releaseName,
+			Namespace:       namespace,
+			ChartName:       common.ChartPath(chartProfile, chartName),
+			ChartRepository: chartRepository,
+			ChartVersion:    chartVersion,
+			ValueFiles:      common.ChartValueFiles(siltaConfig),
+			Values:          values,
+			HelmFlags:       helmFlags,
+			Timeout:         deploymentTimeoutDuration,
+			Wait:            true,
 		}
 
+		var clientset *kubernetes.Clientset
 		if !debug {
-			clientset, err := common.GetKubeClient()
+			clientset, err = common.GetKubeClient()
 			if err != nil {
 				log.Fatalf("failed to get kube client: %v", err)
 			}
@@ -165,418 +218,169 @@ var ciReleaseDeployCmd = &cobra.Command{
 					log.Printf("cannot create namespace: %s\n", err)
 				}
 			}
-		}
-
-		// Add imagePullsecret to release values if IMAGE_PULL_SECRET is set
-		imagePullSecret := os.Getenv("IMAGE_PULL_SECRET")
-		if len(imagePullSecret) > 0 {
-			helmFlags = fmt.Sprintf("%s --set imagePullSecret='%s'", helmFlags, imagePullSecret)
-		}
-
-		if !debug {
-			// Add helm repositories
-			command := fmt.Sprintf("helm repo add '%s' '%s'", "wunderio", chartRepository)
-			exec.Command("bash", "-c", command).Run()
-
-			// Make sure repositories are up to date
-			command = "helm repo update"
-			exec.Command("bash", "-c", command).Run()
 
 			// Delete existing jobs to prevent getting wrong log output
-			command = fmt.Sprintf("kubectl delete job '%s-post-release' --namespace '%s' --ignore-not-found", releaseName, namespace)
-			exec.Command("bash", "-c", command).Run()
-		}
-
-		command := ""
-
-		if chartName == "simple" || strings.HasSuffix(chartName, "/simple") {
-
-			if len(nginxImageUrl) == 0 {
-				log.Fatal("Nginx image url required (nginx-image-url)")
-			}
-
-			_, errDir := os.Stat(common.ExtendedFolder + "/simple")
-			if !os.IsNotExist(errDir) {
-				chartName = common.ExtendedFolder + "/simple"
-			}
-
-			fmt.Printf("Deploying %s helm release %s in %s namespace\n", chartName, releaseName, namespace)
-
-			// helm release
-			command = fmt.Sprintf(`
-			set -Eeuo pipefail
-
-			RELEASE_NAME='%s'
-			CHART_NAME='%s'
-			CHART_REPOSITORY='%s'
-			EXTRA_CHART_VERSION='%s'
-			SILTA_ENVIRONMENT_NAME='%s'
-			BRANCHNAME='%s'
-			NGINX_IMAGE_URL='%s'
-			CLUSTER_DOMAIN='%s'
-			EXTRA_NOAUTHIPS='%s'
-			EXTRA_VPCNATIVE='%s'
-			EXTRA_CLUSTERTYPE='%s'
-			NAMESPACE='%s'
-			SILTA_CONFIG='%s'
-			EXTRA_HELM_FLAGS='%s'
-			DEPLOYMENT_TIMEOUT='%s'
-
-			function deployment_failed() {
-				debug_failed_deployment
-				rm -f helm-output.log || true
+			err = common.DeletePostReleaseJob(clientset, namespace, releaseName)
+			if err != nil {
+				log.Printf("cannot delete post-release job: %s\n", err)
 			}
 
-			function debug_failed_deployment() {
-				silta ci release debug-failed --release-name="${RELEASE_NAME}" --namespace="${NAMESPACE}"
+			_, actionConfig, err := common.InitHelmActionConfig(namespace, common.HelmQuietLog)
+			if err != nil {
+				log.Fatalf("%+v", err)
 			}
 
-			trap deployment_failed ERR
-
-			helm upgrade --install "${RELEASE_NAME}" "${CHART_NAME}" \
-				--repo "${CHART_REPOSITORY}" \
-				${EXTRA_CHART_VERSION} \
-				--cleanup-on-fail \
-				--set environmentName="${SILTA_ENVIRONMENT_NAME}" \
-				--set silta-release.branchName="${BRANCHNAME}" \
-				--set nginx.image="${NGINX_IMAGE_URL}" \
-				--set clusterDomain="${CLUSTER_DOMAIN}" \
-				${EXTRA_NOAUTHIPS} \
-				${EXTRA_VPCNATIVE} \
-				${EXTRA_CLUSTERTYPE} \
-				--namespace="${NAMESPACE}" \
-				--values "${SILTA_CONFIG}" \
-				${EXTRA_HELM_FLAGS} \
-				--timeout "${DEPLOYMENT_TIMEOUT}" \
-				--wait`,
-				releaseName, chartName, chartRepository, chartVersionOverride,
-				siltaEnvironmentName, branchname, nginxImageUrl,
-				clusterDomain, extraNoAuthIPs, vpcNativeOverride, extraClusterType,
-				namespace, siltaConfig, helmFlags, deploymentTimeout)
-			pipedExec(command, "", "ERROR: ", debug)
-
-		} else if chartName == "frontend" || strings.HasSuffix(chartName, "/frontend") {
-
-			fmt.Printf("Deploying %s helm release %s in %s namespace\n", chartName, releaseName, namespace)
-
-			_, errDir := os.Stat(common.ExtendedFolder + "/frontend")
-			if !os.IsNotExist(errDir) {
-				chartName = common.ExtendedFolder + "/frontend"
+			// Chart specific migrations
+			err = chartProfile.PreDeploy(common.ChartPreDeployContext{
+				Clientset:    clientset,
+				ActionConfig: actionConfig,
+				Namespace:    namespace,
+				ReleaseName:  releaseName,
+			}, values)
+			if err != nil {
+				log.Fatalf("Error: %s", err)
 			}
+		}
 
-			// helm release
-			command = fmt.Sprintf(`
-			set -Eeuo pipefail
-
-			RELEASE_NAME='%s'
-			CHART_NAME='%s'
-			CHART_REPOSITORY='%s'
-			EXTRA_CHART_VERSION='%s'
-			SILTA_ENVIRONMENT_NAME='%s'
-			BRANCHNAME='%s'
-			GIT_REPOSITORY_URL='%s'
-			GITAUTH_USERNAME='%s'
-			GITAUTH_PASSWORD='%s'
-			CLUSTER_DOMAIN='%s'
-			NAMESPACE='%s'
-			EXTRA_NOAUTHIPS='%s'
-			EXTRA_VPCNATIVE='%s'
-			EXTRA_CLUSTERTYPE='%s'
-			EXTRA_DB_ROOT_PASS='%s'
-			EXTRA_DB_USER_PASS='%s'
-			SILTA_CONFIG='%s'
-			EXTRA_HELM_FLAGS='%s'
-			DEPLOYMENT_TIMEOUT='%s'
-			DEPLOYMENT_TIMEOUT_SECONDS='%d'
-
-			function deployment_failed() {
-				debug_failed_deployment
-				rm -f helm-output.log || true
-			}
+		fmt.Printf("Deploying %s helm release %s in %s namespace\n", deployment.ChartName, releaseName, namespace)
 
-			function debug_failed_deployment() {
-				silta ci release debug-failed --release-name="${RELEASE_NAME}" --namespace="${NAMESPACE}"
-			}
+		runHelmReleaseDeployment(clientset, deployment, chartProfile.Readiness())
 
-			trap deployment_failed ERR
-
-			helm upgrade --install "${RELEASE_NAME}" "${CHART_NAME}" \
-				--repo "${CHART_REPOSITORY}" \
-				${EXTRA_CHART_VERSION} \
-				--cleanup-on-fail \
-				--set environmentName="${SILTA_ENVIRONMENT_NAME}" \
-				--set silta-release.branchName="${BRANCHNAME}" \
-				--set shell.gitAuth.repositoryUrl="${GIT_REPOSITORY_URL}" \
-				--set shell.gitAuth.keyserver.username="${GITAUTH_USERNAME}" \
-				--set shell.gitAuth.keyserver.password="${GITAUTH_PASSWORD}" \
-				--set clusterDomain="${CLUSTER_DOMAIN}" \
-				--namespace="${NAMESPACE}" \
-				${EXTRA_NOAUTHIPS} \
-				${EXTRA_VPCNATIVE} \
-				${EXTRA_CLUSTERTYPE} \
-				${EXTRA_DB_ROOT_PASS} \
-				${EXTRA_DB_USER_PASS} \
-				--values "${SILTA_CONFIG}" \
-				${EXTRA_HELM_FLAGS} \
-				--wait \
-				--timeout "${DEPLOYMENT_TIMEOUT}" &> helm-output.log & pid=$!
-
-				# TODO: Rewrite this part
-
-				echo "Waiting for containers to start and be ready"
-
-				TIME_WAITING=0
-				LOGS_SHOWN=false
-				while true; do
-					if [ $LOGS_SHOWN == false ] && kubectl get pod -l job-name="${RELEASE_NAME}-post-release" -n "${NAMESPACE}" --ignore-not-found | grep  -qE "Running|Completed" ; then
-						echo ""
-						echo "Post-release log:"
-						kubectl logs "job/${RELEASE_NAME}-post-release" -n "${NAMESPACE}" -f --timestamps=true || true
-						LOGS_SHOWN=true
-					fi
-
-					# Helm command is complete.
-					if ! ps -p "$pid" > /dev/null; then
-						echo "Helm output:"
-						cat helm-output.log || true
-						wait $pid
-						if grep -q "UPGRADE FAILED" helm-output.log ; then
-							debug_failed_deployment
-						fi
-						break
-					fi
-
-					if [ $TIME_WAITING -gt ${DEPLOYMENT_TIMEOUT_SECONDS} ]; then
-						echo "Timeout waiting for resources."
-						debug_failed_deployment
-						exit 1
-					fi
-
-					echo "."
-					sleep 10
-					TIME_WAITING=$((TIME_WAITING+10))
-				done
-
-				# Wait for resources to be ready
-				# Get all deployments and statefulsets in the release and check the status of each one.
-				statefulsets=$(kubectl get statefulset -n "${NAMESPACE}" -l "release=${RELEASE_NAME}" -o=json | jq '.items[]|select(.spec.updateStrategy.type=="RollingUpdate")|.metadata.name')
-				if [ ! -z "$statefulsets" ]; then
-					echo "$statefulsets" | xargs -n 1 kubectl rollout status statefulset -n "$NAMESPACE" --timeout 5m
-				fi
-				kubectl get deployment -n "$NAMESPACE" -l "release=${RELEASE_NAME}" -o name | xargs -n 1 kubectl rollout status -n "$NAMESPACE" --timeout 5m
-				rm -f helm-output.log || true
-				`,
-				releaseName, chartName, chartRepository, chartVersionOverride,
-				siltaEnvironmentName, branchname,
-				repositoryUrl, gitAuthUsername, gitAuthPassword,
-				clusterDomain, namespace,
-				extraNoAuthIPs, vpcNativeOverride, extraClusterType,
-				dbRootPassOverride, dbUserPassOverride,
-				siltaConfig, helmFlags,
-				deploymentTimeout, deploymentTimeoutSeconds)
-			pipedExec(command, "", "ERROR: ", debug)
-
-		} else if chartName == "drupal" || strings.HasSuffix(chartName, "/drupal") {
-
-			if len(phpImageUrl) == 0 {
-				log.Fatal("PHP image url required (php-image-url)")
-			}
-			if len(nginxImageUrl) == 0 {
-				log.Fatal("Nginx image url required (nginx-image-url)")
-			}
-			if len(shellImageUrl) == 0 {
-				log.Fatal("Shell image url required (shell-image-url)")
+		if verifyUrls && !debug {
+			hostnames, err := common.ReleaseHostnames(context.TODO(), clientset, namespace, releaseName)
+			if err != nil {
+				log.Fatalf("Error: %s", err)
 			}
-
-			_, errDir := os.Stat(common.ExtendedFolder + "/drupal")
-			if os.IsNotExist(errDir) == false {
-				chartName = common.ExtendedFolder + "/drupal"
+			fmt.Println("Verifying release urls")
+			_, err = common.VerifyURLs(context.TODO(), common.HostnameURLs(hostnames), verification, os.Stdout)
+			if err != nil {
+				log.Fatalf("Error: %s", err)
 			}
+		}
+	},
+}
 
-			// Special updates
-			// TODO: Rewrite
-			command = fmt.Sprintf(`
-					# Deployed chart version
-					NAMESPACE='%s'
-					RELEASE_NAME='%s'
-					if helm status -n "$NAMESPACE" "$RELEASE_NAME" > /dev/null  2>&1
-					then
-						CURRENT_CHART_VERSION=$(helm history -n "$NAMESPACE" "$RELEASE_NAME" --max 1 --output json | jq -r '.[].chart')
-						echo "There is an existing chart deployed with version $CURRENT_CHART_VERSION"
-					fi
-
-					# Special updates
-					function version_lt() { test "$(printf '%%s\n' "$@" | sort -rV | head -n 1)" != "$1"; }
-
-					if [[ -n "$CURRENT_CHART_VERSION" ]] && [[ "$CURRENT_CHART_VERSION" = drupal-* ]]
-					then
-						if version_lt "$CURRENT_CHART_VERSION" "drupal-0.3.43"
-						then
-						echo "Recreating statefulset for Mariadb subchart update to 7.x."
-						kubectl delete statefulset --cascade=false "$RELEASE_NAME-mariadb" -n "$NAMESPACE"
-						fi
-					fi
-				`, namespace, releaseName)
-			pipedExec(command, "", "ERROR: ", debug)
-
-			// Clean up failed Helm releases
-			common.FailedReleaseCleanup(releaseName, namespace)
-
-			// Chart value overrides
-
-			// Disable reference data if the required volume is not present.
-			referenceDataOverride := ""
-			if !debug {
-
-				clientset, err := common.GetKubeClient()
-				if err != nil {
-					log.Fatalf("failed to get kube client: %v", err)
-				}
-
-				// PVC name can be either "*-reference-data" or "*-reference", so we need to check both
-				// Unless we parse and merge configuration yaml files, we can't know the exact name of the PVC
-				// Check all pvc's in the namespace and see if any of them match the pattern
-				pvcs, err := clientset.CoreV1().PersistentVolumeClaims(namespace).List(context.TODO(), v1meta.ListOptions{})
-				if err != nil {
-					log.Fatalf("cannot get persistent volume claims: %s", err)
-				}
-				referenceDataExists := false
-				for _, pvc := range pvcs.Items {
-					if strings.HasSuffix(pvc.Name, "-reference-data") || strings.HasSuffix(pvc.Name, "-reference") {
-						referenceDataExists = true
-						break
-					}
-				}
-				if !referenceDataExists {
-					referenceDataOverride = "--set referenceData.skipMount=true"
-				}
+// runHelmReleaseDeployment deploys a helm release in-process. Chart readiness rules control whether post-release
+// job logs are streamed while release is being deployed and whether rollout of deployments and statefulsets is
+// awaited afterwards. Failures are diagnosed with debug-failed checks.
+func runHelmReleaseDeployment(clientset *kubernetes.Clientset, deployment common.HelmReleaseDeployment, readiness common.ChartReadiness) {
+
+	helmFlags := releaseHelmFlags(&deployment)
+	if debug {
+		printHelmReleaseDeployment("Helm release deployment (not executed):", deployment)
+		return
+	}
+
+	settings, actionConfig, err := common.InitHelmActionConfig(deployment.Namespace, helmLog(helmFlags))
+	if err != nil {
+		log.Fatalf("%+v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), deployment.Timeout)
+	defer cancel()
+
+	type deploymentResult struct {
+		release *helmRelease.Release
+		err     error
+	}
+	// Pods of the previous release are left for the rollout to replace
+	existingPods, err := common.ListExistingPods(ctx, clientset, deployment.Namespace, deployment.ReleaseName)
+	if err != nil {
+		log.Fatalf("Error: %s", err)
+	}
+	done := make(chan deploymentResult, 1)
+	go func() {
+		release, err := common.UpgradeInstallHelmRelease(ctx, settings, actionConfig, deployment)
+		done <- deploymentResult{release, err}
+	}()
+
+	// Stuck pods fail the deployment right away instead of waiting for the deployment timeout
+	watchCtx, cancelWatch := context.WithCancel(ctx)
+	defer cancelWatch()
+	failures := make(chan error, 2)
+	logsDone := make(chan struct{})
+	if readiness.PostReleaseLogs {
+		fmt.Println("Waiting for containers to start and be ready")
+		go func() {
+			defer close(logsDone)
+			err := common.StreamPostReleaseLogs(watchCtx, clientset, deployment.Namespace, deployment.ReleaseName, os.Stdout)
+			var podFailure *common.PodFailureError
+			if errors.As(err, &podFailure) {
+				failures <- err
 			}
-
-			fmt.Printf("Deploying %s helm release %s in %s namespace\n", chartName, releaseName, namespace)
-
-			// TODO: rewrite the timeout handling and log printing after helm release
-			command = fmt.Sprintf(`
-			set -Eeuo pipefail
-
-			RELEASE_NAME='%s'
-			CHART_NAME='%s'
-			CHART_REPOSITORY='%s'
-			EXTRA_CHART_VERSION='%s'
-			SILTA_ENVIRONMENT_NAME='%s'
-			BRANCHNAME='%s'
-			PHP_IMAGE_URL='%s'
-			NGINX_IMAGE_URL='%s'
-			SHELL_IMAGE_URL='%s'
-			GIT_REPOSITORY_URL='%s'
-			GITAUTH_USERNAME='%s'
-			GITAUTH_PASSWORD='%s'
-			CLUSTER_DOMAIN='%s'
-			EXTRA_NOAUTHIPS='%s'
-			EXTRA_VPCNATIVE='%s'
-			EXTRA_CLUSTERTYPE='%s'
-			EXTRA_DB_ROOT_PASS='%s'
-			EXTRA_DB_USER_PASS='%s'
-			EXTRA_REFERENCE_DATA='%s'
-			NAMESPACE='%s'
-			SILTA_CONFIG='%s'
-			EXTRA_HELM_FLAGS='%s'
-			DEPLOYMENT_TIMEOUT='%s'
-			DEPLOYMENT_TIMEOUT_SECONDS='%d'
-
-			function deployment_failed() {
-				debug_failed_deployment
-				rm -f helm-output.log || true
+		}()
+	} else {
+		close(logsDone)
+	}
+	if readiness.Rollout {
+		go func() {
+			err := common.WatchReleaseProgress(watchCtx, clientset, deployment.Namespace, deployment.ReleaseName, existingPods, os.Stdout)
+			if err != nil {
+				failures <- err
 			}
+		}()
+	}
+
+	var result deploymentResult
+	var failure error
+	select {
+	case result = <-done:
+	case failure = <-failures:
+		fmt.Printf("Error: %s\n", failure)
+		cancel()
+		result = <-done
+	}
+
+	// Post-release job is a hook, it has finished by now. Give log stream a moment to flush.
+	select {
+	case <-logsDone:
+	case <-time.After(10 * time.Second):
+	}
+	cancelWatch()
+
+	if result.err != nil {
+		if failure == nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			fmt.Println("Timeout waiting for resources.")
+		}
+		fmt.Printf("Error: release deployment failed: %s\n", result.err)
+		debugFailedRelease(clientset, deployment.Namespace, deployment.ReleaseName)
+		os.Exit(1)
+	}
 
-			function debug_failed_deployment() {
-				silta ci release debug-failed --release-name="${RELEASE_NAME}" --namespace="${NAMESPACE}"
-			}
+	fmt.Printf("Release %q has been deployed. Revision: %d, status: %s\n", result.release.Name, result.release.Version, result.release.Info.Status)
 
-			trap deployment_failed ERR
-
-			helm upgrade --install "${RELEASE_NAME}" "${CHART_NAME}" \
-				--repo "${CHART_REPOSITORY}" \
-				${EXTRA_CHART_VERSION} \
-				--cleanup-on-fail \
-				--set environmentName="${SILTA_ENVIRONMENT_NAME}" \
-				--set silta-release.branchName="${BRANCHNAME}" \
-				--set php.image="${PHP_IMAGE_URL}" \
-				--set nginx.image="${NGINX_IMAGE_URL}" \
-				--set shell.image="${SHELL_IMAGE_URL}" \
-				--set shell.gitAuth.repositoryUrl="${GIT_REPOSITORY_URL}" \
-				--set shell.gitAuth.keyserver.username="${GITAUTH_USERNAME}" \
-				--set shell.gitAuth.keyserver.password="${GITAUTH_PASSWORD}" \
-				--set clusterDomain="${CLUSTER_DOMAIN}" \
-				${EXTRA_NOAUTHIPS} \
-				${EXTRA_VPCNATIVE} \
-				${EXTRA_CLUSTERTYPE} \
-				${EXTRA_DB_ROOT_PASS} \
-				${EXTRA_DB_USER_PASS} \
-				${EXTRA_REFERENCE_DATA} \
-				--namespace="${NAMESPACE}" \
-				--values "${SILTA_CONFIG}" \
-				${EXTRA_HELM_FLAGS} \
-				--wait \
-				--timeout "${DEPLOYMENT_TIMEOUT}" &> helm-output.log & pid=$!
-
-				# TODO: Rewrite this part
-				
-				echo "Waiting for containers to start and be ready"
-
-				TIME_WAITING=0
-				LOGS_SHOWN=false
-				while true; do
-					if [ $LOGS_SHOWN == false ] && kubectl get pod -l job-name="${RELEASE_NAME}-post-release" -n "${NAMESPACE}" --ignore-not-found | grep  -qE "Running|Completed" ; then
-						echo ""
-						echo "Post-release log:"
-						kubectl logs "job/${RELEASE_NAME}-post-release" -n "${NAMESPACE}" -f --timestamps=true || true
-						LOGS_SHOWN=true
-					fi
-
-					# Helm command is complete.
-					if ! ps -p "$pid" > /dev/null; then
-						echo "Helm output:"
-						cat helm-output.log || true
-						wait $pid
-						if grep -q "UPGRADE FAILED" helm-output.log ; then
-							debug_failed_deployment
-						fi	
-						break
-					fi
-
-					if [ $TIME_WAITING -gt ${DEPLOYMENT_TIMEOUT_SECONDS} ]; then
-						echo "Timeout waiting for resources."
-						debug_failed_deployment
-						exit 1
-					fi
-
-					echo "."
-					sleep 10
-					TIME_WAITING=$((TIME_WAITING+10))
-				done
-
-				# Wait for resources to be ready
-				# Get all deployments and statefulsets in the release and check the status of each one.
-				statefulsets=$(kubectl get statefulset -n "${NAMESPACE}" -l "release=${RELEASE_NAME}" -o=json | jq '.items[]|select(.spec.updateStrategy.type=="RollingUpdate")|.metadata.name')
-				if [ ! -z "$statefulsets" ]; then
-					echo "$statefulsets" | xargs -n 1 kubectl rollout status statefulset -n "$NAMESPACE" --timeout 5m
-				fi
-				kubectl get deployment -n "$NAMESPACE" -l "release=${RELEASE_NAME}" -o name | xargs -n 1 kubectl rollout status -n "$NAMESPACE" --timeout 5m
-				rm -f helm-output.log || true
-				`,
-				releaseName, chartName, chartRepository, chartVersionOverride,
-				siltaEnvironmentName, branchname,
-				phpImageUrl, nginxImageUrl, shellImageUrl,
-				repositoryUrl, gitAuthUsername, gitAuthPassword,
-				clusterDomain, extraNoAuthIPs, vpcNativeOverride, extraClusterType,
-				dbRootPassOverride, dbUserPassOverride, referenceDataOverride, namespace,
-				siltaConfig, helmFlags, deploymentTimeout, deploymentTimeoutSeconds)
-			pipedExec(command, "", "ERROR: ", debug)
-
-		} else {
-			fmt.Printf("Chart name %s does not match preselected names (drupal, frontend, simple), helm release step was skipped\n", chartName)
+	if readiness.Rollout {
+		// Wait for resources to be ready
+		err = common.WaitForReleaseRollout(clientset, deployment.Namespace, deployment.ReleaseName, existingPods, 5*time.Minute, os.Stdout)
+		if err != nil {
+			fmt.Printf("Error: %s\n", err)
+			debugFailedRelease(clientset, deployment.Namespace, deployment.ReleaseName)
+			os.Exit(1)
 		}
-	},
+	}
+}
+
+// printHelmReleaseDeployment prints release deployment parameters and values without deploying
+func printHelmReleaseDeployment(title string, deployment common.HelmReleaseDeployment) {
+	values, err := yaml.Marshal(deployment.Values)
+	if err != nil {
+		log.Fatalf("cannot marshal release values: %s", err)
+	}
+	fmt.Printf(`%s
+RELEASE_NAME: %s
+NAMESPACE: %s
+CHART_NAME: %s
+CHART_REPOSITORY: %s
+CHART_VERSION: %s
+VALUES_FILES: %s
+HELM_FLAGS: %s
+DEPLOYMENT_TIMEOUT: %s
+VALUES:
+%s`,
+		title, deployment.ReleaseName, deployment.Namespace,
+		deployment.ChartName, deployment.ChartRepository, deployment.ChartVersion,
+		strings.Join(deployment.ValueFiles, ","), deployment.HelmFlags,
+		deployment.Timeout, values)
 }
 
 func init() {
@@ -596,15 +400,19 @@ func init() {
 	ciReleaseDeployCmd.Flags().String("php-image-url", "", "PHP image url")
 	ciReleaseDeployCmd.Flags().String("nginx-image-url", "", "PHP image url")
 	ciReleaseDeployCmd.Flags().String("shell-image-url", "", "PHP image url")
+	ciReleaseDeployCmd.Flags().StringToString("image-url", map[string]string{}, "Image urls by chart profile image identifier (i.e. \"php=<url>,nginx=<url>\")")
+	ciReleaseDeployCmd.Flags().String("image-urls-file", "", "JSON file of image urls by image identifier (i.e. written by \"silta ci image build --all\")")
 	ciReleaseDeployCmd.Flags().String("repository-url", "", "Repository url (i.e. git@github.com:wunderio/silta.git)")
 	ciReleaseDeployCmd.Flags().String("gitauth-username", "", "Gitauth server username")
 	ciReleaseDeployCmd.Flags().String("gitauth-password", "", "Gitauth server password")
 	ciReleaseDeployCmd.Flags().String("cluster-domain", "", "Base domain for cluster urls (i.e. dev.example.com)")
 	ciReleaseDeployCmd.Flags().String("chart-name", "", "Chart name")
+	ciReleaseDeployCmd.Flags().String("chart-profile", "", "Chart profile files (comma separated list of YAML files)")
 	ciReleaseDeployCmd.Flags().String("chart-repository", "https://storage.googleapis.com/charts.wdr.io", "Chart repository")
 	ciReleaseDeployCmd.Flags().String("silta-config", "", "Silta release helm chart values")
-	ciReleaseDeployCmd.Flags().String("helm-flags", "", "Extra flags for helm release")
+	ciReleaseDeployCmd.Flags().String("helm-flags", "", "Extra flags for helm release (--set, --set-string, --set-file, --set-json, --set-literal, --values, --atomic, --force, --wait-for-jobs, --history-max, --debug), other flags are ignored")
 	ciReleaseDeployCmd.Flags().String("deployment-timeout", "", "Helm deployment timeout")
+	addVerifyUrlsFlags(ciReleaseDeployCmd)
 
 	ciReleaseDeployCmd.MarkFlagRequired("release-name")
 	ciReleaseDeployCmd.MarkFlagRequired("namespace")
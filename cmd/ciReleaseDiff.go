@@ -5,12 +5,11 @@ import (
 	"fmt"
 	"log"
 	"os"
-	"os/exec"
-	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/wunderio/silta-cli/internal/common"
-	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
 )
 
 // ciReleaseDiffCmd represents the ciReleaseDiff command
@@ -18,6 +17,15 @@ var ciReleaseDiffCmd = &cobra.Command{
 	Use:   "diff",
 	Short: "Diff release resources",
 	Long: `Release diff command is used to compare the resources of a release with the current state of the cluster.
+
+	* Release manifests are rendered with a helm SDK dry-run and compared to 
+	live cluster objects, helm-diff plugin is not required. Status, server 
+	managed metadata and fields defaulted by the API server are ignored. 
+	Secret values are redacted, changed values are marked. Release hooks 
+	are not compared.
+
+	* "--output" selects diff format: "text" (unified diff per resource), 
+	"json" or "markdown" (i.e. for posting to a pull request).
 	
 	* Chart allows prepending extra configuration (to helm --values line) via 
 	"SILTA_<chart_name>_CONFIG_VALUES" environment variable. It has to be a 
@@ -25,6 +33,10 @@ var ciReleaseDiffCmd = &cobra.Command{
 
 	* If IMAGE_PULL_SECRET is set (base64 encoded), it will be added to the 
 	release values as imagePullSecret.
+
+	* Chart specific values are defined by chart profiles, extra profiles can be 
+	loaded via "--chart-profile" flag or "SILTA_CHART_PROFILES" environment 
+	variable (see "silta ci release deploy --help").
 	`,
 	Run: func(cmd *cobra.Command, args []string) {
 
@@ -39,9 +51,6 @@ var ciReleaseDiffCmd = &cobra.Command{
 		vpcNative, _ := cmd.Flags().GetString("vpc-native")
 		clusterType, _ := cmd.Flags().GetString("cluster-type")
 		chartVersion, _ := cmd.Flags().GetString("chart-version")
-		phpImageUrl, _ := cmd.Flags().GetString("php-image-url")
-		nginxImageUrl, _ := cmd.Flags().GetString("nginx-image-url")
-		shellImageUrl, _ := cmd.Flags().GetString("shell-image-url")
 		repositoryUrl, _ := cmd.Flags().GetString("repository-url")
 		gitAuthUsername, _ := cmd.Flags().GetString("gitauth-username")
 		gitAuthPassword, _ := cmd.Flags().GetString("gitauth-password")
@@ -50,6 +59,7 @@ var ciReleaseDiffCmd = &cobra.Command{
 		chartRepository, _ := cmd.Flags().GetString("chart-repository")
 		siltaConfig, _ := cmd.Flags().GetString("silta-config")
 		helmFlags, _ := cmd.Flags().GetString("helm-flags")
+		outputFormat, _ := cmd.Flags().GetString("output")
 
 		// Use environment variables as fallback
 		if useEnv {
@@ -88,6 +98,8 @@ var ciReleaseDiffCmd = &cobra.Command{
 			}
 		}
 
+		chartProfile := releaseChartProfile(cmd, chartName)
+
 		// Uses PrependChartConfigOverrides from "SILTA_<CHART_NAME>_CONFIG_VALUES"
 		// environment variable and prepends it to configuration
 		chartOverrideFile := common.CreateChartConfigurationFile(chartName)
@@ -96,272 +108,113 @@ var ciReleaseDiffCmd = &cobra.Command{
 			siltaConfig = common.PrependChartConfigOverrides(chartOverrideFile, siltaConfig)
 		}
 
-		// Chart value overrides
-
-		// Override Database credentials if specified
-		dbRootPassOverride := ""
-		if len(dbRootPass) > 0 {
-			dbRootPassOverride = fmt.Sprintf("--set mariadb.rootUser.password='%s'", dbRootPass)
-		}
-		dbUserPassOverride := ""
-		if len(dbUserPass) > 0 {
-			dbUserPassOverride = fmt.Sprintf("--set mariadb.db.password='%s'", dbUserPass)
+		if chartProfile == nil {
+			fmt.Print(unknownChartMessage(chartName, "helm diff"))
+			return
 		}
 
-		// Skip basic auth for internal VPN if defined in environment
-		extraNoAuthIPs := ""
-		if len(vpnIP) > 0 {
-			extraNoAuthIPs = fmt.Sprintf("--set nginx.noauthips.vpn='%s/32'", vpnIP)
-		}
+		images := releaseImageUrls(cmd)
+		requireChartImages(chartProfile, images)
 
-		// Pass VPC-native setting if defined in environment
-		vpcNativeOverride := ""
-		if len(vpcNative) > 0 {
-			vpcNativeOverride = fmt.Sprintf("--set cluster.vpcNative='%s'", vpcNative)
+		// Chart value overrides
+		values, err := common.ChartReleaseValues(chartProfile, common.ReleaseParameters{
+			ReleaseName:     releaseName,
+			Namespace:       namespace,
+			EnvironmentName: siltaEnvironmentName,
+			BranchName:      branchname,
+			ClusterDomain:   clusterDomain,
+			ClusterType:     clusterType,
+			VpcNative:       vpcNative,
+			VpnIP:           vpnIP,
+			RepositoryUrl:   repositoryUrl,
+			GitAuthUsername: gitAuthUsername,
+			GitAuthPassword: gitAuthPassword,
+			DBRootPassword:  dbRootPass,
+			DBUserPassword:  dbUserPass,
+			ImagePullSecret: os.Getenv("IMAGE_PULL_SECRET"),
+			Images:          images,
+		})
+		if err != nil {
+			log.Fatalf("Error: %s", err)
 		}
 
-		// Add cluster type if defined in environment
-		extraClusterType := ""
-		if len(clusterType) > 0 {
-			extraClusterType = fmt.Sprintf("--set cluster.type='%s'", clusterType)
+		if outputFormat != "text" && outputFormat != "json" && outputFormat != "markdown" {
+			log.Fatalf("Unknown output format: %s (supported: text, json, markdown)", outputFormat)
 		}
 
-		// Allow pinning a specific chart version
-		chartVersionOverride := ""
-		if len(chartVersion) > 0 {
-			chartVersionOverride = fmt.Sprintf("--version '%s'", chartVersion)
+		deployment := common.HelmReleaseDeployment{
+			ReleaseName:     releaseName,
+			Namespace:       namespace,
+			ChartName:       common.ChartPath(chartProfile, chartName),
+			ChartRepository: chartRepository,
+			ChartVersion:    chartVersion,
+			ValueFiles:      common.ChartValueFiles(siltaConfig),
+			Values:          values,
+			HelmFlags:       helmFlags,
+			Timeout:         15 * time.Minute,
+			DryRun:          true,
 		}
 
-		// Add imagePullsecret to release values if IMAGE_PULL_SECRET is set
-		imagePullSecret := os.Getenv("IMAGE_PULL_SECRET")
-		if len(imagePullSecret) > 0 {
-			helmFlags = fmt.Sprintf("%s --set imagePullSecret='%s'", helmFlags, imagePullSecret)
+		parsedHelmFlags := releaseHelmFlags(&deployment)
+		if debug {
+			printHelmReleaseDeployment("Helm release diff (not executed):", deployment)
+			return
 		}
 
-		if !debug {
-			// Add helm repositories
-			command := fmt.Sprintf("helm repo add '%s' '%s'", "wunderio", chartRepository)
-			exec.Command("bash", "-c", command).Run()
-
-			// Make sure repositories are up to date
-			command = "helm repo update"
-			exec.Command("bash", "-c", command).Run()
+		clientset, err := common.GetKubeClient()
+		if err != nil {
+			log.Fatalf("failed to get kube client: %v", err)
 		}
 
-		if chartName == "simple" || strings.HasSuffix(chartName, "/simple") {
-
-			if len(nginxImageUrl) == 0 {
-				log.Fatal("Nginx image url required (nginx-image-url)")
-			}
-
-			_, errDir := os.Stat(common.ExtendedFolder + "/simple")
-			if !os.IsNotExist(errDir) {
-				chartName = common.ExtendedFolder + "/simple"
-			}
-
-			fmt.Printf("Diffing %s helm release %s in %s namespace\n", chartName, releaseName, namespace)
-
-			// helm release
-			command := fmt.Sprintf(`
-			set -Eeuo pipefail
-
-			RELEASE_NAME='%s'
-			CHART_NAME='%s'
-			CHART_REPOSITORY='%s'
-			EXTRA_CHART_VERSION='%s'
-			SILTA_ENVIRONMENT_NAME='%s'
-			BRANCHNAME='%s'
-			NGINX_IMAGE_URL='%s'
-			CLUSTER_DOMAIN='%s'	
-			EXTRA_NOAUTHIPS='%s'
-			EXTRA_VPCNATIVE='%s'
-			EXTRA_CLUSTERTYPE='%s'
-			NAMESPACE='%s'
-			SILTA_CONFIG='%s'
-			EXTRA_HELM_FLAGS='%s'
-
-			helm diff upgrade --install "${RELEASE_NAME}" "${CHART_NAME}" \
-				--repo "${CHART_REPOSITORY}" \
-				${EXTRA_CHART_VERSION} \
-				--set environmentName="${SILTA_ENVIRONMENT_NAME}" \
-				--set silta-release.branchName="${BRANCHNAME}" \
-				--set nginx.image="${NGINX_IMAGE_URL}" \
-				--set clusterDomain="${CLUSTER_DOMAIN}" \
-				${EXTRA_NOAUTHIPS} \
-				${EXTRA_VPCNATIVE} \
-				${EXTRA_CLUSTERTYPE} \
-				--namespace="${NAMESPACE}" \
-				--values "${SILTA_CONFIG}" \
-				${EXTRA_HELM_FLAGS}`,
-				releaseName, chartName, chartRepository, chartVersionOverride,
-				siltaEnvironmentName, branchname, nginxImageUrl,
-				clusterDomain, extraNoAuthIPs, vpcNativeOverride, extraClusterType,
-				namespace, siltaConfig, helmFlags)
-			pipedExec(command, "", "ERROR: ", debug)
-
-		} else if chartName == "frontend" || strings.HasSuffix(chartName, "/frontend") {
-
-			fmt.Printf("Diffing %s helm release %s in %s namespace\n", chartName, releaseName, namespace)
-
-			_, errDir := os.Stat(common.ExtendedFolder + "/frontend")
-			if !os.IsNotExist(errDir) {
-				chartName = common.ExtendedFolder + "/frontend"
-			}
-
-			// helm release
-			command := fmt.Sprintf(`
-			set -Eeuo pipefail
-
-			RELEASE_NAME='%s'
-			CHART_NAME='%s'
-			CHART_REPOSITORY='%s'
-			EXTRA_CHART_VERSION='%s'
-			SILTA_ENVIRONMENT_NAME='%s'
-			BRANCHNAME='%s'
-			GIT_REPOSITORY_URL='%s'
-			GITAUTH_USERNAME='%s'
-			GITAUTH_PASSWORD='%s'
-			CLUSTER_DOMAIN='%s'	
-			NAMESPACE='%s'
-			EXTRA_NOAUTHIPS='%s'
-			EXTRA_VPCNATIVE='%s'
-			EXTRA_CLUSTERTYPE='%s'
-			EXTRA_DB_ROOT_PASS='%s'
-			EXTRA_DB_USER_PASS='%s'
-			SILTA_CONFIG='%s'
-			EXTRA_HELM_FLAGS='%s'
-			
-			helm diff upgrade --install "${RELEASE_NAME}" "${CHART_NAME}" \
-				--repo "${CHART_REPOSITORY}" \
-				${EXTRA_CHART_VERSION} \
-				--set environmentName="${SILTA_ENVIRONMENT_NAME}" \
-				--set silta-release.branchName="${BRANCHNAME}" \
-				--set shell.gitAuth.repositoryUrl="${GIT_REPOSITORY_URL}" \
-				--set shell.gitAuth.keyserver.username="${GITAUTH_USERNAME}" \
-				--set shell.gitAuth.keyserver.password="${GITAUTH_PASSWORD}" \
-				--set clusterDomain="${CLUSTER_DOMAIN}" \
-				--namespace="${NAMESPACE}" \
-				${EXTRA_NOAUTHIPS} \
-				${EXTRA_VPCNATIVE} \
-				${EXTRA_CLUSTERTYPE} \
-				${EXTRA_DB_ROOT_PASS} \
-				${EXTRA_DB_USER_PASS} \
-				--values "${SILTA_CONFIG}" \
-				${EXTRA_HELM_FLAGS}`,
-				releaseName, chartName, chartRepository, chartVersionOverride,
-				siltaEnvironmentName, branchname,
-				repositoryUrl, gitAuthUsername, gitAuthPassword,
-				clusterDomain, namespace,
-				extraNoAuthIPs, vpcNativeOverride, extraClusterType,
-				dbRootPassOverride, dbUserPassOverride,
-				siltaConfig, helmFlags)
-			pipedExec(command, "", "ERROR: ", debug)
-
-		} else if chartName == "drupal" || strings.HasSuffix(chartName, "/drupal") {
-
-			if len(phpImageUrl) == 0 {
-				log.Fatal("PHP image url required (php-image-url)")
-			}
-			if len(nginxImageUrl) == 0 {
-				log.Fatal("Nginx image url required (nginx-image-url)")
-			}
-			if len(shellImageUrl) == 0 {
-				log.Fatal("Shell image url required (shell-image-url)")
-			}
-
-			_, errDir := os.Stat(common.ExtendedFolder + "/drupal")
-			if os.IsNotExist(errDir) == false {
-				chartName = common.ExtendedFolder + "/drupal"
-			}
-
-			// Disable reference data if the required volume is not present.
-			referenceDataOverride := ""
-			if !debug {
-
-				clientset, err := common.GetKubeClient()
-				if err != nil {
-					log.Fatalf("failed to get kube client: %v", err)
-				}
+		settings, actionConfig, err := common.InitHelmActionConfig(namespace, helmLog(parsedHelmFlags))
+		if err != nil {
+			log.Fatalf("%+v", err)
+		}
 
-				// PVC name can be either "*-reference-data" or "*-reference", so we need to check both
-				// Unless we parse and merge configuration yaml files, we can't know the exact name of the PVC
-				// Check all pvc's in the namespace and see if any of them match the pattern
-				pvcs, err := clientset.CoreV1().PersistentVolumeClaims(namespace).List(context.TODO(), v1.ListOptions{})
-				if err != nil {
-					log.Fatalf("cannot get persistent volume claims: %s", err)
-				}
-				referenceDataExists := false
-				for _, pvc := range pvcs.Items {
-					if strings.HasSuffix(pvc.Name, "-reference-data") || strings.HasSuffix(pvc.Name, "-reference") {
-						referenceDataExists = true
-						break
-					}
-				}
-				if !referenceDataExists {
-					referenceDataOverride = "--set referenceData.skipMount=true"
-				}
-			}
+		// Chart specific migrations only adjust values when diffing
+		err = chartProfile.PreDeploy(common.ChartPreDeployContext{
+			Clientset:    clientset,
+			ActionConfig: actionConfig,
+			Namespace:    namespace,
+			ReleaseName:  releaseName,
+			DryRun:       true,
+		}, values)
+		if err != nil {
+			log.Fatalf("Error: %s", err)
+		}
 
-			fmt.Printf("Diffing %s helm release %s in %s namespace\n", chartName, releaseName, namespace)
+		if outputFormat == "text" {
+			fmt.Printf("Diffing %s helm release %s in %s namespace\n", deployment.ChartName, releaseName, namespace)
+		}
 
-			command := fmt.Sprintf(`
-			set -Eeuo pipefail
+		// Render target manifests
+		target, err := common.UpgradeInstallHelmRelease(context.Background(), settings, actionConfig, deployment)
+		if err != nil {
+			log.Fatalf("Error: cannot render release: %s", err)
+		}
 
-			RELEASE_NAME='%s'
-			CHART_NAME='%s'
-			CHART_REPOSITORY='%s'
-			EXTRA_CHART_VERSION='%s'
-			SILTA_ENVIRONMENT_NAME='%s'
-			BRANCHNAME='%s'
-			PHP_IMAGE_URL='%s'
-			NGINX_IMAGE_URL='%s'
-			SHELL_IMAGE_URL='%s'
-			GIT_REPOSITORY_URL='%s'
-			GITAUTH_USERNAME='%s'
-			GITAUTH_PASSWORD='%s'
-			CLUSTER_DOMAIN='%s'	
-			EXTRA_NOAUTHIPS='%s'
-			EXTRA_VPCNATIVE='%s'
-			EXTRA_CLUSTERTYPE='%s'
-			EXTRA_DB_ROOT_PASS='%s'
-			EXTRA_DB_USER_PASS='%s'
-			EXTRA_REFERENCE_DATA='%s'
-			NAMESPACE='%s'
-			SILTA_CONFIG='%s'
-			EXTRA_HELM_FLAGS='%s'
+		restConfig, err := settings.RESTClientGetter().ToRESTConfig()
+		if err != nil {
+			log.Fatalf("Error: %s", err)
+		}
+		mapper, err := settings.RESTClientGetter().ToRESTMapper()
+		if err != nil {
+			log.Fatalf("Error: %s", err)
+		}
+		dynamicClient, err := dynamic.NewForConfig(restConfig)
+		if err != nil {
+			log.Fatalf("Error: %s", err)
+		}
 
-			helm diff upgrade --install "${RELEASE_NAME}" "${CHART_NAME}" \
-				--repo "${CHART_REPOSITORY}" \
-				${EXTRA_CHART_VERSION} \
-				--set environmentName="${SILTA_ENVIRONMENT_NAME}" \
-				--set silta-release.branchName="${BRANCHNAME}" \
-				--set php.image="${PHP_IMAGE_URL}" \
-				--set nginx.image="${NGINX_IMAGE_URL}" \
-				--set shell.image="${SHELL_IMAGE_URL}" \
-				--set shell.gitAuth.repositoryUrl="${GIT_REPOSITORY_URL}" \
-				--set shell.gitAuth.keyserver.username="${GITAUTH_USERNAME}" \
-				--set shell.gitAuth.keyserver.password="${GITAUTH_PASSWORD}" \
-				--set clusterDomain="${CLUSTER_DOMAIN}" \
-				${EXTRA_NOAUTHIPS} \
-				${EXTRA_VPCNATIVE} \
-				${EXTRA_CLUSTERTYPE} \
-				${EXTRA_DB_ROOT_PASS} \
-				${EXTRA_DB_USER_PASS} \
-				${EXTRA_REFERENCE_DATA} \
-				--namespace="${NAMESPACE}" \
-				--values "${SILTA_CONFIG}" \
-				${EXTRA_HELM_FLAGS}`,
-				releaseName, chartName, chartRepository, chartVersionOverride,
-				siltaEnvironmentName, branchname,
-				phpImageUrl, nginxImageUrl, shellImageUrl,
-				repositoryUrl, gitAuthUsername, gitAuthPassword,
-				clusterDomain, extraNoAuthIPs, vpcNativeOverride, extraClusterType,
-				dbRootPassOverride, dbUserPassOverride, referenceDataOverride, namespace,
-				siltaConfig, helmFlags)
-			pipedExec(command, "", "ERROR: ", debug)
+		diffs, err := common.DiffReleaseManifests(target.Manifest, common.DeployedReleaseManifest(actionConfig, releaseName), namespace,
+			common.NewLiveObjectGetter(dynamicClient, mapper, namespace))
+		if err != nil {
+			log.Fatalf("Error: %s", err)
+		}
 
-		} else {
-			fmt.Printf("Chart name %s does not match preselected names (drupal, frontend, simple), helm diff step was skipped\n", chartName)
+		err = common.PrintResourceDiffs(os.Stdout, diffs, outputFormat)
+		if err != nil {
+			log.Fatalf("Error: %s", err)
 		}
 	},
 }
@@ -383,14 +236,18 @@ func init() {
 	ciReleaseDiffCmd.Flags().String("php-image-url", "", "PHP image url")
 	ciReleaseDiffCmd.Flags().String("nginx-image-url", "", "PHP image url")
 	ciReleaseDiffCmd.Flags().String("shell-image-url", "", "PHP image url")
+	ciReleaseDiffCmd.Flags().StringToString("image-url", map[string]string{}, "Image urls by chart profile image identifier (i.e. \"php=<url>,nginx=<url>\")")
+	ciReleaseDiffCmd.Flags().String("image-urls-file", "", "JSON file of image urls by image identifier (i.e. written by \"silta ci image build --all\")")
 	ciReleaseDiffCmd.Flags().String("repository-url", "", "Repository url (i.e. git@github.com:wunderio/silta.git)")
 	ciReleaseDiffCmd.Flags().String("gitauth-username", "", "Gitauth server username")
 	ciReleaseDiffCmd.Flags().String("gitauth-password", "", "Gitauth server password")
 	ciReleaseDiffCmd.Flags().String("cluster-domain", "", "Base domain for cluster urls (i.e. dev.example.com)")
 	ciReleaseDiffCmd.Flags().String("chart-name", "", "Chart name")
+	ciReleaseDiffCmd.Flags().String("chart-profile", "", "Chart profile files (comma separated list of YAML files)")
 	ciReleaseDiffCmd.Flags().String("chart-repository", "https://storage.googleapis.com/charts.wdr.io", "Chart repository")
 	ciReleaseDiffCmd.Flags().String("silta-config", "", "Silta release helm chart values")
-	ciReleaseDiffCmd.Flags().String("helm-flags", "", "Extra flags for helm release")
+	ciReleaseDiffCmd.Flags().String("helm-flags", "", "Extra flags for helm release (--set, --set-string, --set-file, --set-json, --set-literal, --values, --atomic, --force, --wait-for-jobs, --history-max, --debug), other flags are ignored")
+	ciReleaseDiffCmd.Flags().StringP("output", "o", "text", "Output format (text, json, markdown)")
 
 	ciReleaseDiffCmd.MarkFlagRequired("release-name")
 	ciReleaseDiffCmd.MarkFlagRequired("namespace")
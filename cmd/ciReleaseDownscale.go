@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/wunderio/silta-cli/internal/common"
+	"k8s.io/client-go/kubernetes"
+	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp" // gcp auth provider
+)
+
+var ciReleaseDownscaleCmd = &cobra.Command{
+	Use:   "downscale",
+	Short: "Downscale a release",
+	Long: `Downscale a release to save cluster resources. Required flags: "--release-name" and "--namespace".
+
+	* Deployments and statefulsets are scaled to zero replicas, cronjobs are
+	suspended.
+
+	* Services are redirected to a placeholder host ("--placeholder-host"),
+	i.e. a page that wakes the environment up.
+
+	* Original replica counts, service types, selectors and ports are stored in
+	"auto-downscale/*" annotations, release is restored with
+	"silta ci release wakeup".
+
+	* "--all" downscales all releases in the namespace, "--selector" the
+	releases with deployments or statefulsets matching a label selector.
+	"--all-namespaces" looks for releases across the cluster. Releases are
+	processed in parallel ("--concurrency") and a summary table is printed.
+	`,
+	Run: func(cmd *cobra.Command, args []string) {
+		releaseName, _ := cmd.Flags().GetString("release-name")
+		namespace, _ := cmd.Flags().GetString("namespace")
+		placeholderHost, _ := cmd.Flags().GetString("placeholder-host")
+
+		if len(releaseName) == 0 {
+			releaseBatch(cmd, "Release downscale", func(ctx context.Context, clientset kubernetes.Interface, release common.ReleaseRef, out io.Writer) (string, error) {
+				return "", common.DownscaleRelease(ctx, clientset, release.Namespace, release.Name, placeholderHost, out)
+			})
+			return
+		}
+
+		if debug {
+			fmt.Printf(`Release downscale (not executed):
+RELEASE_NAME: %s
+NAMESPACE: %s
+PLACEHOLDER_HOST: %s
+`, releaseName, namespace, placeholderHost)
+			return
+		}
+
+		clientset, err := common.GetKubeClient()
+		if err != nil {
+			log.Fatalf("failed to get kube client: %v", err)
+		}
+
+		_, actionConfig, err := common.InitHelmActionConfig(namespace, common.HelmQuietLog)
+		if err != nil {
+			log.Fatalf("%+v", err)
+		}
+		// Try loading the latest version of the release
+		_, err = common.ReleaseHistory(actionConfig, releaseName)
+		if err != nil {
+			log.Fatalf("Release not found: %s", err)
+		}
+
+		err = common.DownscaleRelease(context.TODO(), clientset, namespace, releaseName, placeholderHost, os.Stdout)
+		if err != nil {
+			log.Fatalf("Error: %s", err)
+		}
+	},
+}
+
+func init() {
+	ciReleaseCmd.AddCommand(ciReleaseDownscaleCmd)
+
+	ciReleaseDownscaleCmd.Flags().String("release-name", "", "Release name")
+	ciReleaseDownscaleCmd.Flags().String("namespace", "", "Project name (namespace, i.e. \"drupal-project\")")
+	ciReleaseDownscaleCmd.Flags().String("placeholder-host", "silta-downscaler.silta-cluster.svc.cluster.local", "Placeholder host services are redirected to")
+
+	addReleaseBatchFlags(ciReleaseDownscaleCmd)
+}
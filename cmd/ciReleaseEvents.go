@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/wunderio/silta-cli/internal/common"
+)
+
+var ciReleaseEventsCmd = &cobra.Command{
+	Use:   "events",
+	Short: "Show release event timeline",
+	Long: `Show kubernetes events of release objects (selected by "release" and 
+"app.kubernetes.io/instance" labels) as a single chronological timeline.
+Repeated events are merged and shown with a count.
+
+	* "--since" limits events to a recent period (i.e. "30m").
+
+	* "--follow" keeps watching for new events (i.e. during a deploy) until 
+	interrupted.
+	`,
+	Run: func(cmd *cobra.Command, args []string) {
+		releaseName, _ := cmd.Flags().GetString("release-name")
+		namespace, _ := cmd.Flags().GetString("namespace")
+		since, _ := cmd.Flags().GetDuration("since")
+		follow, _ := cmd.Flags().GetBool("follow")
+
+		if since < 0 {
+			log.Fatalf("Error: invalid --since value: %s", since)
+		}
+
+		if debug {
+			sinceValue := "all events"
+			if since > 0 {
+				sinceValue = since.String()
+			}
+			fmt.Printf(`Release events (not executed):
+RELEASE_NAME: %s
+NAMESPACE: %s
+SINCE: %s
+FOLLOW: %t
+`, releaseName, namespace, sinceValue, follow)
+			return
+		}
+
+		sinceTime := time.Time{}
+		if since > 0 {
+			sinceTime = time.Now().Add(-since)
+		}
+
+		clientset, err := common.GetKubeClient()
+		if err != nil {
+			log.Fatalf("failed to get kube client: %v", err)
+		}
+
+		if follow {
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			err = common.FollowReleaseEvents(ctx, clientset, namespace, releaseName, sinceTime, os.Stdout)
+			if err != nil {
+				log.Fatalf("Error: %s", err)
+			}
+			return
+		}
+
+		events, err := common.ReleaseEvents(context.TODO(), clientset, namespace, releaseName, sinceTime)
+		if err != nil {
+			log.Fatalf("Error: %s", err)
+		}
+		if len(events) == 0 {
+			fmt.Println("No events found")
+			return
+		}
+		common.PrintReleaseEvents(os.Stdout, events)
+	},
+}
+
+func init() {
+	ciReleaseCmd.AddCommand(ciReleaseEventsCmd)
+
+	ciReleaseEventsCmd.Flags().String("release-name", "", "Release name")
+	ciReleaseEventsCmd.Flags().String("namespace", "", "Project name (namespace, i.e. \"drupal-project\")")
+	ciReleaseEventsCmd.Flags().Duration("since", 0, "Only show events seen within this duration (i.e. 30m, default: all events)")
+	ciReleaseEventsCmd.Flags().Bool("follow", false, "Watch for new events until interrupted")
+
+	ciReleaseEventsCmd.MarkFlagRequired("release-name")
+	ciReleaseEventsCmd.MarkFlagRequired("namespace")
+}
@@ -0,0 +1,138 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/spf13/cobra"
+	"github.com/wunderio/silta-cli/internal/common"
+	"golang.org/x/term"
+	utilexec "k8s.io/client-go/util/exec"
+)
+
+var ciReleaseExecCmd = &cobra.Command{
+	Use:     "exec [flags] [-- command [args...]]",
+	Aliases: []string{"shell"},
+	Short:   "Run a command in a release pod",
+	Long: `Run a command in a ready release pod, without kubectl or knowing pod names. 
+Pod is selected by "release" and "app.kubernetes.io/instance" labels, 
+cronjob pods are skipped. Command is given after "--", i.e. 
+"silta ci release exec --release-name main --namespace drupal-project -- drush status". 
+When command is not given, an interactive shell is opened.
+
+	* "--component" selects a release component (i.e. "php", "shell", "node"), 
+	"shell" and then "php" are tried when it's not set.
+
+	* Terminal (TTY) is allocated when stdin is a terminal, "--no-tty" disables it 
+	(i.e. when output is parsed). Stdin is passed to the command with a terminal 
+	or with "--stdin" / "-i" (i.e. "silta ci release exec ... -i -- drush sqlc < dump.sql").
+
+	Command exit code is returned.
+	`,
+	Run: func(cmd *cobra.Command, args []string) {
+		releaseName, _ := cmd.Flags().GetString("release-name")
+		namespace, _ := cmd.Flags().GetString("namespace")
+		component, _ := cmd.Flags().GetString("component")
+		noTty, _ := cmd.Flags().GetBool("no-tty")
+		stdin, _ := cmd.Flags().GetBool("stdin")
+
+		components := common.DefaultExecComponents
+		if len(component) > 0 {
+			components = []string{component}
+		}
+		command := args
+		if len(command) == 0 {
+			command = common.DefaultExecCommand
+		}
+
+		if debug {
+			fmt.Printf(`Release exec (not executed):
+RELEASE_NAME: %s
+NAMESPACE: %s
+COMPONENT: %s
+COMMAND: %s
+STDIN: %t
+`, releaseName, namespace, strings.Join(components, ", "), strings.Join(command, " "), stdin)
+			return
+		}
+
+		config, err := common.GetKubeConfig()
+		if err != nil {
+			log.Fatalf("failed to get kube config: %v", err)
+		}
+		clientset, err := common.GetKubeClient()
+		if err != nil {
+			log.Fatalf("failed to get kube client: %v", err)
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM)
+		defer stop()
+
+		pod, container, err := common.FindReleasePod(ctx, clientset, namespace, releaseName, components)
+		if err != nil {
+			log.Fatalf("Error: %s", err)
+		}
+
+		stdinFd := int(os.Stdin.Fd())
+		tty := !noTty && term.IsTerminal(stdinFd)
+		e := common.ReleaseExec{
+			Namespace: namespace,
+			Pod:       pod.Name,
+			Container: container,
+			Command:   command,
+			Stdout:    os.Stdout,
+			Stderr:    os.Stderr,
+			TTY:       tty,
+		}
+		// Without stdin remote command gets EOF instead of waiting for input (i.e. in CI)
+		if tty || stdin {
+			e.Stdin = os.Stdin
+		}
+		if tty {
+			// Keys (i.e. ctrl+c) are passed to the remote terminal
+			state, err := term.MakeRaw(stdinFd)
+			if err != nil {
+				log.Fatalf("Error: %s", err)
+			}
+			sizeCtx, cancel := context.WithCancel(ctx)
+			e.TerminalSizeQueue = common.NewTerminalSizeQueue(sizeCtx, int(os.Stdout.Fd()))
+			err = common.ExecInPod(ctx, config, clientset, e)
+			cancel()
+			term.Restore(stdinFd, state)
+			exitOnExecError(err)
+			return
+		}
+		exitOnExecError(common.ExecInPod(ctx, config, clientset, e))
+	},
+}
+
+// exitOnExecError exits with remote command exit code
+func exitOnExecError(err error) {
+	if err == nil {
+		return
+	}
+	var exitError utilexec.ExitError
+	if errors.As(err, &exitError) && exitError.Exited() {
+		os.Exit(exitError.ExitStatus())
+	}
+	log.Fatalf("Error: %s", err)
+}
+
+func init() {
+	ciReleaseCmd.AddCommand(ciReleaseExecCmd)
+
+	ciReleaseExecCmd.Flags().String("release-name", "", "Release name")
+	ciReleaseExecCmd.Flags().String("namespace", "", "Project name (namespace, i.e. \"drupal-project\")")
+	ciReleaseExecCmd.Flags().String("component", "", "Release component or container name (i.e. php, shell), \"shell\" and \"php\" are tried by default")
+	ciReleaseExecCmd.Flags().Bool("no-tty", false, "Don't allocate a terminal")
+	ciReleaseExecCmd.Flags().BoolP("stdin", "i", false, "Pass stdin to the command (always passed with a terminal)")
+
+	ciReleaseExecCmd.MarkFlagRequired("release-name")
+	ciReleaseExecCmd.MarkFlagRequired("namespace")
+}
@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/wunderio/silta-cli/internal/common"
+)
+
+var ciReleaseFilesCmd = &cobra.Command{
+	Use:   "files",
+	Short: "Release volume file commands",
+	Long: `Copy files between a local directory and a directory on release persistent 
+volume (i.e. public files or reference data). Files are transferred with tar 
+through a ready release pod ("shell" or "php" component).
+
+	* "--include" and "--exclude" select files by glob patterns. A pattern 
+	matches relative file path, a parent directory or a path element (i.e. 
+	"*.log", "styles", "2024/*"). Can be repeated.
+
+	* "--resume" compares md5 checksums and skips files that are unchanged, 
+	so an interrupted transfer can be continued.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		fmt.Println(cmd.Usage())
+	},
+}
+
+func init() {
+	ciReleaseCmd.AddCommand(ciReleaseFilesCmd)
+}
+
+func addReleaseFilesFlags(cmd *cobra.Command) {
+	cmd.Flags().String("release-name", "", "Release name")
+	cmd.Flags().String("namespace", "", "Project name (namespace, i.e. \"drupal-project\")")
+	cmd.Flags().String("remote-path", "/app/web/sites/default/files", "Directory on release volume (i.e. \"/app/reference-data\")")
+	cmd.Flags().String("local-path", "", "Local directory")
+	cmd.Flags().StringArray("include", []string{}, "Only transfer files matching a glob pattern")
+	cmd.Flags().StringArray("exclude", []string{}, "Skip files matching a glob pattern")
+	cmd.Flags().Bool("resume", false, "Skip files with matching checksums")
+
+	cmd.MarkFlagRequired("release-name")
+	cmd.MarkFlagRequired("namespace")
+	cmd.MarkFlagRequired("local-path")
+}
+
+// releaseFilesOptions returns file transfer parameters, printing them in debug mode. False is returned in debug
+// mode, when transfer should not be executed.
+func releaseFilesOptions(cmd *cobra.Command, title string) (common.ReleaseFilesOptions, bool) {
+	releaseName, _ := cmd.Flags().GetString("release-name")
+	namespace, _ := cmd.Flags().GetString("namespace")
+	remotePath, _ := cmd.Flags().GetString("remote-path")
+	localPath, _ := cmd.Flags().GetString("local-path")
+	include, _ := cmd.Flags().GetStringArray("include")
+	exclude, _ := cmd.Flags().GetStringArray("exclude")
+	resume, _ := cmd.Flags().GetBool("resume")
+
+	if !strings.HasPrefix(remotePath, "/") {
+		log.Fatalf("Error: --remote-path must be absolute: %s", remotePath)
+	}
+	opts := common.ReleaseFilesOptions{
+		RemotePath: remotePath,
+		LocalPath:  localPath,
+		Filter:     common.FileFilter{Include: include, Exclude: exclude},
+		Resume:     resume,
+	}
+	if err := opts.Filter.Validate(); err != nil {
+		log.Fatalf("Error: %s", err)
+	}
+
+	if debug {
+		fmt.Printf(`%s (not executed):
+RELEASE_NAME: %s
+NAMESPACE: %s
+REMOTE_PATH: %s
+LOCAL_PATH: %s
+INCLUDE: %s
+EXCLUDE: %s
+RESUME: %t
+`, title, releaseName, namespace, remotePath, localPath, strings.Join(include, ", "), strings.Join(exclude, ", "), resume)
+		return opts, false
+	}
+	return opts, true
+}
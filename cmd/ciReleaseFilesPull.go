@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/spf13/cobra"
+	"github.com/wunderio/silta-cli/internal/common"
+)
+
+var ciReleaseFilesPullCmd = &cobra.Command{
+	Use:   "pull",
+	Short: "Copy files from release volume",
+	Long: `Copy files from a directory on release persistent volume to a local directory. 
+Existing local files are overwritten, files are not deleted. See "silta ci 
+release files" for patterns and resuming.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		releaseName, _ := cmd.Flags().GetString("release-name")
+		namespace, _ := cmd.Flags().GetString("namespace")
+
+		opts, execute := releaseFilesOptions(cmd, "Release files pull")
+		if !execute {
+			return
+		}
+
+		config, err := common.GetKubeConfig()
+		if err != nil {
+			log.Fatalf("failed to get kube config: %v", err)
+		}
+		clientset, err := common.GetKubeClient()
+		if err != nil {
+			log.Fatalf("failed to get kube client: %v", err)
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		err = common.PullReleaseFiles(ctx, config, clientset, namespace, releaseName, opts, os.Stderr)
+		if err != nil {
+			log.Fatalf("Error: %s", err)
+		}
+	},
+}
+
+func init() {
+	ciReleaseFilesCmd.AddCommand(ciReleaseFilesPullCmd)
+
+	addReleaseFilesFlags(ciReleaseFilesPullCmd)
+}
@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/spf13/cobra"
+	"github.com/wunderio/silta-cli/internal/common"
+)
+
+var ciReleaseFilesPushCmd = &cobra.Command{
+	Use:   "push",
+	Short: "Copy files to release volume",
+	Long: `Copy files from a local directory to a directory on release persistent volume. 
+Existing remote files are overwritten, files are not deleted. See "silta ci 
+release files" for patterns and resuming.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		releaseName, _ := cmd.Flags().GetString("release-name")
+		namespace, _ := cmd.Flags().GetString("namespace")
+
+		opts, execute := releaseFilesOptions(cmd, "Release files push")
+		if !execute {
+			return
+		}
+
+		config, err := common.GetKubeConfig()
+		if err != nil {
+			log.Fatalf("failed to get kube config: %v", err)
+		}
+		clientset, err := common.GetKubeClient()
+		if err != nil {
+			log.Fatalf("failed to get kube client: %v", err)
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		err = common.PushReleaseFiles(ctx, config, clientset, namespace, releaseName, opts, os.Stderr)
+		if err != nil {
+			log.Fatalf("Error: %s", err)
+		}
+	},
+}
+
+func init() {
+	ciReleaseFilesCmd.AddCommand(ciReleaseFilesPushCmd)
+
+	addReleaseFilesFlags(ciReleaseFilesPushCmd)
+}
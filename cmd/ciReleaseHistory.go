@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/wunderio/silta-cli/internal/common"
+	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp" // gcp auth provider
+)
+
+var ciReleaseHistoryCmd = &cobra.Command{
+	Use:   "history",
+	Short: "List release revisions",
+	Long: `List all release revisions with status, chart version, deploy time and description.
+Required flags: "--release-name" and "--namespace".
+
+	* "--diff values" prints a diff of computed release values (chart defaults
+	merged with release values) between two revisions.
+
+	* "--diff manifest" prints a diff of rendered release manifests between two
+	revisions.
+
+	* Revisions are selected with "--from-revision" and "--to-revision". By
+	default the latest revision is compared to the one before it. Zero and
+	negative numbers are relative to the latest revision (i.e. -1 is the
+	revision before the latest).
+	`,
+	Run: func(cmd *cobra.Command, args []string) {
+		releaseName, _ := cmd.Flags().GetString("release-name")
+		namespace, _ := cmd.Flags().GetString("namespace")
+		diff, _ := cmd.Flags().GetString("diff")
+		fromRevision, _ := cmd.Flags().GetInt("from-revision")
+		toRevision, _ := cmd.Flags().GetInt("to-revision")
+
+		if diff != "" && diff != "values" && diff != "manifest" {
+			log.Fatalf("Unknown diff type: %s (supported: values, manifest)", diff)
+		}
+
+		if debug {
+			diffType := diff
+			if diffType == "" {
+				diffType = "none"
+			}
+			fmt.Printf(`Helm release history (not executed):
+RELEASE_NAME: %s
+NAMESPACE: %s
+DIFF: %s
+FROM_REVISION: %d
+TO_REVISION: %d
+`, releaseName, namespace, diffType, fromRevision, toRevision)
+			return
+		}
+
+		_, actionConfig, err := common.InitHelmActionConfig(namespace, common.HelmQuietLog)
+		if err != nil {
+			log.Fatalf("%+v", err)
+		}
+
+		history, err := common.ReleaseHistory(actionConfig, releaseName)
+		if err != nil {
+			log.Fatalf("Error: %s", err)
+		}
+
+		if diff == "" {
+			common.PrintReleaseHistory(os.Stdout, history)
+			return
+		}
+
+		from, err := common.ReleaseRevision(history, fromRevision)
+		if err != nil {
+			log.Fatalf("Error: %s", err)
+		}
+		to, err := common.ReleaseRevision(history, toRevision)
+		if err != nil {
+			log.Fatalf("Error: %s", err)
+		}
+
+		output, err := common.DiffReleaseRevisions(from, to, diff)
+		if err != nil {
+			log.Fatalf("Error: %s", err)
+		}
+		if output == "" {
+			fmt.Printf("No %s changes between revisions %d and %d\n", diff, from.Version, to.Version)
+			return
+		}
+		fmt.Print(output)
+	},
+}
+
+func init() {
+	ciReleaseCmd.AddCommand(ciReleaseHistoryCmd)
+
+	ciReleaseHistoryCmd.Flags().String("release-name", "", "Release name")
+	ciReleaseHistoryCmd.Flags().String("namespace", "", "Project name (namespace, i.e. \"drupal-project\")")
+	ciReleaseHistoryCmd.Flags().String("diff", "", "Diff revisions (values, manifest)")
+	ciReleaseHistoryCmd.Flags().Int("from-revision", -1, "Revision to diff from (default: revision before the latest)")
+	ciReleaseHistoryCmd.Flags().Int("to-revision", 0, "Revision to diff to (default: latest revision)")
+
+	ciReleaseHistoryCmd.MarkFlagRequired("release-name")
+	ciReleaseHistoryCmd.MarkFlagRequired("namespace")
+}
@@ -0,0 +1,141 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/wunderio/silta-cli/internal/common"
+	"k8s.io/client-go/kubernetes"
+	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp" // gcp auth provider
+)
+
+var ciReleaseIdleReportCmd = &cobra.Command{
+	Use:   "idle-report",
+	Short: "Report idle releases",
+	Long: `List releases that have not been deployed or touched in a while, and
+optionally downscale them. Designed to be run by a cluster cronjob.
+
+	* Release activity is the latest of helm deploy time, finished deployment
+	rollouts (i.e. scaling), pod starts and ingress changes. Container restarts
+	and cron job pods are not activity.
+
+	* Idle policy is read from silta configuration store:
+	  silta config set idle-policy.max-idle-days 14
+	  silta config set idle-policy.excluded-branches main,production,release/*
+	Releases of excluded branches are never idle. Flags "--max-idle-days" and
+	"--excluded-branches" override the stored policy.
+
+	* With "--downscale" flag idle releases are downscaled the same way as
+	with "silta ci release downscale", so they can be restored with
+	"silta ci release wakeup".
+	`,
+	Run: func(cmd *cobra.Command, args []string) {
+		namespace, _ := cmd.Flags().GetString("namespace")
+		allNamespaces, _ := cmd.Flags().GetBool("all-namespaces")
+		downscale, _ := cmd.Flags().GetBool("downscale")
+		placeholderHost, _ := cmd.Flags().GetString("placeholder-host")
+		concurrency, _ := cmd.Flags().GetInt("concurrency")
+
+		if allNamespaces {
+			namespace = ""
+		}
+
+		policy, err := common.IdlePolicyFromConfig(common.ConfigStore())
+		if err != nil {
+			log.Fatalf("Error: %s", err)
+		}
+		if cmd.Flags().Changed("max-idle-days") {
+			policy.MaxIdleDays, _ = cmd.Flags().GetInt("max-idle-days")
+		}
+		if cmd.Flags().Changed("excluded-branches") {
+			excludedBranches, _ := cmd.Flags().GetString("excluded-branches")
+			policy.ExcludedBranches = common.SplitBranchList(excludedBranches)
+		}
+		if policy.MaxIdleDays < 1 {
+			log.Fatal("Error: max idle days has to be a positive number")
+		}
+
+		if debug {
+			if len(namespace) == 0 {
+				namespace = "(all namespaces)"
+			}
+			fmt.Printf(`Release idle report (not executed):
+NAMESPACE: %s
+MAX_IDLE_DAYS: %d
+EXCLUDED_BRANCHES: %s
+DOWNSCALE: %t
+`, namespace, policy.MaxIdleDays, strings.Join(policy.ExcludedBranches, ","), downscale)
+			return
+		}
+
+		clientset, err := common.GetKubeClient()
+		if err != nil {
+			log.Fatalf("failed to get kube client: %v", err)
+		}
+
+		_, actionConfig, err := common.InitHelmActionConfig(namespace, common.HelmQuietLog)
+		if err != nil {
+			log.Fatalf("%+v", err)
+		}
+		releases, err := common.ListHelmReleases(actionConfig, namespace)
+		if err != nil {
+			log.Fatalf("Error: %s", err)
+		}
+
+		reports, err := common.ReleaseIdleReport(context.TODO(), clientset, releases, policy, time.Now())
+		if err != nil {
+			log.Fatalf("Error: %s", err)
+		}
+		common.PrintIdleReport(os.Stdout, reports)
+
+		if !downscale {
+			return
+		}
+
+		idleReleases := []common.ReleaseRef{}
+		for _, r := range reports {
+			if r.State == common.ReleaseIdle {
+				idleReleases = append(idleReleases, r.Release)
+			}
+		}
+		if len(idleReleases) == 0 {
+			fmt.Println("\nNo idle releases to downscale")
+			return
+		}
+
+		fmt.Println()
+		results := common.RunReleaseBatch(context.TODO(), clientset, idleReleases, concurrency, os.Stdout,
+			func(ctx context.Context, clientset kubernetes.Interface, release common.ReleaseRef, out io.Writer) (string, error) {
+				return "", common.DownscaleRelease(ctx, clientset, release.Namespace, release.Name, placeholderHost, out)
+			})
+		fmt.Println()
+		common.PrintReleaseBatchSummary(os.Stdout, results)
+
+		for _, r := range results {
+			if r.Err != nil {
+				os.Exit(1)
+			}
+		}
+	},
+}
+
+func init() {
+	ciReleaseCmd.AddCommand(ciReleaseIdleReportCmd)
+
+	ciReleaseIdleReportCmd.Flags().String("namespace", "", "Project name (namespace, i.e. \"drupal-project\")")
+	ciReleaseIdleReportCmd.Flags().Bool("all-namespaces", false, "Report releases in all namespaces, except kube-system and silta-cluster")
+	ciReleaseIdleReportCmd.Flags().Int("max-idle-days", common.DefaultIdlePolicy.MaxIdleDays, "Days without activity after which a release is idle (overrides idle-policy.max-idle-days)")
+	ciReleaseIdleReportCmd.Flags().String("excluded-branches", strings.Join(common.DefaultIdlePolicy.ExcludedBranches, ","), "Comma separated branch name patterns that are never idle (overrides idle-policy.excluded-branches)")
+	ciReleaseIdleReportCmd.Flags().Bool("downscale", false, "Downscale idle releases")
+	ciReleaseIdleReportCmd.Flags().String("placeholder-host", "silta-downscaler.silta-cluster.svc.cluster.local", "Placeholder host services of downscaled releases are redirected to")
+	ciReleaseIdleReportCmd.Flags().Int("concurrency", 5, "Number of releases downscaled at the same time")
+
+	ciReleaseIdleReportCmd.MarkFlagsOneRequired("namespace", "all-namespaces")
+	ciReleaseIdleReportCmd.MarkFlagsMutuallyExclusive("namespace", "all-namespaces")
+}
@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"regexp"
+	"syscall"
+
+	"github.com/spf13/cobra"
+	"github.com/wunderio/silta-cli/internal/common"
+	"golang.org/x/term"
+)
+
+var ciReleaseLogsCmd = &cobra.Command{
+	Use:   "logs",
+	Short: "Show logs of all release pods",
+	Long: `Show logs of all release pod containers (selected by "release" and 
+"app.kubernetes.io/instance" labels) at once. Each line is prefixed with pod 
+and container name, prefixes are colored when output is a terminal.
+
+	* "--component" limits logs to containers or release components, 
+	i.e. "php", "nginx", "shell" or "cron" (cronjob pods). Can be repeated 
+	or comma separated.
+
+	* "--since" only shows logs newer than a duration (i.e. "30m"), 
+	"--previous" shows logs of previous (restarted) container instances.
+
+	* "--grep" only shows lines matching a regular expression.
+
+	* "--follow" keeps streaming logs until interrupted. Containers of new 
+	pods are picked up as they start (i.e. during a rollout).
+	`,
+	Run: func(cmd *cobra.Command, args []string) {
+		releaseName, _ := cmd.Flags().GetString("release-name")
+		namespace, _ := cmd.Flags().GetString("namespace")
+		components, _ := cmd.Flags().GetStringSlice("component")
+		since, _ := cmd.Flags().GetDuration("since")
+		previous, _ := cmd.Flags().GetBool("previous")
+		grep, _ := cmd.Flags().GetString("grep")
+		follow, _ := cmd.Flags().GetBool("follow")
+		noColor, _ := cmd.Flags().GetBool("no-color")
+
+		opts := common.ReleaseLogOptions{
+			Components: components,
+			Since:      since,
+			Previous:   previous,
+			Follow:     follow,
+			Color:      !noColor && term.IsTerminal(int(os.Stdout.Fd())),
+		}
+		if len(grep) > 0 {
+			pattern, err := regexp.Compile(grep)
+			if err != nil {
+				log.Fatalf("Error: invalid --grep pattern: %s", err)
+			}
+			opts.Grep = pattern
+		}
+		if since < 0 {
+			log.Fatalf("Error: invalid --since value: %s", since)
+		}
+		if previous && follow {
+			log.Fatal("Error: --previous can't be used with --follow")
+		}
+
+		clientset, err := common.GetKubeClient()
+		if err != nil {
+			log.Fatalf("failed to get kube client: %v", err)
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		err = common.StreamReleaseLogs(ctx, clientset, namespace, releaseName, opts, os.Stdout)
+		if err != nil {
+			log.Fatalf("Error: %s", err)
+		}
+	},
+}
+
+func init() {
+	ciReleaseCmd.AddCommand(ciReleaseLogsCmd)
+
+	ciReleaseLogsCmd.Flags().String("release-name", "", "Release name")
+	ciReleaseLogsCmd.Flags().String("namespace", "", "Project name (namespace, i.e. \"drupal-project\")")
+	ciReleaseLogsCmd.Flags().StringSlice("component", []string{}, "Release components or container names (i.e. php, nginx, shell, cron)")
+	ciReleaseLogsCmd.Flags().Duration("since", 0, "Only show logs newer than this duration (i.e. 30m)")
+	ciReleaseLogsCmd.Flags().Bool("previous", false, "Show logs of previous container instances")
+	ciReleaseLogsCmd.Flags().String("grep", "", "Only show lines matching a regular expression")
+	ciReleaseLogsCmd.Flags().Bool("follow", false, "Stream logs until interrupted")
+	ciReleaseLogsCmd.Flags().Bool("no-color", false, "Disable colored output")
+
+	ciReleaseLogsCmd.MarkFlagRequired("release-name")
+	ciReleaseLogsCmd.MarkFlagRequired("namespace")
+}
@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/wunderio/silta-cli/internal/common"
+)
+
+var ciReleaseRestartCmd = &cobra.Command{
+	Use:   "restart",
+	Short: "Restart release pods",
+	Long: `Restart pods of release deployments and statefulsets (selected by "release" 
+and "app.kubernetes.io/instance" labels) with a rolling update, same as 
+"kubectl rollout restart", and wait for the rollout to complete.
+
+	* "--component" only restarts workloads of a component. Component matches 
+	workload "<release-name>-<component>" or a container name (i.e. "php" 
+	restarts the deployment with php container).
+	`,
+	Run: func(cmd *cobra.Command, args []string) {
+		releaseName, _ := cmd.Flags().GetString("release-name")
+		namespace, _ := cmd.Flags().GetString("namespace")
+		component, _ := cmd.Flags().GetString("component")
+		timeout, _ := cmd.Flags().GetDuration("timeout")
+
+		if debug {
+			fmt.Printf(`Release restart (not executed):
+RELEASE_NAME: %s
+NAMESPACE: %s
+COMPONENT: %s
+`, releaseName, namespace, component)
+			return
+		}
+
+		clientset, err := common.GetKubeClient()
+		if err != nil {
+			log.Fatalf("failed to get kube client: %v", err)
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		workloads, err := common.ReleaseWorkloads(ctx, clientset, namespace, releaseName, component)
+		if err != nil {
+			log.Fatalf("Error: %s", err)
+		}
+		existingPods, err := common.ListExistingPods(ctx, clientset, namespace, releaseName)
+		if err != nil {
+			log.Fatalf("Error: %s", err)
+		}
+		err = common.RestartReleaseWorkloads(ctx, clientset, workloads, time.Now(), os.Stdout)
+		if err != nil {
+			log.Fatalf("Error: %s", err)
+		}
+		err = common.WaitForWorkloadRollouts(ctx, clientset, namespace, releaseName, "", workloads, existingPods, timeout, os.Stdout)
+		if err != nil {
+			log.Fatalf("Error: %s", err)
+		}
+	},
+}
+
+func init() {
+	ciReleaseCmd.AddCommand(ciReleaseRestartCmd)
+
+	ciReleaseRestartCmd.Flags().String("release-name", "", "Release name")
+	ciReleaseRestartCmd.Flags().String("namespace", "", "Project name (namespace, i.e. \"drupal-project\")")
+	ciReleaseRestartCmd.Flags().String("component", "", "Release component or container name (i.e. php, shell)")
+	ciReleaseRestartCmd.Flags().Duration("timeout", 5*time.Minute, "Rollout timeout of each workload")
+
+	ciReleaseRestartCmd.MarkFlagRequired("release-name")
+	ciReleaseRestartCmd.MarkFlagRequired("namespace")
+}
@@ -0,0 +1,120 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/wunderio/silta-cli/internal/common"
+)
+
+var ciReleaseRollbackCmd = &cobra.Command{
+	Use:   "rollback",
+	Short: "Roll back a release",
+	Long: `Roll back a release to a previous revision. Required flags: "--release-name" and "--namespace".
+
+	* Release is rolled back to the last successfully deployed revision
+	unless "--revision" is specified. Revisions can be listed with
+	"silta ci release history".
+
+	* Rollout is awaited and checked the same way as in release deployment,
+	rollback fails right away when a pod it creates is stuck in 
+	CrashLoopBackOff or ImagePullBackOff state. Failures are diagnosed with 
+	debug-failed checks.
+
+	* Release notes are printed after a successful rollback.
+	`,
+	Run: func(cmd *cobra.Command, args []string) {
+		releaseName, _ := cmd.Flags().GetString("release-name")
+		namespace, _ := cmd.Flags().GetString("namespace")
+		revision, _ := cmd.Flags().GetInt("revision")
+		timeout, _ := cmd.Flags().GetString("timeout")
+
+		timeoutDuration, err := time.ParseDuration(timeout)
+		if err != nil {
+			log.Println("Invalid timeout duration, using default 15m.")
+			timeoutDuration = 15 * time.Minute
+		}
+
+		rollback := common.HelmReleaseRollback{
+			ReleaseName: releaseName,
+			Revision:    revision,
+			Timeout:     timeoutDuration,
+			Wait:        true,
+		}
+
+		if debug {
+			targetRevision := "last successful"
+			if revision > 0 {
+				targetRevision = strconv.Itoa(revision)
+			}
+			fmt.Printf(`Helm release rollback (not executed):
+RELEASE_NAME: %s
+NAMESPACE: %s
+REVISION: %s
+TIMEOUT: %s
+`, releaseName, namespace, targetRevision, timeoutDuration)
+			return
+		}
+
+		clientset, err := common.GetKubeClient()
+		if err != nil {
+			log.Fatalf("failed to get kube client: %v", err)
+		}
+
+		_, actionConfig, err := common.InitHelmActionConfig(namespace, common.HelmQuietLog)
+		if err != nil {
+			log.Fatalf("%+v", err)
+		}
+
+		// Existing pods (i.e. crash-looping pods of the current revision) are replaced by the rollout, pods created by
+		// the rollback fail it right away when they are stuck
+		existingPods, err := common.ListExistingPods(context.Background(), clientset, namespace, releaseName)
+		if err != nil {
+			log.Fatalf("Error: %s", err)
+		}
+		release, err := common.RunReleaseRollback(context.Background(), clientset, actionConfig, namespace, rollback, existingPods, os.Stdout)
+		if err != nil {
+			fmt.Printf("Error: release rollback failed: %s\n", err)
+			debugFailedRelease(clientset, namespace, releaseName)
+			os.Exit(1)
+		}
+
+		fmt.Printf("Release %q has been rolled back. Revision: %d, status: %s\n", release.Name, release.Version, release.Info.Status)
+
+		// Readiness checks of the chart that was rolled back to
+		if release.Chart != nil && release.Chart.Metadata != nil {
+			chartProfile := releaseChartProfile(cmd, release.Chart.Metadata.Name)
+			if chartProfile != nil && chartProfile.Readiness().Rollout {
+				err = common.WaitForReleaseRollout(clientset, namespace, releaseName, existingPods, 5*time.Minute, os.Stdout)
+				if err != nil {
+					fmt.Printf("Error: %s\n", err)
+					debugFailedRelease(clientset, namespace, releaseName)
+					os.Exit(1)
+				}
+			}
+		}
+
+		// Release notes, same as "helm get notes"
+		if len(release.Info.Notes) > 0 {
+			fmt.Printf("NOTES:\n%s\n", release.Info.Notes)
+		}
+	},
+}
+
+func init() {
+	ciReleaseCmd.AddCommand(ciReleaseRollbackCmd)
+
+	ciReleaseRollbackCmd.Flags().String("release-name", "", "Release name")
+	ciReleaseRollbackCmd.Flags().String("namespace", "", "Project name (namespace, i.e. \"drupal-project\")")
+	ciReleaseRollbackCmd.Flags().Int("revision", 0, "Release revision to roll back to (default: last successful revision)")
+	ciReleaseRollbackCmd.Flags().String("timeout", "15m", "Rollback timeout")
+	ciReleaseRollbackCmd.Flags().String("chart-profile", "", "Chart profile files (comma separated list of YAML files)")
+
+	ciReleaseRollbackCmd.MarkFlagRequired("release-name")
+	ciReleaseRollbackCmd.MarkFlagRequired("namespace")
+}
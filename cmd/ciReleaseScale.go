@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/wunderio/silta-cli/internal/common"
+)
+
+var ciReleaseScaleCmd = &cobra.Command{
+	Use:   "scale",
+	Short: "Scale release component",
+	Long: `Scale deployments and statefulsets of a release component (i.e. for a load 
+test) and wait for the rollout to complete. Component matches workload 
+"<release-name>-<component>" or a container name (i.e. "php").
+
+	* Replica count before the first scale is stored in "silta/original-replicas" 
+	annotation, "--revert" restores it. Stored replica count is discarded when 
+	replica count was changed after scaling (i.e. release was deployed since).
+
+	* Workloads scaled by a horizontal pod autoscaler are not scaled.
+	`,
+	Run: func(cmd *cobra.Command, args []string) {
+		releaseName, _ := cmd.Flags().GetString("release-name")
+		namespace, _ := cmd.Flags().GetString("namespace")
+		component, _ := cmd.Flags().GetString("component")
+		replicas, _ := cmd.Flags().GetInt32("replicas")
+		revert, _ := cmd.Flags().GetBool("revert")
+		timeout, _ := cmd.Flags().GetDuration("timeout")
+
+		if revert == cmd.Flags().Changed("replicas") {
+			log.Fatal("Error: either --replicas or --revert is required")
+		}
+		if replicas < 0 {
+			log.Fatalf("Error: invalid --replicas value: %d", replicas)
+		}
+
+		if debug {
+			target := strconv.Itoa(int(replicas))
+			if revert {
+				target = "original"
+			}
+			fmt.Printf(`Release scale (not executed):
+RELEASE_NAME: %s
+NAMESPACE: %s
+COMPONENT: %s
+REPLICAS: %s
+`, releaseName, namespace, component, target)
+			return
+		}
+
+		clientset, err := common.GetKubeClient()
+		if err != nil {
+			log.Fatalf("failed to get kube client: %v", err)
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		workloads, err := common.ReleaseWorkloads(ctx, clientset, namespace, releaseName, component)
+		if err != nil {
+			log.Fatalf("Error: %s", err)
+		}
+		var target *int32
+		if !revert {
+			target = &replicas
+		}
+		existingPods, err := common.ListExistingPods(ctx, clientset, namespace, releaseName)
+		if err != nil {
+			log.Fatalf("Error: %s", err)
+		}
+		scaled, err := common.ScaleReleaseWorkloads(ctx, clientset, workloads, target, os.Stdout)
+		if err != nil {
+			log.Fatalf("Error: %s", err)
+		}
+		if len(scaled) == 0 {
+			fmt.Println("Nothing to revert")
+			return
+		}
+		err = common.WaitForWorkloadRollouts(ctx, clientset, namespace, releaseName, "", scaled, existingPods, timeout, os.Stdout)
+		if err != nil {
+			log.Fatalf("Error: %s", err)
+		}
+	},
+}
+
+func init() {
+	ciReleaseCmd.AddCommand(ciReleaseScaleCmd)
+
+	ciReleaseScaleCmd.Flags().String("release-name", "", "Release name")
+	ciReleaseScaleCmd.Flags().String("namespace", "", "Project name (namespace, i.e. \"drupal-project\")")
+	ciReleaseScaleCmd.Flags().String("component", "", "Release component or container name (i.e. php, shell)")
+	ciReleaseScaleCmd.Flags().Int32("replicas", 0, "Replica count")
+	ciReleaseScaleCmd.Flags().Bool("revert", false, "Restore replica count from before scaling")
+	ciReleaseScaleCmd.Flags().Duration("timeout", 5*time.Minute, "Rollout timeout of each workload")
+
+	ciReleaseScaleCmd.MarkFlagRequired("release-name")
+	ciReleaseScaleCmd.MarkFlagRequired("namespace")
+	ciReleaseScaleCmd.MarkFlagRequired("component")
+}
@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/wunderio/silta-cli/internal/common"
+	helmRelease "helm.sh/helm/v3/pkg/release"
+)
+
+var ciReleaseSupportBundleCmd = &cobra.Command{
+	Use:   "support-bundle",
+	Short: "Collect release diagnostics into a tarball",
+	Long: `Collect release diagnostics into a single .tar.gz file that can be uploaded as 
+a CI artifact or attached to a ticket. Bundle contains:
+
+	* helm release manifest and values of the latest revision (helm/)
+	* release resources as yaml (resources/<kind>/<name>.yaml)
+	* events of release resources (events.txt)
+	* current and previous container logs (logs/<pod>/<container>.log)
+	* debug-failed report (debug-failed.json, debug-failed.md)
+	* index.json listing bundle contents and parts that could not be collected
+
+	Secret data, release values, ConfigMap values and container environment 
+	values of sensitive keys (passwords, secrets, tokens, keys) are redacted.
+	`,
+	Run: func(cmd *cobra.Command, args []string) {
+		releaseName, _ := cmd.Flags().GetString("release-name")
+		namespace, _ := cmd.Flags().GetString("namespace")
+		outputFile, _ := cmd.Flags().GetString("output-file")
+
+		if len(outputFile) == 0 {
+			outputFile = releaseName + "-support-bundle.tar.gz"
+		}
+
+		if debug {
+			fmt.Printf(`Release support bundle (not executed):
+RELEASE_NAME: %s
+NAMESPACE: %s
+OUTPUT_FILE: %s
+`, releaseName, namespace, outputFile)
+			return
+		}
+
+		clientset, err := common.GetKubeClient()
+		if err != nil {
+			log.Fatalf("failed to get kube client: %v", err)
+		}
+
+		_, actionConfig, err := common.InitHelmActionConfig(namespace, common.HelmQuietLog)
+		if err != nil {
+			log.Fatalf("%+v", err)
+		}
+
+		// Latest revision, including failed ones
+		var release *helmRelease.Release
+		history, err := common.ReleaseHistory(actionConfig, releaseName)
+		if err == nil {
+			release, _ = common.ReleaseRevision(history, 0)
+		}
+
+		bundle := common.CollectSupportBundle(context.TODO(), clientset, namespace, releaseName, release, time.Now())
+
+		file, err := os.Create(outputFile)
+		if err != nil {
+			log.Fatalf("Error: %s", err)
+		}
+		err = bundle.WriteArchive(file)
+		if err != nil {
+			file.Close()
+			log.Fatalf("Error: cannot write support bundle: %s", err)
+		}
+		err = file.Close()
+		if err != nil {
+			log.Fatalf("Error: %s", err)
+		}
+
+		for _, e := range bundle.Index.Errors {
+			fmt.Printf("Warning: %s\n", e)
+		}
+		fmt.Printf("Support bundle with %d files written to %s\n", len(bundle.Index.Files)+1, outputFile)
+	},
+}
+
+func init() {
+	ciReleaseCmd.AddCommand(ciReleaseSupportBundleCmd)
+
+	ciReleaseSupportBundleCmd.Flags().String("release-name", "", "Release name")
+	ciReleaseSupportBundleCmd.Flags().String("namespace", "", "Project name (namespace, i.e. \"drupal-project\")")
+	ciReleaseSupportBundleCmd.Flags().String("output-file", "", "Output file location (default: <release-name>-support-bundle.tar.gz)")
+
+	ciReleaseSupportBundleCmd.MarkFlagRequired("release-name")
+	ciReleaseSupportBundleCmd.MarkFlagRequired("namespace")
+}
@@ -1,21 +1,42 @@
 package cmd
 
 import (
-	"bufio"
 	"fmt"
 	"log"
 	"os"
-	"os/exec"
 	"strings"
 
 	"github.com/spf13/cobra"
 	"github.com/wunderio/silta-cli/internal/common"
+	helmAction "helm.sh/helm/v3/pkg/action"
+	helmCli "helm.sh/helm/v3/pkg/cli"
 )
 
 // ciReleaseValidateCmd represents the ciReleaseValidate command
 var ciReleaseValidateCmd = &cobra.Command{
 	Use:   "validate",
 	Short: "Validate release",
+	Long: `Validate release configuration before deploying it.
+
+	* Release values (silta configuration files, chart configuration overrides
+	and release parameters with placeholder images) are validated against the
+	chart values.schema.json. Errors point to the file, line and column of the
+	offending value.
+
+	* Keys of silta configuration files and chart configuration overrides that
+	are neither in chart default values nor in the chart schema (i.e. "ngnix"
+	instead of "nginx") are reported with suggestions of similar known keys.
+	Unknown keys are warnings, with "--strict" flag they fail validation.
+
+	* Chart templates are rendered without cluster access, the same way as
+	"helm template" does.
+
+	* Charts are loaded from "--chart-path", extended chart folder or chart
+	repository, in that order. With "--offline" flag the chart has to be
+	available locally, so validation can be run before pushing changes.
+
+	* Cluster and existing releases are not accessed or changed.
+	`,
 	Run: func(cmd *cobra.Command, args []string) {
 
 		releaseName, _ := cmd.Flags().GetString("release-name")
@@ -30,6 +51,10 @@ var ciReleaseValidateCmd = &cobra.Command{
 		vpnIP, _ := cmd.Flags().GetString("vpn-ip")
 		vpcNative, _ := cmd.Flags().GetString("vpc-native")
 		clusterType, _ := cmd.Flags().GetString("cluster-type")
+		clusterDomain, _ := cmd.Flags().GetString("cluster-domain")
+		chartPath, _ := cmd.Flags().GetString("chart-path")
+		offline, _ := cmd.Flags().GetBool("offline")
+		strict, _ := cmd.Flags().GetBool("strict")
 
 		// Use environment variables as fallback
 		if useEnv {
@@ -48,174 +73,148 @@ var ciReleaseValidateCmd = &cobra.Command{
 			if len(clusterType) == 0 {
 				clusterType = os.Getenv("CLUSTER_TYPE")
 			}
+			if len(clusterDomain) == 0 {
+				clusterDomain = os.Getenv("CLUSTER_DOMAIN")
+			}
 		}
 
+		chartProfile := releaseChartProfile(cmd, chartName)
+
 		// Uses PrependChartConfigOverrides from "SILTA_<CHART_NAME>_CONFIG_VALUES"
 		// environment variable and prepends it to configuration
 		chartOverrideFile := common.CreateChartConfigurationFile(chartName)
+		chartOverrideVariable := "SILTA_" + strings.ToUpper(strings.ReplaceAll(common.GetChartName(chartName), "-", "_")) + "_CONFIG_VALUES"
 		if chartOverrideFile != "" {
 			defer os.Remove(chartOverrideFile)
 			siltaConfig = common.PrependChartConfigOverrides(chartOverrideFile, siltaConfig)
 		}
 
-		// Chart value overrides
-
-		// Allow pinning a specific chart version
-		chartVersionOverride := ""
-		if len(chartVersion) > 0 {
-			chartVersionOverride = fmt.Sprintf("--version '%s'", chartVersion)
-		}
-		// Skip basic auth for internal VPN if defined in environment
-		extraNoAuthIPs := ""
-		if len(vpnIP) > 0 {
-			extraNoAuthIPs = fmt.Sprintf("--set nginx.noauthips.vpn='%s/32'", vpnIP)
+		if chartProfile == nil {
+			fmt.Print(unknownChartMessage(chartName, "helm validation"))
+			return
 		}
 
-		// Pass VPC-native setting if defined in environment
-		vpcNativeOverride := ""
-		if len(vpcNative) > 0 {
-			vpcNativeOverride = fmt.Sprintf("--set cluster.vpcNative='%s'", vpcNative)
+		// Placeholder images are used for validation
+		images := map[string]string{}
+		for _, image := range chartProfile.RequiredImages() {
+			images[image.Identifier] = "test:test"
 		}
 
-		// Add cluster type if defined in environment
-		extraClusterType := ""
-		if len(clusterType) > 0 {
-			extraClusterType = fmt.Sprintf("--set cluster.type='%s'", clusterType)
+		// Chart value overrides
+		values, err := common.ChartReleaseValues(chartProfile, common.ReleaseParameters{
+			ReleaseName:     releaseName,
+			Namespace:       namespace,
+			EnvironmentName: siltaEnvironmentName,
+			BranchName:      branchname,
+			ClusterDomain:   clusterDomain,
+			ClusterType:     clusterType,
+			VpcNative:       vpcNative,
+			VpnIP:           vpnIP,
+			Images:          images,
+		})
+		if err != nil {
+			log.Fatalf("Error: %s", err)
 		}
 
-		//Remove release stuck in pending stage
-		command := fmt.Sprintf(`
-			NAMESPACE='%s'
-			RELEASE_NAME='%s'
-
-			# Workaround for previous Helm release stuck in pending state
-			echo "Looking for and deleting malformed secrets"
-			pending_release=$(helm list -n "$NAMESPACE" --pending --filter="(\s|^)($RELEASE_NAME)(\s|$)"| tail -1 | cut -f1)
+		if len(chartPath) == 0 {
+			chartPath = common.ChartPath(chartProfile, chartName)
+		}
+		_, errLocal := os.Stat(chartPath)
+		if offline && errLocal != nil {
+			log.Fatalf("Chart %s is not available locally, offline validation requires a chart directory (--chart-path or extended chart folder)", chartPath)
+		}
 
-			if [[ "$pending_release" == "$RELEASE_NAME" ]]; then
-				upgrade_secret_to_delete=$(kubectl get secret -l owner=helm,status=pending-upgrade,name="$RELEASE_NAME" -n "$NAMESPACE" --no-headers | awk '{print $1}')
-				install_secret_to_delete=$(kubectl get secret -l owner=helm,status=pending-install,name="$RELEASE_NAME" -n "$NAMESPACE" --no-headers | awk '{print $1}')
-				
-				if [[ ! -z "$upgrade_secret_to_delete" ]] ; then
-					kubectl delete secret -n "$NAMESPACE" "$upgrade_secret_to_delete" || true
-				fi
-				if [[ ! -z "$install_secret_to_delete" ]] ; then
-					kubectl delete secret -n "$NAMESPACE" "$install_secret_to_delete" || true
-				fi
-			fi
-			`, namespace, releaseName)
+		valueFiles := common.ChartValueFiles(siltaConfig)
+
+		if debug {
+			fmt.Printf(`Helm release validation (not executed):
+RELEASE_NAME: %s
+NAMESPACE: %s
+CHART: %s
+CHART_VERSION: %s
+VALUE_FILES: %s
+OFFLINE: %t
+STRICT: %t
+`, releaseName, namespace, chartPath, chartVersion, strings.Join(valueFiles, ","), offline, strict)
+			return
+		}
 
-		pipedExec(command, "", "ERROR: ", debug)
+		settings := helmCli.New()
+		settings.SetNamespace(namespace)
+		chartPathOptions := helmAction.ChartPathOptions{RepoURL: chartRepository, Version: chartVersion}
+		chart, err := common.LoadHelmChart(settings, &chartPathOptions, chartPath)
+		if err != nil {
+			log.Fatalf("Error: %s", err)
+		}
 
-		if chartName == "drupal" || strings.HasSuffix(chartName, "/drupal") {
+		fmt.Printf("Validating %s helm release %s in %s namespace\n", chartPath, releaseName, namespace)
 
-			// Add helm repositories
-			command := fmt.Sprintf("helm repo add '%s' '%s'", "wunderio", chartRepository)
-			exec.Command("bash", "-c", command).Run()
+		// Values sources in order of precedence, used to point validation errors to configuration files
+		fileSources := []common.ValuesSource{}
+		for _, file := range valueFiles {
+			name := file
+			if file == chartOverrideFile {
+				name = chartOverrideVariable
+			}
+			source, err := common.ValuesFileSource(name, file)
+			if err != nil {
+				log.Fatalf("Error: %s", err)
+			}
+			fileSources = append(fileSources, source)
+		}
+		releaseSource, err := common.ValuesMapSource("release parameters", values)
+		if err != nil {
+			log.Fatalf("Error: %s", err)
+		}
+		sources := append(append([]common.ValuesSource{}, fileSources...), releaseSource)
 
-			// Make sure repositories are up to date
-			command = "helm repo update"
-			exec.Command("bash", "-c", command).Run()
+		releaseValues, err := common.ComputeReleaseValues(settings, valueFiles, values, "")
+		if err != nil {
+			log.Fatalf("Error: %s", err)
+		}
 
-			_, errDir := os.Stat(common.ExtendedFolder + "/drupal")
-			if os.IsNotExist(errDir) == false {
-				chartName = common.ExtendedFolder + "/drupal"
-			}
+		// Keys that are not used by the chart (i.e. typos), checked before disabled subcharts are dropped
+		unknownKeys, err := common.UnknownValueKeys(chart, fileSources, chartProfile.OpenValues())
+		if err != nil {
+			log.Fatalf("Error: %s", err)
+		}
 
-			fmt.Printf("Deploying %s helm release %s in %s namespace\n", chartName, releaseName, namespace)
-
-			// TODO: rewrite the timeout handling and log printing after helm release
-			command = fmt.Sprintf(`
-			set -Eeuo pipefail
-
-			RELEASE_NAME='%s'
-			CHART_NAME='%s'
-			CHART_REPOSITORY='%s'
-			EXTRA_CHART_VERSION='%s'
-			SILTA_ENVIRONMENT_NAME='%s'
-			BRANCHNAME='%s'
-			NAMESPACE='%s'
-			SILTA_CONFIG='%s'
-			EXTRA_NOAUTHIPS='%s'
-			EXTRA_VPCNATIVE='%s'
-			EXTRA_CLUSTERTYPE='%s'
-
-			# Detect pods in FAILED state
-			function show_failing_pods() {
-				echo ""
-				failed_pods=$(kubectl get pod -l "release=$RELEASE_NAME,cronjob!=true" -n "$NAMESPACE" -o custom-columns="POD:metadata.name,STATE:status.containerStatuses[*].ready" --no-headers | grep -E "<none>|false" | grep -Eo '^[^ ]+')
-				if [[ ! -z "$failed_pods" ]] ; then
-					echo "Failing pods:"
-					while IFS= read -r pod; do
-						echo "---- ${NAMESPACE} / ${pod} ----"
-						echo "* Events"
-						kubectl get events --field-selector involvedObject.name=${pod},type!=Normal --show-kind=true --ignore-not-found=true --namespace ${NAMESPACE}
-						echo ""
-						echo "* Logs"
-						containers=$(kubectl get pods "${pod}" --namespace "${NAMESPACE}" -o json | jq -r 'try .status | .containerStatuses[] | select(.ready == false).name')
-						if [[ ! -z "$containers" ]] ; then
-							for container in ${containers}; do
-								kubectl logs "${pod}" --prefix=true --since="${DEPLOYMENT_TIMEOUT}" --namespace "${NAMESPACE}" -c "${container}" 
-							done
-						else
-							echo "no logs found"
-						fi
-
-						echo "----"
-					done <<< "$failed_pods"
-
-					false
-				else
-					true
-				fi
-			}
+		violations, err := common.ValidateChartValues(chart, releaseValues, sources)
+		if err != nil {
+			log.Fatalf("Error: %s", err)
+		}
 
-			trap show_failing_pods ERR
-
-			helm upgrade --dry-run --install "${RELEASE_NAME}" "${CHART_NAME}" \
-				--repo "${CHART_REPOSITORY}" \
-				${EXTRA_CHART_VERSION} \
-				--set environmentName="${SILTA_ENVIRONMENT_NAME}" \
-				--set silta-release.branchName="${BRANCHNAME}" \
-				--set php.image="test:test" \
-				--set nginx.image="test:test" \
-				--set shell.image="test:test" \
-				--namespace="${NAMESPACE}" \
-				${EXTRA_NOAUTHIPS} \
-				${EXTRA_VPCNATIVE} \
-				${EXTRA_CLUSTERTYPE} \
-				--values "${SILTA_CONFIG}"
-				
-				`,
-				releaseName, chartName, chartRepository, chartVersionOverride,
-				siltaEnvironmentName, branchname,
-				namespace, siltaConfig, extraNoAuthIPs, vpcNativeOverride, extraClusterType)
-
-			cmd := exec.Command("bash", "-c", command)
-			// StdOutPipe omitted to avoid exposing secrets
-			cmdErrReader, err := cmd.StderrPipe()
-			if err != nil {
-				log.Fatal("Error (stderr pipe): ", err)
-				return
+		failed := false
+		if len(violations) > 0 {
+			fmt.Printf("Error: values don't meet the specifications of the %s chart schema:\n", chart.Name())
+			for _, v := range violations {
+				fmt.Printf("- %s\n", v)
 			}
-			errScanner := bufio.NewScanner(cmdErrReader)
-			go func() {
-				for errScanner.Scan() {
-					fmt.Printf("ERROR: %s\n", errScanner.Text())
-				}
-			}()
-			err = cmd.Start()
-			if err != nil {
-				log.Fatal("Error (Start): ", err)
+			failed = true
+		}
+		if len(unknownKeys) > 0 {
+			if strict {
+				fmt.Printf("Error: values contain keys unknown to the %s chart:\n", chart.Name())
+				failed = true
+			} else {
+				fmt.Printf("Warning: values contain keys unknown to the %s chart:\n", chart.Name())
 			}
-			err = cmd.Wait()
-			if err != nil {
-				log.Fatal("Error (Wait): ", err)
+			for _, v := range unknownKeys {
+				fmt.Printf("- %s\n", v)
 			}
+		}
+		if failed {
+			os.Exit(1)
+		}
 
-		} else {
-			fmt.Printf("Chart name %s does not match \"drupal\", helm validation step was skipped\n", chartName)
+		// Chart templates are rendered without cluster access
+		_, err = common.RenderHelmChart(chart, releaseName, namespace, releaseValues)
+		if err != nil {
+			fmt.Printf("Error: chart rendering failed: %s\n", err)
+			os.Exit(1)
 		}
+
+		fmt.Println("Release configuration is valid")
 	},
 }
 
@@ -229,10 +228,15 @@ func init() {
 	ciReleaseValidateCmd.Flags().String("vpn-ip", "", "VPN IP for basic auth allow list")
 	ciReleaseValidateCmd.Flags().String("vpc-native", "", "VPC-native cluster (GKE specific)")
 	ciReleaseValidateCmd.Flags().String("cluster-type", "", "Cluster type (i.e. gke, aws, aks, other)")
+	ciReleaseValidateCmd.Flags().String("cluster-domain", "", "Base domain for cluster urls (i.e. dev.example.com)")
 	ciReleaseValidateCmd.Flags().String("chart-version", "", "Deploy a specific chart version")
 	ciReleaseValidateCmd.Flags().String("chart-name", "", "Chart name")
+	ciReleaseValidateCmd.Flags().String("chart-profile", "", "Chart profile files (comma separated list of YAML files)")
 	ciReleaseValidateCmd.Flags().String("chart-repository", "https://storage.googleapis.com/charts.wdr.io", "Chart repository")
 	ciReleaseValidateCmd.Flags().String("silta-config", "", "Silta release helm chart values")
+	ciReleaseValidateCmd.Flags().String("chart-path", "", "Local chart directory or archive (default: extended chart folder or chart name)")
+	ciReleaseValidateCmd.Flags().Bool("offline", false, "Validate without network and cluster access, requires a local chart")
+	ciReleaseValidateCmd.Flags().Bool("strict", false, "Fail validation on keys unknown to the chart")
 
 	ciReleaseValidateCmd.MarkFlagRequired("release-name")
 	ciReleaseValidateCmd.MarkFlagRequired("namespace")
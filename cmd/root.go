@@ -3,10 +3,12 @@ package cmd
 import (
 	"bufio"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"os/exec"
 	"strings"
+	"sync"
 
 	"github.com/spf13/cobra"
 	"github.com/wunderio/silta-cli/internal/common"
@@ -69,7 +71,7 @@ func init() {
 
 func bufferedExec(command string, debug bool) {
 	if debug {
-		fmt.Sprintf("Command (not executed): %s\n", command)
+		fmt.Printf("Command (not executed): %s\n", command)
 	} else {
 		out, err := exec.Command("bash", "-c", command).CombinedOutput()
 		fmt.Printf("%s\n", out)
@@ -80,43 +82,58 @@ func bufferedExec(command string, debug bool) {
 }
 
 func pipedExec(command string, stdOutPrefix string, stdErrPrefix string, debug bool) {
+	err := pipedExecOutput(os.Stdout, command, stdOutPrefix, stdErrPrefix, debug)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// pipedExecOutput runs a bash command, command output is written to out line by line as it comes
+func pipedExecOutput(out io.Writer, command string, stdOutPrefix string, stdErrPrefix string, debug bool) error {
 	if debug {
-		fmt.Printf("Command (not executed): %s\n", command)
-	} else {
+		fmt.Fprintf(out, "Command (not executed): %s\n", command)
+		return nil
+	}
 
-		// Flush exec output buffers since this might take a while
-		cmd := exec.Command("bash", "-c", command)
+	// Flush exec output buffers since this might take a while
+	cmd := exec.Command("bash", "-c", command)
 
-		// create a pipe for the output of the script
-		cmdOutReader, err := cmd.StdoutPipe()
-		if err != nil {
-			log.Fatal("Error (stdout pipe): ", err)
-			return
-		}
-		cmdErrReader, err := cmd.StderrPipe()
-		if err != nil {
-			log.Fatal("Error (stderr pipe): ", err)
-			return
-		}
-		outScanner := bufio.NewScanner(cmdOutReader)
-		errScanner := bufio.NewScanner(cmdErrReader)
-		go func() {
-			for errScanner.Scan() {
-				fmt.Printf("%s%s\n", stdErrPrefix, errScanner.Text())
-			}
-		}()
-		go func() {
-			for outScanner.Scan() {
-				fmt.Printf("%s%s\n", stdOutPrefix, outScanner.Text())
-			}
-		}()
-		err = cmd.Start()
-		if err != nil {
-			log.Fatal("Error (Start): ", err)
-		}
-		err = cmd.Wait()
-		if err != nil {
-			log.Fatal("Error (Wait): ", err)
+	// create a pipe for the output of the script
+	cmdOutReader, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("Error (stdout pipe): %s", err)
+	}
+	cmdErrReader, err := cmd.StderrPipe()
+	if err != nil {
+		return fmt.Errorf("Error (stderr pipe): %s", err)
+	}
+	err = cmd.Start()
+	if err != nil {
+		return fmt.Errorf("Error (Start): %s", err)
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	scan := func(reader io.Reader, prefix string) {
+		defer wg.Done()
+		scanner := bufio.NewScanner(reader)
+		for scanner.Scan() {
+			mu.Lock()
+			fmt.Fprintf(out, "%s%s\n", prefix, scanner.Text())
+			mu.Unlock()
 		}
+		// Keep the command from blocking on output that could not be scanned
+		io.Copy(io.Discard, reader)
+	}
+	wg.Add(2)
+	go scan(cmdErrReader, stdErrPrefix)
+	go scan(cmdOutReader, stdOutPrefix)
+	// Output has to be read before waiting for the command
+	wg.Wait()
+
+	err = cmd.Wait()
+	if err != nil {
+		return fmt.Errorf("Error (Wait): %s", err)
 	}
+	return nil
 }
@@ -138,23 +138,20 @@ func GetChartNamesFromDependencies(dependencies []dependency) []string {
 	return names
 }
 
-// GetChartName reduces chart name to a simple name
+// GetChartName reduces chart name to a simple name of a registered chart profile
 func GetChartName(chartName string) string {
 	// Charts can be stored stored locally, can't use remote repository name as chart name
-	if chartName == "simple" || strings.HasSuffix(chartName, "/simple") {
-		return "simple"
-	} else if chartName == "frontend" || strings.HasSuffix(chartName, "/frontend") {
-		return "frontend"
-	} else if chartName == "drupal" || strings.HasSuffix(chartName, "/drupal") {
-		return "drupal"
-	}
-	return ""
+	profile := GetChartProfile(chartName)
+	if profile == nil {
+		return ""
+	}
+	return profile.Name()
 }
 
 // Creates a configuration file that can be used for helm release
 func CreateChartConfigurationFile(chartName string) string {
 
-	chartConfigOverride := os.Getenv("SILTA_" + strings.ToUpper(GetChartName(chartName)) + "_CONFIG_VALUES")
+	chartConfigOverride := os.Getenv("SILTA_" + strings.ToUpper(strings.ReplaceAll(GetChartName(chartName), "-", "_")) + "_CONFIG_VALUES")
 	if chartConfigOverride == "" {
 		return ""
 	}
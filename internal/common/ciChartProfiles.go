@@ -0,0 +1,413 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	helmAction "helm.sh/helm/v3/pkg/action"
+)
+
+// ReleaseParameters are release deployment inputs that chart profiles map to chart values
+type ReleaseParameters struct {
+	ReleaseName     string
+	Namespace       string
+	EnvironmentName string
+	BranchName      string
+	ClusterDomain   string
+	ClusterType     string
+	VpcNative       string
+	VpnIP           string
+	RepositoryUrl   string
+	GitAuthUsername string
+	GitAuthPassword string
+	DBRootPassword  string
+	DBUserPassword  string
+	ImagePullSecret string
+	// Image urls by image identifier (i.e. "php", "nginx", "shell")
+	Images map[string]string
+}
+
+// Parameter returns release parameter value by its profile mapping name
+func (p ReleaseParameters) Parameter(name string) (interface{}, error) {
+	switch name {
+	case "releaseName":
+		return p.ReleaseName, nil
+	case "namespace":
+		return p.Namespace, nil
+	case "environmentName":
+		return p.EnvironmentName, nil
+	case "branchName":
+		return p.BranchName, nil
+	case "clusterDomain":
+		return p.ClusterDomain, nil
+	case "clusterType":
+		return p.ClusterType, nil
+	case "vpcNative":
+		if b, err := strconv.ParseBool(p.VpcNative); err == nil {
+			return b, nil
+		}
+		return p.VpcNative, nil
+	case "vpnIPRange":
+		if p.VpnIP == "" {
+			return "", nil
+		}
+		return p.VpnIP + "/32", nil
+	case "repositoryUrl":
+		return p.RepositoryUrl, nil
+	case "gitAuthUsername":
+		return p.GitAuthUsername, nil
+	case "gitAuthPassword":
+		return p.GitAuthPassword, nil
+	case "dbRootPassword":
+		return p.DBRootPassword, nil
+	case "dbUserPassword":
+		return p.DBUserPassword, nil
+	case "imagePullSecret":
+		return p.ImagePullSecret, nil
+	}
+	return nil, fmt.Errorf("unknown release parameter: %s", name)
+}
+
+// ChartImage is a container image required by a chart
+type ChartImage struct {
+	// Image identifier, i.e. "php". Passed via "--<identifier>-image-url" or "--image-url <identifier>=<url>" flags
+	Identifier string `yaml:"identifier"`
+	// Human readable name used in messages, i.e. "PHP"
+	Title string `yaml:"title,omitempty"`
+	// Chart value the image url is set to, i.e. "php.image"
+	Value string `yaml:"value"`
+}
+
+// ChartReadiness describes how release readiness is verified after deployment
+type ChartReadiness struct {
+	// Stream "<release>-post-release" job logs while release is being deployed
+	PostReleaseLogs bool `yaml:"postReleaseLogs"`
+	// Wait for rollout of release deployments and rolling update statefulsets
+	Rollout bool `yaml:"rollout"`
+}
+
+// ChartPreDeployContext is passed to chart pre-deploy migrations
+type ChartPreDeployContext struct {
+	Clientset    kubernetes.Interface
+	ActionConfig *helmAction.Configuration
+	Namespace    string
+	ReleaseName  string
+	// Migrations must not change cluster state when DryRun is set (i.e. diff or validation), only adjust values
+	DryRun bool
+}
+
+// ChartMigration is a pre-deploy step that can adjust release values or cluster state
+type ChartMigration func(ctx ChartPreDeployContext, values map[string]interface{}) error
+
+// ChartProfile describes how a chart type is deployed
+type ChartProfile interface {
+	// Name returns simple chart name, i.e. "drupal"
+	Name() string
+	// RequiredImages lists images that have to be provided for the release
+	RequiredImages() []ChartImage
+	// Values maps release parameters to chart values
+	Values(params ReleaseParameters) (map[string]interface{}, error)
+	// PreDeploy runs migrations before release deployment
+	PreDeploy(ctx ChartPreDeployContext, values map[string]interface{}) error
+	// Readiness returns readiness rules applied after deployment
+	Readiness() ChartReadiness
+	// OpenValues lists chart value maps that accept user defined keys (i.e. "php.cron"), "*" matches any key
+	OpenValues() []string
+}
+
+// ChartProfileDefinition is a declarative chart profile, used for builtin charts and YAML profile files
+type ChartProfileDefinition struct {
+	ProfileName string       `yaml:"name"`
+	Images      []ChartImage `yaml:"images"`
+	// Chart values set from release parameters (chart value -> release parameter)
+	SetValues map[string]string `yaml:"values"`
+	// Chart values set from release parameters only when parameter is not empty
+	OptionalValues map[string]string `yaml:"optionalValues"`
+	// Named pre-deploy migrations, see RegisterChartMigration
+	Migrations []string       `yaml:"migrations"`
+	Ready      ChartReadiness `yaml:"readiness"`
+	// Chart value maps that accept user defined keys even though chart defaults list some of them, i.e. cron jobs
+	Open []string `yaml:"openValues"`
+}
+
+func (d *ChartProfileDefinition) Name() string {
+	return d.ProfileName
+}
+
+func (d *ChartProfileDefinition) RequiredImages() []ChartImage {
+	return d.Images
+}
+
+func (d *ChartProfileDefinition) Values(params ReleaseParameters) (map[string]interface{}, error) {
+	values := map[string]interface{}{}
+
+	for _, key := range sortedKeys(d.SetValues) {
+		value, err := params.Parameter(d.SetValues[key])
+		if err != nil {
+			return nil, err
+		}
+		SetChartValue(values, key, value)
+	}
+
+	for _, key := range sortedKeys(d.OptionalValues) {
+		value, err := params.Parameter(d.OptionalValues[key])
+		if err != nil {
+			return nil, err
+		}
+		if value != "" {
+			SetChartValue(values, key, value)
+		}
+	}
+
+	for _, image := range d.Images {
+		if url := params.Images[image.Identifier]; url != "" {
+			SetChartValue(values, image.Value, url)
+		}
+	}
+
+	return values, nil
+}
+
+func (d *ChartProfileDefinition) PreDeploy(ctx ChartPreDeployContext, values map[string]interface{}) error {
+	for _, name := range d.Migrations {
+		migration, ok := chartMigrations[name]
+		if !ok {
+			return fmt.Errorf("unknown chart migration: %s", name)
+		}
+		if err := migration(ctx, values); err != nil {
+			return fmt.Errorf("chart migration %s failed: %s", name, err)
+		}
+	}
+	return nil
+}
+
+func (d *ChartProfileDefinition) Readiness() ChartReadiness {
+	return d.Ready
+}
+
+func (d *ChartProfileDefinition) OpenValues() []string {
+	return d.Open
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := []string{}
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+var chartProfiles = map[string]ChartProfile{}
+
+var chartMigrations = map[string]ChartMigration{
+	// Remove first release of a chart if it failed and unstick releases in pending-upgrade state
+	"failed-release-cleanup": func(ctx ChartPreDeployContext, values map[string]interface{}) error {
+		if !ctx.DryRun {
+			FailedReleaseCleanup(ctx.ReleaseName, ctx.Namespace)
+		}
+		return nil
+	},
+	// Mariadb subchart update to 7.x requires recreating the statefulset (drupal chart < 0.3.43)
+	"mariadb-statefulset-recreate": func(ctx ChartPreDeployContext, values map[string]interface{}) error {
+		if ctx.DryRun {
+			return nil
+		}
+		return RecreateLegacyMariadbStatefulSet(ctx.Clientset, ctx.ActionConfig, ctx.Namespace, ctx.ReleaseName)
+	},
+	// Disable reference data if the required volume is not present.
+	"reference-data-mount": func(ctx ChartPreDeployContext, values map[string]interface{}) error {
+		// PVC name can be either "*-reference-data" or "*-reference", so we need to check both
+		// Unless we parse and merge configuration yaml files, we can't know the exact name of the PVC
+		// Check all pvc's in the namespace and see if any of them match the pattern
+		pvcs, err := ctx.Clientset.CoreV1().PersistentVolumeClaims(ctx.Namespace).List(context.TODO(), v1.ListOptions{})
+		if err != nil {
+			return fmt.Errorf("cannot get persistent volume claims: %s", err)
+		}
+		for _, pvc := range pvcs.Items {
+			if strings.HasSuffix(pvc.Name, "-reference-data") || strings.HasSuffix(pvc.Name, "-reference") {
+				return nil
+			}
+		}
+		SetChartValue(values, "referenceData.skipMount", true)
+		return nil
+	},
+}
+
+var gitAuthChartValues = map[string]string{
+	"shell.gitAuth.repositoryUrl":      "repositoryUrl",
+	"shell.gitAuth.keyserver.username": "gitAuthUsername",
+	"shell.gitAuth.keyserver.password": "gitAuthPassword",
+}
+
+// Database credentials are only overridden if specified
+var databaseChartValues = map[string]string{
+	"mariadb.rootUser.password": "dbRootPassword",
+	"mariadb.db.password":       "dbUserPassword",
+}
+
+func init() {
+	RegisterChartProfile(&ChartProfileDefinition{
+		ProfileName: "simple",
+		Images: []ChartImage{
+			{Identifier: "nginx", Title: "Nginx", Value: "nginx.image"},
+		},
+	})
+
+	RegisterChartProfile(&ChartProfileDefinition{
+		ProfileName:    "frontend",
+		SetValues:      gitAuthChartValues,
+		OptionalValues: databaseChartValues,
+		Ready:          ChartReadiness{PostReleaseLogs: true, Rollout: true},
+		Open:           []string{"services", "services.*.cron", "services.*.env", "mounts"},
+	})
+
+	RegisterChartProfile(&ChartProfileDefinition{
+		ProfileName: "drupal",
+		Images: []ChartImage{
+			{Identifier: "php", Title: "PHP", Value: "php.image"},
+			{Identifier: "nginx", Title: "Nginx", Value: "nginx.image"},
+			{Identifier: "shell", Title: "Shell", Value: "shell.image"},
+		},
+		SetValues:      gitAuthChartValues,
+		OptionalValues: databaseChartValues,
+		Migrations:     []string{"mariadb-statefulset-recreate", "failed-release-cleanup", "reference-data-mount"},
+		Ready:          ChartReadiness{PostReleaseLogs: true, Rollout: true},
+		Open:           []string{"php.cron", "php.env", "mounts", "services"},
+	})
+}
+
+// RegisterChartProfile registers a chart profile. Profile with the same name is replaced.
+func RegisterChartProfile(profile ChartProfile) {
+	chartProfiles[profile.Name()] = profile
+}
+
+// RegisterChartMigration registers a named pre-deploy migration that chart profiles can refer to
+func RegisterChartMigration(name string, migration ChartMigration) {
+	chartMigrations[name] = migration
+}
+
+// GetChartProfile returns a chart profile matching chart name ("drupal", "wunderio/drupal", "extended-helm-chart/drupal"), nil if there is none.
+// Exact name match is preferred, then the longest suffix match.
+func GetChartProfile(chartName string) ChartProfile {
+	if profile, ok := chartProfiles[chartName]; ok {
+		return profile
+	}
+	match := ""
+	for name := range chartProfiles {
+		if strings.HasSuffix(chartName, "/"+name) && len(name) > len(match) {
+			match = name
+		}
+	}
+	if match == "" {
+		return nil
+	}
+	return chartProfiles[match]
+}
+
+// ChartProfileNames returns names of registered chart profiles
+func ChartProfileNames() []string {
+	names := []string{}
+	for name := range chartProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LoadChartProfiles reads YAML chart profile files and registers them
+func LoadChartProfiles(files []string) error {
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		profile := ChartProfileDefinition{}
+		err = yaml.UnmarshalStrict(content, &profile)
+		if err != nil {
+			return fmt.Errorf("cannot parse chart profile %s: %s", file, err)
+		}
+		if profile.ProfileName == "" {
+			return fmt.Errorf("chart profile %s has no name", file)
+		}
+		for _, name := range profile.Migrations {
+			if _, ok := chartMigrations[name]; !ok {
+				return fmt.Errorf("chart profile %s refers to unknown migration: %s", file, name)
+			}
+		}
+		RegisterChartProfile(&profile)
+	}
+	return nil
+}
+
+// ChartReleaseValues returns release values shared by all charts, extended with chart profile values
+func ChartReleaseValues(profile ChartProfile, params ReleaseParameters) (map[string]interface{}, error) {
+	values := map[string]interface{}{}
+	SetChartValue(values, "environmentName", params.EnvironmentName)
+	SetChartValue(values, "silta-release.branchName", params.BranchName)
+	SetChartValue(values, "clusterDomain", params.ClusterDomain)
+
+	// Skip basic auth for internal VPN if defined in environment
+	if len(params.VpnIP) > 0 {
+		SetChartValue(values, "nginx.noauthips.vpn", params.VpnIP+"/32")
+	}
+
+	// Pass VPC-native setting if defined in environment
+	if len(params.VpcNative) > 0 {
+		vpcNative, _ := params.Parameter("vpcNative")
+		SetChartValue(values, "cluster.vpcNative", vpcNative)
+	}
+
+	// Add cluster type if defined in environment
+	if len(params.ClusterType) > 0 {
+		SetChartValue(values, "cluster.type", params.ClusterType)
+	}
+
+	// Add imagePullsecret to release values if IMAGE_PULL_SECRET is set
+	if len(params.ImagePullSecret) > 0 {
+		SetChartValue(values, "imagePullSecret", params.ImagePullSecret)
+	}
+
+	profileValues, err := profile.Values(params)
+	if err != nil {
+		return nil, err
+	}
+	MergeChartValues(values, profileValues)
+	return values, nil
+}
+
+// MissingChartImages returns chart profile images that have no image url set
+func MissingChartImages(profile ChartProfile, images map[string]string) []ChartImage {
+	missing := []ChartImage{}
+	for _, image := range profile.RequiredImages() {
+		if len(images[image.Identifier]) == 0 {
+			missing = append(missing, image)
+		}
+	}
+	return missing
+}
+
+// ChartPath returns the extended chart folder for the profile if it exists, chart name otherwise
+func ChartPath(profile ChartProfile, chartName string) string {
+	_, errDir := os.Stat(ExtendedFolder + "/" + profile.Name())
+	if !os.IsNotExist(errDir) {
+		return ExtendedFolder + "/" + profile.Name()
+	}
+	return chartName
+}
+
+// ImageTitle returns a human readable image name
+func (i ChartImage) ImageTitle() string {
+	if i.Title != "" {
+		return i.Title
+	}
+	return i.Identifier
+}
@@ -0,0 +1,202 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sync"
+	"text/tabwriter"
+
+	"gopkg.in/yaml.v2"
+)
+
+// DefaultImageBuildFile is the image build file of a project
+const DefaultImageBuildFile = "silta/images.yml"
+
+// ImageBuildSpec is an image listed in the image build file
+type ImageBuildSpec struct {
+	// Image identifier (i.e. "php"), image url is "<repo host>/<repo project>/<namespace>-<identifier>"
+	Identifier string `yaml:"identifier"`
+	// Dockerfile (relative path)
+	Dockerfile string `yaml:"dockerfile"`
+	// Build path, image is built from an empty directory when not set
+	BuildPath string `yaml:"buildPath,omitempty"`
+	// Prefix for image tag
+	TagPrefix string `yaml:"tagPrefix,omitempty"`
+	// Apply .dockerignore patterns the same way as docker build when calculating image tag (see ImageContentHash)
+	Dockerignore bool `yaml:"dockerignore,omitempty"`
+}
+
+// emptyBuildPath is the build path of images built from an empty directory
+const emptyBuildPath = "/tmp/empty"
+
+// ImageBuildPath returns image build path, an empty directory when build path is not set
+func ImageBuildPath(buildPath string) string {
+	if len(buildPath) > 0 {
+		return buildPath
+	}
+	if _, err := os.Stat(emptyBuildPath); os.IsNotExist(err) {
+		_ = os.Mkdir(emptyBuildPath, 0775)
+	}
+	return emptyBuildPath
+}
+
+// PrefixImageTag returns image tag with a tag prefix, tag as is when prefix is empty
+func PrefixImageTag(prefix string, tag string) string {
+	if len(prefix) > 0 {
+		return prefix + "-" + tag
+	}
+	return tag
+}
+
+// ImageContentTag returns image tag calculated from build path content and dockerfile (see ImageContentHash), with
+// an optional tag prefix
+func ImageContentTag(buildPath string, dockerfile string, tagPrefix string, dockerignore bool) (string, error) {
+	contentHash, err := ImageContentHash(buildPath, dockerfile, dockerignore)
+	if err != nil {
+		return "", err
+	}
+	return PrefixImageTag(tagPrefix, contentHash), nil
+}
+
+// ImageBuildFile lists images a project builds. Example:
+//
+//	images:
+//	  - identifier: php
+//	    dockerfile: silta/php.Dockerfile
+//	    buildPath: .
+//	  - identifier: nginx
+//	    dockerfile: silta/nginx.Dockerfile
+//	    buildPath: web
+type ImageBuildFile struct {
+	Images []ImageBuildSpec `yaml:"images"`
+}
+
+// ImageBuildResult is the outcome of an image build
+type ImageBuildResult struct {
+	Identifier string
+	// Image url with tag
+	Image string
+	// "reused" or "built"
+	Status string
+	Err    error
+}
+
+// ImageBuildFunc processes an image of the build file, output is written to out
+type ImageBuildFunc func(spec ImageBuildSpec, out io.Writer) error
+
+var imageIdentifierRegexp = regexp.MustCompile(`^[a-z0-9]+([._-][a-z0-9]+)*$`)
+
+// ReadImageBuildFile reads and validates an image build file
+func ReadImageBuildFile(file string) ([]ImageBuildSpec, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	buildFile := ImageBuildFile{}
+	err = yaml.UnmarshalStrict(content, &buildFile)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse image build file %s: %s", file, err)
+	}
+	if len(buildFile.Images) == 0 {
+		return nil, fmt.Errorf("image build file %s has no images", file)
+	}
+
+	identifiers := map[string]bool{}
+	for i, image := range buildFile.Images {
+		if !imageIdentifierRegexp.MatchString(image.Identifier) {
+			return nil, fmt.Errorf("image build file %s: image %d has an invalid identifier: %q", file, i+1, image.Identifier)
+		}
+		if identifiers[image.Identifier] {
+			return nil, fmt.Errorf("image build file %s: image %s is listed more than once", file, image.Identifier)
+		}
+		identifiers[image.Identifier] = true
+		if image.Dockerfile == "" {
+			return nil, fmt.Errorf("image build file %s: image %s has no dockerfile", file, image.Identifier)
+		}
+	}
+	return buildFile.Images, nil
+}
+
+// RunImageBuilds runs fn for each image with at most "concurrency" images processed at the same time. Output lines
+// are prefixed with image identifier. Errors are returned in the order of images.
+func RunImageBuilds(specs []ImageBuildSpec, concurrency int, out io.Writer, fn ImageBuildFunc) []error {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	errs := make([]error, len(specs))
+	jobs := make(chan int)
+	writer := &syncWriter{out: out}
+
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				prefixed := &linePrefixWriter{prefix: fmt.Sprintf("[%s] ", specs[i].Identifier), out: writer}
+				errs[i] = fn(specs[i], prefixed)
+				prefixed.Flush()
+			}
+		}()
+	}
+	for i := range specs {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	return errs
+}
+
+// PrintImageBuildSummary prints image build results as a table
+func PrintImageBuildSummary(out io.Writer, results []ImageBuildResult) {
+	writer := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(writer, "IMAGE\tSTATUS\tDETAILS")
+	for _, r := range results {
+		status, details := r.Status, r.Image
+		if r.Err != nil {
+			status, details = "failed", r.Err.Error()
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%s\n", r.Identifier, status, details)
+	}
+	writer.Flush()
+}
+
+// ImageUrls returns image urls of successful builds by image identifier
+func ImageUrls(results []ImageBuildResult) map[string]string {
+	urls := map[string]string{}
+	for _, r := range results {
+		if r.Err == nil {
+			urls[r.Identifier] = r.Image
+		}
+	}
+	return urls
+}
+
+// WriteImageUrls writes image urls as a JSON object of image identifier and image url
+func WriteImageUrls(out io.Writer, urls map[string]string) error {
+	content, err := json.MarshalIndent(urls, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(out, string(content))
+	return err
+}
+
+// ReadImageUrlsFile reads image urls written by WriteImageUrls
+func ReadImageUrlsFile(file string) (map[string]string, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	urls := map[string]string{}
+	err = json.Unmarshal(content, &urls)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse image urls file %s: %s", file, err)
+	}
+	return urls, nil
+}
@@ -0,0 +1,199 @@
+package common
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// dockerignorePattern is a compiled .dockerignore line
+type dockerignorePattern struct {
+	exclusion bool
+	pattern   string
+	regexp    *regexp.Regexp
+}
+
+// DockerignoreMatcher matches build context paths with .dockerignore patterns, same as docker build: "*" and "?"
+// don't match "/", "**" matches any number of directories, "!" re-includes paths and the last matching pattern
+// wins. A pattern matching a directory matches everything in it.
+type DockerignoreMatcher struct {
+	patterns []dockerignorePattern
+}
+
+// ReadDockerignore returns patterns of a .dockerignore file. Comments and empty lines are skipped, patterns are
+// cleaned and made relative to build context.
+func ReadDockerignore(r io.Reader) ([]string, error) {
+	patterns := []string{}
+	scanner := bufio.NewScanner(r)
+	first := true
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if first {
+			line = bytes.TrimPrefix(line, []byte("\xEF\xBB\xBF"))
+			first = false
+		}
+		pattern := strings.TrimSpace(string(line))
+		if pattern == "" || strings.HasPrefix(pattern, "#") {
+			continue
+		}
+		invert := pattern[0] == '!'
+		if invert {
+			pattern = strings.TrimSpace(pattern[1:])
+		}
+		if len(pattern) > 0 {
+			pattern = filepath.ToSlash(filepath.Clean(pattern))
+			if len(pattern) > 1 && pattern[0] == '/' {
+				pattern = pattern[1:]
+			}
+		}
+		if invert {
+			pattern = "!" + pattern
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, scanner.Err()
+}
+
+// ReadDockerignoreFile returns patterns of a .dockerignore file, no patterns if file doesn't exist
+func ReadDockerignoreFile(name string) ([]string, error) {
+	f, err := os.Open(name)
+	if os.IsNotExist(err) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadDockerignore(f)
+}
+
+// BuildDockerignorePatterns returns patterns of "<dockerfile>.dockerignore", or "<build path>/.dockerignore" when
+// the former doesn't exist (same precedence as docker build)
+func BuildDockerignorePatterns(buildPath string, dockerfile string) ([]string, error) {
+	if _, err := os.Stat(dockerfile + ".dockerignore"); err == nil {
+		return ReadDockerignoreFile(dockerfile + ".dockerignore")
+	}
+	return ReadDockerignoreFile(filepath.Join(buildPath, ".dockerignore"))
+}
+
+// compileDockerignorePattern converts a pattern to a regular expression
+func compileDockerignorePattern(pattern string) (*regexp.Regexp, error) {
+	expr := "^"
+	inClass := false
+	runes := []rune(pattern)
+	for i := 0; i < len(runes); i++ {
+		ch := runes[i]
+		switch {
+		case inClass:
+			if ch == ']' {
+				inClass = false
+			}
+			if ch == '\\' && i+1 < len(runes) {
+				i++
+				expr += `\` + string(runes[i])
+				continue
+			}
+			expr += string(ch)
+		case ch == '*':
+			if i+1 < len(runes) && runes[i+1] == '*' {
+				i++
+				// "**/" is the same as "**"
+				if i+1 < len(runes) && runes[i+1] == '/' {
+					i++
+				}
+				if i+1 == len(runes) {
+					expr += ".*"
+				} else {
+					expr += "(.*/)?"
+				}
+			} else {
+				expr += "[^/]*"
+			}
+		case ch == '?':
+			expr += "[^/]"
+		case ch == '[':
+			inClass = true
+			expr += "["
+		case ch == '\\':
+			if i+1 < len(runes) {
+				i++
+				expr += regexp.QuoteMeta(string(runes[i]))
+			} else {
+				expr += `\\`
+			}
+		default:
+			expr += regexp.QuoteMeta(string(ch))
+		}
+	}
+	return regexp.Compile(expr + "$")
+}
+
+// NewDockerignoreMatcher compiles .dockerignore patterns
+func NewDockerignoreMatcher(patterns []string) (*DockerignoreMatcher, error) {
+	m := &DockerignoreMatcher{}
+	for _, p := range patterns {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		exclusion := false
+		if p[0] == '!' {
+			if len(p) == 1 {
+				return nil, fmt.Errorf("illegal exclusion pattern: \"!\"")
+			}
+			exclusion = true
+			p = p[1:]
+		}
+		p = path.Clean(p)
+		if _, err := path.Match(p, "."); err != nil {
+			return nil, fmt.Errorf("invalid .dockerignore pattern %q: %s", p, err)
+		}
+		expr, err := compileDockerignorePattern(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid .dockerignore pattern %q: %s", p, err)
+		}
+		m.patterns = append(m.patterns, dockerignorePattern{exclusion: exclusion, pattern: p, regexp: expr})
+	}
+	return m, nil
+}
+
+// Matches returns true if a path (relative to build context, slash separated) is ignored
+func (m *DockerignoreMatcher) Matches(rel string) bool {
+	matched := false
+	parents := strings.Split(path.Dir(rel), "/")
+	for _, p := range m.patterns {
+		// Only a match can change the result
+		if p.exclusion != matched {
+			continue
+		}
+		match := p.regexp.MatchString(rel)
+		if !match && path.Dir(rel) != "." {
+			for i := range parents {
+				if p.regexp.MatchString(strings.Join(parents[:i+1], "/")) {
+					match = true
+					break
+				}
+			}
+		}
+		if match {
+			matched = !p.exclusion
+		}
+	}
+	return matched
+}
+
+// HasExclusions returns true if some paths are re-included with "!", so ignored directories have to be walked
+func (m *DockerignoreMatcher) HasExclusions() bool {
+	for _, p := range m.patterns {
+		if p.exclusion {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,474 @@
+package common
+
+import (
+	"archive/tar"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// imageHashExcludes are left out of image content hash in every build path (composer generated files)
+var imageHashExcludes = []string{"vendor/composer", "vendor/autoload.php"}
+
+// imageHashDockerignoreExcludes are imageHashExcludes with docker build semantics
+var imageHashDockerignoreExcludes = []string{"**/vendor/composer", "**/vendor/autoload.php"}
+
+// imageHashMtime is the latest modification time stored in the hashed archive (2000-01-01 00:00Z)
+const imageHashMtime = 946684800
+
+const (
+	tarBlockSize  = 512
+	tarRecordSize = 20 * tarBlockSize
+)
+
+// imageHashEntry is a file or directory of the hashed archive
+type imageHashEntry struct {
+	name string
+	path string
+	info fs.FileInfo
+	// Name of the same file stored earlier
+	hardlink string
+}
+
+// ImageManifestEntry is an archive entry that contributes to image content hash. Digest is a sha1 of file content
+// and link target, Metadata is the mode and owner ("<mode> <uid>:<gid> <user>:<group>") stored in the archive.
+type ImageManifestEntry struct {
+	Name     string
+	Digest   string
+	Metadata string
+}
+
+// ImageContentHash returns a hash of build path content and dockerfile, leaving out files ignored by
+// .dockerignore. Modification times and file order play no role.
+//
+// The hash is a sha1 of a GNU tar archive, same as
+//
+//	tar --sort=name --absolute-names --exclude-from=<.dockerignore> --exclude='vendor/composer' \
+//	  --exclude='vendor/autoload.php' --mtime='2000-01-01 00:00Z' --clamp-mtime -cf - <build path> <dockerfile> | sha1sum
+//
+// By default .dockerignore patterns are applied the way tar applies exclude patterns, so image tags stay the same as
+// with the tar pipeline: patterns are unanchored (i.e. "node_modules" and "*.log" match at any depth), wildcards
+// match "/" and there are no "!" exclusions. With dockerignore set, patterns are applied the same way as docker build
+// does instead and dockerfile is always included. Tags of builds with nested matches differ between the two.
+// Hard links are stored as regular files.
+func ImageContentHash(buildPath string, dockerfile string, dockerignore bool) (string, error) {
+	hash, _, err := ImageContentManifest(buildPath, dockerfile, dockerignore)
+	return hash, err
+}
+
+// ImageContentManifest returns image content hash and the entries it is calculated from, in archive order
+func ImageContentManifest(buildPath string, dockerfile string, dockerignore bool) (string, []ImageManifestEntry, error) {
+	matcher, err := newImageHashMatcher(buildPath, dockerfile, dockerignore)
+	if err != nil {
+		return "", nil, err
+	}
+
+	root, err := os.Lstat(buildPath)
+	if err != nil {
+		return "", nil, err
+	}
+	entries := []imageHashEntry{}
+	rootName := tarMemberName(buildPath)
+	switch {
+	case matcher.excluded(rootName, ""):
+	case root.IsDir():
+		children, err := walkImageHashEntries(buildPath, rootName, "", matcher)
+		if err != nil {
+			return "", nil, err
+		}
+		entries = append(entries, imageHashEntry{name: strings.TrimSuffix(rootName, "/") + "/", path: buildPath, info: root})
+		entries = append(entries, children...)
+	default:
+		entries = append(entries, imageHashEntry{name: rootName, path: buildPath, info: root})
+	}
+
+	info, err := os.Lstat(dockerfile)
+	if err != nil {
+		return "", nil, err
+	}
+	if !matcher.excluded(tarMemberName(dockerfile), "") {
+		entries = append(entries, dockerfileHashEntry(entries, dockerfile, info))
+	}
+
+	hash := sha1.New()
+	manifest, err := writeGnuTar(hash, entries)
+	if err != nil {
+		return "", nil, err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), manifest, nil
+}
+
+// imageHashMatcher tells which files are left out of image content hash
+type imageHashMatcher interface {
+	// excluded returns true if an archive member is left out. Rel is member path relative to build path, empty for
+	// command line arguments (build path and dockerfile).
+	excluded(name string, rel string) bool
+	// walkExcluded returns true if excluded directories have to be walked for re-included paths
+	walkExcluded() bool
+}
+
+// newImageHashMatcher returns a matcher of .dockerignore (or <dockerfile>.dockerignore) patterns with tar exclude
+// or docker build semantics
+func newImageHashMatcher(buildPath string, dockerfile string, dockerignore bool) (imageHashMatcher, error) {
+	if dockerignore {
+		patterns, err := BuildDockerignorePatterns(buildPath, dockerfile)
+		if err != nil {
+			return nil, err
+		}
+		matcher, err := NewDockerignoreMatcher(append(patterns, imageHashDockerignoreExcludes...))
+		if err != nil {
+			return nil, err
+		}
+		return dockerignoreHashMatcher{matcher}, nil
+	}
+
+	file := filepath.Join(buildPath, ".dockerignore")
+	if _, err := os.Stat(dockerfile + ".dockerignore"); err == nil {
+		file = dockerfile + ".dockerignore"
+	}
+	patterns, err := readTarExcludeFile(file)
+	if err != nil {
+		return nil, err
+	}
+	matcher := tarExcludeMatcher{}
+	for _, pattern := range append(patterns, imageHashExcludes...) {
+		expr, err := compileTarExcludePattern(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid .dockerignore pattern %q: %s", pattern, err)
+		}
+		matcher.patterns = append(matcher.patterns, expr)
+	}
+	return matcher, nil
+}
+
+// dockerignoreHashMatcher applies patterns the same way as docker build, command line arguments are always included
+type dockerignoreHashMatcher struct {
+	matcher *DockerignoreMatcher
+}
+
+func (m dockerignoreHashMatcher) excluded(name string, rel string) bool {
+	return rel != "" && m.matcher.Matches(rel)
+}
+
+func (m dockerignoreHashMatcher) walkExcluded() bool {
+	return m.matcher.HasExclusions()
+}
+
+// tarExcludeMatcher applies patterns the same way as "tar --exclude-from" to archive member names
+type tarExcludeMatcher struct {
+	patterns []*regexp.Regexp
+}
+
+func (m tarExcludeMatcher) excluded(name string, rel string) bool {
+	name = strings.TrimSuffix(name, "/")
+	for _, p := range m.patterns {
+		if p.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m tarExcludeMatcher) walkExcluded() bool {
+	return false
+}
+
+// readTarExcludeFile returns patterns of an exclude file the way "tar --exclude-from" reads them: trailing
+// whitespace is removed and empty lines are skipped, comments and "!" prefixes are literal. No patterns are returned
+// if the file doesn't exist.
+func readTarExcludeFile(name string) ([]string, error) {
+	content, err := os.ReadFile(name)
+	if os.IsNotExist(err) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	patterns := []string{}
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimRightFunc(line, unicode.IsSpace)
+		if line != "" {
+			patterns = append(patterns, line)
+		}
+	}
+	return patterns, nil
+}
+
+// compileTarExcludePattern converts a tar exclude pattern to a regular expression. Like in tar, pattern matches
+// any trailing part of a name that starts after a "/", wildcards match "/" and a pattern matching a directory
+// matches everything in it.
+func compileTarExcludePattern(pattern string) (*regexp.Regexp, error) {
+	expr := ""
+	runes := []rune(pattern)
+	for i := 0; i < len(runes); i++ {
+		ch := runes[i]
+		switch ch {
+		case '*':
+			expr += ".*"
+		case '?':
+			expr += "."
+		case '[':
+			class, n := tarBracketExpression(runes[i:])
+			if n == 0 {
+				expr += regexp.QuoteMeta("[")
+				continue
+			}
+			expr += class
+			i += n - 1
+		case '\\':
+			if i+1 < len(runes) {
+				i++
+			}
+			expr += regexp.QuoteMeta(string(runes[i]))
+		default:
+			expr += regexp.QuoteMeta(string(ch))
+		}
+	}
+	return regexp.Compile("(?s)^(.*/)?" + expr + "(/.*)?$")
+}
+
+// tarBracketExpression converts a fnmatch bracket expression at the start of runes to a regular expression
+// character class. Returns the class and the number of runes it takes, 0 if the bracket is not closed.
+func tarBracketExpression(runes []rune) (string, int) {
+	class := "["
+	i := 1
+	if i < len(runes) && (runes[i] == '!' || runes[i] == '^') {
+		class += "^"
+		i++
+	}
+	for start := i; i < len(runes); i++ {
+		ch := runes[i]
+		switch {
+		case ch == ']' && i > start:
+			return class + "]", i + 1
+		case ch == '\\' && i+1 < len(runes):
+			i++
+			class += regexp.QuoteMeta(string(runes[i]))
+		case ch == '-':
+			class += "-"
+		default:
+			class += regexp.QuoteMeta(string(ch))
+		}
+	}
+	return "", 0
+}
+
+// dockerfileHashEntry returns archive entry of the dockerfile. Tar stores a file that is already in the archive
+// (dockerfile in build path) as a hard link.
+func dockerfileHashEntry(entries []imageHashEntry, dockerfile string, info fs.FileInfo) imageHashEntry {
+	entry := imageHashEntry{name: tarMemberName(dockerfile), path: dockerfile, info: info}
+	if !info.Mode().IsRegular() {
+		return entry
+	}
+	for _, e := range entries {
+		if e.info.Mode().IsRegular() && os.SameFile(e.info, info) {
+			entry.hardlink = e.name
+			break
+		}
+	}
+	return entry
+}
+
+// tarMemberName returns archive name of a command line path, trailing slashes are removed
+func tarMemberName(name string) string {
+	name = filepath.ToSlash(name)
+	trimmed := strings.TrimRight(name, "/")
+	if trimmed == "" && name != "" {
+		return "/"
+	}
+	return trimmed
+}
+
+// walkImageHashEntries returns directory content that is not ignored, sorted by name and depth first. Ignored
+// directories are only walked for re-included paths.
+func walkImageHashEntries(dir string, name string, rel string, matcher imageHashMatcher) ([]imageHashEntry, error) {
+	items, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	entries := []imageHashEntry{}
+	for _, item := range items {
+		itemPath := filepath.Join(dir, item.Name())
+		itemName := strings.TrimSuffix(name, "/") + "/" + item.Name()
+		itemRel := item.Name()
+		if rel != "" {
+			itemRel = rel + "/" + item.Name()
+		}
+		info, err := os.Lstat(itemPath)
+		if err != nil {
+			return nil, err
+		}
+		ignored := matcher.excluded(itemName, itemRel)
+
+		if info.IsDir() {
+			if ignored && !matcher.walkExcluded() {
+				continue
+			}
+			children, err := walkImageHashEntries(itemPath, itemName, itemRel, matcher)
+			if err != nil {
+				return nil, err
+			}
+			if ignored && len(children) == 0 {
+				continue
+			}
+			entries = append(entries, imageHashEntry{name: itemName + "/", path: itemPath, info: info})
+			entries = append(entries, children...)
+			continue
+		}
+		if ignored || !(info.Mode().IsRegular() || info.Mode()&fs.ModeSymlink != 0) {
+			continue
+		}
+		entries = append(entries, imageHashEntry{name: itemName, path: itemPath, info: info})
+	}
+	return entries, nil
+}
+
+// writeGnuTar writes entries in GNU tar format, byte for byte the same as GNU tar with clamped modification times.
+// Returns manifest entries of archive members.
+func writeGnuTar(archive io.Writer, entries []imageHashEntry) ([]ImageManifestEntry, error) {
+	written := int64(0)
+	write := func(b []byte) error {
+		n, err := archive.Write(b)
+		written += int64(n)
+		return err
+	}
+
+	manifest := []ImageManifestEntry{}
+	for _, entry := range entries {
+		linkname := ""
+		if entry.info.Mode()&fs.ModeSymlink != 0 {
+			target, err := os.Readlink(entry.path)
+			if err != nil {
+				return nil, err
+			}
+			linkname = filepath.ToSlash(target)
+		}
+		// Owner ids and names are looked up the same way as tar does
+		header, err := tar.FileInfoHeader(entry.info, linkname)
+		if err != nil {
+			return nil, err
+		}
+		mtime := entry.info.ModTime().Unix()
+		if mtime > imageHashMtime {
+			mtime = imageHashMtime
+		}
+		if entry.hardlink != "" {
+			header.Typeflag = tar.TypeLink
+			linkname = entry.hardlink
+		}
+		size := int64(0)
+		if header.Typeflag == tar.TypeReg {
+			size = entry.info.Size()
+		}
+
+		if len(linkname) > 100 {
+			if err := write(gnuLongNameBlocks(tar.TypeGNULongLink, linkname)); err != nil {
+				return nil, err
+			}
+		}
+		if len(entry.name) > 100 {
+			if err := write(gnuLongNameBlocks(tar.TypeGNULongName, entry.name)); err != nil {
+				return nil, err
+			}
+		}
+		block := gnuTarHeader(entry.name, linkname, header.Typeflag, header.Mode, int64(header.Uid), int64(header.Gid), size, mtime, header.Uname, header.Gname)
+		if err := write(block); err != nil {
+			return nil, err
+		}
+
+		// Content digest covers entry type, link target and file data
+		content := sha1.New()
+		content.Write(append([]byte{header.Typeflag}, linkname+"\x00"...))
+		if size > 0 {
+			f, err := os.Open(entry.path)
+			if err != nil {
+				return nil, err
+			}
+			n, err := io.Copy(io.MultiWriter(archive, content), io.LimitReader(f, size))
+			f.Close()
+			written += n
+			if err != nil {
+				return nil, err
+			}
+			if n < size {
+				return nil, fmt.Errorf("%s: file shrank while reading", entry.path)
+			}
+			if padding := (tarBlockSize - size%tarBlockSize) % tarBlockSize; padding > 0 {
+				if err := write(make([]byte, padding)); err != nil {
+					return nil, err
+				}
+			}
+		}
+		manifest = append(manifest, ImageManifestEntry{
+			Name:     entry.name,
+			Digest:   hex.EncodeToString(content.Sum(nil)),
+			Metadata: fmt.Sprintf("%04o %d:%d %s:%s", header.Mode, header.Uid, header.Gid, header.Uname, header.Gname),
+		})
+	}
+
+	// End of archive is two empty blocks, archive is padded to full records
+	end := 2 * tarBlockSize
+	if remainder := (written + int64(end)) % tarRecordSize; remainder > 0 {
+		end += int(tarRecordSize - remainder)
+	}
+	if err := write(make([]byte, end)); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// gnuLongNameBlocks returns a "././@LongLink" header and data blocks of a name that doesn't fit the header
+func gnuLongNameBlocks(typeflag byte, name string) []byte {
+	size := int64(len(name) + 1)
+	blocks := gnuTarHeader("././@LongLink", "", typeflag, 0644, 0, 0, size, 0, "root", "root")
+	data := make([]byte, (size+tarBlockSize-1)/tarBlockSize*tarBlockSize)
+	copy(data, name)
+	return append(blocks, data...)
+}
+
+// gnuTarHeader returns a GNU format header block
+func gnuTarHeader(name string, linkname string, typeflag byte, mode int64, uid int64, gid int64, size int64, mtime int64, uname string, gname string) []byte {
+	block := make([]byte, tarBlockSize)
+	copy(block[0:100], name)
+	formatTarNumber(block[100:108], mode)
+	formatTarNumber(block[108:116], uid)
+	formatTarNumber(block[116:124], gid)
+	formatTarNumber(block[124:136], size)
+	formatTarNumber(block[136:148], mtime)
+	block[156] = typeflag
+	copy(block[157:257], linkname)
+	copy(block[257:265], "ustar  \x00")
+	copy(block[265:297], uname)
+	copy(block[297:329], gname)
+
+	// Checksum is calculated with checksum field filled with spaces
+	copy(block[148:156], "        ")
+	sum := int64(0)
+	for _, b := range block {
+		sum += int64(b)
+	}
+	copy(block[148:156], fmt.Sprintf("%06o\x00 ", sum))
+	return block
+}
+
+// formatTarNumber writes a zero padded, NUL terminated octal number, or a base-256 number if it doesn't fit
+func formatTarNumber(field []byte, value int64) {
+	octal := fmt.Sprintf("%0*o", len(field)-1, value)
+	if len(octal) < len(field) && value >= 0 {
+		copy(field, octal)
+		field[len(field)-1] = 0
+		return
+	}
+	for i := len(field) - 1; i > 0; i-- {
+		field[i] = byte(value)
+		value >>= 8
+	}
+	field[0] = 0x80
+}
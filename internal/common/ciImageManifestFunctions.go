@@ -0,0 +1,103 @@
+package common
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// ImageManifestChange is a difference between two image manifests
+type ImageManifestChange struct {
+	// "added", "removed", "content changed" or "mode/owner changed"
+	Change string
+	Name   string
+}
+
+// WriteImageManifest writes image manifest, a "# <image>" line followed by "<digest>  <metadata>  <name>" line of
+// every entry
+func WriteImageManifest(out io.Writer, image string, entries []ImageManifestEntry) error {
+	if _, err := fmt.Fprintf(out, "# %s\n", image); err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if _, err := fmt.Fprintf(out, "%s  %s  %s\n", entry.Digest, entry.Metadata, entry.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadImageManifest reads entries of a manifest written by WriteImageManifest, comments and empty lines are skipped
+func ReadImageManifest(r io.Reader) ([]ImageManifestEntry, error) {
+	entries := []ImageManifestEntry{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimRight(scanner.Text(), "\r")
+		if len(strings.TrimSpace(text)) == 0 || strings.HasPrefix(text, "#") {
+			continue
+		}
+		digest, rest, ok := strings.Cut(text, "  ")
+		metadata, name, ok2 := strings.Cut(rest, "  ")
+		if !ok || !ok2 || len(digest) != 40 || len(metadata) == 0 || len(name) == 0 {
+			return nil, fmt.Errorf("invalid manifest line %d: %s", line, text)
+		}
+		entries = append(entries, ImageManifestEntry{Name: name, Digest: digest, Metadata: metadata})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// manifestEntries returns entries by name. Dockerfile in build path is archived twice, the dockerfile entry
+// (archived last) is labeled, i.e. "project/Dockerfile (dockerfile)".
+func manifestEntries(entries []ImageManifestEntry) map[string]ImageManifestEntry {
+	byName := map[string]ImageManifestEntry{}
+	for _, entry := range entries {
+		key := entry.Name
+		if _, ok := byName[key]; ok {
+			key += " (dockerfile)"
+		}
+		byName[key] = entry
+	}
+	return byName
+}
+
+// CompareImageManifests returns entries that were added, removed or changed since the previous manifest, sorted
+// by name. Content and mode/owner changes are reported separately.
+func CompareImageManifests(previous []ImageManifestEntry, current []ImageManifestEntry) []ImageManifestChange {
+	previousEntries := manifestEntries(previous)
+	currentEntries := manifestEntries(current)
+
+	changes := []ImageManifestChange{}
+	for name, entry := range currentEntries {
+		previousEntry, ok := previousEntries[name]
+		if !ok {
+			changes = append(changes, ImageManifestChange{Change: "added", Name: name})
+			continue
+		}
+		if previousEntry.Digest != entry.Digest {
+			changes = append(changes, ImageManifestChange{Change: "content changed", Name: name})
+		}
+		if previousEntry.Metadata != entry.Metadata {
+			changes = append(changes, ImageManifestChange{Change: "mode/owner changed", Name: name})
+		}
+	}
+	for name := range previousEntries {
+		if _, ok := currentEntries[name]; !ok {
+			changes = append(changes, ImageManifestChange{Change: "removed", Name: name})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].Name != changes[j].Name {
+			return changes[i].Name < changes[j].Name
+		}
+		return changes[i].Change < changes[j].Change
+	})
+	return changes
+}
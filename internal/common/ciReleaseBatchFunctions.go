@@ -0,0 +1,165 @@
+package common
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	helmRelease "helm.sh/helm/v3/pkg/release"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// ReleaseRef identifies a release in a namespace
+type ReleaseRef struct {
+	Namespace string
+	Name      string
+}
+
+// ReleaseBatchResult is the outcome of a bulk operation on a single release
+type ReleaseBatchResult struct {
+	Release  ReleaseRef
+	Duration time.Duration
+	// Short summary of the result, i.e. release hostnames
+	Details string
+	Err     error
+}
+
+// ReleaseBatchFunc runs an operation on a single release, output is prefixed with the release name
+type ReleaseBatchFunc func(ctx context.Context, clientset kubernetes.Interface, release ReleaseRef, out io.Writer) (string, error)
+
+// FindReleases returns helm releases that have deployments or statefulsets matching the label selector, sorted by
+// namespace and name. Empty selector matches all release workloads. Workloads are found by both release labels,
+// those with a release label that doesn't belong to a helm release are left out.
+func FindReleases(ctx context.Context, clientset kubernetes.Interface, helmReleases []*helmRelease.Release, selector string) ([]ReleaseRef, error) {
+	candidates := map[ReleaseRef]bool{}
+	namespaces := map[string]bool{}
+	for _, r := range helmReleases {
+		candidates[ReleaseRef{Namespace: r.Namespace, Name: r.Name}] = true
+		namespaces[r.Namespace] = true
+	}
+
+	found := map[ReleaseRef]bool{}
+	for namespace := range namespaces {
+		for _, label := range releaseSelectorLabels {
+			// Only release workloads are considered
+			labelSelector := label
+			if selector != "" {
+				labelSelector = label + "," + selector
+			}
+			deployments, err := clientset.AppsV1().Deployments(namespace).List(ctx, v1.ListOptions{LabelSelector: labelSelector})
+			if err != nil {
+				return nil, fmt.Errorf("error getting the list of deployments: %s", err)
+			}
+			for _, item := range deployments.Items {
+				found[ReleaseRef{Namespace: item.Namespace, Name: item.Labels[label]}] = true
+			}
+			statefulsets, err := clientset.AppsV1().StatefulSets(namespace).List(ctx, v1.ListOptions{LabelSelector: labelSelector})
+			if err != nil {
+				return nil, fmt.Errorf("error getting the list of statefulsets: %s", err)
+			}
+			for _, item := range statefulsets.Items {
+				found[ReleaseRef{Namespace: item.Namespace, Name: item.Labels[label]}] = true
+			}
+		}
+	}
+
+	releases := []ReleaseRef{}
+	for release := range found {
+		if candidates[release] {
+			releases = append(releases, release)
+		}
+	}
+	sort.Slice(releases, func(i, j int) bool {
+		if releases[i].Namespace != releases[j].Namespace {
+			return releases[i].Namespace < releases[j].Namespace
+		}
+		return releases[i].Name < releases[j].Name
+	})
+	return releases, nil
+}
+
+// RunReleaseBatch runs fn for each release with at most "concurrency" releases processed at the same time.
+// Results are returned in the order of releases.
+func RunReleaseBatch(ctx context.Context, clientset kubernetes.Interface, releases []ReleaseRef, concurrency int, out io.Writer, fn ReleaseBatchFunc) []ReleaseBatchResult {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	results := make([]ReleaseBatchResult, len(releases))
+	jobs := make(chan int)
+	writer := &syncWriter{out: out}
+
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				release := releases[i]
+				start := time.Now()
+				prefixed := &linePrefixWriter{prefix: fmt.Sprintf("[%s/%s] ", release.Namespace, release.Name), out: writer}
+				details, err := fn(ctx, clientset, release, prefixed)
+				prefixed.Flush()
+				results[i] = ReleaseBatchResult{Release: release, Duration: time.Since(start), Details: details, Err: err}
+			}
+		}()
+	}
+	for i := range releases {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	return results
+}
+
+// PrintReleaseBatchSummary prints results of a bulk operation as a table
+func PrintReleaseBatchSummary(out io.Writer, results []ReleaseBatchResult) {
+	writer := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(writer, "NAMESPACE\tRELEASE\tSTATUS\tDURATION\tDETAILS")
+	for _, r := range results {
+		status, details := "ok", r.Details
+		if r.Err != nil {
+			status, details = "failed", r.Err.Error()
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\n", r.Release.Namespace, r.Release.Name, status, r.Duration.Round(time.Second), details)
+	}
+	writer.Flush()
+}
+
+// linePrefixWriter prefixes every complete line with a prefix, partial lines are buffered until Flush
+type linePrefixWriter struct {
+	prefix string
+	out    *syncWriter
+	buffer bytes.Buffer
+}
+
+func (w *linePrefixWriter) Write(p []byte) (int, error) {
+	w.buffer.Write(p)
+	for {
+		line, err := w.buffer.ReadString('\n')
+		if err != nil {
+			// Keep the partial line for the next write
+			w.buffer.Reset()
+			w.buffer.WriteString(line)
+			break
+		}
+		w.out.println(w.prefix + strings.TrimSuffix(line, "\n"))
+	}
+	return len(p), nil
+}
+
+// Flush writes out the remaining partial line
+func (w *linePrefixWriter) Flush() {
+	if w.buffer.Len() > 0 {
+		w.out.println(w.prefix + w.buffer.String())
+		w.buffer.Reset()
+	}
+}
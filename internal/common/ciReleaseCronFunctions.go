@@ -0,0 +1,242 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	v1core "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+)
+
+// ReleaseCronJob returns a release cronjob by name. Name can be given without release prefix (i.e. "drupal" for
+// "<release>-cron-drupal"). Name can be omitted when release has only one cronjob.
+func ReleaseCronJob(ctx context.Context, clientset kubernetes.Interface, namespace, releaseName, name string) (*batchv1.CronJob, error) {
+	cronjobs, err := releaseCronJobs(ctx, clientset, namespace, releaseName)
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for i := range cronjobs {
+		names = append(names, cronjobs[i].Name)
+		if name == "" {
+			continue
+		}
+		if cronjobs[i].Name == name || cronjobs[i].Name == releaseName+"-"+name || cronjobs[i].Name == releaseName+"-cron-"+name {
+			return &cronjobs[i], nil
+		}
+	}
+	sort.Strings(names)
+	switch {
+	case len(cronjobs) == 0:
+		return nil, fmt.Errorf("release %s has no cronjobs", releaseName)
+	case name != "":
+		return nil, fmt.Errorf("cronjob %s not found in release %s (cronjobs: %s)", name, releaseName, strings.Join(names, ", "))
+	case len(cronjobs) > 1:
+		return nil, fmt.Errorf("release %s has multiple cronjobs, select one with --cronjob: %s", releaseName, strings.Join(names, ", "))
+	}
+	return &cronjobs[0], nil
+}
+
+// JobFromCronJob returns a job created from cronjob job template, same as "kubectl create job --from=cronjob/..."
+func JobFromCronJob(cronjob *batchv1.CronJob, now time.Time) *batchv1.Job {
+	// Job name is used as a label value, which is limited to 63 characters
+	suffix := fmt.Sprintf("-manual-%d", now.Unix())
+	prefix := cronjob.Name
+	if len(prefix)+len(suffix) > 63 {
+		prefix = strings.TrimRight(prefix[:63-len(suffix)], "-")
+	}
+
+	annotations := map[string]string{"cronjob.kubernetes.io/instantiate": "manual"}
+	for k, v := range cronjob.Spec.JobTemplate.Annotations {
+		annotations[k] = v
+	}
+	controller := true
+	return &batchv1.Job{
+		TypeMeta: v1.TypeMeta{APIVersion: "batch/v1", Kind: "Job"},
+		ObjectMeta: v1.ObjectMeta{
+			Name:        prefix + suffix,
+			Namespace:   cronjob.Namespace,
+			Labels:      cronjob.Spec.JobTemplate.Labels,
+			Annotations: annotations,
+			// Cronjob controller removes the job with the rest of job history
+			OwnerReferences: []v1.OwnerReference{{
+				APIVersion: "batch/v1",
+				Kind:       "CronJob",
+				Name:       cronjob.Name,
+				UID:        cronjob.UID,
+				Controller: &controller,
+			}},
+		},
+		Spec: cronjob.Spec.JobTemplate.Spec,
+	}
+}
+
+// JobResult returns true when job has finished, with an error if it failed
+func JobResult(job *batchv1.Job) (bool, error) {
+	for _, c := range job.Status.Conditions {
+		if c.Status != v1core.ConditionTrue {
+			continue
+		}
+		switch c.Type {
+		case batchv1.JobComplete:
+			return true, nil
+		case batchv1.JobFailed:
+			if c.Message == "" {
+				return true, fmt.Errorf("job %s failed: %s", job.Name, c.Reason)
+			}
+			return true, fmt.Errorf("job %s failed: %s (%s)", job.Name, c.Reason, c.Message)
+		}
+	}
+	return false, nil
+}
+
+// jobWatchSource watches jobs matching a field selector (i.e. "metadata.name=<job>")
+func jobWatchSource(clientset kubernetes.Interface, namespace string, fieldSelector string) watchSource {
+	return watchSource{
+		list: func(ctx context.Context) ([]runtime.Object, string, error) {
+			jobs, err := clientset.BatchV1().Jobs(namespace).List(ctx, v1.ListOptions{FieldSelector: fieldSelector})
+			if err != nil {
+				return nil, "", err
+			}
+			objects := []runtime.Object{}
+			for i := range jobs.Items {
+				objects = append(objects, &jobs.Items[i])
+			}
+			return objects, jobs.ResourceVersion, nil
+		},
+		watch: func(ctx context.Context, resourceVersion string) (watch.Interface, error) {
+			return clientset.BatchV1().Jobs(namespace).Watch(ctx, v1.ListOptions{FieldSelector: fieldSelector, ResourceVersion: resourceVersion})
+		},
+	}
+}
+
+// jobLogStreamer streams container logs of job pods, each pod once
+type jobLogStreamer struct {
+	clientset kubernetes.Interface
+	out       *syncWriter
+	mu        sync.Mutex
+	streamed  map[string]bool
+	wg        sync.WaitGroup
+}
+
+// stream starts streaming logs of a pod when its containers have started
+func (s *jobLogStreamer) stream(ctx context.Context, pod *v1core.Pod) {
+	if !podContainerStarted(pod) {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.streamed[pod.Name] {
+		return
+	}
+	s.streamed[pod.Name] = true
+	for _, status := range pod.Status.ContainerStatuses {
+		s.wg.Add(1)
+		go func(pod *v1core.Pod, container string) {
+			defer s.wg.Done()
+			streamContainerLogs(ctx, s.clientset, pod, container, ReleaseLogOptions{Follow: true}, s.out)
+		}(pod.DeepCopy(), status.Name)
+	}
+}
+
+// RunJob creates a job, streams logs of its pods (retries included) and waits until the job finishes. An error
+// is returned if the job fails or a job pod is stuck in CrashLoopBackOff or ImagePullBackOff.
+func RunJob(ctx context.Context, clientset kubernetes.Interface, job *batchv1.Job, out io.Writer) error {
+	job, err := clientset.BatchV1().Jobs(job.Namespace).Create(ctx, job, v1.CreateOptions{})
+	if err != nil {
+		return fmt.Errorf("error creating job: %s", err)
+	}
+	fmt.Fprintf(out, "Job %s created\n", job.Name)
+
+	streamer := &jobLogStreamer{clientset: clientset, out: &syncWriter{out: out}, streamed: map[string]bool{}}
+	selector := "job-name=" + job.Name
+
+	streamCtx, cancelStreams := context.WithCancel(ctx)
+	defer cancelStreams()
+	watchCtx, cancelWatch := context.WithCancel(ctx)
+	defer cancelWatch()
+
+	podFailure := make(chan error, 1)
+	go func() {
+		podFailure <- watchObjects(watchCtx, podWatchSource(clientset, job.Namespace, selector), func(obj runtime.Object) (bool, error) {
+			pod, ok := obj.(*v1core.Pod)
+			if !ok {
+				return false, nil
+			}
+			if err := PodFailure(pod); err != nil {
+				return true, err
+			}
+			streamer.stream(streamCtx, pod)
+			return false, nil
+		})
+	}()
+
+	result := make(chan error, 1)
+	go func() {
+		var jobErr error
+		err := watchObjects(watchCtx, jobWatchSource(clientset, job.Namespace, "metadata.name="+job.Name), func(obj runtime.Object) (bool, error) {
+			j, ok := obj.(*batchv1.Job)
+			if !ok || j.Name != job.Name {
+				return false, nil
+			}
+			done, err := JobResult(j)
+			jobErr = err
+			return done, nil
+		})
+		if err == nil {
+			err = jobErr
+		}
+		result <- err
+	}()
+
+	// Pod watch errors other than pod failures only disable fail-fast detection
+	finished := true
+	select {
+	case err = <-result:
+	case err = <-podFailure:
+		var failure *PodFailureError
+		if errors.As(err, &failure) {
+			finished = false
+		} else {
+			err = <-result
+		}
+	}
+	cancelWatch()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	// Pods that finished before their logs were picked up by the watch
+	pods, listErr := clientset.CoreV1().Pods(job.Namespace).List(ctx, v1.ListOptions{LabelSelector: selector})
+	if listErr == nil {
+		for i := range pods.Items {
+			streamer.stream(streamCtx, &pods.Items[i])
+		}
+	}
+
+	// Logs of finished containers end on their own, containers of a stuck job are given a moment
+	streamed := make(chan struct{})
+	go func() {
+		streamer.wg.Wait()
+		close(streamed)
+	}()
+	if !finished {
+		select {
+		case <-streamed:
+		case <-time.After(5 * time.Second):
+			cancelStreams()
+		}
+	}
+	<-streamed
+	return err
+}
@@ -0,0 +1,209 @@
+package common
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// Database connection is read from release container environment (DB_HOST, DB_USER, DB_PASS, DB_NAME), so
+// credentials never leave the cluster.
+const dbEnvCheck = `for v in DB_HOST DB_USER DB_PASS DB_NAME; do eval "[ -n \"\${$v}\" ]" || { echo "$v is not set in container" >&2; exit 1; }; done; `
+
+// DbDumpCommand writes a gzip compressed dump to stdout. Exit code of mysqldump is passed through the pipe
+// with a separate file descriptor, as sh has no pipefail.
+var DbDumpCommand = []string{"/bin/sh", "-c", dbEnvCheck +
+	`exec 3>&1; ` +
+	`status=$( { { MYSQL_PWD="$DB_PASS" mysqldump --single-transaction --quick --routines --no-tablespaces -h "$DB_HOST" -u "$DB_USER" "$DB_NAME"; echo $? >&4; } | gzip -c >&3; } 4>&1 ); ` +
+	`exit $status`}
+
+// DbImportCommand reads a gzip compressed dump from stdin. Exit code of gunzip is passed through the pipe the
+// same way as in DbDumpCommand, so a truncated dump fails the import. Exit code of mysql takes precedence.
+var DbImportCommand = []string{"/bin/sh", "-c", dbEnvCheck +
+	`exec 3>&1; ` +
+	`status=$( { { gunzip -c; echo $? >&4; } | MYSQL_PWD="$DB_PASS" mysql -h "$DB_HOST" -u "$DB_USER" "$DB_NAME" >&3; } 4>&1 ) || exit $?; ` +
+	`exit $status`}
+
+// FormatBytes returns a human readable size
+func FormatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// TransferProgress counts bytes written to it and reports them periodically
+type TransferProgress struct {
+	Label string
+	// Expected size, percentage is shown when set
+	Total int64
+	bytes atomic.Int64
+}
+
+func (p *TransferProgress) Write(b []byte) (int, error) {
+	p.bytes.Add(int64(len(b)))
+	return len(b), nil
+}
+
+// String returns transferred amount, i.e. "Importing database: 1.5 MiB / 3.0 MiB (50%)"
+func (p *TransferProgress) String() string {
+	n := p.bytes.Load()
+	if p.Total > 0 {
+		return fmt.Sprintf("%s: %s / %s (%d%%)", p.Label, FormatBytes(n), FormatBytes(p.Total), n*100/p.Total)
+	}
+	return fmt.Sprintf("%s: %s", p.Label, FormatBytes(n))
+}
+
+// Report prints progress every interval until context is cancelled, then prints the final amount
+func (p *TransferProgress) Report(ctx context.Context, out io.Writer, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			fmt.Fprintln(out, p.String())
+			return
+		case <-ticker.C:
+			fmt.Fprintln(out, p.String())
+		}
+	}
+}
+
+// reportProgress starts progress reporting, returned function stops it
+func reportProgress(ctx context.Context, progress *TransferProgress, out io.Writer) func() {
+	if out == nil {
+		return func() {}
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		progress.Report(ctx, out, 2*time.Second)
+		close(done)
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// GzipStream returns a gzip compressed stream of the input, gzip compressed input is returned as is
+func GzipStream(in io.Reader) io.Reader {
+	buffered := bufio.NewReader(in)
+	magic, _ := buffered.Peek(2)
+	if bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		return buffered
+	}
+	reader, writer := io.Pipe()
+	go func() {
+		compressor := gzip.NewWriter(writer)
+		_, err := io.Copy(compressor, buffered)
+		if err == nil {
+			err = compressor.Close()
+		}
+		writer.CloseWithError(err)
+	}()
+	return reader
+}
+
+// releaseDbExec runs a database command in a ready release pod
+func releaseDbExec(ctx context.Context, config *rest.Config, clientset kubernetes.Interface, namespace, releaseName string, command []string, in io.Reader, out io.Writer, stderr io.Writer) error {
+	pod, container, err := FindReleasePod(ctx, clientset, namespace, releaseName, DefaultExecComponents)
+	if err != nil {
+		return err
+	}
+	return ExecInPod(ctx, config, clientset, ReleaseExec{
+		Namespace: namespace,
+		Pod:       pod.Name,
+		Container: container,
+		Command:   command,
+		Stdin:     in,
+		Stdout:    out,
+		Stderr:    stderr,
+	})
+}
+
+// DumpReleaseDatabase writes a gzip compressed database dump of a release. Progress and command errors are
+// printed to stderr.
+func DumpReleaseDatabase(ctx context.Context, config *rest.Config, clientset kubernetes.Interface, namespace, releaseName string, out io.Writer, stderr io.Writer) error {
+	progress := &TransferProgress{Label: "Dumping database"}
+	stop := reportProgress(ctx, progress, stderr)
+	err := releaseDbExec(ctx, config, clientset, namespace, releaseName, DbDumpCommand, nil, io.MultiWriter(out, progress), stderr)
+	stop()
+	if err != nil {
+		return fmt.Errorf("database dump failed: %s", err)
+	}
+	return nil
+}
+
+// ImportReleaseDatabase imports a database dump (plain or gzip compressed) to a release. Tables in the dump
+// replace existing ones. Size of the input is used for progress, 0 if unknown.
+func ImportReleaseDatabase(ctx context.Context, config *rest.Config, clientset kubernetes.Interface, namespace, releaseName string, in io.Reader, size int64, stderr io.Writer) error {
+	progress := &TransferProgress{Label: "Importing database", Total: size}
+	stop := reportProgress(ctx, progress, stderr)
+	err := releaseDbExec(ctx, config, clientset, namespace, releaseName, DbImportCommand, GzipStream(io.TeeReader(in, progress)), nil, stderr)
+	stop()
+	if err != nil {
+		return fmt.Errorf("database import failed: %s", err)
+	}
+	return nil
+}
+
+// CopyReleaseDatabase streams a database dump of one release into another, without storing it locally
+func CopyReleaseDatabase(ctx context.Context, config *rest.Config, clientset kubernetes.Interface, fromNamespace, fromRelease, namespace, releaseName string, stderr io.Writer) error {
+	if fromNamespace == namespace && fromRelease == releaseName {
+		return fmt.Errorf("source and target release are the same")
+	}
+	// Both pods are looked up first, so a missing pod doesn't leave a half done copy
+	if _, _, err := FindReleasePod(ctx, clientset, fromNamespace, fromRelease, DefaultExecComponents); err != nil {
+		return err
+	}
+	if _, _, err := FindReleasePod(ctx, clientset, namespace, releaseName, DefaultExecComponents); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	progress := &TransferProgress{Label: "Copying database"}
+	stop := reportProgress(ctx, progress, stderr)
+	defer stop()
+
+	reader, writer := io.Pipe()
+	dumpErr := make(chan error, 1)
+	go func() {
+		err := releaseDbExec(ctx, config, clientset, fromNamespace, fromRelease, DbDumpCommand, nil, io.MultiWriter(writer, progress), stderr)
+		writer.CloseWithError(err)
+		dumpErr <- err
+	}()
+
+	err := releaseDbExec(ctx, config, clientset, namespace, releaseName, DbImportCommand, reader, nil, stderr)
+	if err != nil {
+		// Stop the dump when import fails
+		reader.CloseWithError(err)
+		cancel()
+	}
+	dErr := <-dumpErr
+	switch {
+	case dErr != nil && err != nil:
+		return fmt.Errorf("database copy failed, dump: %s, import: %s", dErr, err)
+	case dErr != nil:
+		return fmt.Errorf("database dump failed: %s", dErr)
+	case err != nil:
+		return fmt.Errorf("database import failed: %s", err)
+	}
+	return nil
+}
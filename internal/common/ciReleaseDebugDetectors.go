@@ -0,0 +1,427 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Root cause detectors
+const (
+	DebugCheckUnschedulable  = "unschedulable-pod"
+	DebugCheckImagePull      = "image-pull"
+	DebugCheckUnboundVolume  = "unbound-volume-claim"
+	DebugCheckReadinessProbe = "readiness-probe"
+	DebugCheckResourceQuota  = "resource-quota"
+	DebugCheckPostReleaseJob = "post-release-job"
+)
+
+// debugHintRule maps a substring of a kubernetes message to a human readable hint
+type debugHintRule struct {
+	match []string
+	hint  string
+}
+
+var schedulingHints = []debugHintRule{
+	{[]string{"insufficient cpu"}, "cluster has no node with enough free CPU, lower CPU requests or wait for the cluster to scale up"},
+	{[]string{"insufficient memory"}, "cluster has no node with enough free memory, lower memory requests or wait for the cluster to scale up"},
+	{[]string{"untolerated taint", "had taint"}, "nodes have taints the pod does not tolerate, check pod tolerations"},
+	{[]string{"didn't match pod's node affinity", "node affinity/selector", "didn't match node selector"}, "no node matches pod node selector or affinity, check nodeSelector and affinity values"},
+	{[]string{"unbound immediate persistentvolumeclaims", "unbound persistentvolumeclaims"}, "pod waits for a persistent volume, check volume claims of the release"},
+	{[]string{"volume node affinity conflict"}, "persistent volume is in another zone than available nodes"},
+	{[]string{"too many pods"}, "nodes have reached pod limit, wait for the cluster to scale up"},
+}
+
+// imagePullHints are matched in order, first matching rule gives the hint. Docker Hub answers the same way
+// whether repository is missing or private, so neither is singled out.
+var imagePullHints = []debugHintRule{
+	{[]string{"pull access denied", "may require authorization", "may require 'docker login'"}, "repository does not exist or requires authorization, check image url, image pull secret and registry credentials"},
+	{[]string{"invalidimagename", "invalid reference format"}, "image name is invalid, check image url and tag"},
+	{[]string{"unauthorized", "authentication required", "denied", "forbidden", "status code 401", "status code 403"}, "registry denied access, check image pull secret and registry credentials"},
+	{[]string{"manifest unknown", "not found", "notfound", "does not exist"}, "image tag not found in registry, check that the image was built and pushed"},
+	{[]string{"no such host", "i/o timeout", "connection refused", "tls handshake timeout"}, "registry is not reachable from the cluster, check registry url"},
+}
+
+var volumeHints = []debugHintRule{
+	{[]string{"waiting for first consumer"}, "volume is provisioned when a pod using it is scheduled, check pod scheduling"},
+	{[]string{"storageclass", "storage class"}, "storage class does not exist or can't provision volumes, check storageClassName"},
+	{[]string{"exceeded quota"}, "namespace storage quota is used up, remove unused volumes or lower requested size"},
+	{[]string{"waiting for a volume to be created"}, "volume is being provisioned by an external provisioner"},
+}
+
+// debugHint returns hints of all rules matching message, default when none match
+func debugHint(rules []debugHintRule, message string, fallback string) string {
+	message = strings.ToLower(message)
+	hints := []string{}
+	for _, rule := range rules {
+		for _, m := range rule.match {
+			if strings.Contains(message, m) {
+				hints = append(hints, rule.hint)
+				break
+			}
+		}
+	}
+	if len(hints) == 0 {
+		return fallback
+	}
+	return strings.Join(hints, "; ")
+}
+
+// firstDebugHint returns hint of the first rule matching message, default when none match
+func firstDebugHint(rules []debugHintRule, message string, fallback string) string {
+	message = strings.ToLower(message)
+	for _, rule := range rules {
+		for _, m := range rule.match {
+			if strings.Contains(message, m) {
+				return rule.hint
+			}
+		}
+	}
+	return fallback
+}
+
+// filterEvents returns events with given reason
+func filterEvents(events []DebugEvent, reason string) []DebugEvent {
+	filtered := []DebugEvent{}
+	for _, event := range events {
+		if event.Reason == reason {
+			filtered = append(filtered, event)
+		}
+	}
+	return filtered
+}
+
+// CheckUnschedulablePods reports pending pods that can't be scheduled to any node
+func CheckUnschedulablePods(ctx context.Context, clientset kubernetes.Interface, pods []v1.Pod) []DebugFinding {
+	findings := []DebugFinding{}
+	for _, pod := range pods {
+		if pod.Status.Phase != v1.PodPending {
+			continue
+		}
+
+		message := ""
+		for _, condition := range pod.Status.Conditions {
+			if condition.Type == v1.PodScheduled && condition.Status == v1.ConditionFalse && condition.Reason == v1.PodReasonUnschedulable {
+				message = condition.Message
+			}
+		}
+		events := filterEvents(resourceEvents(ctx, clientset, pod.Namespace, pod.Name), "FailedScheduling")
+		if message == "" && len(events) > 0 {
+			message = events[len(events)-1].Message
+		}
+		if message == "" {
+			continue
+		}
+
+		findings = append(findings, DebugFinding{
+			Severity:  DebugSeverityError,
+			Check:     DebugCheckUnschedulable,
+			Kind:      "Pod",
+			Namespace: pod.Namespace,
+			Name:      pod.Name,
+			Reason:    "pod can't be scheduled: " + message,
+			Hint:      debugHint(schedulingHints, message, "no node can run the pod, check resource requests and node selectors"),
+			Events:    events,
+		})
+	}
+	return findings
+}
+
+// CheckImagePullFailures reports containers whose image can't be pulled, telling apart missing tags and
+// registry authentication failures
+func CheckImagePullFailures(ctx context.Context, clientset kubernetes.Interface, pods []v1.Pod) []DebugFinding {
+	findings := []DebugFinding{}
+	for _, pod := range pods {
+		statuses := append([]v1.ContainerStatus{}, pod.Status.InitContainerStatuses...)
+		statuses = append(statuses, pod.Status.ContainerStatuses...)
+
+		var events []DebugEvent
+		for _, status := range statuses {
+			waiting := status.State.Waiting
+			if waiting == nil || (waiting.Reason != "ImagePullBackOff" && waiting.Reason != "ErrImagePull" && waiting.Reason != "InvalidImageName") {
+				continue
+			}
+			if events == nil {
+				events = filterEvents(resourceEvents(ctx, clientset, pod.Namespace, pod.Name), "Failed")
+			}
+
+			// Back-off message does not tell why pull failed, pull errors are in events
+			message := waiting.Reason + " " + waiting.Message
+			for _, event := range events {
+				if strings.Contains(event.Message, status.Image) {
+					message += " " + event.Message
+				}
+			}
+
+			findings = append(findings, DebugFinding{
+				Severity:  DebugSeverityError,
+				Check:     DebugCheckImagePull,
+				Kind:      "Pod",
+				Namespace: pod.Namespace,
+				Name:      pod.Name,
+				Container: status.Name,
+				Reason:    fmt.Sprintf("%s: image %s", waiting.Reason, status.Image),
+				Hint:      firstDebugHint(imagePullHints, message, "image can't be pulled, check image url and registry access"),
+				Events:    events,
+			})
+		}
+	}
+	return findings
+}
+
+// CheckUnboundVolumeClaims reports release persistent volume claims that are not bound to a volume
+func CheckUnboundVolumeClaims(ctx context.Context, clientset kubernetes.Interface, namespace, releaseName string) []DebugFinding {
+	claims := map[string]v1.PersistentVolumeClaim{}
+	for _, l := range releaseSelectorLabels {
+		list, err := clientset.CoreV1().PersistentVolumeClaims(namespace).List(ctx, metav1.ListOptions{LabelSelector: l + "=" + releaseName})
+		if err != nil {
+			continue
+		}
+		for _, item := range list.Items {
+			claims[item.Name] = item
+		}
+	}
+
+	findings := []DebugFinding{}
+	for _, claim := range claims {
+		if claim.Status.Phase == v1.ClaimBound {
+			continue
+		}
+
+		events := resourceEvents(ctx, clientset, claim.Namespace, claim.Name)
+		message := ""
+		for _, event := range events {
+			message += " " + event.Message
+		}
+		storageClass := "default"
+		if claim.Spec.StorageClassName != nil {
+			storageClass = *claim.Spec.StorageClassName
+		}
+
+		finding := DebugFinding{
+			Severity:  DebugSeverityError,
+			Check:     DebugCheckUnboundVolume,
+			Kind:      "PersistentVolumeClaim",
+			Namespace: claim.Namespace,
+			Name:      claim.Name,
+			Reason:    fmt.Sprintf("volume claim is %s (storage class %s)", claim.Status.Phase, storageClass),
+			Hint:      debugHint(volumeHints, message, "volume can't be provisioned, check storage class and requested size"),
+			Events:    events,
+		}
+		// Volume is provisioned later, it's not the cause of failure
+		if strings.Contains(strings.ToLower(message), "waiting for first consumer") {
+			finding.Severity = DebugSeverityWarning
+		}
+		findings = append(findings, finding)
+	}
+	sort.Slice(findings, func(i, j int) bool { return findings[i].Name < findings[j].Name })
+	return findings
+}
+
+// CheckReadinessProbes reports running containers that are not ready because of failing readiness probes
+func CheckReadinessProbes(ctx context.Context, clientset kubernetes.Interface, pods []v1.Pod) []DebugFinding {
+	findings := []DebugFinding{}
+	for _, pod := range pods {
+		running := false
+		for _, status := range pod.Status.ContainerStatuses {
+			if !status.Ready && status.State.Running != nil {
+				running = true
+			}
+		}
+		if !running {
+			continue
+		}
+
+		probeEvents := []DebugEvent{}
+		for _, event := range filterEvents(resourceEvents(ctx, clientset, pod.Namespace, pod.Name), "Unhealthy") {
+			if strings.HasPrefix(event.Message, "Readiness probe failed") {
+				probeEvents = append(probeEvents, event)
+			}
+		}
+		if len(probeEvents) == 0 {
+			continue
+		}
+
+		findings = append(findings, DebugFinding{
+			Severity:  DebugSeverityWarning,
+			Check:     DebugCheckReadinessProbe,
+			Kind:      "Pod",
+			Namespace: pod.Namespace,
+			Name:      pod.Name,
+			Reason:    probeEvents[len(probeEvents)-1].Message,
+			Hint:      "container runs but does not pass readiness probe, check application logs, health check path and startup time",
+			Events:    probeEvents,
+		})
+	}
+	return findings
+}
+
+// CheckResourceQuotas reports namespace resource quotas that are used up. Quotas that prevented creating
+// pods are errors.
+func CheckResourceQuotas(ctx context.Context, clientset kubernetes.Interface, namespace string) []DebugFinding {
+	quotas, err := clientset.CoreV1().ResourceQuotas(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil || len(quotas.Items) == 0 {
+		return []DebugFinding{}
+	}
+
+	// Events of workloads that failed to create pods
+	exceeded := []DebugEvent{}
+	events, err := clientset.CoreV1().Events(namespace).List(ctx, metav1.ListOptions{FieldSelector: "type!=Normal"})
+	if err == nil {
+		for _, event := range events.Items {
+			if event.Type != v1.EventTypeNormal && strings.Contains(event.Message, "exceeded quota") {
+				exceeded = append(exceeded, DebugEvent{
+					Type:    event.Type,
+					Reason:  event.Reason,
+					Kind:    event.InvolvedObject.Kind,
+					Name:    event.InvolvedObject.Name,
+					Message: event.Message,
+				})
+			}
+		}
+	}
+
+	findings := []DebugFinding{}
+	for _, quota := range quotas.Items {
+		resources := []string{}
+		for resource, hard := range quota.Status.Hard {
+			used, ok := quota.Status.Used[resource]
+			if ok && !hard.IsZero() && used.Cmp(hard) >= 0 {
+				resources = append(resources, fmt.Sprintf("%s %s/%s", resource, used.String(), hard.String()))
+			}
+		}
+		if len(resources) == 0 {
+			continue
+		}
+		sort.Strings(resources)
+
+		quotaEvents := []DebugEvent{}
+		for _, event := range exceeded {
+			if strings.Contains(event.Message, quota.Name) {
+				quotaEvents = append(quotaEvents, event)
+			}
+		}
+		severity := DebugSeverityWarning
+		if len(quotaEvents) > 0 {
+			severity = DebugSeverityError
+		}
+
+		findings = append(findings, DebugFinding{
+			Severity:  severity,
+			Check:     DebugCheckResourceQuota,
+			Kind:      "ResourceQuota",
+			Namespace: quota.Namespace,
+			Name:      quota.Name,
+			Reason:    "quota used up: " + strings.Join(resources, ", "),
+			Hint:      "namespace resource quota is exhausted, lower resource requests or remove unused environments",
+			Events:    quotaEvents,
+		})
+	}
+	sort.Slice(findings, func(i, j int) bool { return findings[i].Name < findings[j].Name })
+	return findings
+}
+
+// CheckPostReleaseJob reports a failed "<release>-post-release" job with exit code and logs of the failed container
+func CheckPostReleaseJob(ctx context.Context, clientset kubernetes.Interface, namespace, releaseName string) []DebugFinding {
+	jobName := releaseName + "-post-release"
+	job, err := clientset.BatchV1().Jobs(namespace).Get(ctx, jobName, metav1.GetOptions{})
+	if err != nil || job.Status.Failed == 0 || job.Status.Succeeded > 0 {
+		return []DebugFinding{}
+	}
+	// Job that completed after failed attempts is not a failure
+	for _, condition := range job.Status.Conditions {
+		if condition.Type == batchv1.JobComplete && condition.Status == v1.ConditionTrue {
+			return []DebugFinding{}
+		}
+	}
+
+	finding := DebugFinding{
+		Severity:  DebugSeverityError,
+		Check:     DebugCheckPostReleaseJob,
+		Kind:      "Job",
+		Namespace: namespace,
+		Name:      jobName,
+		Reason:    "post-release job failed",
+		Hint:      "post-release script failed, check the logs",
+		Events:    resourceEvents(ctx, clientset, namespace, jobName),
+	}
+	for _, condition := range job.Status.Conditions {
+		if condition.Type == batchv1.JobFailed && condition.Status == v1.ConditionTrue && condition.Reason == "DeadlineExceeded" {
+			finding.Reason = "post-release job failed: " + condition.Message
+			finding.Hint = "post-release job ran longer than allowed, speed up the post-release script or raise the job deadline"
+		}
+	}
+
+	// Latest failed job pod tells the exit code
+	pods, err := clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: "job-name=" + jobName})
+	if err != nil {
+		return []DebugFinding{finding}
+	}
+	sort.Slice(pods.Items, func(i, j int) bool {
+		return pods.Items[i].CreationTimestamp.Before(&pods.Items[j].CreationTimestamp)
+	})
+	for i := len(pods.Items) - 1; i >= 0; i-- {
+		pod := pods.Items[i]
+		for _, status := range pod.Status.ContainerStatuses {
+			terminated := status.State.Terminated
+			if terminated == nil || terminated.ExitCode == 0 {
+				continue
+			}
+			finding.Container = status.Name
+			finding.Reason = fmt.Sprintf("post-release job failed, container exited with code %d", terminated.ExitCode)
+			if terminated.Reason != "" && terminated.Reason != "Error" {
+				finding.Reason += " (" + terminated.Reason + ")"
+			}
+			finding.Hint = exitCodeHint(terminated.ExitCode, terminated.Reason)
+			finding.Logs = containerLogs(ctx, clientset, pod, status.Name)
+			return []DebugFinding{finding}
+		}
+	}
+	return []DebugFinding{finding}
+}
+
+// exitCodeHint explains common container exit codes
+func exitCodeHint(exitCode int32, reason string) string {
+	switch {
+	case reason == "OOMKilled":
+		return "job ran out of memory, raise post-release job memory limit"
+	case exitCode == 137:
+		return "job was killed (out of memory or deadline), check memory limit and job duration"
+	case exitCode == 127:
+		return "command not found, check post-release commands and image contents"
+	case exitCode == 126:
+		return "command is not executable, check file permissions in the image"
+	}
+	return "post-release script failed, check the logs"
+}
+
+// containerLogs returns last log lines of a container, prefixed with container name
+func containerLogs(ctx context.Context, clientset kubernetes.Interface, pod v1.Pod, container string) string {
+	req := clientset.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, &v1.PodLogOptions{
+		Container: container,
+		TailLines: &DebugLogTailLines,
+	})
+	podLogs, err := req.Stream(ctx)
+	if err != nil {
+		return ""
+	}
+	defer podLogs.Close()
+
+	buf := new(strings.Builder)
+	if _, err = io.Copy(buf, podLogs); err != nil || buf.Len() == 0 {
+		return ""
+	}
+
+	logs := strings.Builder{}
+	for _, line := range strings.Split(strings.TrimRight(buf.String(), "\n"), "\n") {
+		fmt.Fprintf(&logs, "[%s] %s\n", container, line)
+	}
+	return logs.String()
+}
@@ -0,0 +1,420 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Debug finding severities
+const (
+	DebugSeverityError   = "error"
+	DebugSeverityWarning = "warning"
+)
+
+// Debug checks
+const (
+	DebugCheckOOMKilled           = "oom-killed"
+	DebugCheckFailedPod           = "failed-pod"
+	DebugCheckNotReadyStatefulSet = "not-ready-statefulset"
+	DebugCheckNotReadyDeployment  = "not-ready-deployment"
+)
+
+// DebugLogTailLines is the number of container log lines included in findings
+var DebugLogTailLines int64 = 100
+
+// DebugEvent is a non-normal kubernetes event related to a finding
+type DebugEvent struct {
+	Type    string `json:"type"`
+	Reason  string `json:"reason"`
+	Kind    string `json:"kind"`
+	Name    string `json:"name"`
+	Message string `json:"message"`
+}
+
+// DebugFinding is a single problem found in release resources
+type DebugFinding struct {
+	Severity  string       `json:"severity"`
+	Check     string       `json:"check"`
+	Kind      string       `json:"kind"`
+	Namespace string       `json:"namespace"`
+	Name      string       `json:"name"`
+	Container string       `json:"container,omitempty"`
+	Reason    string       `json:"reason"`
+	Hint      string       `json:"hint,omitempty"`
+	Events    []DebugEvent `json:"events,omitempty"`
+	// Last lines of not ready container logs, prefixed with container name
+	Logs string `json:"logs,omitempty"`
+}
+
+// DebugReport collects findings of release failure checks
+type DebugReport struct {
+	Release   string         `json:"release"`
+	Namespace string         `json:"namespace"`
+	Findings  []DebugFinding `json:"findings"`
+}
+
+// HasErrors returns true if report contains error findings
+func (r *DebugReport) HasErrors() bool {
+	for _, f := range r.Findings {
+		if f.Severity == DebugSeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// DebugFailedRelease runs release failure checks: OOMKilled containers, root cause detectors (scheduling, image
+// pull, volume, quota, post-release job and readiness probe failures), failed pods with their events and logs,
+// not ready statefulsets and deployments with their events
+func DebugFailedRelease(ctx context.Context, clientset kubernetes.Interface, namespace, releaseName string) *DebugReport {
+	report := &DebugReport{Release: releaseName, Namespace: namespace, Findings: []DebugFinding{}}
+
+	pods := releasePods(ctx, clientset, namespace, releaseName)
+	report.Findings = append(report.Findings, CheckOOMKilledPods(pods)...)
+	report.Findings = append(report.Findings, CheckImagePullFailures(ctx, clientset, pods)...)
+	report.Findings = append(report.Findings, CheckUnschedulablePods(ctx, clientset, pods)...)
+	report.Findings = append(report.Findings, CheckUnboundVolumeClaims(ctx, clientset, namespace, releaseName)...)
+	report.Findings = append(report.Findings, CheckResourceQuotas(ctx, clientset, namespace)...)
+	report.Findings = append(report.Findings, CheckPostReleaseJob(ctx, clientset, namespace, releaseName)...)
+	report.Findings = append(report.Findings, CheckReadinessProbes(ctx, clientset, pods)...)
+	report.Findings = append(report.Findings, CheckFailedPods(ctx, clientset, pods)...)
+	report.Findings = append(report.Findings, CheckNotReadyStatefulSets(ctx, clientset, namespace, releaseName)...)
+	report.Findings = append(report.Findings, CheckNotReadyDeployments(ctx, clientset, namespace, releaseName)...)
+
+	return report
+}
+
+// releasePods returns release pods excluding cronjob pods, sorted by name
+func releasePods(ctx context.Context, clientset kubernetes.Interface, namespace, releaseName string) []v1.Pod {
+	found := map[string]v1.Pod{}
+	for _, l := range releaseSelectorLabels {
+		pods, err := clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
+			LabelSelector: fmt.Sprintf("%s=%s,cronjob!=true", l, releaseName),
+		})
+		if err != nil {
+			continue
+		}
+		for _, pod := range pods.Items {
+			found[pod.Name] = pod
+		}
+	}
+
+	pods := []v1.Pod{}
+	for _, pod := range found {
+		pods = append(pods, pod)
+	}
+	sort.Slice(pods, func(i, j int) bool { return pods[i].Name < pods[j].Name })
+	return pods
+}
+
+// CheckOOMKilledPods reports containers that have been OOMKilled
+func CheckOOMKilledPods(pods []v1.Pod) []DebugFinding {
+	findings := []DebugFinding{}
+	for _, pod := range pods {
+		for _, containerStatus := range pod.Status.ContainerStatuses {
+			terminated := containerStatus.State.Terminated
+			lastTerminated := containerStatus.LastTerminationState.Terminated
+			if (terminated != nil && terminated.Reason == "OOMKilled") || (lastTerminated != nil && lastTerminated.Reason == "OOMKilled") {
+				findings = append(findings, DebugFinding{
+					Severity:  DebugSeverityError,
+					Check:     DebugCheckOOMKilled,
+					Kind:      "Pod",
+					Namespace: pod.Namespace,
+					Name:      pod.Name,
+					Container: containerStatus.Name,
+					Reason:    "container ran out of memory (OOMKilled)",
+					Hint:      "raise container memory limit and request in silta configuration",
+				})
+			}
+		}
+	}
+	return findings
+}
+
+// CheckFailedPods reports pods with containers that are not ready, with pod events and container logs
+func CheckFailedPods(ctx context.Context, clientset kubernetes.Interface, pods []v1.Pod) []DebugFinding {
+	findings := []DebugFinding{}
+	for _, pod := range pods {
+		reason := podFailureReason(pod)
+		if reason == "" {
+			continue
+		}
+		findings = append(findings, DebugFinding{
+			Severity:  DebugSeverityError,
+			Check:     DebugCheckFailedPod,
+			Kind:      "Pod",
+			Namespace: pod.Namespace,
+			Name:      pod.Name,
+			Reason:    reason,
+			Events:    resourceEvents(ctx, clientset, pod.Namespace, pod.Name),
+			Logs:      notReadyContainerLogs(ctx, clientset, pod),
+		})
+	}
+	return findings
+}
+
+// podFailureReason describes why pod is not ready, empty if all containers are ready
+func podFailureReason(pod v1.Pod) string {
+	// No container statuses means pod hasn't started properly
+	if pod.Status.ContainerStatuses == nil {
+		for _, condition := range pod.Status.Conditions {
+			if condition.Type == v1.PodScheduled && condition.Status != v1.ConditionTrue && condition.Message != "" {
+				return "pod has not started: " + condition.Message
+			}
+		}
+		return "pod has not started"
+	}
+
+	reasons := []string{}
+	for _, containerStatus := range pod.Status.ContainerStatuses {
+		if containerStatus.Ready {
+			continue
+		}
+		reason := "not ready"
+		if containerStatus.State.Waiting != nil && containerStatus.State.Waiting.Reason != "" {
+			reason = containerStatus.State.Waiting.Reason
+		} else if containerStatus.State.Terminated != nil && containerStatus.State.Terminated.Reason != "" {
+			reason = containerStatus.State.Terminated.Reason
+		}
+		reasons = append(reasons, fmt.Sprintf("container %s %s", containerStatus.Name, reason))
+	}
+	return strings.Join(reasons, ", ")
+}
+
+// resourceEvents returns non-normal events of a resource
+func resourceEvents(ctx context.Context, clientset kubernetes.Interface, namespace, name string) []DebugEvent {
+	events, err := clientset.CoreV1().Events(namespace).List(ctx, metav1.ListOptions{
+		FieldSelector: fmt.Sprintf("involvedObject.name=%s,type!=Normal", name),
+	})
+	if err != nil {
+		return nil
+	}
+
+	debugEvents := []DebugEvent{}
+	for _, event := range events.Items {
+		if event.InvolvedObject.Name != name || event.Type == v1.EventTypeNormal {
+			continue
+		}
+		debugEvents = append(debugEvents, DebugEvent{
+			Type:    event.Type,
+			Reason:  event.Reason,
+			Kind:    event.InvolvedObject.Kind,
+			Name:    event.InvolvedObject.Name,
+			Message: event.Message,
+		})
+	}
+	return debugEvents
+}
+
+// notReadyContainerLogs returns last log lines of containers that are not ready
+func notReadyContainerLogs(ctx context.Context, clientset kubernetes.Interface, pod v1.Pod) string {
+	logs := ""
+	for _, containerStatus := range pod.Status.ContainerStatuses {
+		if !containerStatus.Ready {
+			logs += containerLogs(ctx, clientset, pod, containerStatus.Name)
+		}
+	}
+	return logs
+}
+
+// CheckNotReadyStatefulSets reports release statefulsets that have less ready replicas than desired
+func CheckNotReadyStatefulSets(ctx context.Context, clientset kubernetes.Interface, namespace, releaseName string) []DebugFinding {
+	statefulsets, err := releaseStatefulSets(ctx, clientset, namespace, releaseName)
+	if err != nil {
+		return nil
+	}
+
+	findings := []DebugFinding{}
+	for _, sts := range statefulsets {
+		desired := int32(1)
+		if sts.Spec.Replicas != nil {
+			desired = *sts.Spec.Replicas
+		}
+		if sts.Status.ReadyReplicas < desired {
+			findings = append(findings, DebugFinding{
+				Severity:  DebugSeverityError,
+				Check:     DebugCheckNotReadyStatefulSet,
+				Kind:      "StatefulSet",
+				Namespace: sts.Namespace,
+				Name:      sts.Name,
+				Reason:    fmt.Sprintf("%d of %d replicas ready", sts.Status.ReadyReplicas, desired),
+				Events:    resourceEvents(ctx, clientset, sts.Namespace, sts.Name),
+			})
+		}
+	}
+	sort.Slice(findings, func(i, j int) bool { return findings[i].Name < findings[j].Name })
+	return findings
+}
+
+// CheckNotReadyDeployments reports release deployments that have less ready replicas than desired
+func CheckNotReadyDeployments(ctx context.Context, clientset kubernetes.Interface, namespace, releaseName string) []DebugFinding {
+	deployments, err := releaseDeployments(ctx, clientset, namespace, releaseName)
+	if err != nil {
+		return nil
+	}
+
+	findings := []DebugFinding{}
+	for _, deployment := range deployments {
+		desired := int32(1)
+		if deployment.Spec.Replicas != nil {
+			desired = *deployment.Spec.Replicas
+		}
+		if deployment.Status.ReadyReplicas < desired {
+			findings = append(findings, DebugFinding{
+				Severity:  DebugSeverityError,
+				Check:     DebugCheckNotReadyDeployment,
+				Kind:      "Deployment",
+				Namespace: deployment.Namespace,
+				Name:      deployment.Name,
+				Reason:    fmt.Sprintf("%d of %d replicas ready", deployment.Status.ReadyReplicas, desired),
+				Events:    resourceEvents(ctx, clientset, deployment.Namespace, deployment.Name),
+			})
+		}
+	}
+	sort.Slice(findings, func(i, j int) bool { return findings[i].Name < findings[j].Name })
+	return findings
+}
+
+// debugCheckTitles are text report section titles
+var debugCheckTitles = map[string]string{
+	DebugCheckOOMKilled:           "following pods run into Out Of Memory (OOM) issues during deployment (need more memory!)",
+	DebugCheckImagePull:           "container images can't be pulled",
+	DebugCheckUnschedulable:       "pods can't be scheduled",
+	DebugCheckUnboundVolume:       "persistent volume claims are not bound",
+	DebugCheckResourceQuota:       "namespace resource quota is used up",
+	DebugCheckPostReleaseJob:      "post-release job failed",
+	DebugCheckReadinessProbe:      "readiness probes fail",
+	DebugCheckFailedPod:           "pod failures",
+	DebugCheckNotReadyStatefulSet: "statefulset resource failures",
+	DebugCheckNotReadyDeployment:  "deployment resource failures",
+}
+
+// PrintDebugReport prints release debug report as text, json or markdown
+func PrintDebugReport(out io.Writer, report *DebugReport, format string) error {
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	case "markdown":
+		printDebugReportMarkdown(out, report)
+		return nil
+	case "text", "":
+		printDebugReportText(out, report)
+		return nil
+	}
+	return fmt.Errorf("unknown output format: %s (supported: text, json, markdown)", format)
+}
+
+// debugReportSections groups findings by check, keeping the order of findings
+func debugReportSections(report *DebugReport) ([]string, map[string][]DebugFinding) {
+	checks := []string{}
+	sections := map[string][]DebugFinding{}
+	for _, f := range report.Findings {
+		if _, ok := sections[f.Check]; !ok {
+			checks = append(checks, f.Check)
+		}
+		sections[f.Check] = append(sections[f.Check], f)
+	}
+	return checks, sections
+}
+
+func printDebugReportText(out io.Writer, report *DebugReport) {
+	if len(report.Findings) == 0 {
+		fmt.Fprintln(out, "No deployment failures found")
+		return
+	}
+
+	checks, sections := debugReportSections(report)
+	for _, check := range checks {
+		title, ok := debugCheckTitles[check]
+		if !ok {
+			title = check
+		}
+		label := "Warning"
+		for _, f := range sections[check] {
+			if f.Severity == DebugSeverityError {
+				label = "Error"
+			}
+		}
+		fmt.Fprintf(out, "%s: %s:\n", label, title)
+		for _, f := range sections[check] {
+			if f.Container != "" {
+				fmt.Fprintf(out, "  * %s / %s %s: %s\n", f.Namespace, f.Name, f.Container, f.Reason)
+			} else {
+				fmt.Fprintf(out, "  * %s / %s: %s\n", f.Namespace, f.Name, f.Reason)
+			}
+			if f.Hint != "" {
+				fmt.Fprintf(out, "    Hint: %s\n", f.Hint)
+			}
+			if len(f.Events) > 0 {
+				fmt.Fprintln(out, "    ---- Events ----")
+				for _, event := range f.Events {
+					fmt.Fprintf(out, "    %s %s/%s: %s\n", event.Type, event.Kind, event.Name, event.Message)
+				}
+			}
+			if f.Logs != "" {
+				fmt.Fprintln(out, "    ---- Logs ----")
+				for _, line := range strings.Split(strings.TrimRight(f.Logs, "\n"), "\n") {
+					fmt.Fprintf(out, "    %s\n", line)
+				}
+			}
+			if len(f.Events) > 0 || f.Logs != "" {
+				fmt.Fprintln(out, "    ----")
+			}
+		}
+		fmt.Fprintln(out)
+	}
+}
+
+func printDebugReportMarkdown(out io.Writer, report *DebugReport) {
+	fmt.Fprintf(out, "### Release %s failures\n\n", report.Release)
+	if len(report.Findings) == 0 {
+		fmt.Fprintln(out, "No deployment failures found.")
+		return
+	}
+
+	fmt.Fprintln(out, "| Severity | Resource | Reason | Hint |")
+	fmt.Fprintln(out, "| --- | --- | --- | --- |")
+	for _, f := range report.Findings {
+		resource := fmt.Sprintf("%s/%s", f.Kind, f.Name)
+		if f.Container != "" {
+			resource += " (" + f.Container + ")"
+		}
+		fmt.Fprintf(out, "| %s | `%s` | %s | %s |\n", f.Severity, resource, markdownTableCell(f.Reason), markdownTableCell(f.Hint))
+	}
+	fmt.Fprintln(out)
+
+	for _, f := range report.Findings {
+		if len(f.Events) == 0 && f.Logs == "" {
+			continue
+		}
+		fmt.Fprintf(out, "<details><summary>%s/%s</summary>\n\n", f.Kind, f.Name)
+		if len(f.Events) > 0 {
+			fmt.Fprintln(out, "Events:")
+			fmt.Fprintln(out)
+			for _, event := range f.Events {
+				fmt.Fprintf(out, "- %s %s: %s\n", event.Type, event.Reason, event.Message)
+			}
+			fmt.Fprintln(out)
+		}
+		if f.Logs != "" {
+			fmt.Fprintf(out, "Logs:\n\n```\n%s```\n\n", f.Logs)
+		}
+		fmt.Fprintln(out, "</details>")
+		fmt.Fprintln(out)
+	}
+}
+
+// markdownTableCell escapes text for a markdown table cell
+func markdownTableCell(text string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(text, "|", "\\|"), "\n", " ")
+}
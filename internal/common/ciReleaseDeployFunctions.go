@@ -0,0 +1,498 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/Masterminds/semver/v3"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	helmAction "helm.sh/helm/v3/pkg/action"
+	helmChart "helm.sh/helm/v3/pkg/chart"
+	helmLoader "helm.sh/helm/v3/pkg/chart/loader"
+	helmCli "helm.sh/helm/v3/pkg/cli"
+	helmValues "helm.sh/helm/v3/pkg/cli/values"
+	helmGetter "helm.sh/helm/v3/pkg/getter"
+	helmRegistry "helm.sh/helm/v3/pkg/registry"
+	helmRelease "helm.sh/helm/v3/pkg/release"
+	helmDriver "helm.sh/helm/v3/pkg/storage/driver"
+	helmStrvals "helm.sh/helm/v3/pkg/strvals"
+)
+
+// HelmReleaseDeployment holds parameters for an in-process "helm upgrade --install"
+type HelmReleaseDeployment struct {
+	ReleaseName     string
+	Namespace       string
+	ChartName       string
+	ChartRepository string
+	ChartVersion    string
+	// Values files, in order of precedence (later files override earlier ones)
+	ValueFiles []string
+	// Structured values, override values files
+	Values map[string]interface{}
+	// Extra helm flags (see ParseHelmFlags), values override everything else
+	HelmFlags string
+	Timeout   time.Duration
+	Wait      bool
+	// Render release without changing it (server side dry-run, chart lookups are resolved)
+	DryRun bool
+}
+
+// SetChartValue sets a value in a nested values map using dot notation (i.e. "nginx.noauthips.vpn")
+func SetChartValue(values map[string]interface{}, key string, value interface{}) {
+	parts := strings.Split(key, ".")
+	current := values
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := current[part].(map[string]interface{})
+		if !ok {
+			next = map[string]interface{}{}
+			current[part] = next
+		}
+		current = next
+	}
+	current[parts[len(parts)-1]] = value
+}
+
+// MergeChartValues deep merges src values into dst, src values take precedence
+func MergeChartValues(dst map[string]interface{}, src map[string]interface{}) map[string]interface{} {
+	if dst == nil {
+		dst = map[string]interface{}{}
+	}
+	for k, v := range src {
+		if srcMap, ok := v.(map[string]interface{}); ok {
+			if dstMap, ok := dst[k].(map[string]interface{}); ok {
+				dst[k] = MergeChartValues(dstMap, srcMap)
+				continue
+			}
+		}
+		dst[k] = v
+	}
+	return dst
+}
+
+// ChartValueFiles splits comma separated silta configuration file list, skipping empty entries
+func ChartValueFiles(configuration string) []string {
+	files := []string{}
+	for _, f := range strings.Split(configuration, ",") {
+		f = strings.TrimSpace(f)
+		if f != "" {
+			files = append(files, f)
+		}
+	}
+	return files
+}
+
+// splitHelmFlags splits helm flag string into arguments, respecting quotes and backslash escapes
+func splitHelmFlags(flags string) ([]string, error) {
+	args := []string{}
+	var current strings.Builder
+	var quote rune
+	inArg := false
+	escaped := false
+
+	for _, r := range flags {
+		switch {
+		case escaped:
+			current.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped = true
+			inArg = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inArg = true
+		case unicode.IsSpace(r):
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 || escaped {
+		return nil, fmt.Errorf("unterminated quote or escape in helm flags: %s", flags)
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+	return args, nil
+}
+
+// DefaultHelmHistoryMax is the number of release revisions kept, same as "helm upgrade --history-max" default
+const DefaultHelmHistoryMax = 10
+
+// HelmFlags are extra helm flags of a release deployment
+type HelmFlags struct {
+	// --set, --set-string, --set-file, --set-json, --set-literal, --values / -f
+	Values helmValues.Options
+	// --atomic
+	Atomic bool
+	// --force
+	Force bool
+	// --wait-for-jobs
+	WaitForJobs bool
+	// --history-max, 0 keeps all revisions
+	HistoryMax int
+	// --timeout, overrides deployment timeout when set
+	Timeout time.Duration
+	// --version, overrides chart version when set
+	Version string
+	// --debug, print helm debug output
+	Debug bool
+	// Flags that are not supported in-process and were left out
+	Ignored []string
+}
+
+// unsupportedHelmFlags change the cluster or namespace helm talks to, they can't be ignored safely
+var unsupportedHelmFlags = []string{"--kube-context", "--kubeconfig", "--namespace", "-n"}
+
+// ParseHelmFlags parses helm flags. Value flags (--set, --set-string, --set-file, --set-json, --set-literal,
+// --values / -f), --atomic, --force, --wait-for-jobs, --history-max, --timeout, --version and --debug are
+// supported. Flags selecting another cluster or namespace (--kube-context, --kubeconfig, --namespace / -n) are
+// an error, other flags are listed in Ignored.
+func ParseHelmFlags(flags string) (HelmFlags, error) {
+	helmFlags := HelmFlags{HistoryMax: DefaultHelmHistoryMax}
+	options := &helmFlags.Values
+
+	args, err := splitHelmFlags(flags)
+	if err != nil {
+		return helmFlags, err
+	}
+
+	for i := 0; i < len(args); i++ {
+		flag := args[i]
+		value := ""
+		hasValue := false
+		if strings.HasPrefix(flag, "--") && strings.Contains(flag, "=") {
+			parts := strings.SplitN(flag, "=", 2)
+			flag, value, hasValue = parts[0], parts[1], true
+		}
+
+		for _, unsupported := range unsupportedHelmFlags {
+			if flag == unsupported {
+				return helmFlags, fmt.Errorf("helm flag %s is not supported, use silta flags and kubeconfig to select the cluster and namespace", flag)
+			}
+		}
+
+		// Boolean flags
+		boolTarget := (*bool)(nil)
+		switch flag {
+		case "--atomic":
+			boolTarget = &helmFlags.Atomic
+		case "--force":
+			boolTarget = &helmFlags.Force
+		case "--wait-for-jobs":
+			boolTarget = &helmFlags.WaitForJobs
+		case "--debug":
+			boolTarget = &helmFlags.Debug
+		}
+		if boolTarget != nil {
+			*boolTarget = true
+			if hasValue {
+				if *boolTarget, err = strconv.ParseBool(value); err != nil {
+					return helmFlags, fmt.Errorf("invalid value of helm flag %s: %s", flag, value)
+				}
+			}
+			continue
+		}
+
+		target := (*[]string)(nil)
+		switch flag {
+		case "--set":
+			target = &options.Values
+		case "--set-string":
+			target = &options.StringValues
+		case "--set-file":
+			target = &options.FileValues
+		case "--set-json":
+			target = &options.JSONValues
+		case "--set-literal":
+			target = &options.LiteralValues
+		case "--values", "-f":
+			target = &options.ValueFiles
+		case "--history-max", "--timeout", "--version":
+		default:
+			// Value of an unsupported flag is skipped with the flag
+			if !hasValue && i+1 < len(args) && !strings.HasPrefix(args[i+1], "-") {
+				i++
+			}
+			helmFlags.Ignored = append(helmFlags.Ignored, flag)
+			continue
+		}
+
+		if !hasValue {
+			if i+1 >= len(args) {
+				return helmFlags, fmt.Errorf("helm flag %s requires a value", flag)
+			}
+			i++
+			value = args[i]
+		}
+		switch {
+		case flag == "--history-max":
+			if helmFlags.HistoryMax, err = strconv.Atoi(value); err != nil || helmFlags.HistoryMax < 0 {
+				return helmFlags, fmt.Errorf("invalid value of helm flag %s: %s", flag, value)
+			}
+		case flag == "--timeout":
+			if helmFlags.Timeout, err = time.ParseDuration(value); err != nil || helmFlags.Timeout <= 0 {
+				return helmFlags, fmt.Errorf("invalid value of helm flag %s: %s", flag, value)
+			}
+		case flag == "--version":
+			helmFlags.Version = value
+		case target == &options.ValueFiles:
+			*target = append(*target, ChartValueFiles(value)...)
+		default:
+			*target = append(*target, value)
+		}
+	}
+
+	return helmFlags, nil
+}
+
+// WithHelmFlags returns deployment with timeout and chart version overridden by --timeout and --version helm flags
+func (d HelmReleaseDeployment) WithHelmFlags(helmFlags HelmFlags) HelmReleaseDeployment {
+	if helmFlags.Timeout > 0 {
+		d.Timeout = helmFlags.Timeout
+	}
+	if helmFlags.Version != "" {
+		d.ChartVersion = helmFlags.Version
+	}
+	return d
+}
+
+// ComputeReleaseValues merges values files, structured values and extra helm flags into the final release values.
+// Precedence follows helm cli: values files < structured values (former --set lines) < extra helm flags.
+func ComputeReleaseValues(settings *helmCli.EnvSettings, valueFiles []string, values map[string]interface{}, helmFlags string) (map[string]interface{}, error) {
+
+	parsedFlags, err := ParseHelmFlags(helmFlags)
+	if err != nil {
+		return nil, err
+	}
+	flagOptions := parsedFlags.Values
+
+	files := append([]string{}, valueFiles...)
+	files = append(files, flagOptions.ValueFiles...)
+	fileOptions := helmValues.Options{ValueFiles: files}
+	merged, err := fileOptions.MergeValues(helmGetter.All(settings))
+	if err != nil {
+		return nil, err
+	}
+
+	merged = MergeChartValues(merged, values)
+
+	for _, value := range flagOptions.JSONValues {
+		if err := helmStrvals.ParseJSON(value, merged); err != nil {
+			return nil, fmt.Errorf("failed parsing --set-json data %s", value)
+		}
+	}
+	for _, value := range flagOptions.Values {
+		if err := helmStrvals.ParseInto(value, merged); err != nil {
+			return nil, fmt.Errorf("failed parsing --set data: %s", err)
+		}
+	}
+	for _, value := range flagOptions.StringValues {
+		if err := helmStrvals.ParseIntoString(value, merged); err != nil {
+			return nil, fmt.Errorf("failed parsing --set-string data: %s", err)
+		}
+	}
+	for _, value := range flagOptions.FileValues {
+		reader := func(rs []rune) (interface{}, error) {
+			bytes, err := os.ReadFile(string(rs))
+			return string(bytes), err
+		}
+		if err := helmStrvals.ParseIntoFile(value, merged, reader); err != nil {
+			return nil, fmt.Errorf("failed parsing --set-file data: %s", err)
+		}
+	}
+	for _, value := range flagOptions.LiteralValues {
+		if err := helmStrvals.ParseLiteralInto(value, merged); err != nil {
+			return nil, fmt.Errorf("failed parsing --set-literal data: %s", err)
+		}
+	}
+
+	return merged, nil
+}
+
+// LoadHelmChart locates (downloads, if needed) and loads a chart. Local chart paths take precedence over the repository.
+func LoadHelmChart(settings *helmCli.EnvSettings, chartPathOptions *helmAction.ChartPathOptions, chartName string) (*helmChart.Chart, error) {
+
+	chartRef := chartName
+	if _, err := os.Stat(chartRef); err != nil && chartPathOptions.RepoURL != "" && !strings.HasPrefix(chartRef, "oci://") {
+		// Chart is looked up from repository index, drop repository alias (i.e. "wunderio/drupal" -> "drupal")
+		chartRef = path.Base(chartRef)
+	}
+
+	chartPath, err := chartPathOptions.LocateChart(chartRef, settings)
+	if err != nil {
+		return nil, err
+	}
+
+	chart, err := helmLoader.Load(chartPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if req := chart.Metadata.Dependencies; req != nil {
+		if err := helmAction.CheckDependencies(chart, req); err != nil {
+			return nil, fmt.Errorf("an error occurred while checking for chart dependencies: %s", err)
+		}
+	}
+
+	return chart, nil
+}
+
+// UpgradeInstallHelmRelease installs a release or upgrades it when it exists already, like "helm upgrade --install --cleanup-on-fail"
+func UpgradeInstallHelmRelease(ctx context.Context, settings *helmCli.EnvSettings, actionConfig *helmAction.Configuration, d HelmReleaseDeployment) (*helmRelease.Release, error) {
+
+	registryClient, err := helmRegistry.NewClient(
+		helmRegistry.ClientOptCredentialsFile(settings.RegistryConfig),
+		helmRegistry.ClientOptEnableCache(true),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	values, err := ComputeReleaseValues(settings, d.ValueFiles, d.Values, d.HelmFlags)
+	if err != nil {
+		return nil, err
+	}
+	helmFlags, err := ParseHelmFlags(d.HelmFlags)
+	if err != nil {
+		return nil, err
+	}
+	d = d.WithHelmFlags(helmFlags)
+
+	history := helmAction.NewHistory(actionConfig)
+	history.Max = 1
+	_, err = history.Run(d.ReleaseName)
+	if errors.Is(err, helmDriver.ErrReleaseNotFound) {
+
+		install := helmAction.NewInstall(actionConfig)
+		install.SetRegistryClient(registryClient)
+		install.ReleaseName = d.ReleaseName
+		install.Namespace = d.Namespace
+		install.RepoURL = d.ChartRepository
+		install.Version = d.ChartVersion
+		install.Wait = d.Wait
+		install.Timeout = d.Timeout
+		install.Atomic = helmFlags.Atomic
+		install.WaitForJobs = helmFlags.WaitForJobs
+		if d.DryRun {
+			install.DryRunOption = "server"
+			install.Wait = false
+			install.Atomic = false
+			install.WaitForJobs = false
+		}
+
+		chart, err := LoadHelmChart(settings, &install.ChartPathOptions, d.ChartName)
+		if err != nil {
+			return nil, err
+		}
+		return install.RunWithContext(ctx, chart, values)
+
+	} else if err != nil {
+		return nil, err
+	}
+
+	upgrade := helmAction.NewUpgrade(actionConfig)
+	upgrade.SetRegistryClient(registryClient)
+	upgrade.Install = true
+	upgrade.Namespace = d.Namespace
+	upgrade.RepoURL = d.ChartRepository
+	upgrade.Version = d.ChartVersion
+	upgrade.CleanupOnFail = true
+	upgrade.Wait = d.Wait
+	upgrade.Timeout = d.Timeout
+	upgrade.Atomic = helmFlags.Atomic
+	upgrade.Force = helmFlags.Force
+	upgrade.WaitForJobs = helmFlags.WaitForJobs
+	upgrade.MaxHistory = helmFlags.HistoryMax
+	if d.DryRun {
+		upgrade.DryRunOption = "server"
+		upgrade.Wait = false
+		upgrade.Atomic = false
+		upgrade.WaitForJobs = false
+	}
+
+	chart, err := LoadHelmChart(settings, &upgrade.ChartPathOptions, d.ChartName)
+	if err != nil {
+		return nil, err
+	}
+	return upgrade.RunWithContext(ctx, d.ReleaseName, chart, values)
+}
+
+// GetDeployedChart returns chart name and version of the latest release revision, empty strings if release does not exist
+func GetDeployedChart(actionConfig *helmAction.Configuration, releaseName string) (string, string) {
+	history := helmAction.NewHistory(actionConfig)
+	history.Max = 1
+	releases, err := history.Run(releaseName)
+	if err != nil || len(releases) == 0 {
+		return "", ""
+	}
+	latest := releases[len(releases)-1]
+	for _, r := range releases {
+		if r.Version > latest.Version {
+			latest = r
+		}
+	}
+	if latest.Chart == nil || latest.Chart.Metadata == nil {
+		return "", ""
+	}
+	return latest.Chart.Metadata.Name, latest.Chart.Metadata.Version
+}
+
+// DeletePostReleaseJob removes existing post-release job to prevent getting wrong log output
+func DeletePostReleaseJob(clientset kubernetes.Interface, namespace string, releaseName string) error {
+	propagationPolicy := v1.DeletePropagationBackground
+	err := clientset.BatchV1().Jobs(namespace).Delete(context.TODO(), releaseName+"-post-release", v1.DeleteOptions{PropagationPolicy: &propagationPolicy})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// RecreateLegacyMariadbStatefulSet removes mariadb statefulset (pods are kept) when deployed drupal chart
+// is older than drupal-0.3.43. Mariadb subchart update to 7.x requires recreating the statefulset.
+func RecreateLegacyMariadbStatefulSet(clientset kubernetes.Interface, actionConfig *helmAction.Configuration, namespace string, releaseName string) error {
+	chartName, chartVersion := GetDeployedChart(actionConfig, releaseName)
+	if chartName == "" {
+		return nil
+	}
+	fmt.Printf("There is an existing chart deployed with version %s-%s\n", chartName, chartVersion)
+	if chartName != "drupal" {
+		return nil
+	}
+
+	current, err := semver.NewVersion(chartVersion)
+	if err != nil {
+		return nil
+	}
+	if !current.LessThan(semver.MustParse("0.3.43")) {
+		return nil
+	}
+
+	fmt.Println("Recreating statefulset for Mariadb subchart update to 7.x.")
+	propagationPolicy := v1.DeletePropagationOrphan
+	err = clientset.AppsV1().StatefulSets(namespace).Delete(context.TODO(), releaseName+"-mariadb", v1.DeleteOptions{PropagationPolicy: &propagationPolicy})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,446 @@
+package common
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/pmezard/go-difflib/difflib"
+	"gopkg.in/yaml.v2"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic"
+	sigsYaml "sigs.k8s.io/yaml"
+
+	helmAction "helm.sh/helm/v3/pkg/action"
+	helmReleaseutil "helm.sh/helm/v3/pkg/releaseutil"
+)
+
+// Resource change types
+const (
+	ResourceAdded   = "added"
+	ResourceRemoved = "removed"
+	ResourceChanged = "changed"
+)
+
+// ResourceDiff is a unified diff of a single release resource
+type ResourceDiff struct {
+	Kind       string `json:"kind"`
+	APIVersion string `json:"apiVersion"`
+	Namespace  string `json:"namespace,omitempty"`
+	Name       string `json:"name"`
+	Change     string `json:"change"`
+	Diff       string `json:"diff"`
+}
+
+// LiveObjectGetter returns the live cluster state of an object, nil if object does not exist.
+// Namespace of namespaced objects is defaulted to release namespace.
+type LiveObjectGetter func(obj *unstructured.Unstructured) (*unstructured.Unstructured, error)
+
+// Metadata fields managed by the API server or helm, not rendered by charts
+var serverManagedMetadata = []string{"managedFields", "resourceVersion", "uid", "generation", "creationTimestamp", "selfLink"}
+
+var serverManagedAnnotations = []string{
+	"deployment.kubernetes.io/revision",
+	"kubectl.kubernetes.io/last-applied-configuration",
+	"meta.helm.sh/release-name",
+	"meta.helm.sh/release-namespace",
+}
+
+// ManifestObjects parses a rendered release manifest to objects
+func ManifestObjects(manifest string) ([]*unstructured.Unstructured, error) {
+	objects := []*unstructured.Unstructured{}
+	manifests := helmReleaseutil.SplitManifests(manifest)
+	keys := []string{}
+	for key := range manifests {
+		keys = append(keys, key)
+	}
+	sort.Sort(helmReleaseutil.BySplitManifestsOrder(keys))
+	for _, key := range keys {
+		raw, err := sigsYaml.YAMLToJSON([]byte(manifests[key]))
+		if err != nil {
+			return nil, err
+		}
+		if string(raw) == "null" {
+			continue
+		}
+		obj, _, err := unstructured.UnstructuredJSONScheme.Decode(raw, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		u, ok := obj.(*unstructured.Unstructured)
+		if !ok {
+			return nil, fmt.Errorf("unsupported manifest object: %s", obj.GetObjectKind().GroupVersionKind())
+		}
+		objects = append(objects, u)
+	}
+	return objects, nil
+}
+
+// objectKey identifies an object regardless of its api version
+func objectKey(obj *unstructured.Unstructured, namespace string) string {
+	if obj.GetNamespace() != "" {
+		namespace = obj.GetNamespace()
+	}
+	return fmt.Sprintf("%s/%s/%s/%s", obj.GroupVersionKind().Group, obj.GetKind(), namespace, obj.GetName())
+}
+
+// NormalizeObject removes server managed fields and status from an object. When reference objects are given,
+// fields that are not present in any of them are removed too (i.e. values defaulted by the API server).
+func NormalizeObject(obj map[string]interface{}, references ...map[string]interface{}) map[string]interface{} {
+	obj = runtime.DeepCopyJSON(obj)
+	delete(obj, "status")
+	if metadata, ok := obj["metadata"].(map[string]interface{}); ok {
+		for _, field := range serverManagedMetadata {
+			delete(metadata, field)
+		}
+		if annotations, ok := metadata["annotations"].(map[string]interface{}); ok {
+			for _, annotation := range serverManagedAnnotations {
+				delete(annotations, annotation)
+			}
+			if len(annotations) == 0 {
+				delete(metadata, "annotations")
+			}
+		}
+		if labels, ok := metadata["labels"].(map[string]interface{}); ok {
+			if labels["app.kubernetes.io/managed-by"] == "Helm" {
+				delete(labels, "app.kubernetes.io/managed-by")
+			}
+			if len(labels) == 0 {
+				delete(metadata, "labels")
+			}
+		}
+	}
+	refs := []interface{}{}
+	for _, r := range references {
+		if r != nil {
+			refs = append(refs, r)
+		}
+	}
+	if len(refs) == 0 {
+		return obj
+	}
+	return pruneValue(obj, refs).(map[string]interface{})
+}
+
+// pruneValue removes map keys that none of the references have
+func pruneValue(value interface{}, references []interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		pruned := map[string]interface{}{}
+		for key, item := range v {
+			refItems := []interface{}{}
+			for _, r := range references {
+				if refMap, ok := r.(map[string]interface{}); ok {
+					if refItem, ok := refMap[key]; ok {
+						refItems = append(refItems, refItem)
+					}
+				}
+			}
+			if len(refItems) > 0 {
+				pruned[key] = pruneValue(item, refItems)
+			}
+		}
+		return pruned
+	case []interface{}:
+		pruned := []interface{}{}
+		for i, item := range v {
+			refItems := []interface{}{}
+			for _, r := range references {
+				if refList, ok := r.([]interface{}); ok {
+					if refItem := matchListItem(item, i, refList); refItem != nil {
+						refItems = append(refItems, refItem)
+					}
+				}
+			}
+			if len(refItems) > 0 {
+				pruned = append(pruned, pruneValue(item, refItems))
+			} else {
+				pruned = append(pruned, item)
+			}
+		}
+		return pruned
+	}
+	return value
+}
+
+// matchListItem finds the reference list item for a list item, by "name" key for named items and by index otherwise
+func matchListItem(item interface{}, index int, list []interface{}) interface{} {
+	if m, ok := item.(map[string]interface{}); ok {
+		if name, ok := m["name"]; ok {
+			for _, refItem := range list {
+				if refMap, ok := refItem.(map[string]interface{}); ok && refMap["name"] == name {
+					return refItem
+				}
+			}
+			return nil
+		}
+	}
+	if index < len(list) {
+		return list[index]
+	}
+	return nil
+}
+
+// secretData returns Secret data with stringData merged in, base64 encoded like the API server stores it
+func secretData(obj map[string]interface{}) map[string]interface{} {
+	data := map[string]interface{}{}
+	if d, ok := obj["data"].(map[string]interface{}); ok {
+		for k, v := range d {
+			data[k] = v
+		}
+	}
+	if d, ok := obj["stringData"].(map[string]interface{}); ok {
+		for k, v := range d {
+			data[k] = base64.StdEncoding.EncodeToString([]byte(fmt.Sprint(v)))
+		}
+	}
+	return data
+}
+
+// redactSecrets replaces Secret values, marking values that differ between from and to
+func redactSecrets(from map[string]interface{}, to map[string]interface{}) {
+	fromData, toData := map[string]interface{}{}, map[string]interface{}{}
+	if from != nil {
+		fromData = secretData(from)
+	}
+	if to != nil {
+		toData = secretData(to)
+	}
+	redacted := func(data map[string]interface{}, other map[string]interface{}) map[string]interface{} {
+		result := map[string]interface{}{}
+		for k, v := range data {
+			if otherValue, ok := other[k]; ok && otherValue != v {
+				result[k] = "(redacted, changed)"
+			} else {
+				result[k] = "(redacted)"
+			}
+		}
+		return result
+	}
+	if from != nil {
+		delete(from, "stringData")
+		delete(from, "data")
+		if len(fromData) > 0 {
+			// Changes are marked on target side only
+			from["data"] = redacted(fromData, map[string]interface{}{})
+		}
+	}
+	if to != nil {
+		delete(to, "stringData")
+		delete(to, "data")
+		if len(toData) > 0 {
+			to["data"] = redacted(toData, fromData)
+		}
+	}
+}
+
+// objectYaml renders an object for diffing
+func objectYaml(obj map[string]interface{}) (string, error) {
+	if obj == nil {
+		return "", nil
+	}
+	raw, err := yaml.Marshal(obj)
+	if err != nil {
+		return "", err
+	}
+	return string(raw), nil
+}
+
+// DiffObject returns a diff between live and target object state. Previous is the object from the currently
+// deployed release manifest, it's used to tell chart fields from fields defaulted by the API server.
+func DiffObject(live *unstructured.Unstructured, target *unstructured.Unstructured, previous *unstructured.Unstructured) (*ResourceDiff, error) {
+	subject := target
+	change := ResourceChanged
+	if live == nil {
+		change = ResourceAdded
+	} else if target == nil {
+		subject = live
+		change = ResourceRemoved
+	}
+	isSecret := subject.GetKind() == "Secret"
+
+	normalize := func(obj *unstructured.Unstructured) map[string]interface{} {
+		if obj == nil {
+			return nil
+		}
+		normalized := NormalizeObject(obj.Object)
+		if isSecret {
+			// Compare stringData the way API server stores it
+			if data := secretData(normalized); len(data) > 0 {
+				normalized["data"] = data
+			}
+			delete(normalized, "stringData")
+		}
+		return normalized
+	}
+
+	to := normalize(target)
+	var from map[string]interface{}
+	if live != nil {
+		from = NormalizeObject(normalize(live), to, normalize(previous))
+	}
+
+	if isSecret {
+		redactSecrets(from, to)
+	}
+
+	a, err := objectYaml(from)
+	if err != nil {
+		return nil, err
+	}
+	b, err := objectYaml(to)
+	if err != nil {
+		return nil, err
+	}
+	if a == b {
+		return nil, nil
+	}
+
+	name := fmt.Sprintf("%s/%s", strings.ToLower(subject.GetKind()), subject.GetName())
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        diffLines(a),
+		B:        diffLines(b),
+		FromFile: "live " + name,
+		ToFile:   "target " + name,
+		Context:  3,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &ResourceDiff{
+		Kind:       subject.GetKind(),
+		APIVersion: subject.GetAPIVersion(),
+		Namespace:  subject.GetNamespace(),
+		Name:       subject.GetName(),
+		Change:     change,
+		Diff:       diff,
+	}, nil
+}
+
+// DiffReleaseManifests compares target release manifest to live cluster objects. Objects that are in the
+// previous release manifest but not in the target one are reported as removed.
+func DiffReleaseManifests(targetManifest string, previousManifest string, namespace string, getLive LiveObjectGetter) ([]ResourceDiff, error) {
+	targetObjects, err := ManifestObjects(targetManifest)
+	if err != nil {
+		return nil, err
+	}
+	previousObjects, err := ManifestObjects(previousManifest)
+	if err != nil {
+		return nil, err
+	}
+	previousByKey := map[string]*unstructured.Unstructured{}
+	for _, obj := range previousObjects {
+		previousByKey[objectKey(obj, namespace)] = obj
+	}
+
+	diffs := []ResourceDiff{}
+	seen := map[string]bool{}
+	for _, target := range targetObjects {
+		key := objectKey(target, namespace)
+		seen[key] = true
+		live, err := getLive(target)
+		if err != nil {
+			return nil, err
+		}
+		diff, err := DiffObject(live, target, previousByKey[key])
+		if err != nil {
+			return nil, err
+		}
+		if diff != nil {
+			diffs = append(diffs, *diff)
+		}
+	}
+
+	for _, previous := range previousObjects {
+		if seen[objectKey(previous, namespace)] {
+			continue
+		}
+		live, err := getLive(previous)
+		if err != nil {
+			return nil, err
+		}
+		if live == nil {
+			continue
+		}
+		diff, err := DiffObject(live, nil, previous)
+		if err != nil {
+			return nil, err
+		}
+		if diff != nil {
+			diffs = append(diffs, *diff)
+		}
+	}
+
+	return diffs, nil
+}
+
+// DeployedReleaseManifest returns manifest of the currently deployed release revision, empty string if there is none
+func DeployedReleaseManifest(actionConfig *helmAction.Configuration, releaseName string) string {
+	deployed, err := actionConfig.Releases.Deployed(releaseName)
+	if err != nil {
+		return ""
+	}
+	return deployed.Manifest
+}
+
+// NewLiveObjectGetter returns a LiveObjectGetter that reads objects with a dynamic client
+func NewLiveObjectGetter(client dynamic.Interface, mapper meta.RESTMapper, namespace string) LiveObjectGetter {
+	return func(obj *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+		gvk := obj.GroupVersionKind()
+		mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+		if err != nil {
+			return nil, err
+		}
+		var resource dynamic.ResourceInterface = client.Resource(mapping.Resource)
+		if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+			if obj.GetNamespace() == "" {
+				obj.SetNamespace(namespace)
+			}
+			resource = client.Resource(mapping.Resource).Namespace(obj.GetNamespace())
+		}
+		live, err := resource.Get(context.TODO(), obj.GetName(), v1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return live, err
+	}
+}
+
+// PrintResourceDiffs prints release resource diffs as text, json or markdown
+func PrintResourceDiffs(out io.Writer, diffs []ResourceDiff, format string) error {
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(diffs)
+	case "markdown":
+		if len(diffs) == 0 {
+			fmt.Fprintln(out, "No changes in release resources.")
+			return nil
+		}
+		fmt.Fprintf(out, "%d release resource(s) changed:\n\n", len(diffs))
+		for _, d := range diffs {
+			fmt.Fprintf(out, "<details><summary>%s %s (%s)</summary>\n\n```diff\n%s```\n</details>\n\n", d.Kind, d.Name, d.Change, d.Diff)
+		}
+		return nil
+	case "text", "":
+		if len(diffs) == 0 {
+			fmt.Fprintln(out, "No changes in release resources.")
+			return nil
+		}
+		for _, d := range diffs {
+			fmt.Fprintf(out, "%s, %s, %s (%s) has been %s:\n%s\n", d.Namespace, d.Name, d.Kind, d.APIVersion, d.Change, d.Diff)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown output format: %s (supported: text, json, markdown)", format)
+}
@@ -0,0 +1,449 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Annotations and labels of downscaled release resources, shared with silta auto-downscaler
+const (
+	DownscaleOriginalReplicasAnnotation = "auto-downscale/original-replicas"
+	DownscaleOriginalSelectorAnnotation = "auto-downscale/original-selector"
+	DownscaleOriginalTypeAnnotation     = "auto-downscale/original-type"
+	DownscaleOriginalPortsAnnotation    = "auto-downscale/original-ports"
+	DownscaleDownAnnotation             = "auto-downscale/down"
+	DownscaleRedirectedLabel            = "auto-downscale/redirected"
+)
+
+// Release resources are selected by both of these labels
+var releaseSelectorLabels = []string{
+	"release",
+	"app.kubernetes.io/instance",
+}
+
+func releaseDeployments(ctx context.Context, clientset kubernetes.Interface, namespace string, releaseName string) ([]appsv1.Deployment, error) {
+	items := []appsv1.Deployment{}
+	seen := map[string]bool{}
+	for _, l := range releaseSelectorLabels {
+		list, err := clientset.AppsV1().Deployments(namespace).List(ctx, v1.ListOptions{LabelSelector: l + "=" + releaseName})
+		if err != nil {
+			return nil, fmt.Errorf("error getting the list of deployments: %s", err)
+		}
+		for _, item := range list.Items {
+			if !seen[item.Name] {
+				seen[item.Name] = true
+				items = append(items, item)
+			}
+		}
+	}
+	return items, nil
+}
+
+func releaseStatefulSets(ctx context.Context, clientset kubernetes.Interface, namespace string, releaseName string) ([]appsv1.StatefulSet, error) {
+	items := []appsv1.StatefulSet{}
+	seen := map[string]bool{}
+	for _, l := range releaseSelectorLabels {
+		list, err := clientset.AppsV1().StatefulSets(namespace).List(ctx, v1.ListOptions{LabelSelector: l + "=" + releaseName})
+		if err != nil {
+			return nil, fmt.Errorf("error getting the list of statefulsets: %s", err)
+		}
+		for _, item := range list.Items {
+			if !seen[item.Name] {
+				seen[item.Name] = true
+				items = append(items, item)
+			}
+		}
+	}
+	return items, nil
+}
+
+func releaseCronJobs(ctx context.Context, clientset kubernetes.Interface, namespace string, releaseName string) ([]batchv1.CronJob, error) {
+	items := []batchv1.CronJob{}
+	seen := map[string]bool{}
+	for _, l := range releaseSelectorLabels {
+		list, err := clientset.BatchV1().CronJobs(namespace).List(ctx, v1.ListOptions{LabelSelector: l + "=" + releaseName})
+		if err != nil {
+			return nil, fmt.Errorf("error getting the list of cronjobs: %s", err)
+		}
+		for _, item := range list.Items {
+			if !seen[item.Name] {
+				seen[item.Name] = true
+				items = append(items, item)
+			}
+		}
+	}
+	return items, nil
+}
+
+func releaseServices(ctx context.Context, clientset kubernetes.Interface, namespace string, releaseName string) ([]corev1.Service, error) {
+	items := []corev1.Service{}
+	seen := map[string]bool{}
+	for _, l := range releaseSelectorLabels {
+		list, err := clientset.CoreV1().Services(namespace).List(ctx, v1.ListOptions{LabelSelector: l + "=" + releaseName})
+		if err != nil {
+			return nil, fmt.Errorf("error getting the list of services: %s", err)
+		}
+		for _, item := range list.Items {
+			if !seen[item.Name] {
+				seen[item.Name] = true
+				items = append(items, item)
+			}
+		}
+	}
+	return items, nil
+}
+
+// DownscaleRelease scales release deployments and statefulsets to zero, suspends cronjobs and redirects services to
+// a placeholder host (ExternalName service). Original state is stored in "auto-downscale/*" annotations, so the
+// release can be restored with WakeupRelease.
+func DownscaleRelease(ctx context.Context, clientset kubernetes.Interface, namespace string, releaseName string, placeholderHost string, out io.Writer) error {
+
+	fmt.Fprintln(out, "Scaling down deployments")
+	deployments, err := releaseDeployments(ctx, clientset, namespace, releaseName)
+	if err != nil {
+		return err
+	}
+	for _, r := range deployments {
+		if r.Spec.Replicas != nil && *r.Spec.Replicas == 0 {
+			continue
+		}
+		replicas := int32(1)
+		if r.Spec.Replicas != nil {
+			replicas = *r.Spec.Replicas
+		}
+		fmt.Fprintf(out, "Scaling %s to 0 replicas\n", r.Name)
+		if r.Annotations == nil {
+			r.Annotations = map[string]string{}
+		}
+		r.Annotations[DownscaleOriginalReplicasAnnotation] = strconv.Itoa(int(replicas))
+		r.Spec.Replicas = new(int32)
+		if _, err := clientset.AppsV1().Deployments(namespace).Update(ctx, &r, v1.UpdateOptions{}); err != nil {
+			return fmt.Errorf("error updating deployment %s: %s", r.Name, err)
+		}
+	}
+
+	fmt.Fprintln(out, "Scaling down statefulsets")
+	statefulsets, err := releaseStatefulSets(ctx, clientset, namespace, releaseName)
+	if err != nil {
+		return err
+	}
+	for _, r := range statefulsets {
+		if r.Spec.Replicas != nil && *r.Spec.Replicas == 0 {
+			continue
+		}
+		replicas := int32(1)
+		if r.Spec.Replicas != nil {
+			replicas = *r.Spec.Replicas
+		}
+		fmt.Fprintf(out, "Scaling %s to 0 replicas\n", r.Name)
+		if r.Annotations == nil {
+			r.Annotations = map[string]string{}
+		}
+		r.Annotations[DownscaleOriginalReplicasAnnotation] = strconv.Itoa(int(replicas))
+		r.Spec.Replicas = new(int32)
+		if _, err := clientset.AppsV1().StatefulSets(namespace).Update(ctx, &r, v1.UpdateOptions{}); err != nil {
+			return fmt.Errorf("error updating statefulset %s: %s", r.Name, err)
+		}
+	}
+
+	fmt.Fprintln(out, "Suspending cronjobs")
+	cronjobs, err := releaseCronJobs(ctx, clientset, namespace, releaseName)
+	if err != nil {
+		return err
+	}
+	for _, r := range cronjobs {
+		if r.Spec.Suspend != nil && *r.Spec.Suspend {
+			continue
+		}
+		fmt.Fprintf(out, "Suspending %s\n", r.Name)
+		suspend := true
+		r.Spec.Suspend = &suspend
+		if _, err := clientset.BatchV1().CronJobs(namespace).Update(ctx, &r, v1.UpdateOptions{}); err != nil {
+			return fmt.Errorf("error updating cronjob %s: %s", r.Name, err)
+		}
+	}
+
+	fmt.Fprintln(out, "Redirecting services")
+	services, err := releaseServices(ctx, clientset, namespace, releaseName)
+	if err != nil {
+		return err
+	}
+	for _, r := range services {
+		// Already redirected, keep the original definition
+		if r.Annotations[DownscaleOriginalSelectorAnnotation] != "" {
+			continue
+		}
+		// Headless services have no traffic to redirect
+		if r.Spec.ClusterIP == corev1.ClusterIPNone || r.Spec.Type == corev1.ServiceTypeExternalName {
+			continue
+		}
+
+		originalSelector, err := json.Marshal(r.Spec.Selector)
+		if err != nil {
+			return err
+		}
+		originalPorts, err := json.Marshal(r.Spec.Ports)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(out, "Redirecting %s to %s\n", r.Name, placeholderHost)
+
+		// Service type can't be changed in place, service is recreated
+		newService := corev1.Service{
+			ObjectMeta: v1.ObjectMeta{
+				Name:        r.Name,
+				Namespace:   r.Namespace,
+				Annotations: r.Annotations,
+				Labels:      r.Labels,
+			},
+			Spec: corev1.ServiceSpec{
+				Type:         corev1.ServiceTypeExternalName,
+				ExternalName: placeholderHost,
+			},
+		}
+		for _, port := range r.Spec.Ports {
+			newService.Spec.Ports = append(newService.Spec.Ports, corev1.ServicePort{
+				Name:       port.Name,
+				Protocol:   port.Protocol,
+				Port:       port.Port,
+				TargetPort: port.TargetPort,
+			})
+		}
+		if newService.Annotations == nil {
+			newService.Annotations = map[string]string{}
+		}
+		if newService.Labels == nil {
+			newService.Labels = map[string]string{}
+		}
+		newService.Annotations[DownscaleOriginalTypeAnnotation] = string(r.Spec.Type)
+		newService.Annotations[DownscaleOriginalSelectorAnnotation] = string(originalSelector)
+		newService.Annotations[DownscaleOriginalPortsAnnotation] = string(originalPorts)
+		newService.Annotations[DownscaleDownAnnotation] = "true"
+		newService.Labels[DownscaleRedirectedLabel] = "true"
+
+		if err := clientset.CoreV1().Services(namespace).Delete(ctx, r.Name, v1.DeleteOptions{}); err != nil {
+			return fmt.Errorf("error deleting service %s: %s", r.Name, err)
+		}
+		if _, err := clientset.CoreV1().Services(namespace).Create(ctx, &newService, v1.CreateOptions{}); err != nil {
+			return fmt.Errorf("error creating service %s: %s", r.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// WakeupRelease restores a release downscaled by DownscaleRelease (or silta auto-downscaler) and returns ingress
+// hostnames of the release. With non-zero readyTimeout, it waits for at least one ready replica of every workload.
+func WakeupRelease(ctx context.Context, clientset kubernetes.Interface, namespace string, releaseName string, readyTimeout time.Duration, out io.Writer) ([]string, error) {
+
+	// Restore replicas to original state if found
+	fmt.Fprintln(out, "Scaling deployments")
+	deployments, err := releaseDeployments(ctx, clientset, namespace, releaseName)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range deployments {
+		replicas, err := originalReplicas(r.Spec.Replicas, r.Annotations)
+		if err != nil {
+			return nil, fmt.Errorf("deployment %s: %s", r.Name, err)
+		}
+		if replicas == nil {
+			continue
+		}
+		fmt.Fprintf(out, "Scaling %s to %d replica(s)\n", r.Name, *replicas)
+		r.Spec.Replicas = replicas
+		delete(r.Annotations, DownscaleOriginalReplicasAnnotation)
+		if _, err := clientset.AppsV1().Deployments(namespace).Update(ctx, &r, v1.UpdateOptions{}); err != nil {
+			return nil, fmt.Errorf("error updating deployment %s: %s", r.Name, err)
+		}
+	}
+	if readyTimeout > 0 {
+		for _, r := range deployments {
+			err := wait.PollUntilContextTimeout(ctx, 5*time.Second, readyTimeout, true, func(ctx context.Context) (bool, error) {
+				d, err := clientset.AppsV1().Deployments(namespace).Get(ctx, r.Name, v1.GetOptions{})
+				if err != nil {
+					return false, err
+				}
+				return d.Status.ReadyReplicas > 0 || (d.Spec.Replicas != nil && d.Status.ReadyReplicas == *d.Spec.Replicas), nil
+			})
+			if err != nil {
+				return nil, fmt.Errorf("timeout waiting for %s to be ready", r.Name)
+			}
+		}
+	}
+
+	fmt.Fprintln(out, "Scaling statefulsets")
+	statefulsets, err := releaseStatefulSets(ctx, clientset, namespace, releaseName)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range statefulsets {
+		replicas, err := originalReplicas(r.Spec.Replicas, r.Annotations)
+		if err != nil {
+			return nil, fmt.Errorf("statefulset %s: %s", r.Name, err)
+		}
+		if replicas == nil {
+			continue
+		}
+		fmt.Fprintf(out, "Scaling %s to %d replica(s)\n", r.Name, *replicas)
+		r.Spec.Replicas = replicas
+		delete(r.Annotations, DownscaleOriginalReplicasAnnotation)
+		if _, err := clientset.AppsV1().StatefulSets(namespace).Update(ctx, &r, v1.UpdateOptions{}); err != nil {
+			return nil, fmt.Errorf("error updating statefulset %s: %s", r.Name, err)
+		}
+	}
+	if readyTimeout > 0 {
+		for _, r := range statefulsets {
+			err := wait.PollUntilContextTimeout(ctx, 5*time.Second, readyTimeout, true, func(ctx context.Context) (bool, error) {
+				s, err := clientset.AppsV1().StatefulSets(namespace).Get(ctx, r.Name, v1.GetOptions{})
+				if err != nil {
+					return false, err
+				}
+				return s.Status.ReadyReplicas > 0 || (s.Spec.Replicas != nil && s.Status.ReadyReplicas == *s.Spec.Replicas), nil
+			})
+			if err != nil {
+				return nil, fmt.Errorf("timeout waiting for %s to be ready", r.Name)
+			}
+		}
+	}
+
+	fmt.Fprintln(out, "Resuming cronjobs")
+	cronjobs, err := releaseCronJobs(ctx, clientset, namespace, releaseName)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range cronjobs {
+		if r.Spec.Suspend == nil || !*r.Spec.Suspend {
+			continue
+		}
+		fmt.Fprintf(out, "Unpausing %s\n", r.Name)
+		suspend := false
+		r.Spec.Suspend = &suspend
+		if _, err := clientset.BatchV1().CronJobs(namespace).Update(ctx, &r, v1.UpdateOptions{}); err != nil {
+			return nil, fmt.Errorf("error updating cronjob %s: %s", r.Name, err)
+		}
+	}
+
+	fmt.Fprintln(out, "Restoring services")
+	services, err := releaseServices(ctx, clientset, namespace, releaseName)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range services {
+		// If auto-downscale/original-selector is not set, skip
+		if r.Annotations[DownscaleOriginalSelectorAnnotation] == "" {
+			continue
+		}
+
+		fmt.Fprintf(out, "Resetting %s\n", r.Name)
+
+		// Recreate service with original definition and change type
+		newService := corev1.Service{
+			ObjectMeta: v1.ObjectMeta{
+				Name:        r.Name,
+				Namespace:   r.Namespace,
+				Annotations: r.Annotations,
+				Labels:      r.Labels,
+			},
+			Spec: r.Spec,
+		}
+
+		// Restore type, fall back to current type when annotation is missing
+		if r.Annotations[DownscaleOriginalTypeAnnotation] != "" {
+			newService.Spec.Type = corev1.ServiceType(r.Annotations[DownscaleOriginalTypeAnnotation])
+		}
+
+		// Remove newService.Spec.ExternalName, we don't use it anymore
+		newService.Spec.ExternalName = ""
+
+		originalSelector := map[string]string{}
+		if err := json.Unmarshal([]byte(r.Annotations[DownscaleOriginalSelectorAnnotation]), &originalSelector); err != nil {
+			return nil, fmt.Errorf("error parsing original selector for %s/%s", namespace, r.Name)
+		}
+		newService.Spec.Selector = originalSelector
+
+		// Old downscales did not set ports. If original ports are not set, use current ports.
+		if r.Annotations[DownscaleOriginalPortsAnnotation] != "" {
+			originalPorts := []corev1.ServicePort{}
+			if err := json.Unmarshal([]byte(r.Annotations[DownscaleOriginalPortsAnnotation]), &originalPorts); err != nil {
+				return nil, fmt.Errorf("error parsing original ports for %s/%s", namespace, r.Name)
+			}
+			// Readd ports, but skip nodeport value
+			newService.Spec.Ports = []corev1.ServicePort{}
+			for _, port := range originalPorts {
+				newService.Spec.Ports = append(newService.Spec.Ports, corev1.ServicePort{
+					Name:       port.Name,
+					Protocol:   port.Protocol,
+					Port:       port.Port,
+					TargetPort: port.TargetPort,
+				})
+			}
+		}
+
+		delete(newService.Annotations, DownscaleOriginalTypeAnnotation)
+		delete(newService.Annotations, DownscaleOriginalSelectorAnnotation)
+		delete(newService.Annotations, DownscaleOriginalPortsAnnotation)
+		delete(newService.Labels, DownscaleRedirectedLabel)
+		newService.Annotations[DownscaleDownAnnotation] = "false"
+
+		if err := clientset.CoreV1().Services(namespace).Delete(ctx, r.Name, v1.DeleteOptions{}); err != nil {
+			return nil, fmt.Errorf("error deleting service: %s", err)
+		}
+		if _, err := clientset.CoreV1().Services(namespace).Create(ctx, &newService, v1.CreateOptions{}); err != nil {
+			return nil, fmt.Errorf("error creating new service: %s", err)
+		}
+		fmt.Fprintf(out, "Reset %s to original service\n", r.Name)
+	}
+
+	return ReleaseHostnames(ctx, clientset, namespace, releaseName)
+}
+
+// originalReplicas returns replica count to restore for a workload scaled to zero, nil if workload is running
+func originalReplicas(replicas *int32, annotations map[string]string) (*int32, error) {
+	if replicas == nil || *replicas != 0 {
+		return nil, nil
+	}
+	original := annotations[DownscaleOriginalReplicasAnnotation]
+	if original == "" {
+		original = "1"
+	}
+	value, err := strconv.ParseInt(original, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("error converting original replicas to int: %s", err)
+	}
+	result := int32(value)
+	return &result, nil
+}
+
+// ReleaseHostnames returns unique ingress hostnames of a release
+func ReleaseHostnames(ctx context.Context, clientset kubernetes.Interface, namespace string, releaseName string) ([]string, error) {
+	hostnames := []string{}
+	seen := map[string]bool{}
+	for _, l := range releaseSelectorLabels {
+		list, err := clientset.NetworkingV1().Ingresses(namespace).List(ctx, v1.ListOptions{LabelSelector: l + "=" + releaseName})
+		if err != nil {
+			return nil, fmt.Errorf("error getting the list of ingresses: %s", err)
+		}
+		for _, ingress := range list.Items {
+			for _, rule := range ingress.Spec.Rules {
+				if rule.Host != "" && !seen[rule.Host] {
+					seen[rule.Host] = true
+					hostnames = append(hostnames, rule.Host)
+				}
+			}
+		}
+	}
+	return hostnames, nil
+}
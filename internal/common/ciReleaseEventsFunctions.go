@@ -0,0 +1,301 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	v1core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+)
+
+// ReleaseEvent is a kubernetes event of a release object, repeated events are merged
+type ReleaseEvent struct {
+	FirstSeen time.Time
+	LastSeen  time.Time
+	Type      string
+	Reason    string
+	Kind      string
+	Name      string
+	Message   string
+	Count     int32
+}
+
+// key identifies repeats of the same event
+func (e ReleaseEvent) key() string {
+	return strings.Join([]string{e.Kind, e.Name, e.Type, e.Reason, e.Message}, "\x00")
+}
+
+// String formats event as a timeline line
+func (e ReleaseEvent) String() string {
+	line := fmt.Sprintf("%s %s %s %s/%s: %s", e.LastSeen.UTC().Format(time.RFC3339), e.Type, e.Reason, e.Kind, e.Name, e.Message)
+	if e.Count > 1 {
+		line += fmt.Sprintf(" (x%d)", e.Count)
+	}
+	return line
+}
+
+// releaseObjectMatcher tells if an event belongs to a release object. Release objects are listed with release
+// labels, pods are also matched by the name of their owner (i.e. pods that have been deleted since).
+type releaseObjectMatcher struct {
+	ctx       context.Context
+	clientset kubernetes.Interface
+	namespace string
+	release   string
+	objects   map[string]bool
+	owners    []string
+	// Objects are relisted on a miss, at most once per refreshInterval
+	refreshInterval time.Duration
+	refreshed       time.Time
+}
+
+func newReleaseObjectMatcher(ctx context.Context, clientset kubernetes.Interface, namespace, releaseName string, refreshInterval time.Duration) (*releaseObjectMatcher, error) {
+	m := &releaseObjectMatcher{
+		ctx:             ctx,
+		clientset:       clientset,
+		namespace:       namespace,
+		release:         releaseName,
+		refreshInterval: refreshInterval,
+	}
+	return m, m.refresh()
+}
+
+func (m *releaseObjectMatcher) refresh() error {
+	objects := map[string]bool{}
+	owners := []string{}
+	for _, k := range releaseResourceKinds {
+		for _, l := range releaseSelectorLabels {
+			list, err := k.list(m.ctx, m.clientset, m.namespace, v1.ListOptions{LabelSelector: l + "=" + m.release})
+			if err != nil {
+				return fmt.Errorf("error getting the list of %ss: %s", k.kind, err)
+			}
+			for _, obj := range list {
+				accessor, err := meta.Accessor(obj)
+				if err != nil {
+					continue
+				}
+				objects[k.kind+"/"+accessor.GetName()] = true
+				if k.kind == "replicaset" || k.kind == "statefulset" || k.kind == "job" {
+					owners = append(owners, accessor.GetName()+"-")
+				}
+			}
+		}
+	}
+	m.objects = objects
+	m.owners = owners
+	m.refreshed = time.Now()
+	return nil
+}
+
+func (m *releaseObjectMatcher) lookup(ref v1core.ObjectReference) bool {
+	kind := strings.ToLower(ref.Kind)
+	if m.objects[kind+"/"+ref.Name] {
+		return true
+	}
+	if kind == "pod" {
+		for _, owner := range m.owners {
+			if strings.HasPrefix(ref.Name, owner) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matches returns true if the event object is a release object, objects are relisted to find new objects
+func (m *releaseObjectMatcher) matches(ref v1core.ObjectReference) bool {
+	if m.lookup(ref) {
+		return true
+	}
+	if m.refreshInterval > 0 && time.Since(m.refreshed) >= m.refreshInterval {
+		if m.refresh() == nil {
+			return m.lookup(ref)
+		}
+	}
+	return false
+}
+
+// eventTime returns the time an event was last seen
+func eventTime(event v1core.Event) time.Time {
+	switch {
+	case !event.LastTimestamp.IsZero():
+		return event.LastTimestamp.Time
+	case !event.EventTime.IsZero():
+		return event.EventTime.Time
+	case !event.FirstTimestamp.IsZero():
+		return event.FirstTimestamp.Time
+	}
+	return event.CreationTimestamp.Time
+}
+
+// releaseEvent converts a kubernetes event
+func releaseEvent(event v1core.Event) ReleaseEvent {
+	lastSeen := eventTime(event)
+	firstSeen := event.FirstTimestamp.Time
+	if firstSeen.IsZero() || firstSeen.After(lastSeen) {
+		firstSeen = lastSeen
+	}
+	count := event.Count
+	if event.Series != nil && event.Series.Count > count {
+		count = event.Series.Count
+	}
+	if count < 1 {
+		count = 1
+	}
+	return ReleaseEvent{
+		FirstSeen: firstSeen,
+		LastSeen:  lastSeen,
+		Type:      event.Type,
+		Reason:    event.Reason,
+		Kind:      event.InvolvedObject.Kind,
+		Name:      event.InvolvedObject.Name,
+		Message:   strings.TrimSpace(event.Message),
+		Count:     count,
+	}
+}
+
+// MergeReleaseEvents merges repeated events, summing their counts, and sorts them by the time they were last seen.
+// Events last seen before "since" are skipped.
+func MergeReleaseEvents(events []ReleaseEvent, since time.Time) []ReleaseEvent {
+	merged := map[string]*ReleaseEvent{}
+	keys := []string{}
+	for _, e := range events {
+		if e.LastSeen.Before(since) {
+			continue
+		}
+		key := e.key()
+		existing, ok := merged[key]
+		if !ok {
+			e := e
+			merged[key] = &e
+			keys = append(keys, key)
+			continue
+		}
+		existing.Count += e.Count
+		if e.FirstSeen.Before(existing.FirstSeen) {
+			existing.FirstSeen = e.FirstSeen
+		}
+		if e.LastSeen.After(existing.LastSeen) {
+			existing.LastSeen = e.LastSeen
+		}
+	}
+
+	result := []ReleaseEvent{}
+	for _, key := range keys {
+		result = append(result, *merged[key])
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].LastSeen.Before(result[j].LastSeen)
+	})
+	return result
+}
+
+// ReleaseEvents returns events of objects selected by release labels, merged and sorted chronologically
+func ReleaseEvents(ctx context.Context, clientset kubernetes.Interface, namespace, releaseName string, since time.Time) ([]ReleaseEvent, error) {
+	matcher, err := newReleaseObjectMatcher(ctx, clientset, namespace, releaseName, 0)
+	if err != nil {
+		return nil, err
+	}
+	list, err := clientset.CoreV1().Events(namespace).List(ctx, v1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("error getting the list of events: %s", err)
+	}
+
+	events := []ReleaseEvent{}
+	for _, event := range list.Items {
+		if matcher.matches(event.InvolvedObject) {
+			events = append(events, releaseEvent(event))
+		}
+	}
+	return MergeReleaseEvents(events, since), nil
+}
+
+// PrintReleaseEvents prints events one per line
+func PrintReleaseEvents(out io.Writer, events []ReleaseEvent) {
+	for _, e := range events {
+		fmt.Fprintln(out, e.String())
+	}
+}
+
+// FollowReleaseEvents prints release events, then watches and prints new and repeated events until context is
+// cancelled. Repeated events are printed with updated count.
+func FollowReleaseEvents(ctx context.Context, clientset kubernetes.Interface, namespace, releaseName string, since time.Time, out io.Writer) error {
+	matcher, err := newReleaseObjectMatcher(ctx, clientset, namespace, releaseName, 5*time.Second)
+	if err != nil {
+		return err
+	}
+
+	// Current events are printed as a merged timeline
+	list, err := clientset.CoreV1().Events(namespace).List(ctx, v1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("error getting the list of events: %s", err)
+	}
+	current := []ReleaseEvent{}
+	printed := map[string]ReleaseEvent{}
+	seen := map[string]int32{}
+	for _, event := range list.Items {
+		seen[event.Name] = releaseEvent(event).Count
+		if matcher.matches(event.InvolvedObject) {
+			current = append(current, releaseEvent(event))
+		}
+	}
+	for _, e := range MergeReleaseEvents(current, since) {
+		printed[e.key()] = e
+		fmt.Fprintln(out, e.String())
+	}
+
+	source := watchSource{
+		list: func(ctx context.Context) ([]runtime.Object, string, error) {
+			events, err := clientset.CoreV1().Events(namespace).List(ctx, v1.ListOptions{})
+			if err != nil {
+				return nil, "", err
+			}
+			objects := []runtime.Object{}
+			for i := range events.Items {
+				objects = append(objects, &events.Items[i])
+			}
+			return objects, events.ResourceVersion, nil
+		},
+		watch: func(ctx context.Context, resourceVersion string) (watch.Interface, error) {
+			return clientset.CoreV1().Events(namespace).Watch(ctx, v1.ListOptions{ResourceVersion: resourceVersion})
+		},
+	}
+
+	err = watchObjects(ctx, source, func(obj runtime.Object) (bool, error) {
+		event, ok := obj.(*v1core.Event)
+		if !ok {
+			return false, nil
+		}
+		e := releaseEvent(*event)
+		// Skip events that were already handled (i.e. when events are relisted)
+		if count, ok := seen[event.Name]; ok && count >= e.Count {
+			return false, nil
+		}
+		previous := seen[event.Name]
+		seen[event.Name] = e.Count
+		if e.LastSeen.Before(since) || !matcher.matches(event.InvolvedObject) {
+			return false, nil
+		}
+
+		// Repeats of printed events add to their count
+		if p, ok := printed[e.key()]; ok {
+			p.Count += e.Count - previous
+			p.LastSeen = e.LastSeen
+			e = p
+		}
+		printed[e.key()] = e
+		fmt.Fprintln(out, e.String())
+		return false, nil
+	})
+	if ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,144 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+	v1core "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+// DefaultExecComponents are tried in order when exec component is not set
+var DefaultExecComponents = []string{"shell", "php"}
+
+// DefaultExecCommand opens bash, or sh when bash is not available
+var DefaultExecCommand = []string{"/bin/sh", "-c", "command -v bash >/dev/null && exec bash || exec sh"}
+
+// ReleaseExec holds parameters for running a command in a release pod
+type ReleaseExec struct {
+	Namespace string
+	Pod       string
+	Container string
+	Command   []string
+	Stdin     io.Reader
+	Stdout    io.Writer
+	Stderr    io.Writer
+	// Allocate a terminal, stderr is merged into stdout
+	TTY bool
+	// Terminal size changes, used with TTY
+	TerminalSizeQueue remotecommand.TerminalSizeQueue
+}
+
+// podReady returns true if pod is running and ready
+func podReady(pod *v1core.Pod) bool {
+	if pod.Status.Phase != v1core.PodRunning || pod.DeletionTimestamp != nil {
+		return false
+	}
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == v1core.PodReady {
+			return condition.Status == v1core.ConditionTrue
+		}
+	}
+	return false
+}
+
+// FindReleasePod returns a ready release pod and container of the first component that has one. Cronjob pods are
+// not considered. Container named after the component is preferred.
+func FindReleasePod(ctx context.Context, clientset kubernetes.Interface, namespace, releaseName string, components []string) (*v1core.Pod, string, error) {
+	pods, err := listReleasePods(ctx, clientset, namespace, releaseName)
+	if err != nil {
+		return nil, "", err
+	}
+
+	for _, component := range components {
+		for i := range pods {
+			pod := &pods[i]
+			if pod.Labels["cronjob"] == "true" || !podReady(pod) {
+				continue
+			}
+			matched := ""
+			for _, container := range pod.Spec.Containers {
+				if container.Name == component {
+					matched = container.Name
+					break
+				}
+				if matched == "" && MatchesComponent(pod, container.Name, releaseName, []string{component}) {
+					matched = container.Name
+				}
+			}
+			if matched != "" {
+				return pod, matched, nil
+			}
+		}
+	}
+	return nil, "", fmt.Errorf("no ready %s pod found in release %s", strings.Join(components, " or "), releaseName)
+}
+
+// ExecInPod runs a command in a pod container over SPDY, same as "kubectl exec"
+func ExecInPod(ctx context.Context, config *rest.Config, clientset kubernetes.Interface, e ReleaseExec) error {
+	req := clientset.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(e.Namespace).
+		Name(e.Pod).
+		SubResource("exec").
+		VersionedParams(&v1core.PodExecOptions{
+			Container: e.Container,
+			Command:   e.Command,
+			Stdin:     e.Stdin != nil,
+			Stdout:    e.Stdout != nil,
+			Stderr:    e.Stderr != nil && !e.TTY,
+			TTY:       e.TTY,
+		}, scheme.ParameterCodec)
+
+	executor, err := remotecommand.NewSPDYExecutor(config, "POST", req.URL())
+	if err != nil {
+		return err
+	}
+
+	options := remotecommand.StreamOptions{
+		Stdin:  e.Stdin,
+		Stdout: e.Stdout,
+		Tty:    e.TTY,
+	}
+	if e.TTY {
+		options.TerminalSizeQueue = e.TerminalSizeQueue
+	} else {
+		options.Stderr = e.Stderr
+	}
+	return executor.StreamWithContext(ctx, options)
+}
+
+// terminalSizeQueue reports terminal size changes. Size is polled, so it works without platform specific signals.
+type terminalSizeQueue struct {
+	ctx  context.Context
+	fd   int
+	last remotecommand.TerminalSize
+}
+
+// NewTerminalSizeQueue returns a queue of terminal size changes until context is cancelled
+func NewTerminalSizeQueue(ctx context.Context, fd int) remotecommand.TerminalSizeQueue {
+	return &terminalSizeQueue{ctx: ctx, fd: fd}
+}
+
+func (q *terminalSizeQueue) Next() *remotecommand.TerminalSize {
+	for {
+		width, height, err := term.GetSize(q.fd)
+		if err == nil && (uint16(width) != q.last.Width || uint16(height) != q.last.Height) {
+			q.last = remotecommand.TerminalSize{Width: uint16(width), Height: uint16(height)}
+			size := q.last
+			return &size
+		}
+		select {
+		case <-q.ctx.Done():
+			return nil
+		case <-time.After(250 * time.Millisecond):
+		}
+	}
+}
@@ -0,0 +1,431 @@
+package common
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	v1core "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// Remote commands get the directory as a positional argument, so it doesn't need quoting. File lists are NUL
+// separated, so any file name is passed as is.
+const (
+	remoteListCommand     = `[ -d "$1" ] || exit 0; cd "$1" && find . -type f -print0`
+	remoteChecksumCommand = `[ -d "$1" ] || exit 0; cd "$1" && find . -type f -exec sh -c 'for f do sum=$(md5sum < "$f") || exit 1; printf "%s  %s\0" "${sum%% *}" "$f"; done' sh {} +`
+	remoteTarCommand      = `cd "$1" && tar --null --verbatim-files-from -cf - -T -`
+	remoteUntarCommand    = `mkdir -p "$1" && cd "$1" && tar xof -`
+)
+
+// FileFilter selects files by glob patterns. A pattern matches a file when it matches its relative path, one
+// of the parent directories or one of the path elements (i.e. "*.log", "styles", "2024/*").
+type FileFilter struct {
+	// Only matching files are selected, all files when empty
+	Include []string
+	// Matching files are skipped
+	Exclude []string
+}
+
+// Validate returns an error for malformed patterns
+func (f FileFilter) Validate() error {
+	for _, pattern := range append(append([]string{}, f.Include...), f.Exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q: %s", pattern, err)
+		}
+	}
+	return nil
+}
+
+func filterPatternMatches(pattern string, rel string) bool {
+	elements := strings.Split(rel, "/")
+	for i, element := range elements {
+		if ok, _ := path.Match(pattern, element); ok {
+			return true
+		}
+		if ok, _ := path.Match(pattern, strings.Join(elements[:i+1], "/")); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Matches returns true if file (relative path, slash separated) is selected
+func (f FileFilter) Matches(rel string) bool {
+	if len(f.Include) > 0 {
+		included := false
+		for _, pattern := range f.Include {
+			if filterPatternMatches(pattern, rel) {
+				included = true
+				break
+			}
+		}
+		if !included {
+			return false
+		}
+	}
+	for _, pattern := range f.Exclude {
+		if filterPatternMatches(pattern, rel) {
+			return false
+		}
+	}
+	return true
+}
+
+// ReleaseFilesOptions describes a file transfer between a local directory and a release volume
+type ReleaseFilesOptions struct {
+	// Directory on a release volume, i.e. "/app/web/sites/default/files"
+	RemotePath string
+	LocalPath  string
+	Filter     FileFilter
+	// Compare checksums and skip files that are unchanged
+	Resume bool
+}
+
+// fileChecksum returns md5 checksum of a file
+func fileChecksum(name string) (string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	hash := md5.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// ListLocalFiles returns regular files in a directory matching the filter, as relative slash separated paths
+// mapped to md5 checksums. Checksums are empty unless requested. Missing directory has no files.
+func ListLocalFiles(dir string, filter FileFilter, checksums bool) (map[string]string, error) {
+	files := map[string]string{}
+	err := filepath.WalkDir(dir, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if name == dir && os.IsNotExist(err) {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, name)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if !filter.Matches(rel) {
+			return nil
+		}
+		files[rel] = ""
+		if checksums {
+			files[rel], err = fileChecksum(name)
+		}
+		return err
+	})
+	return files, err
+}
+
+// ParseRemoteFileList parses NUL separated "find -print0" output, or "<md5 checksum>  <file>" entries when
+// checksums are listed
+func ParseRemoteFileList(output string, filter FileFilter, checksums bool) map[string]string {
+	files := map[string]string{}
+	for _, entry := range strings.Split(output, "\x00") {
+		if entry == "" {
+			continue
+		}
+		checksum := ""
+		if checksums {
+			parts := strings.SplitN(entry, "  ", 2)
+			if len(parts) != 2 {
+				continue
+			}
+			checksum, entry = parts[0], parts[1]
+		}
+		rel := strings.TrimPrefix(entry, "./")
+		if filter.Matches(rel) {
+			files[rel] = checksum
+		}
+	}
+	return files
+}
+
+// RemoteTarFileList returns files as a NUL separated list for remote tar. Files are prefixed with "./", so
+// names starting with a dash are not taken for options.
+func RemoteTarFileList(files []string) string {
+	list := strings.Builder{}
+	for _, rel := range files {
+		list.WriteString("./" + rel + "\x00")
+	}
+	return list.String()
+}
+
+// FilesToTransfer returns sorted source files, skipping files with the same checksum in target when resuming
+func FilesToTransfer(source map[string]string, target map[string]string, resume bool) []string {
+	files := []string{}
+	for rel, checksum := range source {
+		if resume && checksum != "" && target[rel] == checksum {
+			continue
+		}
+		files = append(files, rel)
+	}
+	sort.Strings(files)
+	return files
+}
+
+// WriteTar writes files of a directory to a tar stream. Ownership is not stored.
+func WriteTar(out io.Writer, dir string, files []string) error {
+	writer := tar.NewWriter(out)
+	for _, rel := range files {
+		name := filepath.Join(dir, filepath.FromSlash(rel))
+		info, err := os.Stat(name)
+		if err != nil {
+			return err
+		}
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = rel
+		header.Uid, header.Gid, header.Uname, header.Gname = 0, 0, "", ""
+		if err := writer.WriteHeader(header); err != nil {
+			return err
+		}
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(writer, f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return writer.Close()
+}
+
+// ExtractTar extracts regular files and directories of a tar stream to a directory and returns the number of
+// extracted files. Entries outside of the directory are rejected.
+func ExtractTar(in io.Reader, dir string) (int, error) {
+	reader := tar.NewReader(in)
+	count := 0
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return count, nil
+		}
+		if err != nil {
+			return count, err
+		}
+		rel := path.Clean(strings.TrimPrefix(header.Name, "./"))
+		if rel == "." || path.IsAbs(rel) || rel == ".." || strings.HasPrefix(rel, "../") {
+			return count, fmt.Errorf("invalid file name in archive: %s", header.Name)
+		}
+		name := filepath.Join(dir, filepath.FromSlash(rel))
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(name, 0755); err != nil {
+				return count, err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+				return count, err
+			}
+			f, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, header.FileInfo().Mode().Perm())
+			if err != nil {
+				return count, err
+			}
+			_, err = io.Copy(f, reader)
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				return count, err
+			}
+			os.Chtimes(name, header.ModTime, header.ModTime)
+			count++
+		}
+	}
+}
+
+// releaseVolumePod returns a ready release pod and container that has the remote path on a persistent volume
+func releaseVolumePod(ctx context.Context, clientset kubernetes.Interface, namespace, releaseName, remotePath string) (*v1core.Pod, string, error) {
+	pod, container, err := FindReleasePod(ctx, clientset, namespace, releaseName, DefaultExecComponents)
+	if err != nil {
+		return nil, "", err
+	}
+	mounts := ReleaseVolumeMounts(pod, container)
+	for _, mount := range mounts {
+		if remotePath == mount || strings.HasPrefix(remotePath, strings.TrimSuffix(mount, "/")+"/") {
+			return pod, container, nil
+		}
+	}
+	return nil, "", fmt.Errorf("%s is not on a persistent volume of %s/%s (volumes: %s)", remotePath, pod.Name, container, strings.Join(mounts, ", "))
+}
+
+// ReleaseVolumeMounts returns mount paths of persistent volume claims in a pod container
+func ReleaseVolumeMounts(pod *v1core.Pod, container string) []string {
+	claims := map[string]bool{}
+	for _, volume := range pod.Spec.Volumes {
+		if volume.PersistentVolumeClaim != nil {
+			claims[volume.Name] = true
+		}
+	}
+	mounts := []string{}
+	for _, c := range pod.Spec.Containers {
+		if c.Name != container {
+			continue
+		}
+		for _, mount := range c.VolumeMounts {
+			if claims[mount.Name] {
+				mounts = append(mounts, mount.MountPath)
+			}
+		}
+	}
+	sort.Strings(mounts)
+	return mounts
+}
+
+// remoteFiles lists files of a remote directory
+func remoteFiles(ctx context.Context, config *rest.Config, clientset kubernetes.Interface, pod *v1core.Pod, container string, opts ReleaseFilesOptions, stderr io.Writer) (map[string]string, error) {
+	command := remoteListCommand
+	if opts.Resume {
+		command = remoteChecksumCommand
+	}
+	out := &bytes.Buffer{}
+	err := ExecInPod(ctx, config, clientset, ReleaseExec{
+		Namespace: pod.Namespace,
+		Pod:       pod.Name,
+		Container: container,
+		Command:   []string{"/bin/sh", "-c", command, "sh", opts.RemotePath},
+		Stdout:    out,
+		Stderr:    stderr,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing remote files failed: %s", err)
+	}
+	return ParseRemoteFileList(out.String(), opts.Filter, opts.Resume), nil
+}
+
+// PullReleaseFiles copies files from a release volume directory to a local directory
+func PullReleaseFiles(ctx context.Context, config *rest.Config, clientset kubernetes.Interface, namespace, releaseName string, opts ReleaseFilesOptions, stderr io.Writer) error {
+	pod, container, err := releaseVolumePod(ctx, clientset, namespace, releaseName, opts.RemotePath)
+	if err != nil {
+		return err
+	}
+	source, err := remoteFiles(ctx, config, clientset, pod, container, opts, stderr)
+	if err != nil {
+		return err
+	}
+	target, err := ListLocalFiles(opts.LocalPath, opts.Filter, opts.Resume)
+	if err != nil {
+		return err
+	}
+	files := FilesToTransfer(source, target, opts.Resume)
+	fmt.Fprintf(stderr, "Pulling %d of %d files from %s\n", len(files), len(source), opts.RemotePath)
+	if len(files) == 0 {
+		return nil
+	}
+
+	progress := &TransferProgress{Label: "Pulling files"}
+	stop := reportProgress(ctx, progress, stderr)
+	defer stop()
+
+	reader, writer := io.Pipe()
+	execErr := make(chan error, 1)
+	go func() {
+		err := ExecInPod(ctx, config, clientset, ReleaseExec{
+			Namespace: namespace,
+			Pod:       pod.Name,
+			Container: container,
+			Command:   []string{"/bin/sh", "-c", remoteTarCommand, "sh", opts.RemotePath},
+			Stdin:     strings.NewReader(RemoteTarFileList(files)),
+			Stdout:    io.MultiWriter(writer, progress),
+			Stderr:    stderr,
+		})
+		writer.CloseWithError(err)
+		execErr <- err
+	}()
+
+	_, err = ExtractTar(bufio.NewReader(reader), opts.LocalPath)
+	if err != nil {
+		// Stop the remote command
+		reader.CloseWithError(err)
+		<-execErr
+		return fmt.Errorf("extracting files failed: %s", err)
+	}
+	// Remaining output (tar padding) is drained, so the remote command can finish
+	io.Copy(io.Discard, reader)
+	if err := <-execErr; err != nil {
+		return fmt.Errorf("pulling files failed: %s", err)
+	}
+	return nil
+}
+
+// PushReleaseFiles copies files from a local directory to a release volume directory
+func PushReleaseFiles(ctx context.Context, config *rest.Config, clientset kubernetes.Interface, namespace, releaseName string, opts ReleaseFilesOptions, stderr io.Writer) error {
+	info, err := os.Stat(opts.LocalPath)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", opts.LocalPath)
+	}
+	pod, container, err := releaseVolumePod(ctx, clientset, namespace, releaseName, opts.RemotePath)
+	if err != nil {
+		return err
+	}
+	source, err := ListLocalFiles(opts.LocalPath, opts.Filter, opts.Resume)
+	if err != nil {
+		return err
+	}
+	target := map[string]string{}
+	if opts.Resume {
+		target, err = remoteFiles(ctx, config, clientset, pod, container, opts, stderr)
+		if err != nil {
+			return err
+		}
+	}
+	files := FilesToTransfer(source, target, opts.Resume)
+	fmt.Fprintf(stderr, "Pushing %d of %d files to %s\n", len(files), len(source), opts.RemotePath)
+	if len(files) == 0 {
+		return nil
+	}
+
+	progress := &TransferProgress{Label: "Pushing files"}
+	stop := reportProgress(ctx, progress, stderr)
+	defer stop()
+
+	reader, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError(WriteTar(io.MultiWriter(writer, progress), opts.LocalPath, files))
+	}()
+	err = ExecInPod(ctx, config, clientset, ReleaseExec{
+		Namespace: namespace,
+		Pod:       pod.Name,
+		Container: container,
+		Command:   []string{"/bin/sh", "-c", remoteUntarCommand, "sh", opts.RemotePath},
+		Stdin:     reader,
+		Stdout:    stderr,
+		Stderr:    stderr,
+	})
+	reader.Close()
+	if err != nil {
+		return fmt.Errorf("pushing files failed: %s", err)
+	}
+	return nil
+}
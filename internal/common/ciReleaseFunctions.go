@@ -387,3 +387,37 @@ func DeleteOrphanedReleaseResources(kubernetesClient *kubernetes.Clientset, helm
 
 	return nil
 }
+
+// SystemNamespaces hold cluster infrastructure (ingress, cert-manager, downscaled release placeholder), their
+// releases are only listed when the namespace is named explicitly
+var SystemNamespaces = []string{"kube-system", "silta-cluster"}
+
+// ListHelmReleases returns deployed releases of a namespace, or all namespaces except SystemNamespaces when namespace
+// is empty
+func ListHelmReleases(actionConfig *helmAction.Configuration, namespace string) ([]*helmRelease.Release, error) {
+	list := helmAction.NewList(actionConfig)
+	list.AllNamespaces = namespace == ""
+	list.SetStateMask()
+	releases, err := list.Run()
+	if err != nil || namespace != "" {
+		return releases, err
+	}
+	return WithoutSystemNamespaces(releases), nil
+}
+
+// WithoutSystemNamespaces returns releases that are not in SystemNamespaces
+func WithoutSystemNamespaces(releases []*helmRelease.Release) []*helmRelease.Release {
+	filtered := []*helmRelease.Release{}
+	for _, r := range releases {
+		system := false
+		for _, namespace := range SystemNamespaces {
+			if r.Namespace == namespace {
+				system = true
+			}
+		}
+		if !system {
+			filtered = append(filtered, r)
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,221 @@
+package common
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pmezard/go-difflib/difflib"
+	"gopkg.in/yaml.v2"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	helmAction "helm.sh/helm/v3/pkg/action"
+	helmChartutil "helm.sh/helm/v3/pkg/chartutil"
+	helmRelease "helm.sh/helm/v3/pkg/release"
+	helmReleaseutil "helm.sh/helm/v3/pkg/releaseutil"
+)
+
+// ReleaseHistory returns all stored revisions of a release, oldest first
+func ReleaseHistory(actionConfig *helmAction.Configuration, releaseName string) ([]*helmRelease.Release, error) {
+	history, err := helmAction.NewHistory(actionConfig).Run(releaseName)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(history, func(i, j int) bool {
+		return history[i].Version < history[j].Version
+	})
+	return history, nil
+}
+
+// ReleaseRevision returns a revision from release history, 0 selects the latest revision and negative
+// values count back from the latest one (i.e. -1 is the revision before the latest)
+func ReleaseRevision(history []*helmRelease.Release, revision int) (*helmRelease.Release, error) {
+	if len(history) == 0 {
+		return nil, fmt.Errorf("release has no revisions")
+	}
+	if revision <= 0 {
+		index := len(history) - 1 + revision
+		if index < 0 {
+			return nil, fmt.Errorf("release has only %d revisions", len(history))
+		}
+		return history[index], nil
+	}
+	for _, r := range history {
+		if r.Version == revision {
+			return r, nil
+		}
+	}
+	return nil, fmt.Errorf("release has no revision %d", revision)
+}
+
+// PrintReleaseHistory prints release revisions as a table
+func PrintReleaseHistory(out io.Writer, history []*helmRelease.Release) {
+	writer := tabwriter.NewWriter(out, 0, 8, 1, '\t', tabwriter.AlignRight)
+	fmt.Fprintln(writer, "REVISION\tUPDATED\tSTATUS\tCHART\tAPP VERSION\tDESCRIPTION")
+	for _, r := range history {
+		chart, appVersion := "", ""
+		if r.Chart != nil && r.Chart.Metadata != nil {
+			chart = r.Chart.Metadata.Name + "-" + r.Chart.Metadata.Version
+			appVersion = r.Chart.Metadata.AppVersion
+		}
+		fmt.Fprintf(writer, "%d\t%s\t%s\t%s\t%s\t%s\n", r.Version, r.Info.LastDeployed.Format("Mon Jan _2 15:04:05 2006"), r.Info.Status.String(), chart, appVersion, r.Info.Description)
+	}
+	writer.Flush()
+}
+
+// ReleaseComputedValues returns release values merged with chart defaults (same as "helm get values --all")
+func ReleaseComputedValues(r *helmRelease.Release) (map[string]interface{}, error) {
+	if r.Chart == nil {
+		return r.Config, nil
+	}
+	values, err := helmChartutil.CoalesceValues(r.Chart, r.Config)
+	if err != nil {
+		return nil, err
+	}
+	return values.AsMap(), nil
+}
+
+// DiffReleaseRevisions returns a unified diff of computed values ("values") or rendered manifests ("manifest")
+// between two release revisions. Sensitive values and Secret data are redacted. Empty string is returned when
+// there are no changes.
+func DiffReleaseRevisions(from *helmRelease.Release, to *helmRelease.Release, kind string) (string, error) {
+	var a, b string
+	switch kind {
+	case "values":
+		fromValues, err := ReleaseComputedValues(from)
+		if err != nil {
+			return "", err
+		}
+		toValues, err := ReleaseComputedValues(to)
+		if err != nil {
+			return "", err
+		}
+		rawFrom, err := yaml.Marshal(RedactValues(fromValues))
+		if err != nil {
+			return "", err
+		}
+		rawTo, err := yaml.Marshal(RedactValues(toValues))
+		if err != nil {
+			return "", err
+		}
+		a, b = string(rawFrom), string(rawTo)
+	case "manifest":
+		var err error
+		a, b, err = redactManifestSecrets(from.Manifest, to.Manifest)
+		if err != nil {
+			return "", err
+		}
+	default:
+		return "", fmt.Errorf("unknown diff type: %s (supported: values, manifest)", kind)
+	}
+
+	return difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        diffLines(a),
+		B:        diffLines(b),
+		FromFile: fmt.Sprintf("revision %d %s", from.Version, kind),
+		ToFile:   fmt.Sprintf("revision %d %s", to.Version, kind),
+		Context:  3,
+	})
+}
+
+// redactManifestSecrets redacts Secret data in two release manifests, marking values that differ between them.
+// Other manifest documents are kept as they are.
+func redactManifestSecrets(from string, to string) (string, string, error) {
+	fromDocs, fromSecrets, err := manifestSecrets(from)
+	if err != nil {
+		return "", "", err
+	}
+	toDocs, toSecrets, err := manifestSecrets(to)
+	if err != nil {
+		return "", "", err
+	}
+	for key, obj := range fromSecrets {
+		if toObj, ok := toSecrets[key]; ok {
+			redactSecrets(obj.Object, toObj.Object)
+		} else {
+			redactSecrets(obj.Object, nil)
+		}
+	}
+	for key, obj := range toSecrets {
+		if _, ok := fromSecrets[key]; !ok {
+			redactSecrets(nil, obj.Object)
+		}
+	}
+	a, err := renderManifestDocs(fromDocs)
+	if err != nil {
+		return "", "", err
+	}
+	b, err := renderManifestDocs(toDocs)
+	if err != nil {
+		return "", "", err
+	}
+	return a, b, nil
+}
+
+// manifestDoc is a release manifest document, secret is set for Secret documents
+type manifestDoc struct {
+	raw    string
+	secret *unstructured.Unstructured
+}
+
+// manifestSecrets splits a release manifest to documents and parses Secret documents
+func manifestSecrets(manifest string) ([]*manifestDoc, map[string]*unstructured.Unstructured, error) {
+	docs := []*manifestDoc{}
+	secrets := map[string]*unstructured.Unstructured{}
+	manifests := helmReleaseutil.SplitManifests(manifest)
+	keys := []string{}
+	for key := range manifests {
+		keys = append(keys, key)
+	}
+	sort.Sort(helmReleaseutil.BySplitManifestsOrder(keys))
+	for _, key := range keys {
+		doc := &manifestDoc{raw: manifests[key]}
+		docs = append(docs, doc)
+		var head struct {
+			Kind string `yaml:"kind"`
+		}
+		if err := yaml.Unmarshal([]byte(doc.raw), &head); err != nil || head.Kind != "Secret" {
+			continue
+		}
+		objects, err := ManifestObjects(doc.raw)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(objects) == 1 {
+			doc.secret = objects[0]
+			secrets[objectKey(doc.secret, "")] = doc.secret
+		}
+	}
+	return docs, secrets, nil
+}
+
+// renderManifestDocs joins manifest documents, Secret documents are rendered from parsed objects
+func renderManifestDocs(docs []*manifestDoc) (string, error) {
+	rendered := []string{}
+	for _, doc := range docs {
+		if doc.secret == nil {
+			rendered = append(rendered, doc.raw)
+			continue
+		}
+		raw, err := yaml.Marshal(doc.secret.Object)
+		if err != nil {
+			return "", err
+		}
+		rendered = append(rendered, strings.TrimSpace(string(raw)))
+	}
+	return strings.Join(rendered, "\n---\n"), nil
+}
+
+// diffLines splits text to lines for diffing, each line ending with a newline
+func diffLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	if !strings.HasSuffix(text, "\n") {
+		text += "\n"
+	}
+	lines := strings.SplitAfter(text, "\n")
+	return lines[:len(lines)-1]
+}
@@ -0,0 +1,229 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/viper"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	helmRelease "helm.sh/helm/v3/pkg/release"
+)
+
+// Idle policy keys in silta configuration store
+const (
+	IdlePolicyMaxIdleDaysKey      = "idle-policy.max-idle-days"
+	IdlePolicyExcludedBranchesKey = "idle-policy.excluded-branches"
+)
+
+// IdlePolicy defines when a release is considered idle
+type IdlePolicy struct {
+	MaxIdleDays int
+	// Branch name patterns (i.e. "main", "release/*") of releases that are never idle
+	ExcludedBranches []string
+}
+
+// Idle release states
+const (
+	ReleaseActive     = "active"
+	ReleaseIdle       = "idle"
+	ReleaseExcluded   = "excluded"
+	ReleaseDownscaled = "downscaled"
+)
+
+// IdleReleaseReport is the idle state of a single release
+type IdleReleaseReport struct {
+	Release      ReleaseRef
+	Branch       string
+	LastDeployed time.Time
+	// Latest of helm deploy time, finished deployment rollouts, pod starts and ingress changes
+	LastActivity time.Time
+	IdleDays     int
+	State        string
+}
+
+// DefaultIdlePolicy is used when policy is not set in configuration store
+var DefaultIdlePolicy = IdlePolicy{
+	MaxIdleDays:      14,
+	ExcludedBranches: []string{"main", "master", "production", "stage"},
+}
+
+// IdlePolicyFromConfig reads idle policy from silta configuration store. Excluded branches can be a list or a comma
+// separated string (i.e. "silta config set idle-policy.excluded-branches main,production").
+func IdlePolicyFromConfig(store viper.Viper) (IdlePolicy, error) {
+	policy := IdlePolicy{
+		MaxIdleDays:      DefaultIdlePolicy.MaxIdleDays,
+		ExcludedBranches: DefaultIdlePolicy.ExcludedBranches,
+	}
+
+	if store.IsSet(IdlePolicyMaxIdleDaysKey) {
+		days, err := strconv.Atoi(strings.TrimSpace(fmt.Sprint(store.Get(IdlePolicyMaxIdleDaysKey))))
+		if err != nil || days < 1 {
+			return policy, fmt.Errorf("invalid %s value: %v", IdlePolicyMaxIdleDaysKey, store.Get(IdlePolicyMaxIdleDaysKey))
+		}
+		policy.MaxIdleDays = days
+	}
+
+	if store.IsSet(IdlePolicyExcludedBranchesKey) {
+		switch value := store.Get(IdlePolicyExcludedBranchesKey).(type) {
+		case []interface{}:
+			policy.ExcludedBranches = []string{}
+			for _, branch := range value {
+				policy.ExcludedBranches = append(policy.ExcludedBranches, fmt.Sprint(branch))
+			}
+		default:
+			policy.ExcludedBranches = SplitBranchList(fmt.Sprint(value))
+		}
+	}
+
+	return policy, nil
+}
+
+// SplitBranchList splits a comma separated list of branch names
+func SplitBranchList(list string) []string {
+	branches := []string{}
+	for _, branch := range strings.Split(list, ",") {
+		if branch = strings.TrimSpace(branch); branch != "" {
+			branches = append(branches, branch)
+		}
+	}
+	return branches
+}
+
+// ExcludesBranch checks if branch matches any of the excluded branch patterns
+func (p IdlePolicy) ExcludesBranch(branch string) bool {
+	for _, pattern := range p.ExcludedBranches {
+		if matched, _ := path.Match(pattern, branch); matched || pattern == branch {
+			return true
+		}
+	}
+	return false
+}
+
+// ReleaseIdleReport inspects release deploy times, deployment rollouts, pod starts and ingress state, and reports releases that have not
+// been deployed or touched in policy.MaxIdleDays days. Releases with all workloads scaled to zero are reported as
+// downscaled, releases of excluded branches are never idle.
+func ReleaseIdleReport(ctx context.Context, clientset kubernetes.Interface, releases []*helmRelease.Release, policy IdlePolicy, now time.Time) ([]IdleReleaseReport, error) {
+	reports := []IdleReleaseReport{}
+
+	for _, r := range releases {
+		report := IdleReleaseReport{
+			Release: ReleaseRef{Namespace: r.Namespace, Name: r.Name},
+			Branch:  releaseBranchName(r),
+		}
+		if r.Info != nil {
+			report.LastDeployed = r.Info.LastDeployed.Time
+		}
+		report.LastActivity = report.LastDeployed
+
+		deployments, err := releaseDeployments(ctx, clientset, r.Namespace, r.Name)
+		if err != nil {
+			return nil, err
+		}
+		statefulsets, err := releaseStatefulSets(ctx, clientset, r.Namespace, r.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		running := false
+		for _, d := range deployments {
+			if d.Spec.Replicas == nil || *d.Spec.Replicas > 0 {
+				running = true
+			}
+			// Only finished rollouts count, crash looping pods keep updating other conditions
+			for _, condition := range d.Status.Conditions {
+				if condition.Type == appsv1.DeploymentProgressing && condition.Reason == "NewReplicaSetAvailable" {
+					report.LastActivity = latestTime(report.LastActivity, condition.LastUpdateTime.Time)
+				}
+			}
+		}
+		for _, s := range statefulsets {
+			if s.Spec.Replicas == nil || *s.Spec.Replicas > 0 {
+				running = true
+			}
+		}
+
+		for _, l := range releaseSelectorLabels {
+			ingresses, err := clientset.NetworkingV1().Ingresses(r.Namespace).List(ctx, v1.ListOptions{LabelSelector: l + "=" + r.Name})
+			if err != nil {
+				return nil, fmt.Errorf("error getting the list of ingresses: %s", err)
+			}
+			for _, ingress := range ingresses.Items {
+				report.LastActivity = latestTime(report.LastActivity, ingress.CreationTimestamp.Time)
+			}
+		}
+
+		// Pod starts (not container restarts), cron job pods start on schedule and are left out
+		pods, err := listReleasePods(ctx, clientset, r.Namespace, r.Name)
+		if err != nil {
+			return nil, err
+		}
+		for _, pod := range pods {
+			if pod.Labels["cronjob"] != "true" && pod.Status.StartTime != nil {
+				report.LastActivity = latestTime(report.LastActivity, pod.Status.StartTime.Time)
+			}
+		}
+
+		if !report.LastActivity.IsZero() {
+			report.IdleDays = int(now.Sub(report.LastActivity).Hours() / 24)
+		}
+
+		switch {
+		case policy.ExcludesBranch(report.Branch):
+			report.State = ReleaseExcluded
+		case len(deployments)+len(statefulsets) > 0 && !running:
+			report.State = ReleaseDownscaled
+		case report.IdleDays >= policy.MaxIdleDays:
+			report.State = ReleaseIdle
+		default:
+			report.State = ReleaseActive
+		}
+
+		reports = append(reports, report)
+	}
+
+	sort.Slice(reports, func(i, j int) bool {
+		if reports[i].Release.Namespace != reports[j].Release.Namespace {
+			return reports[i].Release.Namespace < reports[j].Release.Namespace
+		}
+		return reports[i].Release.Name < reports[j].Release.Name
+	})
+	return reports, nil
+}
+
+// releaseBranchName returns the branch name the release was deployed from, release name if it's not known
+func releaseBranchName(r *helmRelease.Release) string {
+	if siltaRelease, ok := r.Config["silta-release"].(map[string]interface{}); ok {
+		if branchName, ok := siltaRelease["branchName"].(string); ok && branchName != "" {
+			return branchName
+		}
+	}
+	return r.Name
+}
+
+func latestTime(a time.Time, b time.Time) time.Time {
+	if b.After(a) {
+		return b
+	}
+	return a
+}
+
+// PrintIdleReport prints release idle states as a table
+func PrintIdleReport(out io.Writer, reports []IdleReleaseReport) {
+	writer := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(writer, "NAMESPACE\tRELEASE\tBRANCH\tLAST DEPLOYED\tLAST ACTIVITY\tIDLE DAYS\tSTATE")
+	for _, r := range reports {
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\t%d\t%s\n", r.Release.Namespace, r.Release.Name, r.Branch,
+			r.LastDeployed.Format("2006-01-02 15:04"), r.LastActivity.Format("2006-01-02 15:04"), r.IdleDays, r.State)
+	}
+	writer.Flush()
+}
@@ -0,0 +1,236 @@
+package common
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	v1core "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+)
+
+// ReleaseLogOptions selects and formats release container logs
+type ReleaseLogOptions struct {
+	// Container names or release components (i.e. "php", "nginx", "shell", "cron"), all containers when empty
+	Components []string
+	// Only return logs newer than this
+	Since time.Duration
+	// Logs of the previous container instance
+	Previous bool
+	// Only print matching lines
+	Grep *regexp.Regexp
+	// Keep streaming logs, including containers of new pods
+	Follow bool
+	// Color line prefixes
+	Color bool
+}
+
+// ANSI colors for line prefixes
+var logColors = []int{32, 33, 34, 35, 36, 92, 93, 94, 95, 96}
+
+// isReleasePod returns true if pod has a release label
+func isReleasePod(pod *v1core.Pod, releaseName string) bool {
+	for _, l := range releaseSelectorLabels {
+		if pod.Labels[l] == releaseName {
+			return true
+		}
+	}
+	return false
+}
+
+// listReleasePods returns release pods sorted by name. Pods are listed by each release label, pods labeled with
+// both are returned once.
+func listReleasePods(ctx context.Context, clientset kubernetes.Interface, namespace, releaseName string) ([]v1core.Pod, error) {
+	found := map[string]v1core.Pod{}
+	for _, l := range releaseSelectorLabels {
+		list, err := clientset.CoreV1().Pods(namespace).List(ctx, v1.ListOptions{LabelSelector: l + "=" + releaseName})
+		if err != nil {
+			return nil, fmt.Errorf("error getting the list of pods: %s", err)
+		}
+		for _, pod := range list.Items {
+			found[pod.Name] = pod
+		}
+	}
+	pods := []v1core.Pod{}
+	for _, pod := range found {
+		pods = append(pods, pod)
+	}
+	sort.Slice(pods, func(i, j int) bool { return pods[i].Name < pods[j].Name })
+	return pods, nil
+}
+
+// MatchesComponent returns true if pod container belongs to one of components. Component matches container name,
+// pods of "<release>-<component>" workloads or cronjob pods ("cron").
+func MatchesComponent(pod *v1core.Pod, container string, releaseName string, components []string) bool {
+	if len(components) == 0 {
+		return true
+	}
+	cronjob := pod.Labels["cronjob"] == "true"
+	for _, component := range components {
+		if component == "cron" {
+			if cronjob {
+				return true
+			}
+			continue
+		}
+		if cronjob {
+			continue
+		}
+		if container == component || strings.HasPrefix(pod.Name, releaseName+"-"+component+"-") {
+			return true
+		}
+	}
+	return false
+}
+
+// logContainer is a container instance logs are streamed from
+type logContainer struct {
+	name         string
+	restartCount int32
+}
+
+// podLogContainers returns pod containers that have logs and match components
+func podLogContainers(pod *v1core.Pod, releaseName string, opts ReleaseLogOptions) []logContainer {
+	statuses := append([]v1core.ContainerStatus{}, pod.Status.InitContainerStatuses...)
+	statuses = append(statuses, pod.Status.ContainerStatuses...)
+
+	containers := []logContainer{}
+	for _, status := range statuses {
+		if !MatchesComponent(pod, status.Name, releaseName, opts.Components) {
+			continue
+		}
+		if opts.Previous && status.RestartCount == 0 {
+			continue
+		}
+		if !opts.Previous && status.State.Running == nil && status.State.Terminated == nil {
+			continue
+		}
+		containers = append(containers, logContainer{name: status.Name, restartCount: status.RestartCount})
+	}
+	return containers
+}
+
+// logPrefix returns line prefix of a container, colored by pod and container name
+func logPrefix(pod string, container string, color bool) string {
+	prefix := fmt.Sprintf("[%s/%s]", pod, container)
+	if !color {
+		return prefix + " "
+	}
+	hash := fnv.New32a()
+	hash.Write([]byte(pod + "/" + container))
+	return fmt.Sprintf("\033[%dm%s\033[0m ", logColors[hash.Sum32()%uint32(len(logColors))], prefix)
+}
+
+// streamContainerLogs prints container log lines with a prefix
+func streamContainerLogs(ctx context.Context, clientset kubernetes.Interface, pod *v1core.Pod, container string, opts ReleaseLogOptions, out *syncWriter) {
+	prefix := logPrefix(pod.Name, container, opts.Color)
+	logOptions := &v1core.PodLogOptions{
+		Container: container,
+		Follow:    opts.Follow,
+		Previous:  opts.Previous,
+	}
+	if opts.Since > 0 {
+		seconds := int64(opts.Since.Seconds())
+		logOptions.SinceSeconds = &seconds
+	}
+
+	stream, err := clientset.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, logOptions).Stream(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			out.println(prefix + "error getting logs: " + err.Error())
+		}
+		return
+	}
+	defer stream.Close()
+
+	scanner := bufio.NewScanner(stream)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if opts.Grep != nil && !opts.Grep.MatchString(line) {
+			continue
+		}
+		out.println(prefix + line)
+	}
+}
+
+// StreamReleaseLogs prints logs of release pod containers, each line prefixed with pod and container name. With
+// opts.Follow logs are streamed in parallel until context is cancelled, containers of new pods (i.e. during a
+// rollout) and restarted containers are picked up as they start.
+func StreamReleaseLogs(ctx context.Context, clientset kubernetes.Interface, namespace, releaseName string, opts ReleaseLogOptions, out io.Writer) error {
+	writer := &syncWriter{out: out}
+
+	if !opts.Follow {
+		pods, err := listReleasePods(ctx, clientset, namespace, releaseName)
+		if err != nil {
+			return err
+		}
+		for i := range pods {
+			for _, container := range podLogContainers(&pods[i], releaseName, opts) {
+				streamContainerLogs(ctx, clientset, &pods[i], container.name, opts, writer)
+			}
+		}
+		return nil
+	}
+
+	// Pods are watched by each release label, pods labeled with both are streamed once
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	streaming := map[string]bool{}
+	handle := func(obj runtime.Object) (bool, error) {
+		pod, ok := obj.(*v1core.Pod)
+		if !ok || !isReleasePod(pod, releaseName) {
+			return false, nil
+		}
+		for _, container := range podLogContainers(pod, releaseName, opts) {
+			// Restarted container is a new log stream
+			key := fmt.Sprintf("%s/%s/%d", pod.Name, container.name, container.restartCount)
+			mu.Lock()
+			started := streaming[key]
+			streaming[key] = true
+			mu.Unlock()
+			if started {
+				continue
+			}
+			wg.Add(1)
+			go func(pod *v1core.Pod, container string) {
+				defer wg.Done()
+				streamContainerLogs(ctx, clientset, pod, container, opts, writer)
+			}(pod.DeepCopy(), container.name)
+		}
+		return false, nil
+	}
+
+	watchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	errs := make(chan error, len(releaseSelectorLabels))
+	for _, l := range releaseSelectorLabels {
+		go func(selector string) {
+			err := watchObjects(watchCtx, podWatchSource(clientset, namespace, selector), handle)
+			// Failed watch stops the other one
+			cancel()
+			errs <- err
+		}(l + "=" + releaseName)
+	}
+	var err error
+	for range releaseSelectorLabels {
+		if e := <-errs; err == nil && !errors.Is(e, context.Canceled) {
+			err = e
+		}
+	}
+	wg.Wait()
+	if ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
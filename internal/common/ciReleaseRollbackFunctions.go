@@ -0,0 +1,162 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	helmAction "helm.sh/helm/v3/pkg/action"
+	helmKube "helm.sh/helm/v3/pkg/kube"
+	helmRelease "helm.sh/helm/v3/pkg/release"
+	"k8s.io/client-go/kubernetes"
+)
+
+// HelmReleaseRollback holds parameters for an in-process "helm rollback"
+type HelmReleaseRollback struct {
+	ReleaseName string
+	// Target revision, 0 selects the last successful revision
+	Revision int
+	Timeout  time.Duration
+	Wait     bool
+}
+
+// RollbackTargetRevision returns the revision a release should be rolled back to. When revision is 0, the latest
+// successfully deployed revision before the current one is selected.
+func RollbackTargetRevision(history []*helmRelease.Release, revision int) (int, error) {
+	if len(history) == 0 {
+		return 0, fmt.Errorf("release has no revisions")
+	}
+	releases := append([]*helmRelease.Release{}, history...)
+	sort.Slice(releases, func(i, j int) bool {
+		return releases[i].Version < releases[j].Version
+	})
+	current := releases[len(releases)-1]
+
+	if revision > 0 {
+		if revision == current.Version {
+			return 0, fmt.Errorf("revision %d is the current release revision", revision)
+		}
+		for _, r := range releases {
+			if r.Version == revision {
+				return revision, nil
+			}
+		}
+		return 0, fmt.Errorf("release has no revision %d", revision)
+	}
+
+	for i := len(releases) - 2; i >= 0; i-- {
+		status := releases[i].Info.Status
+		if status == helmRelease.StatusDeployed || status == helmRelease.StatusSuperseded {
+			return releases[i].Version, nil
+		}
+	}
+	return 0, fmt.Errorf("release has no successful revisions before revision %d", current.Version)
+}
+
+// contextKubeClient stops waiting for resources when context is cancelled, helm rollback doesn't take a context
+type contextKubeClient struct {
+	helmKube.Interface
+	ctx context.Context
+}
+
+func (c contextKubeClient) wait(fn func() error) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- fn()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-c.ctx.Done():
+		return c.ctx.Err()
+	}
+}
+
+func (c contextKubeClient) Wait(resources helmKube.ResourceList, timeout time.Duration) error {
+	return c.wait(func() error { return c.Interface.Wait(resources, timeout) })
+}
+
+func (c contextKubeClient) WaitWithJobs(resources helmKube.ResourceList, timeout time.Duration) error {
+	return c.wait(func() error { return c.Interface.WaitWithJobs(resources, timeout) })
+}
+
+func (c contextKubeClient) WaitForDelete(resources helmKube.ResourceList, timeout time.Duration) error {
+	if client, ok := c.Interface.(helmKube.InterfaceExt); ok {
+		return c.wait(func() error { return client.WaitForDelete(resources, timeout) })
+	}
+	return nil
+}
+
+// RollbackHelmRelease rolls release back to the target revision and returns the resulting release. Waiting for
+// resources is stopped and the rollback fails when context is cancelled.
+func RollbackHelmRelease(ctx context.Context, actionConfig *helmAction.Configuration, r HelmReleaseRollback) (*helmRelease.Release, error) {
+	history, err := helmAction.NewHistory(actionConfig).Run(r.ReleaseName)
+	if err != nil {
+		return nil, err
+	}
+	revision, err := RollbackTargetRevision(history, r.Revision)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Printf("Rolling back release %s to revision %d\n", r.ReleaseName, revision)
+
+	config := *actionConfig
+	config.KubeClient = contextKubeClient{Interface: actionConfig.KubeClient, ctx: ctx}
+	rollback := helmAction.NewRollback(&config)
+	rollback.Version = revision
+	rollback.Wait = r.Wait
+	rollback.Timeout = r.Timeout
+	rollback.CleanupOnFail = true
+	if err := rollback.Run(r.ReleaseName); err != nil {
+		return nil, err
+	}
+
+	return actionConfig.Releases.Last(r.ReleaseName)
+}
+
+// RunReleaseRollback rolls release back while rollout progress is reported. Rollback fails right away when a
+// release pod that is not one of "existing" pods is stuck in CrashLoopBackOff or ImagePullBackOff, the same way as
+// release deployment does, instead of waiting for rollback timeout. Pod failure is returned as a *PodFailureError.
+func RunReleaseRollback(ctx context.Context, clientset kubernetes.Interface, actionConfig *helmAction.Configuration, namespace string, r HelmReleaseRollback, existing ExistingPods, out io.Writer) (*helmRelease.Release, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type rollbackResult struct {
+		release *helmRelease.Release
+		err     error
+	}
+	done := make(chan rollbackResult, 1)
+	go func() {
+		release, err := RollbackHelmRelease(ctx, actionConfig, r)
+		done <- rollbackResult{release, err}
+	}()
+
+	watchCtx, cancelWatch := context.WithCancel(ctx)
+	defer cancelWatch()
+	failures := make(chan error, 1)
+	go func() {
+		if err := WatchReleaseProgress(watchCtx, clientset, namespace, r.ReleaseName, existing, out); err != nil {
+			failures <- err
+		}
+	}()
+
+	select {
+	case result := <-done:
+		return result.release, result.err
+	case failure := <-failures:
+		cancel()
+		result := <-done
+		if result.err == nil {
+			return result.release, nil
+		}
+		var podFailure *PodFailureError
+		if errors.As(failure, &podFailure) {
+			return nil, failure
+		}
+		return nil, result.err
+	}
+}
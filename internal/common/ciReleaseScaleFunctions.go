@@ -0,0 +1,226 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// RestartedAtAnnotation is set on pod template to restart pods, same as "kubectl rollout restart"
+	RestartedAtAnnotation = "kubectl.kubernetes.io/restartedAt"
+	// ScaleOriginalReplicasAnnotation stores replica count before "silta ci release scale"
+	ScaleOriginalReplicasAnnotation = "silta/original-replicas"
+	// ScaleReplicasAnnotation stores replica count set by "silta ci release scale"
+	ScaleReplicasAnnotation = "silta/scaled-replicas"
+)
+
+// workloadMatchesComponent returns true if workload is "<release>-<component>" or has a container named after the
+// component. Empty component matches all workloads.
+func workloadMatchesComponent(name string, template corev1.PodTemplateSpec, releaseName string, component string) bool {
+	if component == "" || name == releaseName+"-"+component {
+		return true
+	}
+	for _, container := range template.Spec.Containers {
+		if container.Name == component {
+			return true
+		}
+	}
+	return false
+}
+
+// ReleaseWorkloads returns release deployments and statefulsets of a component (all when component is empty)
+func ReleaseWorkloads(ctx context.Context, clientset kubernetes.Interface, namespace, releaseName, component string) ([]runtime.Object, error) {
+	workloads := []runtime.Object{}
+	deployments, err := releaseDeployments(ctx, clientset, namespace, releaseName)
+	if err != nil {
+		return nil, err
+	}
+	for i := range deployments {
+		if workloadMatchesComponent(deployments[i].Name, deployments[i].Spec.Template, releaseName, component) {
+			workloads = append(workloads, &deployments[i])
+		}
+	}
+	statefulsets, err := releaseStatefulSets(ctx, clientset, namespace, releaseName)
+	if err != nil {
+		return nil, err
+	}
+	for i := range statefulsets {
+		if workloadMatchesComponent(statefulsets[i].Name, statefulsets[i].Spec.Template, releaseName, component) {
+			workloads = append(workloads, &statefulsets[i])
+		}
+	}
+	if len(workloads) == 0 {
+		if component == "" {
+			return nil, fmt.Errorf("no deployments or statefulsets found for release %s", releaseName)
+		}
+		return nil, fmt.Errorf("no deployments or statefulsets found for component %s of release %s", component, releaseName)
+	}
+	return workloads, nil
+}
+
+// RestartReleaseWorkloads restarts pods of workloads by setting a pod template annotation
+func RestartReleaseWorkloads(ctx context.Context, clientset kubernetes.Interface, workloads []runtime.Object, now time.Time, out io.Writer) error {
+	patch := []byte(fmt.Sprintf(`{"spec":{"template":{"metadata":{"annotations":{%q:%q}}}}}`, RestartedAtAnnotation, now.Format(time.RFC3339)))
+	for _, workload := range workloads {
+		var err error
+		switch r := workload.(type) {
+		case *appsv1.Deployment:
+			fmt.Fprintf(out, "Restarting deployment %s\n", r.Name)
+			_, err = clientset.AppsV1().Deployments(r.Namespace).Patch(ctx, r.Name, types.StrategicMergePatchType, patch, v1.PatchOptions{})
+		case *appsv1.StatefulSet:
+			fmt.Fprintf(out, "Restarting statefulset %s\n", r.Name)
+			_, err = clientset.AppsV1().StatefulSets(r.Namespace).Patch(ctx, r.Name, types.StrategicMergePatchType, patch, v1.PatchOptions{})
+		}
+		if err != nil {
+			return fmt.Errorf("error restarting %s: %s", workloadName(workload), err)
+		}
+	}
+	return nil
+}
+
+// workloadName returns "kind/name" of a workload
+func workloadName(workload runtime.Object) string {
+	switch r := workload.(type) {
+	case *appsv1.Deployment:
+		return "deployment/" + r.Name
+	case *appsv1.StatefulSet:
+		return "statefulset/" + r.Name
+	}
+	return ""
+}
+
+// workloadNamespace returns namespace of a workload
+func workloadNamespace(workload runtime.Object) string {
+	switch r := workload.(type) {
+	case *appsv1.Deployment:
+		return r.Namespace
+	case *appsv1.StatefulSet:
+		return r.Namespace
+	}
+	return ""
+}
+
+// scaleWorkload sets workload replicas. Replica count before the first scale is stored in an annotation, together
+// with the scaled replica count. Stored replica count is discarded when live replica count doesn't match the scaled
+// one anymore (i.e. release was deployed since). With nil replicas, stored replica count is restored.
+// Returns target replica count (nil if replicas are not changed) and whether annotations were discarded.
+func scaleWorkload(meta *v1.ObjectMeta, current *int32, replicas *int32) (*int32, bool, error) {
+	live := int32(1)
+	if current != nil {
+		live = *current
+	}
+	original, ok := meta.Annotations[ScaleOriginalReplicasAnnotation]
+	discarded := false
+	if scaled, found := meta.Annotations[ScaleReplicasAnnotation]; ok && found && scaled != strconv.Itoa(int(live)) {
+		delete(meta.Annotations, ScaleOriginalReplicasAnnotation)
+		delete(meta.Annotations, ScaleReplicasAnnotation)
+		ok, discarded = false, true
+	}
+
+	if replicas == nil {
+		if !ok {
+			return nil, discarded, nil
+		}
+		value, err := strconv.ParseInt(original, 10, 32)
+		if err != nil {
+			return nil, discarded, fmt.Errorf("error converting original replicas to int: %s", err)
+		}
+		delete(meta.Annotations, ScaleOriginalReplicasAnnotation)
+		delete(meta.Annotations, ScaleReplicasAnnotation)
+		result := int32(value)
+		return &result, discarded, nil
+	}
+	if meta.Annotations == nil {
+		meta.Annotations = map[string]string{}
+	}
+	if !ok {
+		meta.Annotations[ScaleOriginalReplicasAnnotation] = strconv.Itoa(int(live))
+	}
+	meta.Annotations[ScaleReplicasAnnotation] = strconv.Itoa(int(*replicas))
+	return replicas, discarded, nil
+}
+
+// workloadAutoscalers returns names of horizontal pod autoscalers by the workload ("kind/name") they scale
+func workloadAutoscalers(ctx context.Context, clientset kubernetes.Interface, namespace string) (map[string]string, error) {
+	autoscalers := map[string]string{}
+	list, err := clientset.AutoscalingV1().HorizontalPodAutoscalers(namespace).List(ctx, v1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	for _, hpa := range list.Items {
+		ref := hpa.Spec.ScaleTargetRef
+		autoscalers[strings.ToLower(ref.Kind)+"/"+ref.Name] = hpa.Name
+	}
+	return autoscalers, nil
+}
+
+// ScaleReleaseWorkloads scales workloads to a replica count, or reverts them to the replica count they had
+// before they were first scaled when replicas is nil. Workloads that were not scaled are not reverted, neither
+// are workloads whose replica count was changed since they were scaled. Workloads scaled by a horizontal pod
+// autoscaler are refused. Scaled workloads are returned.
+func ScaleReleaseWorkloads(ctx context.Context, clientset kubernetes.Interface, workloads []runtime.Object, replicas *int32, out io.Writer) ([]runtime.Object, error) {
+	if replicas != nil && len(workloads) > 0 {
+		autoscalers, err := workloadAutoscalers(ctx, clientset, workloadNamespace(workloads[0]))
+		if err != nil {
+			return nil, fmt.Errorf("error listing horizontal pod autoscalers: %s", err)
+		}
+		for _, workload := range workloads {
+			if hpa, ok := autoscalers[workloadName(workload)]; ok {
+				return nil, fmt.Errorf("%s is scaled by horizontal pod autoscaler %s", workloadName(workload), hpa)
+			}
+		}
+	}
+
+	scaled := []runtime.Object{}
+	for _, workload := range workloads {
+		var err error
+		var target *int32
+		var discarded bool
+		switch r := workload.(type) {
+		case *appsv1.Deployment:
+			target, discarded, err = scaleWorkload(&r.ObjectMeta, r.Spec.Replicas, replicas)
+			if err != nil || (target == nil && !discarded) {
+				break
+			}
+			if target != nil {
+				fmt.Fprintf(out, "Scaling deployment %s to %d replica(s)\n", r.Name, *target)
+				r.Spec.Replicas = target
+			}
+			r, err = clientset.AppsV1().Deployments(r.Namespace).Update(ctx, r, v1.UpdateOptions{})
+			if err == nil && target != nil {
+				scaled = append(scaled, r)
+			}
+		case *appsv1.StatefulSet:
+			target, discarded, err = scaleWorkload(&r.ObjectMeta, r.Spec.Replicas, replicas)
+			if err != nil || (target == nil && !discarded) {
+				break
+			}
+			if target != nil {
+				fmt.Fprintf(out, "Scaling statefulset %s to %d replica(s)\n", r.Name, *target)
+				r.Spec.Replicas = target
+			}
+			r, err = clientset.AppsV1().StatefulSets(r.Namespace).Update(ctx, r, v1.UpdateOptions{})
+			if err == nil && target != nil {
+				scaled = append(scaled, r)
+			}
+		}
+		if discarded {
+			fmt.Fprintf(out, "Replica count of %s was changed after it was scaled, original replica count was discarded\n", workloadName(workload))
+		}
+		if err != nil {
+			return scaled, fmt.Errorf("error scaling %s: %s", workloadName(workload), err)
+		}
+	}
+	return scaled, nil
+}
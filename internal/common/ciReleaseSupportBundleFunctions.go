@@ -0,0 +1,480 @@
+package common
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/yaml"
+
+	helmRelease "helm.sh/helm/v3/pkg/release"
+)
+
+// Value keys that are redacted in support bundle values
+var sensitiveValueKey = regexp.MustCompile(`(?i)(pass(word|wd)?|secret|token|key|credential|auth|private|salt|cert)`)
+
+// SupportBundleFile is an entry of support bundle index
+type SupportBundleFile struct {
+	Path        string `json:"path"`
+	Description string `json:"description"`
+}
+
+// SupportBundleIndex describes support bundle contents
+type SupportBundleIndex struct {
+	Release      string              `json:"release"`
+	Namespace    string              `json:"namespace"`
+	Created      time.Time           `json:"created"`
+	Chart        string              `json:"chart,omitempty"`
+	Revision     int                 `json:"revision,omitempty"`
+	Status       string              `json:"status,omitempty"`
+	LastDeployed time.Time           `json:"lastDeployed"`
+	Files        []SupportBundleFile `json:"files"`
+	// Parts of the bundle that could not be collected
+	Errors []string `json:"errors,omitempty"`
+}
+
+// SupportBundle collects release diagnostics in memory before they are written to an archive
+type SupportBundle struct {
+	Index SupportBundleIndex
+	files map[string][]byte
+}
+
+// NewSupportBundle returns an empty support bundle of a release
+func NewSupportBundle(namespace, releaseName string, created time.Time) *SupportBundle {
+	return &SupportBundle{
+		Index: SupportBundleIndex{
+			Release:   releaseName,
+			Namespace: namespace,
+			Created:   created,
+			Files:     []SupportBundleFile{},
+		},
+		files: map[string][]byte{},
+	}
+}
+
+// Add adds a file to the bundle
+func (b *SupportBundle) Add(path string, description string, content []byte) {
+	if _, exists := b.files[path]; !exists {
+		b.Index.Files = append(b.Index.Files, SupportBundleFile{Path: path, Description: description})
+	}
+	b.files[path] = content
+}
+
+// AddError records a part of the bundle that could not be collected
+func (b *SupportBundle) AddError(format string, a ...interface{}) {
+	b.Index.Errors = append(b.Index.Errors, fmt.Sprintf(format, a...))
+}
+
+// File returns bundle file content, nil if there is no such file
+func (b *SupportBundle) File(path string) []byte {
+	return b.files[path]
+}
+
+// CollectSupportBundle collects helm release manifest and values, release resources, events, container logs and
+// debug-failed report of a release. Secret values, sensitive ConfigMap values and sensitive container environment
+// values are redacted. Release can be nil if helm release is not found.
+func CollectSupportBundle(ctx context.Context, clientset kubernetes.Interface, namespace, releaseName string, release *helmRelease.Release, created time.Time) *SupportBundle {
+	bundle := NewSupportBundle(namespace, releaseName, created)
+
+	if release != nil {
+		bundle.addHelmRelease(release)
+	} else {
+		bundle.AddError("helm release %s not found", releaseName)
+	}
+
+	bundle.addReleaseResources(ctx, clientset, namespace, releaseName)
+	bundle.addEvents(ctx, clientset, namespace, releaseName)
+	bundle.addLogs(ctx, clientset, namespace, releaseName)
+
+	report := DebugFailedRelease(ctx, clientset, namespace, releaseName)
+	for _, format := range []string{"json", "markdown"} {
+		buf := &bytes.Buffer{}
+		PrintDebugReport(buf, report, format)
+		path := "debug-failed.json"
+		if format == "markdown" {
+			path = "debug-failed.md"
+		}
+		bundle.Add(path, "debug-failed report ("+format+")", buf.Bytes())
+	}
+
+	return bundle
+}
+
+func (b *SupportBundle) addHelmRelease(r *helmRelease.Release) {
+	b.Index.Revision = r.Version
+	if r.Info != nil {
+		b.Index.Status = r.Info.Status.String()
+		b.Index.LastDeployed = r.Info.LastDeployed.Time
+	}
+	if r.Chart != nil && r.Chart.Metadata != nil {
+		b.Index.Chart = r.Chart.Metadata.Name + "-" + r.Chart.Metadata.Version
+	}
+
+	// Secrets, ConfigMaps and container environment in manifest
+	manifest := []string{}
+	objects, err := ManifestObjects(r.Manifest)
+	if err != nil {
+		b.AddError("cannot parse release manifest: %s", err)
+	}
+	for _, obj := range objects {
+		redactObject(obj.Object)
+		raw, err := yaml.Marshal(obj.Object)
+		if err != nil {
+			b.AddError("cannot marshal %s %s: %s", obj.GetKind(), obj.GetName(), err)
+			continue
+		}
+		manifest = append(manifest, string(raw))
+	}
+	b.Add("helm/manifest.yaml", fmt.Sprintf("helm release manifest, revision %d", r.Version), []byte(strings.Join(manifest, "---\n")))
+
+	values, err := yaml.Marshal(RedactValues(r.Config))
+	if err != nil {
+		b.AddError("cannot marshal release values: %s", err)
+	} else {
+		b.Add("helm/values.yaml", "helm release values", values)
+	}
+
+	if r.Info != nil && r.Info.Notes != "" {
+		b.Add("helm/notes.txt", "helm release notes", []byte(r.Info.Notes))
+	}
+}
+
+// RedactValues returns a copy of values with values of sensitive keys (passwords, secrets, tokens, keys)
+// replaced
+func RedactValues(values map[string]interface{}) map[string]interface{} {
+	redacted := map[string]interface{}{}
+	for k, v := range values {
+		redacted[k] = redactValue(k, v)
+	}
+	return redacted
+}
+
+func redactValue(key string, value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		// Whole secrets sections are redacted
+		if strings.EqualFold(key, "secrets") {
+			return redactAll(v)
+		}
+		return RedactValues(v)
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, item := range v {
+			list[i] = redactValue(key, item)
+		}
+		return list
+	case string:
+		if v != "" && sensitiveValueKey.MatchString(key) {
+			return "(redacted)"
+		}
+	}
+	return value
+}
+
+func redactAll(values map[string]interface{}) map[string]interface{} {
+	redacted := map[string]interface{}{}
+	for k, v := range values {
+		if m, ok := v.(map[string]interface{}); ok {
+			redacted[k] = redactAll(m)
+		} else {
+			redacted[k] = "(redacted)"
+		}
+	}
+	return redacted
+}
+
+// releaseResourceKinds lists release resource kinds, resources are selected with release labels
+var releaseResourceKinds = []struct {
+	kind string
+	list func(ctx context.Context, clientset kubernetes.Interface, namespace string, options metav1.ListOptions) ([]runtime.Object, error)
+}{
+	{"deployment", func(ctx context.Context, c kubernetes.Interface, ns string, o metav1.ListOptions) ([]runtime.Object, error) {
+		list, err := c.AppsV1().Deployments(ns).List(ctx, o)
+		return listObjects(list, err)
+	}},
+	{"statefulset", func(ctx context.Context, c kubernetes.Interface, ns string, o metav1.ListOptions) ([]runtime.Object, error) {
+		list, err := c.AppsV1().StatefulSets(ns).List(ctx, o)
+		return listObjects(list, err)
+	}},
+	{"replicaset", func(ctx context.Context, c kubernetes.Interface, ns string, o metav1.ListOptions) ([]runtime.Object, error) {
+		list, err := c.AppsV1().ReplicaSets(ns).List(ctx, o)
+		return listObjects(list, err)
+	}},
+	{"pod", func(ctx context.Context, c kubernetes.Interface, ns string, o metav1.ListOptions) ([]runtime.Object, error) {
+		list, err := c.CoreV1().Pods(ns).List(ctx, o)
+		return listObjects(list, err)
+	}},
+	{"job", func(ctx context.Context, c kubernetes.Interface, ns string, o metav1.ListOptions) ([]runtime.Object, error) {
+		list, err := c.BatchV1().Jobs(ns).List(ctx, o)
+		return listObjects(list, err)
+	}},
+	{"cronjob", func(ctx context.Context, c kubernetes.Interface, ns string, o metav1.ListOptions) ([]runtime.Object, error) {
+		list, err := c.BatchV1().CronJobs(ns).List(ctx, o)
+		return listObjects(list, err)
+	}},
+	{"service", func(ctx context.Context, c kubernetes.Interface, ns string, o metav1.ListOptions) ([]runtime.Object, error) {
+		list, err := c.CoreV1().Services(ns).List(ctx, o)
+		return listObjects(list, err)
+	}},
+	{"ingress", func(ctx context.Context, c kubernetes.Interface, ns string, o metav1.ListOptions) ([]runtime.Object, error) {
+		list, err := c.NetworkingV1().Ingresses(ns).List(ctx, o)
+		return listObjects(list, err)
+	}},
+	{"configmap", func(ctx context.Context, c kubernetes.Interface, ns string, o metav1.ListOptions) ([]runtime.Object, error) {
+		list, err := c.CoreV1().ConfigMaps(ns).List(ctx, o)
+		return listObjects(list, err)
+	}},
+	{"secret", func(ctx context.Context, c kubernetes.Interface, ns string, o metav1.ListOptions) ([]runtime.Object, error) {
+		list, err := c.CoreV1().Secrets(ns).List(ctx, o)
+		return listObjects(list, err)
+	}},
+	{"persistentvolumeclaim", func(ctx context.Context, c kubernetes.Interface, ns string, o metav1.ListOptions) ([]runtime.Object, error) {
+		list, err := c.CoreV1().PersistentVolumeClaims(ns).List(ctx, o)
+		return listObjects(list, err)
+	}},
+}
+
+// listObjects returns list items as objects
+func listObjects(list runtime.Object, err error) ([]runtime.Object, error) {
+	if err != nil {
+		return nil, err
+	}
+	return meta.ExtractList(list)
+}
+
+// addReleaseResources adds release labeled resources as yaml files
+func (b *SupportBundle) addReleaseResources(ctx context.Context, clientset kubernetes.Interface, namespace, releaseName string) {
+	for _, k := range releaseResourceKinds {
+		for _, l := range releaseSelectorLabels {
+			objects, err := k.list(ctx, clientset, namespace, metav1.ListOptions{LabelSelector: l + "=" + releaseName})
+			if err != nil {
+				b.AddError("cannot list %ss: %s", k.kind, err)
+				break
+			}
+			for _, obj := range objects {
+				accessor, err := meta.Accessor(obj)
+				if err != nil {
+					continue
+				}
+				path := fmt.Sprintf("resources/%s/%s.yaml", k.kind, accessor.GetName())
+				if _, exists := b.files[path]; exists {
+					continue
+				}
+				raw, err := resourceYaml(obj)
+				if err != nil {
+					b.AddError("cannot marshal %s %s: %s", k.kind, accessor.GetName(), err)
+					continue
+				}
+				b.Add(path, k.kind+" "+accessor.GetName(), raw)
+			}
+		}
+	}
+}
+
+// resourceYaml renders a typed object as yaml with kind and apiVersion, secret values redacted and managed
+// fields removed
+func resourceYaml(obj runtime.Object) ([]byte, error) {
+	obj = obj.DeepCopyObject()
+	if gvks, _, err := scheme.Scheme.ObjectKinds(obj); err == nil && len(gvks) > 0 {
+		obj.GetObjectKind().SetGroupVersionKind(gvks[0])
+	}
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, err
+	}
+	if metadata, ok := content["metadata"].(map[string]interface{}); ok {
+		delete(metadata, "managedFields")
+	}
+	redactObject(content)
+	return yaml.Marshal(content)
+}
+
+// podSpecPaths lists pod spec locations of workload kinds
+var podSpecPaths = map[string][]string{
+	"Pod":         {"spec"},
+	"Deployment":  {"spec", "template", "spec"},
+	"StatefulSet": {"spec", "template", "spec"},
+	"ReplicaSet":  {"spec", "template", "spec"},
+	"DaemonSet":   {"spec", "template", "spec"},
+	"Job":         {"spec", "template", "spec"},
+	"CronJob":     {"spec", "jobTemplate", "spec", "template", "spec"},
+}
+
+// redactObject redacts Secret data, sensitive ConfigMap keys and sensitive literal container environment values
+func redactObject(obj map[string]interface{}) {
+	kind, _ := obj["kind"].(string)
+	switch kind {
+	case "Secret":
+		redactSecrets(obj, nil)
+	case "ConfigMap":
+		for _, field := range []string{"data", "binaryData"} {
+			if data, ok := obj[field].(map[string]interface{}); ok {
+				for k := range data {
+					if sensitiveValueKey.MatchString(k) {
+						data[k] = "(redacted)"
+					}
+				}
+			}
+		}
+	}
+	path, ok := podSpecPaths[kind]
+	if !ok {
+		return
+	}
+	value, found, err := unstructured.NestedFieldNoCopy(obj, path...)
+	spec, ok := value.(map[string]interface{})
+	if !found || err != nil || !ok {
+		return
+	}
+	for _, field := range []string{"initContainers", "containers"} {
+		containers, ok := spec[field].([]interface{})
+		if !ok {
+			continue
+		}
+		for _, c := range containers {
+			container, ok := c.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			env, _ := container["env"].([]interface{})
+			for _, e := range env {
+				item, ok := e.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				name, _ := item["name"].(string)
+				if value, ok := item["value"].(string); ok && value != "" && sensitiveValueKey.MatchString(name) {
+					item["value"] = "(redacted)"
+				}
+			}
+		}
+	}
+}
+
+// addEvents adds events of release resources sorted by time
+func (b *SupportBundle) addEvents(ctx context.Context, clientset kubernetes.Interface, namespace, releaseName string) {
+	events, err := ReleaseEvents(ctx, clientset, namespace, releaseName, time.Time{})
+	if err != nil {
+		b.AddError("cannot list events: %s", err)
+		return
+	}
+	buf := &bytes.Buffer{}
+	PrintReleaseEvents(buf, events)
+	b.Add("events.txt", "events of release resources", buf.Bytes())
+}
+
+// addLogs adds current and previous logs of release pod containers
+func (b *SupportBundle) addLogs(ctx context.Context, clientset kubernetes.Interface, namespace, releaseName string) {
+	// Post-release job pods are not always labeled with release name
+	selectors := []string{"job-name=" + releaseName + "-post-release"}
+	for _, l := range releaseSelectorLabels {
+		selectors = append(selectors, l+"="+releaseName)
+	}
+
+	found := map[string]v1.Pod{}
+	for _, selector := range selectors {
+		pods, err := clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+		if err != nil {
+			b.AddError("cannot list pods: %s", err)
+			return
+		}
+		for _, pod := range pods.Items {
+			found[pod.Name] = pod
+		}
+	}
+
+	for _, pod := range found {
+		statuses := append([]v1.ContainerStatus{}, pod.Status.InitContainerStatuses...)
+		statuses = append(statuses, pod.Status.ContainerStatuses...)
+		for _, status := range statuses {
+			if status.State.Waiting == nil || status.RestartCount > 0 {
+				b.addContainerLogs(ctx, clientset, pod, status.Name, false)
+			}
+			if status.RestartCount > 0 {
+				b.addContainerLogs(ctx, clientset, pod, status.Name, true)
+			}
+		}
+	}
+}
+
+func (b *SupportBundle) addContainerLogs(ctx context.Context, clientset kubernetes.Interface, pod v1.Pod, container string, previous bool) {
+	path := fmt.Sprintf("logs/%s/%s.log", pod.Name, container)
+	description := fmt.Sprintf("pod %s container %s logs", pod.Name, container)
+	if previous {
+		path = fmt.Sprintf("logs/%s/%s.previous.log", pod.Name, container)
+		description = fmt.Sprintf("pod %s container %s logs before the last restart", pod.Name, container)
+	}
+
+	req := clientset.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, &v1.PodLogOptions{Container: container, Previous: previous})
+	podLogs, err := req.Stream(ctx)
+	if err != nil {
+		b.AddError("cannot get %s: %s", description, err)
+		return
+	}
+	defer podLogs.Close()
+
+	buf := &bytes.Buffer{}
+	if _, err := io.Copy(buf, podLogs); err != nil {
+		b.AddError("cannot read %s: %s", description, err)
+		return
+	}
+	b.Add(path, description, buf.Bytes())
+}
+
+// WriteArchive writes the bundle as a gzipped tarball. Files are placed in a "<release>-support-bundle" folder,
+// "index.json" lists bundle contents.
+func (b *SupportBundle) WriteArchive(out io.Writer) error {
+	sort.Slice(b.Index.Files, func(i, j int) bool { return b.Index.Files[i].Path < b.Index.Files[j].Path })
+	index, err := json.MarshalIndent(b.Index, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(out)
+	archive := tar.NewWriter(gz)
+	folder := b.Index.Release + "-support-bundle/"
+
+	write := func(path string, content []byte) error {
+		err := archive.WriteHeader(&tar.Header{
+			Name:     folder + path,
+			Mode:     0644,
+			Size:     int64(len(content)),
+			ModTime:  b.Index.Created,
+			Typeflag: tar.TypeReg,
+		})
+		if err != nil {
+			return err
+		}
+		_, err = archive.Write(content)
+		return err
+	}
+
+	if err := write("index.json", append(index, '\n')); err != nil {
+		return err
+	}
+	for _, file := range b.Index.Files {
+		if err := write(file.Path, b.files[file.Path]); err != nil {
+			return err
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
@@ -0,0 +1,539 @@
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+	"github.com/santhosh-tekuri/jsonschema/v6/kind"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+	"gopkg.in/yaml.v3"
+
+	helmAction "helm.sh/helm/v3/pkg/action"
+	helmChart "helm.sh/helm/v3/pkg/chart"
+	helmChartutil "helm.sh/helm/v3/pkg/chartutil"
+	helmRelease "helm.sh/helm/v3/pkg/release"
+)
+
+// ValuesSource is a set of release values with a name used in validation messages (i.e. values file name).
+// Values parsed from files keep line and column information.
+type ValuesSource struct {
+	Name   string
+	node   *yaml.Node
+	prefix []string
+}
+
+// ValuesValidationError is a chart schema violation with the location of the offending value
+type ValuesValidationError struct {
+	// JSON pointer of the value, i.e. "/php/replicas"
+	Path    string
+	Message string
+	// Values source that defines the value, empty if the value is not defined anywhere (i.e. missing required value)
+	Source string
+	Line   int
+	Column int
+}
+
+func (e ValuesValidationError) String() string {
+	location := e.Source
+	if location != "" && e.Line > 0 {
+		location = fmt.Sprintf("%s:%d:%d", e.Source, e.Line, e.Column)
+	}
+	if location != "" {
+		return fmt.Sprintf("%s: at '%s': %s", location, e.Path, e.Message)
+	}
+	return fmt.Sprintf("at '%s': %s", e.Path, e.Message)
+}
+
+var schemaMessagePrinter = message.NewPrinter(language.English)
+
+// ValuesFileSource reads a values file as a validation source
+func ValuesFileSource(name string, file string) (ValuesSource, error) {
+	raw, err := os.ReadFile(file)
+	if err != nil {
+		return ValuesSource{}, err
+	}
+	return valuesYamlSource(name, raw, nil)
+}
+
+// ValuesMapSource wraps structured values (i.e. values computed from release parameters) as a validation source
+func ValuesMapSource(name string, values map[string]interface{}) (ValuesSource, error) {
+	node := &yaml.Node{}
+	if err := node.Encode(values); err != nil {
+		return ValuesSource{}, err
+	}
+	return ValuesSource{Name: name, node: node}, nil
+}
+
+func valuesYamlSource(name string, raw []byte, prefix []string) (ValuesSource, error) {
+	node := &yaml.Node{}
+	if err := yaml.Unmarshal(raw, node); err != nil {
+		return ValuesSource{}, fmt.Errorf("%s: %s", name, err)
+	}
+	return ValuesSource{Name: name, node: node, prefix: prefix}, nil
+}
+
+// chartValuesSources returns default values files of a chart and its subcharts
+func chartValuesSources(chart *helmChart.Chart, name string, prefix []string) []ValuesSource {
+	sources := []ValuesSource{}
+	for _, file := range chart.Raw {
+		if file.Name != helmChartutil.ValuesfileName {
+			continue
+		}
+		source, err := valuesYamlSource(name+"/"+file.Name, file.Data, prefix)
+		if err == nil {
+			sources = append(sources, source)
+		}
+	}
+	for _, subchart := range chart.Dependencies() {
+		subPrefix := append(append([]string{}, prefix...), subchart.Name())
+		sources = append(sources, chartValuesSources(subchart, name+"/charts/"+subchart.Name(), subPrefix)...)
+	}
+	return sources
+}
+
+// lookup finds the deepest node defining the path, returns the node and the number of matched path elements.
+// Mapping entries are located by their keys.
+func (s ValuesSource) lookup(path []string) (*yaml.Node, int) {
+	if s.node == nil || len(path) < len(s.prefix) {
+		return nil, 0
+	}
+	for i, p := range s.prefix {
+		if path[i] != p {
+			return nil, 0
+		}
+	}
+
+	node := s.node
+	if node.Kind == yaml.DocumentNode {
+		if len(node.Content) == 0 {
+			return nil, 0
+		}
+		node = node.Content[0]
+	}
+	position := node
+	depth := len(s.prefix)
+	for _, element := range path[len(s.prefix):] {
+		key, value := yamlChild(node, element)
+		if value == nil {
+			break
+		}
+		position, node = key, value
+		depth++
+	}
+	return position, depth
+}
+
+// yamlChild returns the key (or item) node and value node of a mapping key or sequence index, following aliases and merge keys
+func yamlChild(node *yaml.Node, element string) (*yaml.Node, *yaml.Node) {
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == element {
+				value := node.Content[i+1]
+				if value.Kind == yaml.AliasNode {
+					value = value.Alias
+				}
+				return node.Content[i], value
+			}
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value != "<<" {
+				continue
+			}
+			merged := []*yaml.Node{node.Content[i+1]}
+			if node.Content[i+1].Kind == yaml.SequenceNode {
+				merged = node.Content[i+1].Content
+			}
+			for _, m := range merged {
+				if key, value := yamlChild(m, element); value != nil {
+					return key, value
+				}
+			}
+		}
+	case yaml.SequenceNode:
+		index, err := strconv.Atoi(element)
+		if err == nil && index >= 0 && index < len(node.Content) {
+			item := node.Content[index]
+			if item.Kind == yaml.AliasNode {
+				return item, item.Alias
+			}
+			return item, item
+		}
+	}
+	return nil, nil
+}
+
+// locate sets the source and position of the value at path. Sources are in order of precedence (later sources
+// override earlier ones), the last source defining the value wins. When the value is not defined at all, the closest
+// defined parent is used.
+func (e *ValuesValidationError) locate(sources []ValuesSource, path []string) {
+	bestDepth := -1
+	for i := len(sources) - 1; i >= 0; i-- {
+		node, depth := sources[i].lookup(path)
+		if node == nil || depth <= bestDepth {
+			continue
+		}
+		bestDepth = depth
+		e.Source, e.Line, e.Column = sources[i].Name, node.Line, node.Column
+		if depth == len(path) {
+			return
+		}
+	}
+}
+
+// ValidateChartValues validates release values against the values.schema.json of the chart and its subcharts, the same
+// way helm does before rendering. Chart default values are merged in. Schema violations are returned with the location
+// of the offending value in sources, an error is returned only when validation could not be run.
+func ValidateChartValues(chart *helmChart.Chart, values map[string]interface{}, sources []ValuesSource) ([]ValuesValidationError, error) {
+
+	if err := helmChartutil.ProcessDependenciesWithMerge(chart, values); err != nil {
+		return nil, err
+	}
+	merged, err := helmChartutil.CoalesceValues(chart, values)
+	if err != nil {
+		return nil, err
+	}
+
+	allSources := append(chartValuesSources(chart, chart.Name(), nil), sources...)
+
+	violations, err := validateChartSchema(chart, merged.AsMap(), nil, allSources)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(violations, func(i, j int) bool {
+		return violations[i].Path < violations[j].Path
+	})
+	return violations, nil
+}
+
+func validateChartSchema(chart *helmChart.Chart, values map[string]interface{}, prefix []string, sources []ValuesSource) ([]ValuesValidationError, error) {
+	violations := []ValuesValidationError{}
+
+	if chart.Schema != nil {
+		schema, err := jsonschema.UnmarshalJSON(bytes.NewReader(chart.Schema))
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid values.schema.json: %s", chart.Name(), err)
+		}
+		compiler := jsonschema.NewCompiler()
+		if err := compiler.AddResource("file:///values.schema.json", schema); err != nil {
+			return nil, fmt.Errorf("%s: invalid values.schema.json: %s", chart.Name(), err)
+		}
+		validator, err := compiler.Compile("file:///values.schema.json")
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid values.schema.json: %s", chart.Name(), err)
+		}
+
+		err = validator.Validate(values)
+		if validationErr, ok := err.(*jsonschema.ValidationError); ok {
+			violations = append(violations, schemaViolations(validationErr, prefix, sources)...)
+		} else if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, subchart := range chart.Dependencies() {
+		subchartValues, _ := values[subchart.Name()].(map[string]interface{})
+		subPrefix := append(append([]string{}, prefix...), subchart.Name())
+		subViolations, err := validateChartSchema(subchart, subchartValues, subPrefix, sources)
+		if err != nil {
+			return nil, err
+		}
+		violations = append(violations, subViolations...)
+	}
+
+	return violations, nil
+}
+
+// schemaViolations flattens a validation error tree to leaf errors
+func schemaViolations(err *jsonschema.ValidationError, prefix []string, sources []ValuesSource) []ValuesValidationError {
+	if len(err.Causes) > 0 {
+		violations := []ValuesValidationError{}
+		for _, cause := range err.Causes {
+			violations = append(violations, schemaViolations(cause, prefix, sources)...)
+		}
+		return violations
+	}
+
+	path := append(append([]string{}, prefix...), err.InstanceLocation...)
+
+	// Unknown keys are reported one by one, pointing to the key itself
+	if additional, ok := err.ErrorKind.(*kind.AdditionalProperties); ok {
+		violations := []ValuesValidationError{}
+		for _, property := range additional.Properties {
+			propertyPath := append(append([]string{}, path...), property)
+			violation := ValuesValidationError{
+				Path:    jsonPointer(propertyPath),
+				Message: (&kind.AdditionalProperties{Properties: []string{property}}).LocalizedString(schemaMessagePrinter),
+			}
+			violation.locate(sources, propertyPath)
+			violations = append(violations, violation)
+		}
+		return violations
+	}
+
+	violation := ValuesValidationError{
+		Path:    jsonPointer(path),
+		Message: err.ErrorKind.LocalizedString(schemaMessagePrinter),
+	}
+	violation.locate(sources, path)
+	return []ValuesValidationError{violation}
+}
+
+func jsonPointer(path []string) string {
+	var sb strings.Builder
+	for _, element := range path {
+		sb.WriteString("/")
+		sb.WriteString(strings.ReplaceAll(strings.ReplaceAll(element, "~", "~0"), "/", "~1"))
+	}
+	return sb.String()
+}
+
+// RenderHelmChart renders chart templates without cluster access, like "helm template". Cluster lookups return
+// empty results and default kubernetes capabilities are used.
+func RenderHelmChart(chart *helmChart.Chart, releaseName string, namespace string, values map[string]interface{}) (*helmRelease.Release, error) {
+	install := helmAction.NewInstall(&helmAction.Configuration{Log: HelmQuietLog})
+	install.ReleaseName = releaseName
+	install.Namespace = namespace
+	install.DryRun = true
+	install.ClientOnly = true
+	install.Replace = true
+	return install.Run(chart, values)
+}
+
+// UnknownValueKeys reports keys in values sources that are neither defined in chart default values nor in the chart
+// schema, i.e. typos like "ngnix" instead of "nginx" that helm would silently ignore. Known key with the closest
+// spelling is suggested. Maps without defaults and schema properties are free-form and not checked, keys of maps closed
+// with "additionalProperties: false" are reported by schema validation already. Open values are dot separated paths of
+// maps that accept user defined keys ("*" matches any key), see ChartProfile.OpenValues.
+func UnknownValueKeys(chart *helmChart.Chart, sources []ValuesSource, openValues []string) ([]ValuesValidationError, error) {
+	defaults, err := helmChartutil.CoalesceValues(chart, map[string]interface{}{})
+	if err != nil {
+		return nil, err
+	}
+	schema := map[string]interface{}{}
+	if chart.Schema != nil {
+		if err := json.Unmarshal(chart.Schema, &schema); err != nil {
+			return nil, fmt.Errorf("%s: invalid values.schema.json: %s", chart.Name(), err)
+		}
+	}
+
+	unknown := []ValuesValidationError{}
+	for _, source := range sources {
+		node := source.node
+		if node == nil {
+			continue
+		}
+		if node.Kind == yaml.DocumentNode {
+			if len(node.Content) == 0 {
+				continue
+			}
+			node = node.Content[0]
+		}
+		unknown = append(unknown, unknownKeys(source.Name, node, nil, defaults.AsMap(), schema, schema, openValues)...)
+	}
+	return unknown, nil
+}
+
+// isOpenValue returns true if value path matches one of open value paths
+func isOpenValue(path []string, openValues []string) bool {
+	for _, open := range openValues {
+		parts := strings.Split(open, ".")
+		if len(parts) != len(path) {
+			continue
+		}
+		match := true
+		for i := range parts {
+			if parts[i] != "*" && parts[i] != path[i] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
+
+func unknownKeys(sourceName string, node *yaml.Node, path []string, defaults interface{}, schema map[string]interface{}, rootSchema map[string]interface{}, openValues []string) []ValuesValidationError {
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	defaultsMap, _ := defaults.(map[string]interface{})
+	schema = resolveSchemaRef(schema, rootSchema)
+	properties := schemaProperties(schema, rootSchema)
+	if _, ok := schema["additionalProperties"]; ok {
+		// Closed maps are validated by the schema, open maps accept any key
+		return nil
+	}
+	if len(defaultsMap) == 0 && len(properties) == 0 {
+		return nil
+	}
+	open := isOpenValue(path, openValues)
+
+	known := []string{}
+	for key := range defaultsMap {
+		known = append(known, key)
+	}
+	for key := range properties {
+		if _, ok := defaultsMap[key]; !ok {
+			known = append(known, key)
+		}
+	}
+	sort.Strings(known)
+
+	unknown := []ValuesValidationError{}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		keyNode, valueNode := node.Content[i], node.Content[i+1]
+		key := keyNode.Value
+		if key == "<<" {
+			merged := []*yaml.Node{valueNode}
+			if valueNode.Kind == yaml.SequenceNode {
+				merged = valueNode.Content
+			}
+			for _, m := range merged {
+				unknown = append(unknown, unknownKeys(sourceName, m, path, defaults, schema, rootSchema, openValues)...)
+			}
+			continue
+		}
+		keyPath := append(append([]string{}, path...), key)
+
+		_, inDefaults := defaultsMap[key]
+		keySchema, inSchema := properties[key]
+		if !inSchema {
+			keySchema, inSchema = schemaPatternProperty(schema, key)
+		}
+		if inDefaults || inSchema {
+			if key == "global" && len(path) == 0 {
+				continue
+			}
+			unknown = append(unknown, unknownKeys(sourceName, valueNode, keyPath, defaultsMap[key], keySchema, rootSchema, openValues)...)
+			continue
+		}
+		if open {
+			continue
+		}
+
+		message := "unknown key"
+		if suggestion := closestKey(key, known); suggestion != "" {
+			message = fmt.Sprintf("unknown key, did you mean '%s'?", suggestion)
+		}
+		unknown = append(unknown, ValuesValidationError{
+			Path:    jsonPointer(keyPath),
+			Message: message,
+			Source:  sourceName,
+			Line:    keyNode.Line,
+			Column:  keyNode.Column,
+		})
+	}
+	return unknown
+}
+
+// resolveSchemaRef follows local schema references (i.e. "#/definitions/image")
+func resolveSchemaRef(schema map[string]interface{}, rootSchema map[string]interface{}) map[string]interface{} {
+	for i := 0; i < 10 && schema != nil; i++ {
+		ref, ok := schema["$ref"].(string)
+		if !ok || !strings.HasPrefix(ref, "#") {
+			return schema
+		}
+		var target interface{} = rootSchema
+		for _, element := range strings.Split(strings.TrimPrefix(strings.TrimPrefix(ref, "#"), "/"), "/") {
+			if element == "" {
+				continue
+			}
+			element = strings.ReplaceAll(strings.ReplaceAll(element, "~1", "/"), "~0", "~")
+			targetMap, _ := target.(map[string]interface{})
+			target = targetMap[element]
+		}
+		schema, _ = target.(map[string]interface{})
+	}
+	return schema
+}
+
+// schemaProperties returns object properties of a schema, including properties of allOf, anyOf and oneOf subschemas
+func schemaProperties(schema map[string]interface{}, rootSchema map[string]interface{}) map[string]map[string]interface{} {
+	properties := map[string]map[string]interface{}{}
+	if schema == nil {
+		return properties
+	}
+	if p, ok := schema["properties"].(map[string]interface{}); ok {
+		for key, value := range p {
+			properties[key], _ = value.(map[string]interface{})
+		}
+	}
+	for _, combinator := range []string{"allOf", "anyOf", "oneOf"} {
+		subschemas, _ := schema[combinator].([]interface{})
+		for _, subschema := range subschemas {
+			subschemaMap, _ := subschema.(map[string]interface{})
+			for key, value := range schemaProperties(resolveSchemaRef(subschemaMap, rootSchema), rootSchema) {
+				if _, ok := properties[key]; !ok {
+					properties[key] = value
+				}
+			}
+		}
+	}
+	return properties
+}
+
+func schemaPatternProperty(schema map[string]interface{}, key string) (map[string]interface{}, bool) {
+	patterns, _ := schema["patternProperties"].(map[string]interface{})
+	for pattern, value := range patterns {
+		if matched, err := regexp.MatchString(pattern, key); err == nil && matched {
+			valueMap, _ := value.(map[string]interface{})
+			return valueMap, true
+		}
+	}
+	return nil, false
+}
+
+// closestKey returns the known key with the smallest edit distance, if it is close enough to be a typo
+func closestKey(key string, known []string) string {
+	suggestion := ""
+	best := -1
+	for _, candidate := range known {
+		distance := levenshteinDistance(strings.ToLower(key), strings.ToLower(candidate))
+		if distance > 2 && distance > len(key)/3 {
+			continue
+		}
+		if best == -1 || distance < best {
+			suggestion, best = candidate, distance
+		}
+	}
+	return suggestion
+}
+
+func levenshteinDistance(a string, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(rb)]
+}
@@ -0,0 +1,157 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// URLVerification holds parameters for checking that release urls answer
+type URLVerification struct {
+	// Accepted response status codes, i.e. "200-399,401"
+	ExpectedStatus string
+	Username       string
+	Password       string
+	// Attempts after the first failed request, delay between attempts doubles starting from Backoff
+	Retries int
+	Backoff time.Duration
+	// Timeout of a single request
+	Timeout time.Duration
+	// HTTP client, defaults to a client with Timeout
+	Client *http.Client
+}
+
+// URLCheckResult is the outcome of url verification
+type URLCheckResult struct {
+	URL      string
+	Status   int
+	Attempts int
+	Err      error
+}
+
+// ParseStatusCodes parses a comma separated list of status codes and ranges (i.e. "200-399,401")
+func ParseStatusCodes(codes string) ([][2]int, error) {
+	ranges := [][2]int{}
+	for _, part := range strings.Split(codes, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		bounds := strings.SplitN(part, "-", 2)
+		from, err := strconv.Atoi(strings.TrimSpace(bounds[0]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid status code: %s", part)
+		}
+		to := from
+		if len(bounds) == 2 {
+			to, err = strconv.Atoi(strings.TrimSpace(bounds[1]))
+			if err != nil || to < from {
+				return nil, fmt.Errorf("invalid status code range: %s", part)
+			}
+		}
+		ranges = append(ranges, [2]int{from, to})
+	}
+	if len(ranges) == 0 {
+		return nil, fmt.Errorf("no status codes given")
+	}
+	return ranges, nil
+}
+
+// HostnameURLs returns https urls for ingress hostnames, wildcard hostnames are skipped
+func HostnameURLs(hostnames []string) []string {
+	urls := []string{}
+	for _, hostname := range hostnames {
+		if hostname != "" && !strings.HasPrefix(hostname, "*") {
+			urls = append(urls, "https://"+hostname)
+		}
+	}
+	return urls
+}
+
+// VerifyURLs requests each url until it answers with an expected status code or retries run out. An error is
+// returned if any of the urls did not answer as expected.
+func VerifyURLs(ctx context.Context, urls []string, v URLVerification, out io.Writer) ([]URLCheckResult, error) {
+	expected, err := ParseStatusCodes(v.ExpectedStatus)
+	if err != nil {
+		return nil, err
+	}
+	client := v.Client
+	if client == nil {
+		client = &http.Client{Timeout: v.Timeout}
+	}
+
+	results := []URLCheckResult{}
+	failed := 0
+	for _, url := range urls {
+		result := verifyURL(ctx, client, url, expected, v)
+		if result.Err != nil {
+			failed++
+			fmt.Fprintf(out, "%s: %s (%d attempts)\n", url, result.Err, result.Attempts)
+		} else {
+			fmt.Fprintf(out, "%s: %d %s\n", url, result.Status, http.StatusText(result.Status))
+		}
+		results = append(results, result)
+	}
+
+	if failed > 0 {
+		return results, fmt.Errorf("%d of %d urls did not answer as expected", failed, len(urls))
+	}
+	return results, nil
+}
+
+func verifyURL(ctx context.Context, client *http.Client, url string, expected [][2]int, v URLVerification) URLCheckResult {
+	result := URLCheckResult{URL: url}
+	backoff := v.Backoff
+
+	for {
+		result.Attempts++
+		result.Status, result.Err = requestStatus(ctx, client, url, v)
+		if result.Err == nil {
+			if statusExpected(result.Status, expected) {
+				return result
+			}
+			result.Err = fmt.Errorf("unexpected status %d %s", result.Status, http.StatusText(result.Status))
+		}
+
+		if result.Attempts > v.Retries {
+			return result
+		}
+		select {
+		case <-ctx.Done():
+			result.Err = ctx.Err()
+			return result
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func requestStatus(ctx context.Context, client *http.Client, url string, v URLVerification) (int, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return 0, err
+	}
+	if v.Username != "" || v.Password != "" {
+		request.SetBasicAuth(v.Username, v.Password)
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+	io.Copy(io.Discard, response.Body)
+	return response.StatusCode, nil
+}
+
+func statusExpected(status int, expected [][2]int) bool {
+	for _, r := range expected {
+		if status >= r[0] && status <= r[1] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,507 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1core "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Container waiting reasons that don't resolve without a new release
+var podFailureReasons = map[string]bool{
+	"CrashLoopBackOff": true,
+	"ImagePullBackOff": true,
+	"InvalidImageName": true,
+}
+
+// PodFailureError describes a pod container that is stuck and will not become ready
+type PodFailureError struct {
+	Pod       string
+	Container string
+	Reason    string
+	Message   string
+}
+
+func (e *PodFailureError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("pod %s container %s: %s", e.Pod, e.Container, e.Reason)
+	}
+	return fmt.Sprintf("pod %s container %s: %s (%s)", e.Pod, e.Container, e.Reason, e.Message)
+}
+
+// PodFailure returns an error when any pod container is in CrashLoopBackOff, ImagePullBackOff or InvalidImageName state
+func PodFailure(pod *v1core.Pod) error {
+	statuses := append([]v1core.ContainerStatus{}, pod.Status.InitContainerStatuses...)
+	statuses = append(statuses, pod.Status.ContainerStatuses...)
+	for _, status := range statuses {
+		if status.State.Waiting != nil && podFailureReasons[status.State.Waiting.Reason] {
+			return &PodFailureError{
+				Pod:       pod.Name,
+				Container: status.Name,
+				Reason:    status.State.Waiting.Reason,
+				Message:   status.State.Waiting.Message,
+			}
+		}
+	}
+	return nil
+}
+
+// podContainerStarted returns true when any pod container is running or has terminated, so logs are available
+func podContainerStarted(pod *v1core.Pod) bool {
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.State.Running != nil || status.State.Terminated != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// watchSource lists objects and watches their changes starting from list resource version
+type watchSource struct {
+	list  func(ctx context.Context) ([]runtime.Object, string, error)
+	watch func(ctx context.Context, resourceVersion string) (watch.Interface, error)
+}
+
+func podWatchSource(clientset kubernetes.Interface, namespace string, selector string) watchSource {
+	return watchSource{
+		list: func(ctx context.Context) ([]runtime.Object, string, error) {
+			pods, err := clientset.CoreV1().Pods(namespace).List(ctx, v1.ListOptions{LabelSelector: selector})
+			if err != nil {
+				return nil, "", err
+			}
+			objects := []runtime.Object{}
+			for i := range pods.Items {
+				objects = append(objects, &pods.Items[i])
+			}
+			return objects, pods.ResourceVersion, nil
+		},
+		watch: func(ctx context.Context, resourceVersion string) (watch.Interface, error) {
+			return clientset.CoreV1().Pods(namespace).Watch(ctx, v1.ListOptions{LabelSelector: selector, ResourceVersion: resourceVersion})
+		},
+	}
+}
+
+func deploymentWatchSource(clientset kubernetes.Interface, namespace string, selector string) watchSource {
+	return watchSource{
+		list: func(ctx context.Context) ([]runtime.Object, string, error) {
+			deployments, err := clientset.AppsV1().Deployments(namespace).List(ctx, v1.ListOptions{LabelSelector: selector})
+			if err != nil {
+				return nil, "", err
+			}
+			objects := []runtime.Object{}
+			for i := range deployments.Items {
+				objects = append(objects, &deployments.Items[i])
+			}
+			return objects, deployments.ResourceVersion, nil
+		},
+		watch: func(ctx context.Context, resourceVersion string) (watch.Interface, error) {
+			return clientset.AppsV1().Deployments(namespace).Watch(ctx, v1.ListOptions{LabelSelector: selector, ResourceVersion: resourceVersion})
+		},
+	}
+}
+
+func statefulSetWatchSource(clientset kubernetes.Interface, namespace string, selector string) watchSource {
+	return watchSource{
+		list: func(ctx context.Context) ([]runtime.Object, string, error) {
+			statefulsets, err := clientset.AppsV1().StatefulSets(namespace).List(ctx, v1.ListOptions{LabelSelector: selector})
+			if err != nil {
+				return nil, "", err
+			}
+			objects := []runtime.Object{}
+			for i := range statefulsets.Items {
+				objects = append(objects, &statefulsets.Items[i])
+			}
+			return objects, statefulsets.ResourceVersion, nil
+		},
+		watch: func(ctx context.Context, resourceVersion string) (watch.Interface, error) {
+			return clientset.AppsV1().StatefulSets(namespace).Watch(ctx, v1.ListOptions{LabelSelector: selector, ResourceVersion: resourceVersion})
+		},
+	}
+}
+
+// watchObjects passes current and changed objects to handle until it reports done, returns an error or
+// context is cancelled. Objects are relisted when the watch is closed or expires.
+func watchObjects(ctx context.Context, source watchSource, handle func(obj runtime.Object) (bool, error)) error {
+	for {
+		objects, resourceVersion, err := source.list(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		for _, obj := range objects {
+			done, err := handle(obj)
+			if err != nil || done {
+				return err
+			}
+		}
+
+		w, err := source.watch(ctx, resourceVersion)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		done, err := consumeWatch(ctx, w, handle)
+		w.Stop()
+		if err != nil || done {
+			return err
+		}
+	}
+}
+
+// consumeWatch reads watch events until handle reports done or watch has to be restarted
+func consumeWatch(ctx context.Context, w watch.Interface, handle func(obj runtime.Object) (bool, error)) (bool, error) {
+	for {
+		select {
+		case <-ctx.Done():
+			return true, ctx.Err()
+		case event, ok := <-w.ResultChan():
+			if !ok {
+				return false, nil
+			}
+			switch event.Type {
+			case watch.Error:
+				// Most likely an expired resource version, relist
+				return false, nil
+			case watch.Added, watch.Modified:
+				done, err := handle(event.Object)
+				if err != nil || done {
+					return true, err
+				}
+			}
+		}
+	}
+}
+
+// StreamPostReleaseLogs watches for post-release job pod and streams its logs (with timestamps) as soon as
+// the container starts, until the container terminates or context is cancelled. A *PodFailureError is returned
+// when job pod is stuck in CrashLoopBackOff or ImagePullBackOff.
+func StreamPostReleaseLogs(ctx context.Context, clientset kubernetes.Interface, namespace string, releaseName string, out io.Writer) error {
+	selector := "job-name=" + releaseName + "-post-release"
+	scheduled := map[string]bool{}
+
+	var logPod *v1core.Pod
+	err := watchObjects(ctx, podWatchSource(clientset, namespace, selector), func(obj runtime.Object) (bool, error) {
+		pod, ok := obj.(*v1core.Pod)
+		if !ok {
+			return false, nil
+		}
+		if pod.Spec.NodeName != "" && !scheduled[pod.Name] {
+			scheduled[pod.Name] = true
+			fmt.Fprintf(out, "Post-release job pod %s scheduled on %s\n", pod.Name, pod.Spec.NodeName)
+		}
+		if err := PodFailure(pod); err != nil {
+			return true, err
+		}
+		if podContainerStarted(pod) {
+			logPod = pod
+			return true, nil
+		}
+		return false, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(out, "")
+	fmt.Fprintln(out, "Post-release log:")
+	req := clientset.CoreV1().Pods(namespace).GetLogs(logPod.Name, &v1core.PodLogOptions{
+		Follow:     true,
+		Timestamps: true,
+	})
+	stream, err := req.Stream(ctx)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+	_, err = io.Copy(out, stream)
+	return err
+}
+
+// DeploymentRolloutStatus returns a rollout status message and whether the rollout is complete (same logic as "kubectl rollout status")
+func DeploymentRolloutStatus(deployment *appsv1.Deployment) (string, bool, error) {
+	if deployment.Generation > deployment.Status.ObservedGeneration {
+		return fmt.Sprintf("Waiting for deployment %q spec update to be observed...", deployment.Name), false, nil
+	}
+	for _, c := range deployment.Status.Conditions {
+		if c.Type == appsv1.DeploymentProgressing && c.Reason == "ProgressDeadlineExceeded" {
+			return "", false, fmt.Errorf("deployment %q exceeded its progress deadline", deployment.Name)
+		}
+	}
+	replicas := int32(1)
+	if deployment.Spec.Replicas != nil {
+		replicas = *deployment.Spec.Replicas
+	}
+	if deployment.Status.UpdatedReplicas < replicas {
+		return fmt.Sprintf("Waiting for deployment %q rollout to finish: %d out of %d new replicas have been updated...", deployment.Name, deployment.Status.UpdatedReplicas, replicas), false, nil
+	}
+	if deployment.Status.Replicas > deployment.Status.UpdatedReplicas {
+		return fmt.Sprintf("Waiting for deployment %q rollout to finish: %d old replicas are pending termination...", deployment.Name, deployment.Status.Replicas-deployment.Status.UpdatedReplicas), false, nil
+	}
+	if deployment.Status.AvailableReplicas < deployment.Status.UpdatedReplicas {
+		return fmt.Sprintf("Waiting for deployment %q rollout to finish: %d of %d updated replicas are available...", deployment.Name, deployment.Status.AvailableReplicas, deployment.Status.UpdatedReplicas), false, nil
+	}
+	return fmt.Sprintf("deployment %q successfully rolled out", deployment.Name), true, nil
+}
+
+// StatefulSetRolloutStatus returns a rollout status message and whether the rollout is complete (same logic as "kubectl rollout status")
+func StatefulSetRolloutStatus(sts *appsv1.StatefulSet) (string, bool, error) {
+	if sts.Spec.UpdateStrategy.Type != appsv1.RollingUpdateStatefulSetStrategyType {
+		return "", true, fmt.Errorf("rollout status is only available for %s strategy type", appsv1.RollingUpdateStatefulSetStrategyType)
+	}
+	if sts.Status.ObservedGeneration == 0 || sts.Generation > sts.Status.ObservedGeneration {
+		return fmt.Sprintf("Waiting for statefulset %q spec update to be observed...", sts.Name), false, nil
+	}
+	replicas := int32(1)
+	if sts.Spec.Replicas != nil {
+		replicas = *sts.Spec.Replicas
+	}
+	if sts.Status.ReadyReplicas < replicas {
+		return fmt.Sprintf("Waiting for %d pods to be ready...", replicas-sts.Status.ReadyReplicas), false, nil
+	}
+	if sts.Spec.UpdateStrategy.RollingUpdate != nil && sts.Spec.UpdateStrategy.RollingUpdate.Partition != nil {
+		partition := *sts.Spec.UpdateStrategy.RollingUpdate.Partition
+		if sts.Status.UpdatedReplicas < replicas-partition {
+			return fmt.Sprintf("Waiting for partitioned roll out to finish: %d out of %d new pods have been updated...", sts.Status.UpdatedReplicas, replicas-partition), false, nil
+		}
+		return fmt.Sprintf("partitioned roll out complete: %d new pods have been updated...", sts.Status.UpdatedReplicas), true, nil
+	}
+	if sts.Status.UpdateRevision != sts.Status.CurrentRevision {
+		return fmt.Sprintf("waiting for statefulset %q rolling update to complete %d pods at revision %s...", sts.Name, sts.Status.UpdatedReplicas, sts.Status.UpdateRevision), false, nil
+	}
+	return fmt.Sprintf("statefulset rolling update complete %d pods at revision %s...", sts.Status.CurrentReplicas, sts.Status.CurrentRevision), true, nil
+}
+
+// rolloutStatus returns rollout status of a deployment or a rolling update statefulset, ok is false for other objects
+func rolloutStatus(obj runtime.Object) (key string, message string, done bool, ok bool, err error) {
+	switch r := obj.(type) {
+	case *appsv1.Deployment:
+		message, done, err = DeploymentRolloutStatus(r)
+		return "deployment/" + r.Name, message, done, true, err
+	case *appsv1.StatefulSet:
+		if r.Spec.UpdateStrategy.Type != appsv1.RollingUpdateStatefulSetStrategyType {
+			return "", "", false, false, nil
+		}
+		message, done, err = StatefulSetRolloutStatus(r)
+		return "statefulset/" + r.Name, message, done, true, err
+	}
+	return "", "", false, false, nil
+}
+
+// syncWriter serializes writes of concurrent watchers
+type syncWriter struct {
+	mu  sync.Mutex
+	out io.Writer
+}
+
+func (w *syncWriter) println(message string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	fmt.Fprintln(w.out, message)
+}
+
+// ExistingPods is a set of release pods (by UID) that existed before a rollout started. Pods that are not in the set
+// were created by the rollout. It's based on API server state, so clock skew between the client and the cluster
+// doesn't matter. Empty set treats all pods as new.
+type ExistingPods map[types.UID]bool
+
+// ListExistingPods returns the set of release pods that exist now
+func ListExistingPods(ctx context.Context, clientset kubernetes.Interface, namespace string, releaseName string) (ExistingPods, error) {
+	pods, err := listReleasePods(ctx, clientset, namespace, releaseName)
+	if err != nil {
+		return nil, err
+	}
+	existing := ExistingPods{}
+	for _, pod := range pods {
+		existing[pod.UID] = true
+	}
+	return existing, nil
+}
+
+// watchPodFailures returns a *PodFailureError for the first release pod that is not one of "existing" pods and gets
+// stuck. Cronjob pods are ignored.
+func watchPodFailures(ctx context.Context, clientset kubernetes.Interface, namespace string, releaseName string, existing ExistingPods) error {
+	selector := "release=" + releaseName + ",cronjob!=true"
+	return watchObjects(ctx, podWatchSource(clientset, namespace, selector), func(obj runtime.Object) (bool, error) {
+		pod, ok := obj.(*v1core.Pod)
+		if !ok || existing[pod.UID] {
+			return false, nil
+		}
+		if err := PodFailure(pod); err != nil {
+			return true, err
+		}
+		return false, nil
+	})
+}
+
+// WatchReleaseProgress reports rollout progress of release deployments and rolling update statefulsets as it
+// happens. It returns nil when context is cancelled, or a *PodFailureError as soon as a release pod that is not one
+// of "existing" pods is stuck in CrashLoopBackOff or ImagePullBackOff.
+func WatchReleaseProgress(ctx context.Context, clientset kubernetes.Interface, namespace string, releaseName string, existing ExistingPods, out io.Writer) error {
+	selector := "release=" + releaseName
+	writer := &syncWriter{out: out}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var mu sync.Mutex
+	lastMessages := map[string]string{}
+	reportRollout := func(obj runtime.Object) (bool, error) {
+		key, message, _, ok, err := rolloutStatus(obj)
+		if !ok {
+			return false, nil
+		}
+		if err != nil {
+			message = err.Error()
+		}
+		mu.Lock()
+		changed := lastMessages[key] != message
+		lastMessages[key] = message
+		mu.Unlock()
+		if changed && message != "" {
+			writer.println(message)
+		}
+		return false, nil
+	}
+
+	errs := make(chan error, 3)
+	go func() {
+		errs <- watchObjects(ctx, deploymentWatchSource(clientset, namespace, selector), reportRollout)
+	}()
+	go func() {
+		errs <- watchObjects(ctx, statefulSetWatchSource(clientset, namespace, selector), reportRollout)
+	}()
+	go func() {
+		errs <- watchPodFailures(ctx, clientset, namespace, releaseName, existing)
+	}()
+
+	for i := 0; i < 3; i++ {
+		err := <-errs
+		var podFailure *PodFailureError
+		if errors.As(err, &podFailure) {
+			return err
+		}
+	}
+	return nil
+}
+
+// WaitForReleaseRollout waits until rolling update statefulsets and deployments of a release are rolled out,
+// printing progress as it happens. Each resource is given "timeout" to complete. Waiting is stopped as soon
+// as a release pod that is not one of "existing" pods is stuck in CrashLoopBackOff or ImagePullBackOff, pods of the
+// previous rollout are left for the rollout to replace.
+func WaitForReleaseRollout(clientset kubernetes.Interface, namespace string, releaseName string, existing ExistingPods, timeout time.Duration, out io.Writer) error {
+	selector := "release=" + releaseName
+
+	resources := []runtime.Object{}
+	statefulsets, err := clientset.AppsV1().StatefulSets(namespace).List(context.Background(), v1.ListOptions{
+		LabelSelector: selector,
+	})
+	if err != nil {
+		return err
+	}
+	for i := range statefulsets.Items {
+		resources = append(resources, &statefulsets.Items[i])
+	}
+	deployments, err := clientset.AppsV1().Deployments(namespace).List(context.Background(), v1.ListOptions{
+		LabelSelector: selector,
+	})
+	if err != nil {
+		return err
+	}
+	for i := range deployments.Items {
+		resources = append(resources, &deployments.Items[i])
+	}
+
+	return WaitForWorkloadRollouts(context.Background(), clientset, namespace, releaseName, selector, resources, existing, timeout, out)
+}
+
+// WaitForWorkloadRollouts waits until release deployments and rolling update statefulsets are rolled out, one
+// after another, printing progress as it happens. Workloads are watched with a label selector ("" watches all
+// workloads of the namespace). Each resource is given "timeout" to complete. Waiting is stopped as soon as a
+// release pod that is not one of "existing" pods is stuck in CrashLoopBackOff or ImagePullBackOff.
+func WaitForWorkloadRollouts(ctx context.Context, clientset kubernetes.Interface, namespace string, releaseName string, selector string, resources []runtime.Object, existing ExistingPods, timeout time.Duration, out io.Writer) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	failure := make(chan error, 1)
+	go func() {
+		failure <- watchPodFailures(ctx, clientset, namespace, releaseName, existing)
+	}()
+
+	for _, resource := range resources {
+		key, _, _, ok, _ := rolloutStatus(resource)
+		if !ok {
+			continue
+		}
+
+		var source watchSource
+		var kind, name string
+		switch r := resource.(type) {
+		case *appsv1.Deployment:
+			source, kind, name = deploymentWatchSource(clientset, namespace, selector), "deployment", r.Name
+		case *appsv1.StatefulSet:
+			source, kind, name = statefulSetWatchSource(clientset, namespace, selector), "statefulset", r.Name
+		}
+
+		rolloutCtx, cancelRollout := context.WithTimeout(ctx, timeout)
+		rollout := make(chan error, 1)
+		go func() {
+			lastMessage := ""
+			rollout <- watchObjects(rolloutCtx, source, func(obj runtime.Object) (bool, error) {
+				objKey, message, done, ok, err := rolloutStatus(obj)
+				if !ok || objKey != key {
+					return false, nil
+				}
+				if err != nil {
+					return true, err
+				}
+				if message != lastMessage {
+					fmt.Fprintln(out, message)
+					lastMessage = message
+				}
+				return done, nil
+			})
+		}()
+
+		err := waitForRollout(rollout, &failure)
+		cancelRollout()
+		if err != nil {
+			return fmt.Errorf("%s %s: %s", kind, name, err)
+		}
+	}
+
+	return nil
+}
+
+// waitForRollout waits for rollout watch result. Pod failures stop waiting immediately, other pod watch errors
+// only disable fail-fast detection.
+func waitForRollout(rollout chan error, failure *chan error) error {
+	for {
+		select {
+		case err := <-*failure:
+			var podFailure *PodFailureError
+			if errors.As(err, &podFailure) {
+				return err
+			}
+			*failure = nil
+		case err := <-rollout:
+			if errors.Is(err, context.DeadlineExceeded) {
+				return errors.New("timed out waiting for the condition")
+			}
+			return err
+		}
+	}
+}
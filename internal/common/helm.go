@@ -0,0 +1,24 @@
+package common
+
+import (
+	"os"
+
+	helmAction "helm.sh/helm/v3/pkg/action"
+	helmCli "helm.sh/helm/v3/pkg/cli"
+)
+
+// InitHelmActionConfig initializes helm client settings and action configuration for a namespace.
+// Helm debug output is passed to debugLog, use a no-op function to keep it quiet.
+func InitHelmActionConfig(namespace string, debugLog helmAction.DebugLog) (*helmCli.EnvSettings, *helmAction.Configuration, error) {
+	settings := helmCli.New()
+	settings.SetNamespace(namespace) // Ensure Helm uses the correct namespace
+
+	actionConfig := new(helmAction.Configuration)
+	if err := actionConfig.Init(settings.RESTClientGetter(), namespace, os.Getenv("HELM_DRIVER"), debugLog); err != nil {
+		return nil, nil, err
+	}
+	return settings, actionConfig, nil
+}
+
+// HelmQuietLog discards helm debug output
+func HelmQuietLog(format string, v ...interface{}) {}
@@ -9,7 +9,8 @@ import (
 	"k8s.io/client-go/tools/clientcmd"
 )
 
-func GetKubeClient() (*kubernetes.Clientset, error) {
+// GetKubeConfig returns kubernetes client configuration from user kubeconfig or in-cluster service account
+func GetKubeConfig() (*rest.Config, error) {
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
 		return nil, errors.New("cannot read user home dir")
@@ -27,6 +28,14 @@ func GetKubeClient() (*kubernetes.Clientset, error) {
 			return nil, err
 		}
 	}
+	return config, nil
+}
+
+func GetKubeClient() (*kubernetes.Clientset, error) {
+	config, err := GetKubeConfig()
+	if err != nil {
+		return nil, err
+	}
 
 	clientset, err := kubernetes.NewForConfig(config)
 	if err != nil {
@@ -0,0 +1,38 @@
+package cmd_test
+
+import (
+	"testing"
+
+	"github.com/wunderio/silta-cli/internal/common"
+)
+
+func TestGetChartProfile(t *testing.T) {
+	common.RegisterChartProfile(&common.ChartProfileDefinition{ProfileName: "profile-test"})
+	common.RegisterChartProfile(&common.ChartProfileDefinition{ProfileName: "charts/profile-test"})
+	// Alphabetical order would pick "a-profile-test" first
+	common.RegisterChartProfile(&common.ChartProfileDefinition{ProfileName: "a-profile-test"})
+	common.RegisterChartProfile(&common.ChartProfileDefinition{ProfileName: "zz/a-profile-test"})
+
+	tests := map[string]string{
+		"profile-test":                 "profile-test",
+		"charts/profile-test":          "charts/profile-test",
+		"wunderio/profile-test":        "profile-test",
+		"extended/charts/profile-test": "charts/profile-test",
+		"wunderio/a-profile-test":      "a-profile-test",
+		"wunderio/zz/a-profile-test":   "zz/a-profile-test",
+		"drupal":                       "drupal",
+		"wunderio/drupal":              "drupal",
+	}
+	for chartName, expected := range tests {
+		// Map iteration order must not change the result
+		for i := 0; i < 20; i++ {
+			profile := common.GetChartProfile(chartName)
+			if profile == nil || profile.Name() != expected {
+				t.Fatalf("%s: expected profile %s, received %v", chartName, expected, profile)
+			}
+		}
+	}
+	if profile := common.GetChartProfile("wunderio/unknown"); profile != nil {
+		t.Errorf("Expected no profile, received %s", profile.Name())
+	}
+}
@@ -0,0 +1,150 @@
+package cmd_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/wunderio/silta-cli/internal/common"
+)
+
+func TestReadImageBuildFile(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		content string
+		err     string
+	}{
+		{"images:\n  - identifier: php\n    dockerfile: silta/php.Dockerfile\n    buildPath: .\n  - identifier: nginx\n    dockerfile: silta/nginx.Dockerfile\n    tagPrefix: v2\n", ""},
+		{"images: []\n", "has no images"},
+		{"images:\n  - identifier: php\n    dockerfile: a\n  - identifier: php\n    dockerfile: b\n", "image php is listed more than once"},
+		{"images:\n  - identifier: php\n", "image php has no dockerfile"},
+		{"images:\n  - identifier: PHP\n    dockerfile: a\n", "image 1 has an invalid identifier"},
+		{"images:\n  - identifier: php\n    dockerfile: a\n    context: .\n", "cannot parse image build file"},
+	}
+	for i, test := range tests {
+		file := filepath.Join(dir, "images.yml")
+		os.WriteFile(file, []byte(test.content), 0644)
+		specs, err := common.ReadImageBuildFile(file)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("Test %d: expected error %q, received %v", i, test.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Test %d: unexpected error: %s", i, err)
+		}
+		expected := []common.ImageBuildSpec{
+			{Identifier: "php", Dockerfile: "silta/php.Dockerfile", BuildPath: "."},
+			{Identifier: "nginx", Dockerfile: "silta/nginx.Dockerfile", TagPrefix: "v2"},
+		}
+		if len(specs) != len(expected) || specs[0] != expected[0] || specs[1] != expected[1] {
+			t.Errorf("Unexpected images: %v", specs)
+		}
+	}
+}
+
+func TestRunImageBuilds(t *testing.T) {
+	specs := []common.ImageBuildSpec{{Identifier: "php"}, {Identifier: "nginx"}, {Identifier: "shell"}}
+
+	var running, maxRunning int32
+	out := &bytes.Buffer{}
+	errs := common.RunImageBuilds(specs, 2, out, func(spec common.ImageBuildSpec, out io.Writer) error {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			max := atomic.LoadInt32(&maxRunning)
+			if n <= max || atomic.CompareAndSwapInt32(&maxRunning, max, n) {
+				break
+			}
+		}
+		time.Sleep(50 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+
+		io.WriteString(out, "building\npartial")
+		if spec.Identifier == "nginx" {
+			return errors.New("build failed")
+		}
+		return nil
+	})
+
+	if maxRunning != 2 {
+		t.Errorf("Expected 2 concurrent builds, received %d", maxRunning)
+	}
+	if errs[0] != nil || errs[1] == nil || errs[1].Error() != "build failed" || errs[2] != nil {
+		t.Errorf("Unexpected errors: %v", errs)
+	}
+	for _, line := range []string{"[php] building\n", "[php] partial\n", "[nginx] building\n", "[shell] partial\n"} {
+		if !strings.Contains(out.String(), line) {
+			t.Errorf("Output is missing %q:\n%s", line, out.String())
+		}
+	}
+}
+
+func TestImageUrls(t *testing.T) {
+	results := []common.ImageBuildResult{
+		{Identifier: "php", Image: "foo.bar/silta/baz-php:abc", Status: "reused"},
+		{Identifier: "nginx", Image: "foo.bar/silta/baz-nginx:def", Status: "built"},
+		{Identifier: "shell", Image: "foo.bar/silta/baz-shell:ghi", Status: "built", Err: errors.New("Error (Wait): exit status 1")},
+	}
+
+	summary := &bytes.Buffer{}
+	common.PrintImageBuildSummary(summary, results)
+	expected := `IMAGE  STATUS  DETAILS
+php    reused  foo.bar/silta/baz-php:abc
+nginx  built   foo.bar/silta/baz-nginx:def
+shell  failed  Error (Wait): exit status 1
+`
+	if summary.String() != expected {
+		t.Errorf("Expected:\n'%s'\nReceived:\n'%s'", expected, summary.String())
+	}
+
+	// Image urls survive a round trip
+	file := filepath.Join(t.TempDir(), "image-urls.json")
+	f, _ := os.Create(file)
+	common.WriteImageUrls(f, common.ImageUrls(results))
+	f.Close()
+	urls, err := common.ReadImageUrlsFile(file)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if len(urls) != 2 || urls["php"] != "foo.bar/silta/baz-php:abc" || urls["nginx"] != "foo.bar/silta/baz-nginx:def" {
+		t.Errorf("Unexpected image urls: %v", urls)
+	}
+
+	os.WriteFile(file, []byte("php=abc"), 0644)
+	if _, err := common.ReadImageUrlsFile(file); err == nil {
+		t.Error("Expected invalid image urls file error")
+	}
+}
+
+func TestImageContentTag(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "Dockerfile"), []byte("FROM php"), 0644)
+	dockerfile := filepath.Join(dir, "Dockerfile")
+
+	hash, _ := common.ImageContentHash(dir, dockerfile, false)
+	if tag, err := common.ImageContentTag(dir, dockerfile, "", false); err != nil || tag != hash {
+		t.Errorf("Expected tag %s, received %s (%v)", hash, tag, err)
+	}
+	if tag, _ := common.ImageContentTag(dir, dockerfile, "v2", false); tag != "v2-"+hash {
+		t.Errorf("Expected prefixed tag, received %s", tag)
+	}
+	if _, err := common.ImageContentTag(dir, filepath.Join(dir, "missing.Dockerfile"), "", false); err == nil {
+		t.Error("Expected missing dockerfile error")
+	}
+
+	if common.ImageBuildPath("web") != "web" {
+		t.Error("Build path changed")
+	}
+	if path := common.ImageBuildPath(""); path != "/tmp/empty" {
+		t.Errorf("Expected empty build path, received %s", path)
+	} else if info, err := os.Stat(path); err != nil || !info.IsDir() {
+		t.Errorf("Empty build path was not created: %v", err)
+	}
+}
@@ -0,0 +1,291 @@
+package cmd_test
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wunderio/silta-cli/internal/common"
+)
+
+func TestDockerignoreMatcher(t *testing.T) {
+	patterns, err := common.ReadDockerignore(strings.NewReader("\xEF\xBB\xBF# comment\n\nnode_modules/\n/docs\n*.log\n!keep.log\n**/cache\nweb/**/*.tmp\n! web/sites/keep.tmp\n"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	expected := []string{"node_modules", "docs", "*.log", "!keep.log", "**/cache", "web/**/*.tmp", "!web/sites/keep.tmp"}
+	if strings.Join(patterns, ",") != strings.Join(expected, ",") {
+		t.Errorf("Unexpected patterns: %v", patterns)
+	}
+	matcher, err := common.NewDockerignoreMatcher(patterns)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	tests := map[string]bool{
+		"node_modules":            true,
+		"node_modules/a/b.js":     true,
+		"web/node_modules":        false,
+		"docs/index.md":           true,
+		"a.log":                   true,
+		"logs/a.log":              false,
+		"keep.log":                false,
+		"cache":                   true,
+		"a/b/cache/c":             true,
+		"web/a.tmp":               true,
+		"web/sites/default/b.tmp": true,
+		"web/sites/keep.tmp":      false,
+		"web/index.php":           false,
+		"composer.json":           false,
+	}
+	for rel, expected := range tests {
+		if matcher.Matches(rel) != expected {
+			t.Errorf("%s: expected ignored %t", rel, expected)
+		}
+	}
+	if !matcher.HasExclusions() {
+		t.Error("Expected exclusions")
+	}
+
+	if _, err := common.NewDockerignoreMatcher([]string{"!"}); err == nil {
+		t.Error("Expected illegal exclusion pattern error")
+	}
+	if _, err := common.NewDockerignoreMatcher([]string{"[a-"}); err == nil {
+		t.Error("Expected invalid pattern error")
+	}
+}
+
+// tarImageHash is the image tag calculation native hashing replaced
+func tarImageHash(t *testing.T, buildPath string, dockerfile string) string {
+	excludeDockerignore := ""
+	if _, err := os.Stat(buildPath + "/.dockerignore"); err == nil {
+		excludeDockerignore = "--exclude-from='" + buildPath + "'/.dockerignore"
+	}
+	if _, err := os.Stat(dockerfile + ".dockerignore"); err == nil {
+		excludeDockerignore = "--exclude-from='" + dockerfile + ".dockerignore'"
+	}
+	command := `tar --sort=name ` + excludeDockerignore + ` --absolute-names --exclude='vendor/composer' --exclude='vendor/autoload.php' ` +
+		`--mtime='2000-01-01 00:00Z' --clamp-mtime -cf - '` + buildPath + `' '` + dockerfile + `' | sha1sum | cut -c 1-40 | tr -d $'\n'`
+	out, err := exec.Command("bash", "-c", command).CombinedOutput()
+	if err != nil {
+		t.Fatalf("Tar hash failed: %s: %s", err, out)
+	}
+	return string(out)
+}
+
+func TestImageContentHash(t *testing.T) {
+	version, err := exec.Command("tar", "--version").Output()
+	if err != nil || !strings.Contains(string(version), "GNU tar") {
+		t.Skip("GNU tar is not available")
+	}
+
+	wd, _ := os.Getwd()
+	dir := t.TempDir()
+	os.Chdir(dir)
+	defer os.Chdir(wd)
+
+	files := map[string]string{
+		"project/composer.json":                     "{}",
+		"project/web/index.php":                     "<?php",
+		"project/web/sites/default/settings.php":    "<?php // settings",
+		"project/vendor/autoload.php":               "<?php // generated",
+		"project/vendor/composer/installed.json":    "[]",
+		"project/vendor/drupal/core/lib.php":        "<?php // core",
+		"project/node_modules/package/index.js":     "js",
+		"project/debug.log":                         "log",
+		"project/silta/php.Dockerfile":              "FROM php",
+		"project/" + strings.Repeat("a", 98):        "name fits the header",
+		"project/" + strings.Repeat("b", 120):       "long name",
+		"project/" + strings.Repeat("c", 92) + "/x": "long name in a directory",
+		"nginx.Dockerfile":                          "FROM nginx",
+		"nginx.Dockerfile.dockerignore":             "web\n",
+	}
+	for name, content := range files {
+		os.MkdirAll(filepath.Dir(name), 0755)
+		os.WriteFile(name, []byte(content), 0644)
+	}
+	os.WriteFile("project/.dockerignore", []byte("node_modules\n*.log\n"), 0644)
+	os.MkdirAll("project/empty", 0700)
+	os.Chmod("project/web/index.php", 0755)
+	os.Symlink("web/index.php", "project/index.php")
+	os.Symlink(strings.Repeat("../", 40)+"target", "project/long-link")
+	// Modification times before 2000 are kept
+	old := time.Date(1995, 1, 1, 0, 0, 0, 0, time.UTC)
+	os.Chtimes("project/composer.json", old, old)
+
+	tests := []struct {
+		buildPath  string
+		dockerfile string
+	}{
+		{"project", "project/silta/php.Dockerfile"},
+		{"project/", "nginx.Dockerfile"},
+		{"./project", "./nginx.Dockerfile"},
+		{dir + "/project", dir + "/project/silta/php.Dockerfile"},
+		{"project/web", "project/silta/php.Dockerfile"},
+	}
+	for _, test := range tests {
+		expected := tarImageHash(t, test.buildPath, test.dockerfile)
+		received, err := common.ImageContentHash(test.buildPath, test.dockerfile, false)
+		if err != nil {
+			t.Fatalf("%s %s: unexpected error: %s", test.buildPath, test.dockerfile, err)
+		}
+		if received != expected {
+			t.Errorf("%s %s: expected %s, received %s", test.buildPath, test.dockerfile, expected, received)
+		}
+	}
+
+	// Unanchored patterns match nested paths like in tar
+	os.MkdirAll("nested/web/themes/x/node_modules", 0755)
+	os.MkdirAll("nested/logs", 0755)
+	os.WriteFile("nested/Dockerfile", []byte("FROM php"), 0644)
+	os.WriteFile("nested/.dockerignore", []byte("node_modules\n*.log\n"), 0644)
+	os.WriteFile("nested/web/themes/x/node_modules/a.js", []byte("js"), 0644)
+	os.WriteFile("nested/web/themes/x/style.css", []byte("css"), 0644)
+	os.WriteFile("nested/logs/a.log", []byte("log"), 0644)
+	os.WriteFile("nested/root.log", []byte("log"), 0644)
+	manifestNames := func(dockerignore bool) string {
+		_, manifest, err := common.ImageContentManifest("nested", "nested/Dockerfile", dockerignore)
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		names := []string{}
+		for _, entry := range manifest {
+			names = append(names, entry.Name)
+		}
+		return strings.Join(names, ",")
+	}
+	expectedNames := "nested/,nested/.dockerignore,nested/Dockerfile,nested/logs/,nested/web/,nested/web/themes/," +
+		"nested/web/themes/x/,nested/web/themes/x/style.css,nested/Dockerfile"
+	if names := manifestNames(false); names != expectedNames {
+		t.Errorf("Unexpected nested manifest entries: %s", names)
+	}
+	if nested, _ := common.ImageContentHash("nested", "nested/Dockerfile", false); nested != tarImageHash(t, "nested", "nested/Dockerfile") {
+		t.Error("Expected nested matches to be left out like in tar")
+	}
+
+	// Wildcards match "/", comments and exclusions are literal, dockerfile and build path can be excluded
+	ignores := []string{
+		"web/th*x\n",
+		"themes/*.css  \n\n# comment\n!root.log\n",
+		"w?b/[s-u]hemes\n",
+		"Dockerfile\n",
+		"nested\n",
+	}
+	for _, ignore := range ignores {
+		os.WriteFile("nested/.dockerignore", []byte(ignore), 0644)
+		expected := tarImageHash(t, "nested", "nested/Dockerfile")
+		if received, _ := common.ImageContentHash("nested", "nested/Dockerfile", false); received != expected {
+			t.Errorf("%q: expected %s, received %s", ignore, expected, received)
+		}
+	}
+
+	// With docker semantics unanchored patterns only match at build path root
+	os.WriteFile("nested/.dockerignore", []byte("node_modules\n*.log\n"), 0644)
+	expectedNames = "nested/,nested/.dockerignore,nested/Dockerfile,nested/logs/,nested/logs/a.log,nested/web/,nested/web/themes/," +
+		"nested/web/themes/x/,nested/web/themes/x/node_modules/,nested/web/themes/x/node_modules/a.js,nested/web/themes/x/style.css,nested/Dockerfile"
+	if names := manifestNames(true); names != expectedNames {
+		t.Errorf("Unexpected nested manifest entries with docker semantics: %s", names)
+	}
+
+	// Hash follows content
+	before, _ := common.ImageContentHash("project", "project/silta/php.Dockerfile", false)
+	os.WriteFile("project/node_modules/package/index.js", []byte("changed"), 0644)
+	if after, _ := common.ImageContentHash("project", "project/silta/php.Dockerfile", false); after != before {
+		t.Error("Ignored file changed the hash")
+	}
+	os.WriteFile("project/composer.json", []byte(`{"name": "changed"}`), 0644)
+	if after, _ := common.ImageContentHash("project", "project/silta/php.Dockerfile", false); after == before {
+		t.Error("Changed file did not change the hash")
+	}
+
+	// Re-included paths are hashed with docker semantics
+	os.WriteFile("project/.dockerignore", []byte("node_modules\n!node_modules/package\n"), 0644)
+	reincluded, _ := common.ImageContentHash("project", "project/silta/php.Dockerfile", true)
+	os.WriteFile("project/.dockerignore", []byte("node_modules\n"), 0644)
+	excluded, _ := common.ImageContentHash("project", "project/silta/php.Dockerfile", true)
+	if reincluded == excluded {
+		t.Error("Re-included directory did not change the hash")
+	}
+}
+
+func TestImageManifest(t *testing.T) {
+	wd, _ := os.Getwd()
+	dir := t.TempDir()
+	os.Chdir(dir)
+	defer os.Chdir(wd)
+
+	os.MkdirAll("project/web", 0755)
+	os.WriteFile("project/Dockerfile", []byte("FROM php"), 0644)
+	os.WriteFile("project/web/index.php", []byte("<?php"), 0644)
+	os.WriteFile("project/web/generated.css", []byte("body {}"), 0644)
+
+	hash, previous, err := common.ImageContentManifest("project", "project/Dockerfile", false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if contentHash, _ := common.ImageContentHash("project", "project/Dockerfile", false); contentHash != hash {
+		t.Errorf("Manifest hash %s differs from content hash %s", hash, contentHash)
+	}
+	names := []string{}
+	for _, entry := range previous {
+		names = append(names, entry.Name)
+	}
+	expected := "project/,project/Dockerfile,project/web/,project/web/generated.css,project/web/index.php,project/Dockerfile"
+	if strings.Join(names, ",") != expected {
+		t.Errorf("Unexpected manifest entries: %v", names)
+	}
+
+	// Manifest survives a round trip
+	out := &strings.Builder{}
+	common.WriteImageManifest(out, "foo.bar/silta/baz-php:"+hash, previous)
+	if !strings.HasPrefix(out.String(), "# foo.bar/silta/baz-php:"+hash+"\n"+previous[0].Digest+"  "+previous[0].Metadata+"  project/\n") {
+		t.Errorf("Unexpected manifest:\n%s", out.String())
+	}
+	read, err := common.ReadImageManifest(strings.NewReader(out.String()))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if len(common.CompareImageManifests(previous, read)) > 0 || len(read) != len(previous) {
+		t.Errorf("Manifest changed in a round trip: %v", read)
+	}
+	if _, err := common.ReadImageManifest(strings.NewReader("foo bar\n")); err == nil {
+		t.Error("Expected invalid manifest error")
+	}
+	if !strings.HasPrefix(previous[3].Metadata, "0644 ") {
+		t.Errorf("Unexpected metadata: %s", previous[3].Metadata)
+	}
+
+	// Same content with a different mode or owner has the same digest
+	modeChanged := append([]common.ImageManifestEntry{}, previous...)
+	modeChanged[3].Metadata = "0600 0:0 root:root"
+	changes := []string{}
+	for _, change := range common.CompareImageManifests(previous, modeChanged) {
+		changes = append(changes, change.Change+" "+change.Name)
+	}
+	if strings.Join(changes, ",") != "mode/owner changed project/web/generated.css" {
+		t.Errorf("Unexpected changes: %v", changes)
+	}
+
+	// Content, mode and file list changes
+	os.WriteFile("project/web/generated.css", []byte("body { color: red }"), 0644)
+	os.Chmod("project/web/index.php", 0755)
+	os.WriteFile("project/web/new.php", []byte("<?php"), 0644)
+	os.Remove("project/Dockerfile")
+	os.WriteFile("Dockerfile", []byte("FROM php"), 0644)
+	_, current, err := common.ImageContentManifest("project", "Dockerfile", false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	changes = []string{}
+	for _, change := range common.CompareImageManifests(previous, current) {
+		changes = append(changes, change.Change+" "+change.Name)
+	}
+	expected = "added Dockerfile,removed project/Dockerfile,removed project/Dockerfile (dockerfile),content changed project/web/generated.css," +
+		"mode/owner changed project/web/index.php,added project/web/new.php"
+	if strings.Join(changes, ",") != expected {
+		t.Errorf("Unexpected changes: %v", changes)
+	}
+}
@@ -117,6 +117,18 @@ func TestImageUrlCmd(t *testing.T) {
 	testString = `foo.bar/silta/baz-nginx:qux`
 	CliExecTest(t, command, environment, testString, true)
 
+	// Content manifest test
+	command = "ci image url --image-repo-host 'foo.bar' --image-repo-project 'silta' --namespace 'baz' --image-identifier 'nginx' --dockerfile 'tests/nginx.Dockerfile' --build-path 'docs' --explain"
+	environment = []string{}
+	testString = `  tests/nginx.Dockerfile`
+	CliExecTest(t, command, environment, testString, false)
+
+	// Manifest compare test
+	command = "ci image url --image-repo-host 'foo.bar' --image-repo-project 'silta' --namespace 'baz' --image-identifier 'nginx' --dockerfile 'tests/nginx.Dockerfile' --build-path 'docs' --compare 'tests/nonexistent.manifest'"
+	environment = []string{}
+	testString = `Error: open tests/nonexistent.manifest: no such file or directory`
+	CliExecTest(t, command, environment, testString, false)
+
 	// Change dir back to previous
 	os.Chdir(wd)
 }
@@ -138,6 +150,20 @@ func TestImageBuildCmd(t *testing.T) {
 	testString = `docker push 'foo.bar/silta/baz-nginx:qux'`
 	CliExecTest(t, command, environment, testString, false)
 
+	// Image build file test
+	command = "ci image build --image-repo-host 'foo.bar' --image-repo-project 'silta' --namespace 'baz' --branchname 'feature/test' --all --images-file 'tests/assets/image_build_test/images.yml' --debug"
+	environment = []string{}
+	testString = `[nginx] Command (not executed): docker push 'foo.bar/silta/baz-nginx:branch--feature-test'`
+	CliExecTest(t, command, environment, testString, false)
+	testString = `"nginx": "foo.bar/silta/baz-nginx:v2-`
+	CliExecTest(t, command, environment, testString, false)
+
+	// Image build file is exclusive with single image flags
+	command = "ci image build --image-repo-host 'foo.bar' --image-repo-project 'silta' --namespace 'baz' --all --image-identifier 'nginx'"
+	environment = []string{}
+	testString = `[all image-identifier] were all set`
+	CliExecTest(t, command, environment, testString, false)
+
 	// Change dir back to previous
 	os.Chdir(wd)
 }
@@ -0,0 +1,150 @@
+package cmd_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/wunderio/silta-cli/internal/common"
+	helmRelease "helm.sh/helm/v3/pkg/release"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestFindReleases(t *testing.T) {
+	clientset := fake.NewClientset(
+		testDeployment("main-drupal", map[string]string{"release": "main", "app": "drupal"}).namespace("project-a").build(),
+		testDeployment("main-varnish", map[string]string{"release": "main", "app": "varnish"}).namespace("project-a").build(),
+		testDeployment("feature-drupal", map[string]string{"release": "feature", "app": "drupal"}).namespace("project-a").build(),
+		testDeployment("main-frontend", map[string]string{"release": "main", "app": "frontend"}).namespace("project-b").build(),
+		testDeployment("unmanaged", map[string]string{"app": "drupal"}).namespace("project-b").build(),
+		&appsv1.StatefulSet{ObjectMeta: v1.ObjectMeta{Name: "db-mariadb", Namespace: "project-b", Labels: map[string]string{"release": "db"}}},
+		// Releases of charts that use the standard instance label
+		testDeployment("storybook", map[string]string{"app.kubernetes.io/instance": "storybook"}).namespace("project-b").build(),
+		&appsv1.StatefulSet{ObjectMeta: v1.ObjectMeta{Name: "cache-redis", Namespace: "project-b", Labels: map[string]string{"release": "cache", "app.kubernetes.io/instance": "cache"}}},
+		// Release label without a helm release
+		testDeployment("tooling", map[string]string{"release": "tooling", "app": "drupal"}).namespace("project-a").build(),
+		// Cluster infrastructure
+		testDeployment("ingress-nginx-controller", map[string]string{"release": "ingress-nginx"}).namespace("kube-system").build(),
+		testDeployment("silta-cluster-downscaler", map[string]string{"release": "silta-cluster"}).namespace("silta-cluster").build(),
+	)
+	helmReleases := []*helmRelease.Release{
+		{Name: "main", Namespace: "project-a"},
+		{Name: "feature", Namespace: "project-a"},
+		{Name: "main", Namespace: "project-b"},
+		{Name: "db", Namespace: "project-b"},
+		{Name: "storybook", Namespace: "project-b"},
+		{Name: "cache", Namespace: "project-b"},
+		{Name: "ingress-nginx", Namespace: "kube-system"},
+		{Name: "silta-cluster", Namespace: "silta-cluster"},
+	}
+	ctx := context.Background()
+
+	releases, err := common.FindReleases(ctx, clientset, helmReleases[:2], "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []common.ReleaseRef{{Namespace: "project-a", Name: "feature"}, {Namespace: "project-a", Name: "main"}}
+	if !reflect.DeepEqual(releases, expected) {
+		t.Errorf("Expected %v, got %v", expected, releases)
+	}
+
+	allNamespaces := common.WithoutSystemNamespaces(helmReleases)
+	releases, err = common.FindReleases(ctx, clientset, allNamespaces, "app=drupal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(releases, expected) {
+		t.Errorf("Expected %v, got %v", expected, releases)
+	}
+
+	releases, err = common.FindReleases(ctx, clientset, allNamespaces, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = []common.ReleaseRef{
+		{Namespace: "project-a", Name: "feature"},
+		{Namespace: "project-a", Name: "main"},
+		{Namespace: "project-b", Name: "cache"},
+		{Namespace: "project-b", Name: "db"},
+		{Namespace: "project-b", Name: "main"},
+		{Namespace: "project-b", Name: "storybook"},
+	}
+	if !reflect.DeepEqual(releases, expected) {
+		t.Errorf("Expected %v, got %v", expected, releases)
+	}
+
+	// System namespaces are searched when named explicitly
+	releases, err = common.FindReleases(ctx, clientset, helmReleases[6:7], "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = []common.ReleaseRef{{Namespace: "kube-system", Name: "ingress-nginx"}}
+	if !reflect.DeepEqual(releases, expected) {
+		t.Errorf("Expected %v, got %v", expected, releases)
+	}
+}
+
+func TestRunReleaseBatch(t *testing.T) {
+	releases := []common.ReleaseRef{}
+	for _, name := range []string{"a", "b", "c", "d", "e", "f"} {
+		releases = append(releases, common.ReleaseRef{Namespace: "project", Name: name})
+	}
+
+	var running, maxRunning int32
+	out := &bytes.Buffer{}
+	results := common.RunReleaseBatch(context.Background(), fake.NewClientset(), releases, 2, out,
+		func(ctx context.Context, clientset kubernetes.Interface, release common.ReleaseRef, out io.Writer) (string, error) {
+			current := atomic.AddInt32(&running, 1)
+			defer atomic.AddInt32(&running, -1)
+			for {
+				previous := atomic.LoadInt32(&maxRunning)
+				if current <= previous || atomic.CompareAndSwapInt32(&maxRunning, previous, current) {
+					break
+				}
+			}
+			out.Write([]byte("working\ndone"))
+			time.Sleep(20 * time.Millisecond)
+			if release.Name == "c" {
+				return "", errors.New("boom")
+			}
+			return release.Name + ".example.com", nil
+		})
+
+	if maxRunning != 2 {
+		t.Errorf("Expected 2 releases processed at the same time, got %d", maxRunning)
+	}
+	for i, r := range results {
+		if r.Release != releases[i] {
+			t.Errorf("Results are not in release order: %v", results)
+		}
+	}
+	if results[2].Err == nil || results[0].Details != "a.example.com" {
+		t.Errorf("Unexpected results: %v", results)
+	}
+	for _, line := range []string{"[project/a] working", "[project/a] done", "[project/f] done"} {
+		if !strings.Contains(out.String(), line+"\n") {
+			t.Errorf("Output does not contain %q:\n%s", line, out.String())
+		}
+	}
+
+	summary := &bytes.Buffer{}
+	results[0].Duration, results[1].Duration, results[2].Duration = 0, 0, 0
+	common.PrintReleaseBatchSummary(summary, results[:3])
+	expected := `NAMESPACE  RELEASE  STATUS  DURATION  DETAILS
+project    a        ok      0s        a.example.com
+project    b        ok      0s        b.example.com
+project    c        failed  0s        boom
+`
+	if summary.String() != expected {
+		t.Errorf("Expected:\n%s\nReceived:\n%s", expected, summary.String())
+	}
+}
@@ -0,0 +1,143 @@
+package cmd_test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wunderio/silta-cli/internal/common"
+	batchv1 "k8s.io/api/batch/v1"
+	v1core "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestReleaseCronJob(t *testing.T) {
+	labels := map[string]string{"release": "test"}
+	ctx := context.Background()
+	clientset := fake.NewClientset(
+		testCronJob("test-cron-drupal", labels),
+		testCronJob("test-cron-backup", labels),
+		testCronJob("test-2-cron-drupal", map[string]string{"release": "test-2"}),
+	)
+
+	for _, name := range []string{"test-cron-drupal", "cron-drupal", "drupal"} {
+		cronjob, err := common.ReleaseCronJob(ctx, clientset, "default", "test", name)
+		if err != nil || cronjob.Name != "test-cron-drupal" {
+			t.Errorf("Name %s: unexpected result %v, %v", name, cronjob, err)
+		}
+	}
+
+	_, err := common.ReleaseCronJob(ctx, clientset, "default", "test", "")
+	if err == nil || err.Error() != "release test has multiple cronjobs, select one with --cronjob: test-cron-backup, test-cron-drupal" {
+		t.Errorf("Expected multiple cronjobs error, received: %v", err)
+	}
+	_, err = common.ReleaseCronJob(ctx, clientset, "default", "test", "mail")
+	if err == nil || err.Error() != "cronjob mail not found in release test (cronjobs: test-cron-backup, test-cron-drupal)" {
+		t.Errorf("Expected missing cronjob error, received: %v", err)
+	}
+
+	cronjob, err := common.ReleaseCronJob(ctx, clientset, "default", "test-2", "")
+	if err != nil || cronjob.Name != "test-2-cron-drupal" {
+		t.Errorf("Single cronjob should be selected: %v, %v", cronjob, err)
+	}
+}
+
+func TestJobFromCronJob(t *testing.T) {
+	now := time.Unix(1714564800, 0)
+	job := common.JobFromCronJob(testCronJob("test-cron-drupal", nil), now)
+	if job.Name != "test-cron-drupal-manual-1714564800" {
+		t.Errorf("Unexpected job name: %s", job.Name)
+	}
+	if job.Labels["cronjob"] != "true" || job.Annotations["cronjob.kubernetes.io/instantiate"] != "manual" {
+		t.Errorf("Unexpected job metadata: %v, %v", job.Labels, job.Annotations)
+	}
+	if len(job.OwnerReferences) != 1 || job.OwnerReferences[0].Kind != "CronJob" || job.OwnerReferences[0].UID != "cron-uid" {
+		t.Errorf("Unexpected owner references: %v", job.OwnerReferences)
+	}
+	if job.Spec.Template.Spec.Containers[0].Command[1] != "cron" {
+		t.Errorf("Job template not copied: %v", job.Spec.Template.Spec)
+	}
+
+	// Job name is limited to 63 characters
+	job = common.JobFromCronJob(testCronJob("feature-very-long-branch-name-for-testing-cron-drupal", nil), now)
+	if len(job.Name) > 63 || !strings.HasPrefix(job.Name, "feature-very-long-branch-name") || !strings.HasSuffix(job.Name, "-manual-1714564800") {
+		t.Errorf("Job name too long: %s", job.Name)
+	}
+}
+
+func TestRunJob(t *testing.T) {
+	for _, failed := range []bool{false, true} {
+		clientset := fake.NewClientset()
+		job := common.JobFromCronJob(testCronJob("test-cron-drupal", nil), time.Unix(1714564800, 0))
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+
+		out := &bytes.Buffer{}
+		result := make(chan error, 1)
+		go func() {
+			result <- common.RunJob(ctx, clientset, job, out)
+		}()
+		time.Sleep(100 * time.Millisecond)
+
+		pod := testPod(job.Name+"-abc", map[string]string{"job-name": job.Name}).
+			container("main", v1core.ContainerState{Terminated: &v1core.ContainerStateTerminated{ExitCode: 0}}).build()
+		clientset.CoreV1().Pods("default").Create(ctx, pod, v1.CreateOptions{})
+		time.Sleep(100 * time.Millisecond)
+
+		condition := batchv1.JobCondition{Type: batchv1.JobComplete, Status: v1core.ConditionTrue}
+		if failed {
+			condition = batchv1.JobCondition{Type: batchv1.JobFailed, Status: v1core.ConditionTrue, Reason: "BackoffLimitExceeded", Message: "Job has reached the specified backoff limit"}
+		}
+		created, _ := clientset.BatchV1().Jobs("default").Get(ctx, job.Name, v1.GetOptions{})
+		created.Status.Conditions = []batchv1.JobCondition{condition}
+		clientset.BatchV1().Jobs("default").UpdateStatus(ctx, created, v1.UpdateOptions{})
+
+		err := <-result
+		cancel()
+		if failed {
+			if err == nil || err.Error() != "job test-cron-drupal-manual-1714564800 failed: BackoffLimitExceeded (Job has reached the specified backoff limit)" {
+				t.Errorf("Expected job failure, received: %v", err)
+			}
+		} else if err != nil {
+			t.Errorf("Unexpected error: %s", err)
+		}
+		expected := "Job test-cron-drupal-manual-1714564800 created\n[test-cron-drupal-manual-1714564800-abc/main] fake logs\n"
+		if out.String() != expected {
+			t.Errorf("Expected:\n'%s'\nReceived:\n'%s'", expected, out.String())
+		}
+
+		// Only the created job is watched
+		watched := false
+		for _, action := range clientset.Actions() {
+			if watch, ok := action.(k8stesting.WatchAction); ok && action.GetResource().Resource == "jobs" {
+				watched = true
+				if selector := watch.GetWatchRestrictions().Fields.String(); selector != "metadata.name="+job.Name {
+					t.Errorf("Expected job watch by name, received field selector %q", selector)
+				}
+			}
+		}
+		if !watched {
+			t.Errorf("Job was not watched")
+		}
+	}
+
+	// Stuck job pod fails fast
+	clientset := fake.NewClientset()
+	job := common.JobFromCronJob(testCronJob("test-cron-drupal", nil), time.Unix(1714564800, 0))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	result := make(chan error, 1)
+	go func() {
+		result <- common.RunJob(ctx, clientset, job, &bytes.Buffer{})
+	}()
+	time.Sleep(100 * time.Millisecond)
+	clientset.CoreV1().Pods("default").Create(ctx, testPod(job.Name+"-def", map[string]string{"job-name": job.Name}).
+		container("main", v1core.ContainerState{Waiting: &v1core.ContainerStateWaiting{Reason: "ImagePullBackOff"}}).build(), v1.CreateOptions{})
+	err := <-result
+	if err == nil || !strings.Contains(err.Error(), "ImagePullBackOff") {
+		t.Errorf("Expected pod failure, received: %v", err)
+	}
+}
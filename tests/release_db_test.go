@@ -0,0 +1,120 @@
+package cmd_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/wunderio/silta-cli/internal/common"
+)
+
+func TestFormatBytes(t *testing.T) {
+	tests := map[int64]string{
+		0:                      "0 B",
+		1023:                   "1023 B",
+		1024:                   "1.0 KiB",
+		1536:                   "1.5 KiB",
+		5 * 1024 * 1024:        "5.0 MiB",
+		3 * 1024 * 1024 * 1024: "3.0 GiB",
+	}
+	for n, expected := range tests {
+		if received := common.FormatBytes(n); received != expected {
+			t.Errorf("FormatBytes(%d): expected %s, received %s", n, expected, received)
+		}
+	}
+}
+
+func TestTransferProgress(t *testing.T) {
+	progress := &common.TransferProgress{Label: "Importing database", Total: 4096}
+	io.Copy(progress, strings.NewReader(strings.Repeat("x", 1024)))
+	if progress.String() != "Importing database: 1.0 KiB / 4.0 KiB (25%)" {
+		t.Errorf("Unexpected progress: %s", progress.String())
+	}
+
+	progress = &common.TransferProgress{Label: "Dumping database"}
+	io.Copy(progress, strings.NewReader("dump"))
+	if progress.String() != "Dumping database: 4 B" {
+		t.Errorf("Unexpected progress: %s", progress.String())
+	}
+}
+
+func TestGzipStream(t *testing.T) {
+	dump := "CREATE TABLE test (id int);\n"
+
+	// Plain input is compressed
+	compressed, err := io.ReadAll(common.GzipStream(strings.NewReader(dump)))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	reader, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		t.Fatalf("Output is not gzip compressed: %s", err)
+	}
+	plain, _ := io.ReadAll(reader)
+	if string(plain) != dump {
+		t.Errorf("Unexpected content: %s", plain)
+	}
+
+	// Compressed input is passed as is
+	passed, _ := io.ReadAll(common.GzipStream(bytes.NewReader(compressed)))
+	if !bytes.Equal(passed, compressed) {
+		t.Error("Compressed input was modified")
+	}
+
+	// Empty input
+	compressed, _ = io.ReadAll(common.GzipStream(strings.NewReader("")))
+	reader, err = gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		t.Fatalf("Output is not gzip compressed: %s", err)
+	}
+	plain, _ = io.ReadAll(reader)
+	if len(plain) != 0 {
+		t.Errorf("Unexpected content: %s", plain)
+	}
+}
+
+func TestDbImportCommand(t *testing.T) {
+	// mysql is replaced with a stub that stores the imported dump
+	bin := t.TempDir()
+	imported := filepath.Join(bin, "imported.sql")
+	stub := "#!/bin/sh\ncat > " + imported + "\nexit ${MYSQL_STUB_STATUS:-0}\n"
+	if err := os.WriteFile(filepath.Join(bin, "mysql"), []byte(stub), 0755); err != nil {
+		t.Fatal(err)
+	}
+	env := append(os.Environ(), "PATH="+bin+":"+os.Getenv("PATH"), "DB_HOST=db", "DB_USER=user", "DB_PASS=pass", "DB_NAME=drupal")
+
+	dump := strings.Repeat("INSERT INTO test VALUES (1);\n", 1000)
+	compressed, _ := io.ReadAll(common.GzipStream(strings.NewReader(dump)))
+
+	run := func(input []byte, extraEnv ...string) error {
+		cmd := exec.Command(common.DbImportCommand[0], common.DbImportCommand[1:]...)
+		cmd.Env = append(env, extraEnv...)
+		cmd.Stdin = bytes.NewReader(input)
+		cmd.Stderr = io.Discard
+		return cmd.Run()
+	}
+
+	if err := run(compressed); err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+	if content, _ := os.ReadFile(imported); string(content) != dump {
+		t.Errorf("Dump was not imported")
+	}
+
+	// Truncated dump fails the import even though mysql succeeds
+	if err := run(compressed[:len(compressed)/2]); err == nil {
+		t.Errorf("Expected truncated dump to fail the import")
+	}
+
+	// mysql errors fail the import
+	if err := run(compressed, "MYSQL_STUB_STATUS=3"); err == nil {
+		t.Errorf("Expected mysql error to fail the import")
+	} else if exitErr, ok := err.(*exec.ExitError); !ok || exitErr.ExitCode() != 3 {
+		t.Errorf("Expected mysql exit code 3, received %s", err)
+	}
+}
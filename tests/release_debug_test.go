@@ -0,0 +1,321 @@
+package cmd_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/wunderio/silta-cli/internal/common"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	v1core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestDebugFailedRelease(t *testing.T) {
+	ctx := context.Background()
+	labels := map[string]string{"release": "test"}
+	replicas := int32(2)
+
+	clientset := fake.NewClientset(
+		&v1core.Pod{
+			ObjectMeta: v1.ObjectMeta{Name: "test-php", Namespace: "default", Labels: labels},
+			Status: v1core.PodStatus{ContainerStatuses: []v1core.ContainerStatus{
+				{Name: "php", Ready: false, State: v1core.ContainerState{Waiting: &v1core.ContainerStateWaiting{Reason: "CrashLoopBackOff"}},
+					LastTerminationState: v1core.ContainerState{Terminated: &v1core.ContainerStateTerminated{Reason: "OOMKilled"}}},
+				{Name: "nginx", Ready: true},
+			}},
+		},
+		&v1core.Pod{
+			ObjectMeta: v1.ObjectMeta{Name: "test-nginx", Namespace: "default", Labels: labels},
+			Status:     v1core.PodStatus{ContainerStatuses: []v1core.ContainerStatus{{Name: "nginx", Ready: true}}},
+		},
+		&v1core.Pod{
+			ObjectMeta: v1.ObjectMeta{Name: "test-cron", Namespace: "default", Labels: map[string]string{"release": "test", "cronjob": "true"}},
+		},
+		&appsv1.Deployment{
+			ObjectMeta: v1.ObjectMeta{Name: "test-php", Namespace: "default", Labels: labels},
+			Spec:       appsv1.DeploymentSpec{Replicas: &replicas},
+			Status:     appsv1.DeploymentStatus{ReadyReplicas: 1},
+		},
+		&appsv1.StatefulSet{
+			ObjectMeta: v1.ObjectMeta{Name: "test-mariadb", Namespace: "default", Labels: labels},
+			Spec:       appsv1.StatefulSetSpec{Replicas: &replicas},
+			Status:     appsv1.StatefulSetStatus{ReadyReplicas: 2},
+		},
+		&v1core.Event{
+			ObjectMeta:     v1.ObjectMeta{Name: "test-php.1", Namespace: "default"},
+			InvolvedObject: v1core.ObjectReference{Kind: "Pod", Name: "test-php"},
+			Type:           "Warning", Reason: "BackOff", Message: "Back-off restarting failed container",
+		},
+		&v1core.Event{
+			ObjectMeta:     v1.ObjectMeta{Name: "test-php.2", Namespace: "default"},
+			InvolvedObject: v1core.ObjectReference{Kind: "Pod", Name: "test-php"},
+			Type:           "Normal", Reason: "Pulled", Message: "Container image already present",
+		},
+	)
+
+	report := common.DebugFailedRelease(ctx, clientset, "default", "test")
+	if !report.HasErrors() {
+		t.Fatalf("Expected errors in report")
+	}
+
+	summary := []string{}
+	for _, f := range report.Findings {
+		summary = append(summary, f.Check+" "+f.Kind+"/"+f.Name+" "+f.Container+": "+f.Reason)
+	}
+	expected := []string{
+		"oom-killed Pod/test-php php: container ran out of memory (OOMKilled)",
+		"failed-pod Pod/test-php : container php CrashLoopBackOff",
+		"not-ready-deployment Deployment/test-php : 1 of 2 replicas ready",
+	}
+	if strings.Join(summary, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Unexpected findings:\n%s", strings.Join(summary, "\n"))
+	}
+
+	failedPod := report.Findings[1]
+	if len(failedPod.Events) != 1 || failedPod.Events[0].Reason != "BackOff" {
+		t.Errorf("Unexpected events: %+v", failedPod.Events)
+	}
+	if failedPod.Logs != "[php] fake logs\n" {
+		t.Errorf("Unexpected logs: %q", failedPod.Logs)
+	}
+
+	// Text
+	out := &bytes.Buffer{}
+	common.PrintDebugReport(out, report, "text")
+	expectedText := `Error: pod failures:
+  * default / test-php: container php CrashLoopBackOff
+    ---- Events ----
+    Warning Pod/test-php: Back-off restarting failed container
+    ---- Logs ----
+    [php] fake logs
+    ----
+`
+	if !strings.Contains(out.String(), expectedText) {
+		t.Errorf("Unexpected text report:\n%s", out.String())
+	}
+
+	// JSON
+	out = &bytes.Buffer{}
+	common.PrintDebugReport(out, report, "json")
+	decoded := common.DebugReport{}
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil {
+		t.Fatalf("Invalid json report: %s", err)
+	}
+	if decoded.Release != "test" || len(decoded.Findings) != 3 || decoded.Findings[0].Severity != "error" {
+		t.Errorf("Unexpected json report: %s", out.String())
+	}
+
+	// Markdown
+	out = &bytes.Buffer{}
+	common.PrintDebugReport(out, report, "markdown")
+	if !strings.Contains(out.String(), "| error | `Pod/test-php (php)` | container ran out of memory (OOMKilled) | raise container memory limit and request in silta configuration |") ||
+		!strings.Contains(out.String(), "<details><summary>Pod/test-php</summary>") {
+		t.Errorf("Unexpected markdown report:\n%s", out.String())
+	}
+
+	if err := common.PrintDebugReport(out, report, "yaml"); err == nil {
+		t.Errorf("Expected error for unknown format")
+	}
+
+	// Healthy release
+	report = common.DebugFailedRelease(ctx, fake.NewClientset(), "default", "test")
+	out = &bytes.Buffer{}
+	common.PrintDebugReport(out, report, "text")
+	if report.HasErrors() || out.String() != "No deployment failures found\n" {
+		t.Errorf("Unexpected report for healthy release: %s", out.String())
+	}
+}
+
+func TestDebugFailedReleaseDetectors(t *testing.T) {
+	ctx := context.Background()
+	labels := map[string]string{"release": "test"}
+	storageClass := "fast"
+	running := v1core.ContainerState{Running: &v1core.ContainerStateRunning{}}
+
+	clientset := fake.NewClientset(
+		// Pull failures, missing tag and registry authentication
+		&v1core.Pod{
+			ObjectMeta: v1.ObjectMeta{Name: "test-php", Namespace: "default", Labels: labels},
+			Status: v1core.PodStatus{Phase: v1core.PodPending, ContainerStatuses: []v1core.ContainerStatus{
+				{Name: "php", Image: "eu.gcr.io/project/php:abc123", State: v1core.ContainerState{Waiting: &v1core.ContainerStateWaiting{Reason: "ImagePullBackOff"}}},
+				{Name: "nginx", Image: "eu.gcr.io/private/nginx:abc123", State: v1core.ContainerState{Waiting: &v1core.ContainerStateWaiting{Reason: "ErrImagePull"}}},
+			}},
+		},
+		&v1core.Event{
+			ObjectMeta:     v1.ObjectMeta{Name: "test-php.1", Namespace: "default"},
+			InvolvedObject: v1core.ObjectReference{Kind: "Pod", Name: "test-php"},
+			Type:           "Warning", Reason: "Failed",
+			Message: `Failed to pull image "eu.gcr.io/project/php:abc123": rpc error: code = NotFound desc = eu.gcr.io/project/php:abc123: not found`,
+		},
+		&v1core.Event{
+			ObjectMeta:     v1.ObjectMeta{Name: "test-php.2", Namespace: "default"},
+			InvolvedObject: v1core.ObjectReference{Kind: "Pod", Name: "test-php"},
+			Type:           "Warning", Reason: "Failed",
+			Message: `Failed to pull image "eu.gcr.io/private/nginx:abc123": failed to authorize: 403 Forbidden`,
+		},
+		// Scheduling failure
+		&v1core.Pod{
+			ObjectMeta: v1.ObjectMeta{Name: "test-mariadb-0", Namespace: "default", Labels: labels},
+			Status: v1core.PodStatus{Phase: v1core.PodPending, Conditions: []v1core.PodCondition{{
+				Type: v1core.PodScheduled, Status: v1core.ConditionFalse, Reason: v1core.PodReasonUnschedulable,
+				Message: "0/3 nodes are available: 1 node(s) had untolerated taint {dedicated: db}, 2 Insufficient memory.",
+			}}},
+		},
+		// Unbound volume claim
+		&v1core.PersistentVolumeClaim{
+			ObjectMeta: v1.ObjectMeta{Name: "test-mariadb-data", Namespace: "default", Labels: labels},
+			Spec:       v1core.PersistentVolumeClaimSpec{StorageClassName: &storageClass},
+			Status:     v1core.PersistentVolumeClaimStatus{Phase: v1core.ClaimPending},
+		},
+		&v1core.Event{
+			ObjectMeta:     v1.ObjectMeta{Name: "test-mariadb-data.1", Namespace: "default"},
+			InvolvedObject: v1core.ObjectReference{Kind: "PersistentVolumeClaim", Name: "test-mariadb-data"},
+			Type:           "Warning", Reason: "ProvisioningFailed", Message: `storageclass.storage.k8s.io "fast" not found`,
+		},
+		// Failing readiness probe
+		&v1core.Pod{
+			ObjectMeta: v1.ObjectMeta{Name: "test-node", Namespace: "default", Labels: labels},
+			Status: v1core.PodStatus{Phase: v1core.PodRunning, ContainerStatuses: []v1core.ContainerStatus{
+				{Name: "node", Ready: false, State: running},
+			}},
+		},
+		&v1core.Event{
+			ObjectMeta:     v1.ObjectMeta{Name: "test-node.1", Namespace: "default"},
+			InvolvedObject: v1core.ObjectReference{Kind: "Pod", Name: "test-node"},
+			Type:           "Warning", Reason: "Unhealthy", Message: "Readiness probe failed: HTTP probe failed with statuscode: 503",
+		},
+		// Exhausted quota
+		&v1core.ResourceQuota{
+			ObjectMeta: v1.ObjectMeta{Name: "compute", Namespace: "default"},
+			Status: v1core.ResourceQuotaStatus{
+				Hard: v1core.ResourceList{"requests.cpu": resource.MustParse("2"), "requests.memory": resource.MustParse("4Gi")},
+				Used: v1core.ResourceList{"requests.cpu": resource.MustParse("2"), "requests.memory": resource.MustParse("1Gi")},
+			},
+		},
+		&v1core.Event{
+			ObjectMeta:     v1.ObjectMeta{Name: "test-shell.1", Namespace: "default"},
+			InvolvedObject: v1core.ObjectReference{Kind: "ReplicaSet", Name: "test-shell-1234"},
+			Type:           "Warning", Reason: "FailedCreate",
+			Message: `pods "test-shell-1234-x" is forbidden: exceeded quota: compute, requested: requests.cpu=500m`,
+		},
+		// Failed post-release job
+		&batchv1.Job{
+			ObjectMeta: v1.ObjectMeta{Name: "test-post-release", Namespace: "default"},
+			Status:     batchv1.JobStatus{Failed: 1},
+		},
+		&v1core.Pod{
+			ObjectMeta: v1.ObjectMeta{Name: "test-post-release-abcde", Namespace: "default", Labels: map[string]string{"job-name": "test-post-release"}},
+			Status: v1core.PodStatus{Phase: v1core.PodFailed, ContainerStatuses: []v1core.ContainerStatus{
+				{Name: "post-release", State: v1core.ContainerState{Terminated: &v1core.ContainerStateTerminated{ExitCode: 127, Reason: "Error"}}},
+			}},
+		},
+	)
+
+	report := common.DebugFailedRelease(ctx, clientset, "default", "test")
+
+	findings := map[string]common.DebugFinding{}
+	for _, f := range report.Findings {
+		findings[f.Check+" "+f.Name+" "+f.Container] = f
+	}
+
+	expected := map[string][2]string{
+		"image-pull test-php php": {"ImagePullBackOff: image eu.gcr.io/project/php:abc123",
+			"image tag not found in registry, check that the image was built and pushed"},
+		"image-pull test-php nginx": {"ErrImagePull: image eu.gcr.io/private/nginx:abc123",
+			"registry denied access, check image pull secret and registry credentials"},
+		"unschedulable-pod test-mariadb-0 ": {"pod can't be scheduled: 0/3 nodes are available: 1 node(s) had untolerated taint {dedicated: db}, 2 Insufficient memory.",
+			"cluster has no node with enough free memory, lower memory requests or wait for the cluster to scale up; nodes have taints the pod does not tolerate, check pod tolerations"},
+		"unbound-volume-claim test-mariadb-data ": {"volume claim is Pending (storage class fast)",
+			"storage class does not exist or can't provision volumes, check storageClassName"},
+		"readiness-probe test-node ": {"Readiness probe failed: HTTP probe failed with statuscode: 503",
+			"container runs but does not pass readiness probe, check application logs, health check path and startup time"},
+		"resource-quota compute ": {"quota used up: requests.cpu 2/2",
+			"namespace resource quota is exhausted, lower resource requests or remove unused environments"},
+		"post-release-job test-post-release post-release": {"post-release job failed, container exited with code 127",
+			"command not found, check post-release commands and image contents"},
+	}
+	for key, e := range expected {
+		f, ok := findings[key]
+		if !ok {
+			t.Errorf("Finding %q not found", key)
+			continue
+		}
+		if f.Reason != e[0] || f.Hint != e[1] {
+			t.Errorf("Unexpected finding %q:\nreason: %s\nhint: %s", key, f.Reason, f.Hint)
+		}
+	}
+
+	if findings["resource-quota compute "].Severity != common.DebugSeverityError {
+		t.Errorf("Quota that blocked pod creation should be an error")
+	}
+	if findings["readiness-probe test-node "].Severity != common.DebugSeverityWarning {
+		t.Errorf("Readiness probe failure should be a warning")
+	}
+	if findings["post-release-job test-post-release post-release"].Logs != "[post-release] fake logs\n" {
+		t.Errorf("Unexpected post-release job logs: %q", findings["post-release-job test-post-release post-release"].Logs)
+	}
+
+	out := &bytes.Buffer{}
+	common.PrintDebugReport(out, report, "text")
+	if !strings.Contains(out.String(), `Error: post-release job failed:
+  * default / test-post-release post-release: post-release job failed, container exited with code 127
+    Hint: command not found, check post-release commands and image contents
+`) {
+		t.Errorf("Unexpected text report:\n%s", out.String())
+	}
+}
+
+func TestCheckImagePullFailuresHints(t *testing.T) {
+	tests := map[string]string{
+		`Failed to pull image "nginx:abc123": pull access denied for project/nginx, repository does not exist or may require 'docker login': denied: requested access to the resource is denied`: "repository does not exist or requires authorization, check image url, image pull secret and registry credentials",
+		`Failed to pull image "nginx:abc123": rpc error: code = NotFound desc = failed to resolve reference "nginx:abc123": manifest unknown`:                                                    "image tag not found in registry, check that the image was built and pushed",
+		`Failed to pull image "nginx:abc123": failed to fetch oauth token: unexpected status from GET request: 401 Unauthorized`:                                                                 "registry denied access, check image pull secret and registry credentials",
+		`Failed to pull image "nginx:abc123": failed to resolve reference: unexpected status code 403`:                                                                                           "registry denied access, check image pull secret and registry credentials",
+		`Failed to pull image "nginx:abc123": dial tcp: lookup registry.example.com: no such host`:                                                                                               "registry is not reachable from the cluster, check registry url",
+	}
+	for message, hint := range tests {
+		clientset := fake.NewClientset(&v1core.Event{
+			ObjectMeta:     v1.ObjectMeta{Name: "test-nginx.1", Namespace: "default"},
+			InvolvedObject: v1core.ObjectReference{Kind: "Pod", Name: "test-nginx"},
+			Type:           "Warning", Reason: "Failed", Message: message,
+		})
+		pod := v1core.Pod{
+			ObjectMeta: v1.ObjectMeta{Name: "test-nginx", Namespace: "default"},
+			Status: v1core.PodStatus{ContainerStatuses: []v1core.ContainerStatus{
+				{Name: "nginx", Image: "nginx:abc123", State: v1core.ContainerState{Waiting: &v1core.ContainerStateWaiting{Reason: "ErrImagePull"}}},
+			}},
+		}
+		findings := common.CheckImagePullFailures(context.Background(), clientset, []v1core.Pod{pod})
+		if len(findings) != 1 || findings[0].Hint != hint {
+			t.Errorf("%s: expected hint %q, received %+v", message, hint, findings)
+		}
+	}
+}
+
+func TestCheckPostReleaseJob(t *testing.T) {
+	tests := []struct {
+		status   batchv1.JobStatus
+		findings int
+	}{
+		{batchv1.JobStatus{Failed: 1}, 1},
+		{batchv1.JobStatus{Failed: 1, Succeeded: 1}, 0},
+		{batchv1.JobStatus{Failed: 2, Conditions: []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: v1core.ConditionTrue}}}, 0},
+		{batchv1.JobStatus{}, 0},
+	}
+	for _, test := range tests {
+		clientset := fake.NewClientset(&batchv1.Job{
+			ObjectMeta: v1.ObjectMeta{Name: "test-post-release", Namespace: "default"},
+			Status:     test.status,
+		})
+		findings := common.CheckPostReleaseJob(context.Background(), clientset, "default", "test")
+		if len(findings) != test.findings {
+			t.Errorf("%+v: expected %d findings, received %+v", test.status, test.findings, findings)
+		}
+	}
+}
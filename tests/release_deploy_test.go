@@ -0,0 +1,75 @@
+package cmd_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wunderio/silta-cli/internal/common"
+)
+
+func TestParseHelmFlags(t *testing.T) {
+	flags, err := common.ParseHelmFlags(`--set a=1 --set-string "b=two words" --values=values.yml --atomic --force=false --wait-for-jobs --history-max 3 --timeout=5m --version 1.2.3 --debug`)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if !reflect.DeepEqual(flags.Values.Values, []string{"a=1"}) || !reflect.DeepEqual(flags.Values.StringValues, []string{"b=two words"}) ||
+		!reflect.DeepEqual(flags.Values.ValueFiles, []string{"values.yml"}) {
+		t.Errorf("Unexpected value flags: %+v", flags.Values)
+	}
+	if !flags.Atomic || flags.Force || !flags.WaitForJobs || flags.HistoryMax != 3 || !flags.Debug || len(flags.Ignored) != 0 ||
+		flags.Timeout != 5*time.Minute || flags.Version != "1.2.3" {
+		t.Errorf("Unexpected flags: %+v", flags)
+	}
+
+	// Defaults are the same as helm cli defaults
+	flags, err = common.ParseHelmFlags("")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if flags.Atomic || flags.HistoryMax != 10 {
+		t.Errorf("Unexpected default flags: %+v", flags)
+	}
+
+	// Timeout and version override deployment parameters
+	deployment := common.HelmReleaseDeployment{ChartVersion: "1.0.0", Timeout: 15 * time.Minute}.WithHelmFlags(flags)
+	if deployment.Timeout != 15*time.Minute || deployment.ChartVersion != "1.0.0" {
+		t.Errorf("Unexpected deployment with default flags: %+v", deployment)
+	}
+	deployment = deployment.WithHelmFlags(common.HelmFlags{Timeout: time.Minute, Version: "2.0.0"})
+	if deployment.Timeout != time.Minute || deployment.ChartVersion != "2.0.0" {
+		t.Errorf("Flags did not override deployment: %+v", deployment)
+	}
+
+	// Unsupported flags are ignored with their values
+	flags, err = common.ParseHelmFlags("--skip-crds --set a=1 --description=test --atomic --dependency-update")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if !reflect.DeepEqual(flags.Ignored, []string{"--skip-crds", "--description", "--dependency-update"}) {
+		t.Errorf("Unexpected ignored flags: %v", flags.Ignored)
+	}
+	if !reflect.DeepEqual(flags.Values.Values, []string{"a=1"}) || !flags.Atomic {
+		t.Errorf("Supported flags were not parsed: %+v", flags)
+	}
+
+	// Invalid flags
+	for _, test := range []struct {
+		flags string
+		err   string
+	}{
+		{"--set", "helm flag --set requires a value"},
+		{"--history-max ten", "invalid value of helm flag --history-max: ten"},
+		{"--atomic=maybe", "invalid value of helm flag --atomic: maybe"},
+		{`--set "a=1`, "unterminated quote"},
+		{"--timeout 5", "invalid value of helm flag --timeout: 5"},
+		{"--kube-context other", "helm flag --kube-context is not supported"},
+		{"--set a=1 -n other", "helm flag -n is not supported"},
+	} {
+		_, err := common.ParseHelmFlags(test.flags)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: expected error %q, received %v", test.flags, test.err, err)
+		}
+	}
+}
@@ -0,0 +1,266 @@
+package cmd_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/wunderio/silta-cli/internal/common"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const diffTestPreviousManifest = `---
+# Source: drupal/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: test-php
+  labels:
+    app: php
+spec:
+  replicas: 1
+  template:
+    spec:
+      containers:
+        - name: php
+          image: php:1
+          env:
+            - name: OLD
+              value: "1"
+---
+# Source: drupal/templates/service.yaml
+apiVersion: v1
+kind: Service
+metadata:
+  name: test-legacy
+spec:
+  ports:
+    - port: 80
+---
+# Source: drupal/templates/secret.yaml
+apiVersion: v1
+kind: Secret
+metadata:
+  name: test-secrets
+stringData:
+  password: old-password
+  username: drupal
+`
+
+const diffTestTargetManifest = `---
+# Source: drupal/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: test-php
+  labels:
+    app: php
+spec:
+  replicas: 1
+  template:
+    spec:
+      containers:
+        - name: php
+          image: php:2
+---
+# Source: drupal/templates/configmap.yaml
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: test-config
+data:
+  key: value
+---
+# Source: drupal/templates/secret.yaml
+apiVersion: v1
+kind: Secret
+metadata:
+  name: test-secrets
+stringData:
+  password: new-password
+  username: drupal
+`
+
+// Live objects, as returned by API server
+const diffTestLiveManifest = `---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: test-php
+  namespace: default
+  uid: 1234
+  resourceVersion: "42"
+  generation: 3
+  creationTimestamp: "2024-01-01T00:00:00Z"
+  managedFields:
+    - manager: helm
+  annotations:
+    deployment.kubernetes.io/revision: "3"
+    meta.helm.sh/release-name: test
+    meta.helm.sh/release-namespace: default
+  labels:
+    app: php
+    app.kubernetes.io/managed-by: Helm
+spec:
+  replicas: 1
+  progressDeadlineSeconds: 600
+  template:
+    spec:
+      dnsPolicy: ClusterFirst
+      containers:
+        - name: php
+          image: php:1
+          imagePullPolicy: IfNotPresent
+          terminationMessagePath: /dev/termination-log
+          env:
+            - name: OLD
+              value: "1"
+status:
+  replicas: 1
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: test-legacy
+  namespace: default
+spec:
+  clusterIP: 10.0.0.1
+  ports:
+    - port: 80
+      protocol: TCP
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: test-secrets
+  namespace: default
+type: Opaque
+data:
+  password: b2xkLXBhc3N3b3Jk
+  username: ZHJ1cGFs
+`
+
+func diffTestLiveObjects(t *testing.T) common.LiveObjectGetter {
+	objects, err := common.ManifestObjects(diffTestLiveManifest)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	return func(obj *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+		if obj.GetNamespace() == "" {
+			obj.SetNamespace("default")
+		}
+		for _, live := range objects {
+			if live.GetKind() == obj.GetKind() && live.GetName() == obj.GetName() {
+				return live, nil
+			}
+		}
+		return nil, nil
+	}
+}
+
+func TestDiffReleaseManifests(t *testing.T) {
+	diffs, err := common.DiffReleaseManifests(diffTestTargetManifest, diffTestPreviousManifest, "default", diffTestLiveObjects(t))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	changes := []string{}
+	for _, d := range diffs {
+		changes = append(changes, d.Kind+"/"+d.Name+":"+d.Change)
+	}
+	expectedChanges := "Deployment/test-php:changed,ConfigMap/test-config:added,Secret/test-secrets:changed,Service/test-legacy:removed"
+	if strings.Join(changes, ",") != expectedChanges {
+		t.Fatalf("Expected changes %s, received %s", expectedChanges, strings.Join(changes, ","))
+	}
+
+	// Server defaulted and managed fields are ignored, fields removed from chart are not
+	expected := `--- live deployment/test-php
++++ target deployment/test-php
+@@ -10,8 +10,5 @@
+   template:
+     spec:
+       containers:
+-      - env:
+-        - name: OLD
+-          value: "1"
+-        image: php:1
++      - image: php:2
+         name: php
+`
+	if diffs[0].Diff != expected {
+		t.Errorf("Expected:\n%s\nReceived:\n%s", expected, diffs[0].Diff)
+	}
+
+	// Secret values are redacted
+	expected = `--- live secret/test-secrets
++++ target secret/test-secrets
+@@ -1,6 +1,6 @@
+ apiVersion: v1
+ data:
+-  password: (redacted)
++  password: (redacted, changed)
+   username: (redacted)
+ kind: Secret
+ metadata:
+`
+	if diffs[2].Diff != expected {
+		t.Errorf("Expected:\n%s\nReceived:\n%s", expected, diffs[2].Diff)
+	}
+	for _, d := range diffs {
+		if strings.Contains(d.Diff, "password: new-password") || strings.Contains(d.Diff, "b2xkLXBhc3N3b3Jk") {
+			t.Errorf("Secret value leaked in diff:\n%s", d.Diff)
+		}
+	}
+
+	// No changes
+	diffs, err = common.DiffReleaseManifests(diffTestPreviousManifest, diffTestPreviousManifest, "default", diffTestLiveObjects(t))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if len(diffs) != 0 {
+		t.Errorf("Expected no changes, received %d", len(diffs))
+	}
+}
+
+func TestPrintResourceDiffs(t *testing.T) {
+	diffs := []common.ResourceDiff{{
+		Kind:       "ConfigMap",
+		APIVersion: "v1",
+		Namespace:  "default",
+		Name:       "test-config",
+		Change:     common.ResourceAdded,
+		Diff:       "--- live configmap/test-config\n+++ target configmap/test-config\n@@ -0,0 +1 @@\n+kind: ConfigMap\n",
+	}}
+
+	out := &bytes.Buffer{}
+	common.PrintResourceDiffs(out, diffs, "text")
+	expected := "default, test-config, ConfigMap (v1) has been added:\n" + diffs[0].Diff + "\n"
+	if out.String() != expected {
+		t.Errorf("Expected:\n%s\nReceived:\n%s", expected, out.String())
+	}
+
+	out.Reset()
+	common.PrintResourceDiffs(out, diffs, "markdown")
+	expected = "1 release resource(s) changed:\n\n<details><summary>ConfigMap test-config (added)</summary>\n\n```diff\n" + diffs[0].Diff + "```\n</details>\n\n"
+	if out.String() != expected {
+		t.Errorf("Expected:\n%s\nReceived:\n%s", expected, out.String())
+	}
+
+	out.Reset()
+	common.PrintResourceDiffs(out, diffs, "json")
+	decoded := []common.ResourceDiff{}
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil || len(decoded) != 1 || decoded[0] != diffs[0] {
+		t.Errorf("Unexpected json output: %s", out.String())
+	}
+
+	out.Reset()
+	common.PrintResourceDiffs(out, []common.ResourceDiff{}, "text")
+	if out.String() != "No changes in release resources.\n" {
+		t.Errorf("Unexpected output: %s", out.String())
+	}
+
+	if err := common.PrintResourceDiffs(out, diffs, "html"); err == nil {
+		t.Errorf("Expected unknown format error")
+	}
+}
@@ -0,0 +1,120 @@
+package cmd_test
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/wunderio/silta-cli/internal/common"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	v1core "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestDownscaleWakeupRelease(t *testing.T) {
+	ctx := context.Background()
+	labels := map[string]string{"release": "test", "app.kubernetes.io/instance": "test"}
+	replicas := int32(2)
+	suspended := false
+	ports := []v1core.ServicePort{{Name: "web", Protocol: v1core.ProtocolTCP, Port: 80, TargetPort: intstr.FromInt(8080)}}
+	selector := map[string]string{"app": "nginx", "release": "test"}
+
+	clientset := fake.NewClientset(
+		&appsv1.Deployment{
+			ObjectMeta: v1.ObjectMeta{Name: "test-nginx", Namespace: "default", Labels: labels},
+			Spec:       appsv1.DeploymentSpec{Replicas: &replicas},
+		},
+		&appsv1.StatefulSet{
+			ObjectMeta: v1.ObjectMeta{Name: "test-mariadb", Namespace: "default", Labels: labels},
+			Spec:       appsv1.StatefulSetSpec{Replicas: &replicas},
+		},
+		&batchv1.CronJob{
+			ObjectMeta: v1.ObjectMeta{Name: "test-cron", Namespace: "default", Labels: labels},
+			Spec:       batchv1.CronJobSpec{Suspend: &suspended},
+		},
+		&v1core.Service{
+			ObjectMeta: v1.ObjectMeta{Name: "test-nginx", Namespace: "default", Labels: map[string]string{"release": "test"}},
+			Spec:       v1core.ServiceSpec{Type: v1core.ServiceTypeNodePort, Selector: selector, Ports: ports},
+		},
+		&networkingv1.Ingress{
+			ObjectMeta: v1.ObjectMeta{Name: "test-ingress", Namespace: "default", Labels: labels},
+			Spec: networkingv1.IngressSpec{Rules: []networkingv1.IngressRule{
+				{Host: "test.example.com"}, {Host: "www.test.example.com"}, {Host: "test.example.com"},
+			}},
+		},
+	)
+
+	// Downscale, running twice does not overwrite original state
+	out := &bytes.Buffer{}
+	for i := 0; i < 2; i++ {
+		err := common.DownscaleRelease(ctx, clientset, "default", "test", "placeholder.example.com", out)
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+	}
+
+	deployment, _ := clientset.AppsV1().Deployments("default").Get(ctx, "test-nginx", v1.GetOptions{})
+	if *deployment.Spec.Replicas != 0 || deployment.Annotations[common.DownscaleOriginalReplicasAnnotation] != "2" {
+		t.Errorf("Deployment not downscaled: replicas %d, annotations %v", *deployment.Spec.Replicas, deployment.Annotations)
+	}
+	statefulset, _ := clientset.AppsV1().StatefulSets("default").Get(ctx, "test-mariadb", v1.GetOptions{})
+	if *statefulset.Spec.Replicas != 0 || statefulset.Annotations[common.DownscaleOriginalReplicasAnnotation] != "2" {
+		t.Errorf("Statefulset not downscaled: replicas %d, annotations %v", *statefulset.Spec.Replicas, statefulset.Annotations)
+	}
+	cronjob, _ := clientset.BatchV1().CronJobs("default").Get(ctx, "test-cron", v1.GetOptions{})
+	if !*cronjob.Spec.Suspend {
+		t.Errorf("Cronjob not suspended")
+	}
+	service, _ := clientset.CoreV1().Services("default").Get(ctx, "test-nginx", v1.GetOptions{})
+	if service.Spec.Type != v1core.ServiceTypeExternalName || service.Spec.ExternalName != "placeholder.example.com" || len(service.Spec.Selector) != 0 {
+		t.Errorf("Service not redirected: %+v", service.Spec)
+	}
+	expectedAnnotations := map[string]string{
+		common.DownscaleOriginalTypeAnnotation:     "NodePort",
+		common.DownscaleOriginalSelectorAnnotation: `{"app":"nginx","release":"test"}`,
+		common.DownscaleOriginalPortsAnnotation:    `[{"name":"web","protocol":"TCP","port":80,"targetPort":8080}]`,
+		common.DownscaleDownAnnotation:             "true",
+	}
+	if !reflect.DeepEqual(service.Annotations, expectedAnnotations) {
+		t.Errorf("Expected service annotations %v, got %v", expectedAnnotations, service.Annotations)
+	}
+
+	// Wakeup restores the original state
+	out = &bytes.Buffer{}
+	hostnames, err := common.WakeupRelease(ctx, clientset, "default", "test", 0, out)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if !reflect.DeepEqual(hostnames, []string{"test.example.com", "www.test.example.com"}) {
+		t.Errorf("Unexpected hostnames: %v", hostnames)
+	}
+
+	deployment, _ = clientset.AppsV1().Deployments("default").Get(ctx, "test-nginx", v1.GetOptions{})
+	if *deployment.Spec.Replicas != 2 || len(deployment.Annotations) != 0 {
+		t.Errorf("Deployment not restored: replicas %d, annotations %v", *deployment.Spec.Replicas, deployment.Annotations)
+	}
+	statefulset, _ = clientset.AppsV1().StatefulSets("default").Get(ctx, "test-mariadb", v1.GetOptions{})
+	if *statefulset.Spec.Replicas != 2 || len(statefulset.Annotations) != 0 {
+		t.Errorf("Statefulset not restored: replicas %d, annotations %v", *statefulset.Spec.Replicas, statefulset.Annotations)
+	}
+	cronjob, _ = clientset.BatchV1().CronJobs("default").Get(ctx, "test-cron", v1.GetOptions{})
+	if *cronjob.Spec.Suspend {
+		t.Errorf("Cronjob not resumed")
+	}
+	service, _ = clientset.CoreV1().Services("default").Get(ctx, "test-nginx", v1.GetOptions{})
+	if service.Spec.Type != v1core.ServiceTypeNodePort || service.Spec.ExternalName != "" ||
+		!reflect.DeepEqual(service.Spec.Selector, selector) || !reflect.DeepEqual(service.Spec.Ports, ports) {
+		t.Errorf("Service not restored: %+v", service.Spec)
+	}
+	if !reflect.DeepEqual(service.Annotations, map[string]string{common.DownscaleDownAnnotation: "false"}) {
+		t.Errorf("Unexpected service annotations: %v", service.Annotations)
+	}
+	if _, ok := service.Labels[common.DownscaleRedirectedLabel]; ok {
+		t.Errorf("Redirected label not removed")
+	}
+}
@@ -0,0 +1,85 @@
+package cmd_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/wunderio/silta-cli/internal/common"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestReleaseEvents(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	labels := map[string]string{"release": "test"}
+
+	clientset := fake.NewClientset(
+		&appsv1.Deployment{ObjectMeta: v1.ObjectMeta{Name: "test-php", Namespace: "default", Labels: labels}},
+		&appsv1.ReplicaSet{ObjectMeta: v1.ObjectMeta{Name: "test-php-7d9f", Namespace: "default", Labels: labels}},
+		// Pod of the release replicaset that no longer exists
+		testEvent("e1", "Pod", "test-php-7d9f-x2x4z", "BackOff", "Back-off restarting failed container", 2, now.Add(-10*time.Minute)),
+		testEvent("e2", "Pod", "test-php-7d9f-x2x4z", "BackOff", "Back-off restarting failed container", 3, now.Add(-5*time.Minute)),
+		testEvent("e3", "Deployment", "test-php", "ScalingReplicaSet", "Scaled up replica set test-php-7d9f to 1", 1, now.Add(-20*time.Minute)),
+		testEvent("e4", "Pod", "test-2-php-abc-def", "BackOff", "Other release", 1, now.Add(-5*time.Minute)),
+		testEvent("e5", "ReplicaSet", "test-php-7d9f", "SuccessfulCreate", "Created pod: test-php-7d9f-x2x4z", 1, now.Add(-2*time.Hour)),
+	)
+
+	events, err := common.ReleaseEvents(context.Background(), clientset, "default", "test", now.Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	out := &bytes.Buffer{}
+	common.PrintReleaseEvents(out, events)
+	expected := `2024-05-01T11:40:00Z Warning ScalingReplicaSet Deployment/test-php: Scaled up replica set test-php-7d9f to 1
+2024-05-01T11:55:00Z Warning BackOff Pod/test-php-7d9f-x2x4z: Back-off restarting failed container (x5)
+`
+	if out.String() != expected {
+		t.Errorf("Expected:\n'%s'\nReceived:\n'%s'", expected, out.String())
+	}
+	if !events[1].FirstSeen.Equal(now.Add(-11 * time.Minute)) {
+		t.Errorf("Unexpected first seen time: %s", events[1].FirstSeen)
+	}
+}
+
+func TestFollowReleaseEvents(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+	labels := map[string]string{"release": "test"}
+
+	clientset := fake.NewClientset(
+		&appsv1.ReplicaSet{ObjectMeta: v1.ObjectMeta{Name: "test-php-7d9f", Namespace: "default", Labels: labels}},
+		testEvent("e1", "ReplicaSet", "test-php-7d9f", "SuccessfulCreate", "Created pod: test-php-7d9f-x2x4z", 1, now),
+	)
+
+	out := &bytes.Buffer{}
+	ctx, cancel := context.WithCancel(context.Background())
+	result := make(chan error, 1)
+	go func() {
+		result <- common.FollowReleaseEvents(ctx, clientset, "default", "test", time.Time{}, out)
+	}()
+
+	// New event, repeated event and an event of another release
+	time.Sleep(100 * time.Millisecond)
+	event := testEvent("e2", "Pod", "test-php-7d9f-x2x4z", "BackOff", "Back-off restarting failed container", 1, now)
+	clientset.CoreV1().Events("default").Create(context.TODO(), event, v1.CreateOptions{})
+	clientset.CoreV1().Events("default").Create(context.TODO(), testEvent("e3", "Pod", "other", "BackOff", "Other release", 1, now), v1.CreateOptions{})
+	time.Sleep(100 * time.Millisecond)
+	event.Count = 4
+	clientset.CoreV1().Events("default").Update(context.TODO(), event, v1.UpdateOptions{})
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+
+	if err := <-result; err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	timestamp := now.Format(time.RFC3339)
+	expected := timestamp + ` Warning SuccessfulCreate ReplicaSet/test-php-7d9f: Created pod: test-php-7d9f-x2x4z
+` + timestamp + ` Warning BackOff Pod/test-php-7d9f-x2x4z: Back-off restarting failed container
+` + timestamp + ` Warning BackOff Pod/test-php-7d9f-x2x4z: Back-off restarting failed container (x4)
+`
+	if out.String() != expected {
+		t.Errorf("Expected:\n'%s'\nReceived:\n'%s'", expected, out.String())
+	}
+}
@@ -0,0 +1,54 @@
+package cmd_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/wunderio/silta-cli/internal/common"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestFindReleasePod(t *testing.T) {
+	labels := map[string]string{"release": "test"}
+	clientset := fake.NewClientset(
+		testPod("test-drupal-abc", labels).containers("php", "nginx").ready(false).build(),
+		testPod("test-drupal-def", labels).containers("nginx", "php").ready(true).build(),
+		testPod("test-cron-drupal-123", map[string]string{"release": "test", "cronjob": "true"}).containers("php").ready(true).build(),
+		testPod("test-shell-xyz", map[string]string{"app.kubernetes.io/instance": "test"}).containers("shell").ready(true).build(),
+		testPod("test-2-node-abc", map[string]string{"release": "test-2"}).containers("node").ready(true).build(),
+	)
+
+	tests := []struct {
+		components []string
+		pod        string
+		container  string
+	}{
+		{common.DefaultExecComponents, "test-shell-xyz", "shell"},
+		{[]string{"php"}, "test-drupal-def", "php"},
+		{[]string{"drupal"}, "test-drupal-def", "nginx"},
+		{[]string{"node", "php"}, "test-drupal-def", "php"},
+	}
+	for _, test := range tests {
+		pod, container, err := common.FindReleasePod(context.Background(), clientset, "default", "test", test.components)
+		if err != nil {
+			t.Fatalf("Components %v: unexpected error: %s", test.components, err)
+		}
+		if pod.Name != test.pod || container != test.container {
+			t.Errorf("Components %v: expected %s/%s, received %s/%s", test.components, test.pod, test.container, pod.Name, container)
+		}
+	}
+
+	_, _, err := common.FindReleasePod(context.Background(), clientset, "default", "test", []string{"node"})
+	if err == nil || err.Error() != "no ready node pod found in release test" {
+		t.Errorf("Expected missing pod error, received: %v", err)
+	}
+
+	// Pods are listed by release labels, not all pods of the namespace
+	for _, action := range clientset.Actions() {
+		list, ok := action.(k8stesting.ListAction)
+		if ok && list.GetListRestrictions().Labels.Empty() {
+			t.Errorf("Pods were listed without a label selector")
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package cmd_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/wunderio/silta-cli/internal/common"
+	v1core "k8s.io/api/core/v1"
+)
+
+func TestFileFilter(t *testing.T) {
+	filter := common.FileFilter{
+		Include: []string{"*.jpg", "2024/*", "styles"},
+		Exclude: []string{"*.tmp.jpg", "private"},
+	}
+	tests := map[string]bool{
+		"a.jpg":                true,
+		"x/y/a.jpg":            true,
+		"a.png":                false,
+		"2024/a.png":           true,
+		"2024/sub/a.png":       true,
+		"2023/a.png":           false,
+		"css/styles/a.css":     true,
+		"a.tmp.jpg":            false,
+		"private/a.jpg":        false,
+		"x/private/2024/a.jpg": false,
+		"styles/private.png":   true,
+	}
+	for rel, expected := range tests {
+		if filter.Matches(rel) != expected {
+			t.Errorf("%s: expected %t", rel, expected)
+		}
+	}
+	if !(common.FileFilter{}).Matches("any/file") {
+		t.Error("Empty filter should match all files")
+	}
+	if (common.FileFilter{Exclude: []string{"["}}).Validate() == nil {
+		t.Error("Expected invalid pattern error")
+	}
+}
+
+func TestParseRemoteFileList(t *testing.T) {
+	files := common.ParseRemoteFileList("./a.jpg\x00./b/c.png\x00./d.log\x00./-rf\x00", common.FileFilter{Exclude: []string{"*.log"}}, false)
+	expected := map[string]string{"a.jpg": "", "b/c.png": "", "-rf": ""}
+	if !reflect.DeepEqual(files, expected) {
+		t.Errorf("Unexpected files: %v", files)
+	}
+
+	output := "d41d8cd98f00b204e9800998ecf8427e  ./a.jpg\x000cc175b9c0f1b6a831c399e269772661  ./b\\c\nd  e.png\x00"
+	files = common.ParseRemoteFileList(output, common.FileFilter{}, true)
+	expected = map[string]string{"a.jpg": "d41d8cd98f00b204e9800998ecf8427e", "b\\c\nd  e.png": "0cc175b9c0f1b6a831c399e269772661"}
+	if !reflect.DeepEqual(files, expected) {
+		t.Errorf("Unexpected checksums: %v", files)
+	}
+}
+
+func TestRemoteTarFileList(t *testing.T) {
+	list := common.RemoteTarFileList([]string{"-rf", "b/c\nd.png"})
+	if list != "./-rf\x00./b/c\nd.png\x00" {
+		t.Errorf("Unexpected file list: %q", list)
+	}
+
+	// Remote tar archives files starting with a dash
+	version, err := exec.Command("tar", "--version").Output()
+	if err != nil || !strings.Contains(string(version), "GNU tar") {
+		t.Skip("GNU tar is not available")
+	}
+	source := t.TempDir()
+	os.WriteFile(filepath.Join(source, "-rf"), []byte("a"), 0644)
+	os.WriteFile(filepath.Join(source, "--remove-files"), []byte("b"), 0644)
+	tarCmd := exec.Command("tar", "--null", "--verbatim-files-from", "-cf", "-", "-T", "-")
+	tarCmd.Dir = source
+	tarCmd.Stdin = strings.NewReader(common.RemoteTarFileList([]string{"-rf", "--remove-files"}))
+	archive, err := tarCmd.Output()
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	target := t.TempDir()
+	if count, err := common.ExtractTar(bytes.NewReader(archive), target); err != nil || count != 2 {
+		t.Fatalf("Expected 2 files, received %d (%v)", count, err)
+	}
+	if content, _ := os.ReadFile(filepath.Join(target, "-rf")); string(content) != "a" {
+		t.Errorf("Unexpected content: %s", content)
+	}
+	if _, err := os.Stat(filepath.Join(source, "--remove-files")); err != nil {
+		t.Error("File name was taken for an option")
+	}
+}
+
+func TestFilesToTransfer(t *testing.T) {
+	source := map[string]string{"a": "1", "b": "2", "c": "3"}
+	target := map[string]string{"a": "1", "b": "x"}
+	if files := common.FilesToTransfer(source, target, false); !reflect.DeepEqual(files, []string{"a", "b", "c"}) {
+		t.Errorf("Unexpected files: %v", files)
+	}
+	if files := common.FilesToTransfer(source, target, true); !reflect.DeepEqual(files, []string{"b", "c"}) {
+		t.Errorf("Unexpected resumed files: %v", files)
+	}
+}
+
+func TestFilesTar(t *testing.T) {
+	source := t.TempDir()
+	os.MkdirAll(filepath.Join(source, "b", "c"), 0755)
+	os.WriteFile(filepath.Join(source, "a.txt"), []byte("a"), 0644)
+	os.WriteFile(filepath.Join(source, "b", "c", "d.txt"), []byte("d"), 0600)
+	os.WriteFile(filepath.Join(source, "b", "e.log"), []byte("e"), 0644)
+
+	files, err := common.ListLocalFiles(source, common.FileFilter{Exclude: []string{"*.log"}}, true)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	expected := map[string]string{
+		"a.txt":     "0cc175b9c0f1b6a831c399e269772661",
+		"b/c/d.txt": "8277e0910d750195b448797616e091ad",
+	}
+	if !reflect.DeepEqual(files, expected) {
+		t.Errorf("Unexpected local files: %v", files)
+	}
+
+	missing, err := common.ListLocalFiles(filepath.Join(source, "missing"), common.FileFilter{}, false)
+	if err != nil || len(missing) != 0 {
+		t.Errorf("Missing directory should have no files: %v, %v", missing, err)
+	}
+
+	archive := &bytes.Buffer{}
+	if err := common.WriteTar(archive, source, common.FilesToTransfer(files, nil, false)); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	target := t.TempDir()
+	count, err := common.ExtractTar(archive, target)
+	if err != nil || count != 2 {
+		t.Fatalf("Unexpected extract result: %d, %v", count, err)
+	}
+	extracted, _ := common.ListLocalFiles(target, common.FileFilter{}, true)
+	if !reflect.DeepEqual(extracted, expected) {
+		t.Errorf("Unexpected extracted files: %v", extracted)
+	}
+	info, _ := os.Stat(filepath.Join(target, "b", "c", "d.txt"))
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Unexpected file mode: %s", info.Mode())
+	}
+
+	// Files outside of the target directory are rejected
+	archive.Reset()
+	writer := tar.NewWriter(archive)
+	writer.WriteHeader(&tar.Header{Name: "../escape.txt", Mode: 0644, Size: 1, Typeflag: tar.TypeReg})
+	writer.Write([]byte("x"))
+	writer.Close()
+	if _, err := common.ExtractTar(archive, target); err == nil {
+		t.Error("Expected invalid file name error")
+	}
+}
+
+func TestReleaseVolumeMounts(t *testing.T) {
+	pod := &v1core.Pod{Spec: v1core.PodSpec{
+		Volumes: []v1core.Volume{
+			{Name: "files", VolumeSource: v1core.VolumeSource{PersistentVolumeClaim: &v1core.PersistentVolumeClaimVolumeSource{ClaimName: "test-public-files"}}},
+			{Name: "reference", VolumeSource: v1core.VolumeSource{PersistentVolumeClaim: &v1core.PersistentVolumeClaimVolumeSource{ClaimName: "test-reference-data"}}},
+			{Name: "config", VolumeSource: v1core.VolumeSource{ConfigMap: &v1core.ConfigMapVolumeSource{}}},
+		},
+		Containers: []v1core.Container{
+			{Name: "php", VolumeMounts: []v1core.VolumeMount{
+				{Name: "files", MountPath: "/app/web/sites/default/files"},
+				{Name: "reference", MountPath: "/app/reference-data"},
+				{Name: "config", MountPath: "/etc/php"},
+			}},
+			{Name: "nginx", VolumeMounts: []v1core.VolumeMount{{Name: "files", MountPath: "/app/files"}}},
+		},
+	}}
+	mounts := common.ReleaseVolumeMounts(pod, "php")
+	if !reflect.DeepEqual(mounts, []string{"/app/reference-data", "/app/web/sites/default/files"}) {
+		t.Errorf("Unexpected mounts: %v", mounts)
+	}
+}
@@ -0,0 +1,168 @@
+package cmd_test
+
+import (
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	v1core "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	helmChart "helm.sh/helm/v3/pkg/chart"
+	helmRelease "helm.sh/helm/v3/pkg/release"
+	helmTime "helm.sh/helm/v3/pkg/time"
+)
+
+// Release objects shared by tests. Objects are in "default" namespace unless set otherwise.
+
+// testPodBuilder builds a release pod
+type testPodBuilder struct {
+	pod *v1core.Pod
+}
+
+// testPod returns a builder of a pod that was created now and is scheduled to a node. Fake clientset doesn't set UIDs,
+// pod name is used.
+func testPod(name string, labels map[string]string) testPodBuilder {
+	return testPodBuilder{&v1core.Pod{
+		ObjectMeta: v1.ObjectMeta{Name: name, Namespace: "default", Labels: labels, UID: types.UID(name), CreationTimestamp: v1.Now()},
+		Spec:       v1core.PodSpec{NodeName: "node-1"},
+	}}
+}
+
+// containers adds pod spec containers
+func (b testPodBuilder) containers(names ...string) testPodBuilder {
+	for _, name := range names {
+		b.pod.Spec.Containers = append(b.pod.Spec.Containers, v1core.Container{Name: name})
+	}
+	return b
+}
+
+// ready sets pod running with a Ready condition
+func (b testPodBuilder) ready(ready bool) testPodBuilder {
+	status := v1core.ConditionFalse
+	if ready {
+		status = v1core.ConditionTrue
+	}
+	b.pod.Status.Phase = v1core.PodRunning
+	b.pod.Status.Conditions = []v1core.PodCondition{{Type: v1core.PodReady, Status: status}}
+	return b
+}
+
+// container adds a container status
+func (b testPodBuilder) container(name string, state v1core.ContainerState) testPodBuilder {
+	b.pod.Status.ContainerStatuses = append(b.pod.Status.ContainerStatuses, v1core.ContainerStatus{Name: name, State: state})
+	return b
+}
+
+// running adds statuses of running containers
+func (b testPodBuilder) running(names ...string) testPodBuilder {
+	for _, name := range names {
+		b.container(name, v1core.ContainerState{Running: &v1core.ContainerStateRunning{}})
+	}
+	return b
+}
+
+func (b testPodBuilder) build() *v1core.Pod {
+	return b.pod
+}
+
+// testDeploymentBuilder builds a release deployment
+type testDeploymentBuilder struct {
+	deployment *appsv1.Deployment
+}
+
+// testDeployment returns a builder of a deployment
+func testDeployment(name string, labels map[string]string) testDeploymentBuilder {
+	return testDeploymentBuilder{&appsv1.Deployment{ObjectMeta: v1.ObjectMeta{Name: name, Namespace: "default", Labels: labels}}}
+}
+
+func (b testDeploymentBuilder) namespace(namespace string) testDeploymentBuilder {
+	b.deployment.Namespace = namespace
+	return b
+}
+
+func (b testDeploymentBuilder) replicas(replicas int32) testDeploymentBuilder {
+	b.deployment.Spec.Replicas = &replicas
+	return b
+}
+
+// containers adds pod template containers
+func (b testDeploymentBuilder) containers(names ...string) testDeploymentBuilder {
+	for _, name := range names {
+		b.deployment.Spec.Template.Spec.Containers = append(b.deployment.Spec.Template.Spec.Containers, v1core.Container{Name: name})
+	}
+	return b
+}
+
+func (b testDeploymentBuilder) build() *appsv1.Deployment {
+	return b.deployment
+}
+
+// testCronJob returns a drupal cron job
+func testCronJob(name string, labels map[string]string) *batchv1.CronJob {
+	return &batchv1.CronJob{
+		ObjectMeta: v1.ObjectMeta{Name: name, Namespace: "default", Labels: labels, UID: "cron-uid"},
+		Spec: batchv1.CronJobSpec{
+			JobTemplate: batchv1.JobTemplateSpec{
+				ObjectMeta: v1.ObjectMeta{Labels: map[string]string{"cronjob": "true"}},
+				Spec: batchv1.JobSpec{Template: v1core.PodTemplateSpec{Spec: v1core.PodSpec{
+					Containers: []v1core.Container{{Name: "php", Command: []string{"drush", "cron"}}},
+				}}},
+			},
+		},
+	}
+}
+
+// testEvent returns a warning event of an object, first seen a minute before last seen
+func testEvent(name string, kind string, object string, reason string, message string, count int32, lastSeen time.Time) *v1core.Event {
+	return &v1core.Event{
+		ObjectMeta:     v1.ObjectMeta{Name: name, Namespace: "default"},
+		InvolvedObject: v1core.ObjectReference{Kind: kind, Name: object},
+		Type:           "Warning",
+		Reason:         reason,
+		Message:        message,
+		Count:          count,
+		FirstTimestamp: v1.Time{Time: lastSeen.Add(-time.Minute)},
+		LastTimestamp:  v1.Time{Time: lastSeen},
+	}
+}
+
+// testReleaseBuilder builds a revision of "test" drupal chart release
+type testReleaseBuilder struct {
+	release *helmRelease.Release
+}
+
+// testRelease returns a builder of a release revision, deployed <version> seconds after 2024-03-05 10:00 UTC
+func testRelease(version int, chartVersion string, status helmRelease.Status) testReleaseBuilder {
+	return testReleaseBuilder{&helmRelease.Release{
+		Name:      "test",
+		Namespace: "default",
+		Version:   version,
+		Chart: &helmChart.Chart{
+			Metadata: &helmChart.Metadata{Name: "drupal", Version: chartVersion, AppVersion: "1.0"},
+			Values:   map[string]interface{}{"replicas": 1, "php": map[string]interface{}{"image": "", "memory": "256M"}},
+		},
+		Info: &helmRelease.Info{
+			Status:       status,
+			Description:  "Upgrade complete",
+			Notes:        "Notes for " + chartVersion,
+			LastDeployed: helmTime.Time{Time: time.Date(2024, 3, 5, 10, 0, version, 0, time.UTC)},
+		},
+	}}
+}
+
+// config sets user supplied values of the revision
+func (b testReleaseBuilder) config(config map[string]interface{}) testReleaseBuilder {
+	b.release.Config = config
+	return b
+}
+
+func (b testReleaseBuilder) manifest(manifest string) testReleaseBuilder {
+	b.release.Manifest = manifest
+	return b
+}
+
+func (b testReleaseBuilder) build() *helmRelease.Release {
+	return b.release
+}
@@ -0,0 +1,138 @@
+package cmd_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/wunderio/silta-cli/internal/common"
+
+	helmRelease "helm.sh/helm/v3/pkg/release"
+)
+
+func TestReleaseHistory(t *testing.T) {
+	history := []*helmRelease.Release{
+		testRelease(1, "1.0.0", helmRelease.StatusSuperseded).
+			config(map[string]interface{}{"php": map[string]interface{}{"image": "php:1"}}).manifest("kind: Deployment\nname: test\nimage: php:1\n").build(),
+		testRelease(2, "1.1.0", helmRelease.StatusDeployed).
+			config(map[string]interface{}{"php": map[string]interface{}{"image": "php:2"}}).manifest("kind: Deployment\nname: test\nimage: php:2\n").build(),
+	}
+
+	// History table
+	out := &bytes.Buffer{}
+	common.PrintReleaseHistory(out, history)
+	expected := "REVISION\tUPDATED\t\t\t\tSTATUS\t\tCHART\t\tAPP VERSION\tDESCRIPTION\n" +
+		"1\t\tTue Mar  5 10:00:01 2024\tsuperseded\tdrupal-1.0.0\t1.0\t\tUpgrade complete\n" +
+		"2\t\tTue Mar  5 10:00:02 2024\tdeployed\tdrupal-1.1.0\t1.0\t\tUpgrade complete\n"
+	if out.String() != expected {
+		t.Errorf("Expected:\n%s\nReceived:\n%s", expected, out.String())
+	}
+
+	// Revision selection
+	r, err := common.ReleaseRevision(history, -1)
+	if err != nil || r.Version != 1 {
+		t.Errorf("Expected revision 1, received %v (%v)", r, err)
+	}
+	r, err = common.ReleaseRevision(history, 0)
+	if err != nil || r.Version != 2 {
+		t.Errorf("Expected revision 2, received %v (%v)", r, err)
+	}
+	_, err = common.ReleaseRevision(history, 3)
+	if err == nil || err.Error() != "release has no revision 3" {
+		t.Errorf("Expected missing revision error, received %v", err)
+	}
+	_, err = common.ReleaseRevision(history, -2)
+	if err == nil || err.Error() != "release has only 2 revisions" {
+		t.Errorf("Expected missing revision error, received %v", err)
+	}
+
+	// Computed values diff
+	diff, err := common.DiffReleaseRevisions(history[0], history[1], "values")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	expected = `--- revision 1 values
++++ revision 2 values
+@@ -1,4 +1,4 @@
+ php:
+-  image: php:1
++  image: php:2
+   memory: 256M
+ replicas: 1
+`
+	if diff != expected {
+		t.Errorf("Expected:\n%s\nReceived:\n%s", expected, diff)
+	}
+
+	// Manifest diff
+	diff, err = common.DiffReleaseRevisions(history[0], history[1], "manifest")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	expected = `--- revision 1 manifest
++++ revision 2 manifest
+@@ -1,3 +1,3 @@
+ kind: Deployment
+ name: test
+-image: php:1
++image: php:2
+`
+	if diff != expected {
+		t.Errorf("Expected:\n%s\nReceived:\n%s", expected, diff)
+	}
+
+	// No changes
+	diff, _ = common.DiffReleaseRevisions(history[1], history[1], "manifest")
+	if diff != "" {
+		t.Errorf("Expected no diff, received:\n%s", diff)
+	}
+
+	_, err = common.DiffReleaseRevisions(history[0], history[1], "hooks")
+	if err == nil {
+		t.Errorf("Expected unknown diff type error")
+	}
+}
+
+func TestReleaseHistoryDiffRedactsSecrets(t *testing.T) {
+	secretManifest := func(password string) string {
+		return "---\n# Source: drupal/templates/secret.yaml\napiVersion: v1\nkind: Secret\nmetadata:\n  name: test-secrets-drupal\n" +
+			"stringData:\n  DB_PASS: " + password + "\n  HASH_SALT: salt-value\n" +
+			"---\n# Source: drupal/templates/deployment.yaml\napiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: test-drupal\n"
+	}
+	values := func(password string, image string) map[string]interface{} {
+		return map[string]interface{}{
+			"imagePullSecret": "pull-secret-value",
+			"mariadb": map[string]interface{}{
+				"rootUser": map[string]interface{}{"password": "root-" + password},
+				"db":       map[string]interface{}{"password": "db-" + password},
+			},
+			"shell": map[string]interface{}{
+				"gitAuth": map[string]interface{}{"keyserver": map[string]interface{}{"password": "keyserver-" + password}},
+			},
+			"php": map[string]interface{}{"image": image},
+		}
+	}
+	from := testRelease(1, "1.0.0", helmRelease.StatusSuperseded).
+		config(values("old-password", "php:1")).manifest(secretManifest("old-password")).build()
+	to := testRelease(2, "1.0.0", helmRelease.StatusDeployed).config(values("new-password", "php:2")).manifest(secretManifest("new-password")).build()
+
+	for _, kind := range []string{"values", "manifest"} {
+		diff, err := common.DiffReleaseRevisions(from, to, kind)
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		for _, secret := range []string{"old-password", "new-password", "pull-secret-value", "salt-value"} {
+			if strings.Contains(diff, secret+"\n") || strings.Contains(diff, secret+"\"") {
+				t.Errorf("Expected %s diff not to contain %q, received:\n%s", kind, secret, diff)
+			}
+		}
+		if !strings.Contains(diff, "(redacted)") {
+			t.Errorf("Expected %s diff to contain redacted values, received:\n%s", kind, diff)
+		}
+	}
+
+	diff, _ := common.DiffReleaseRevisions(from, to, "manifest")
+	if !strings.Contains(diff, "+  DB_PASS: (redacted, changed)") || strings.Contains(diff, "HASH_SALT: (redacted, changed)") {
+		t.Errorf("Expected changed secret value to be marked, received:\n%s", diff)
+	}
+}
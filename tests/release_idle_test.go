@@ -0,0 +1,142 @@
+package cmd_test
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/wunderio/silta-cli/internal/common"
+	appsv1 "k8s.io/api/apps/v1"
+	v1core "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	helmRelease "helm.sh/helm/v3/pkg/release"
+	helmTime "helm.sh/helm/v3/pkg/time"
+)
+
+func TestIdlePolicyFromConfig(t *testing.T) {
+	store := viper.New()
+	policy, err := common.IdlePolicyFromConfig(*store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(policy, common.DefaultIdlePolicy) {
+		t.Errorf("Expected default policy, got %v", policy)
+	}
+
+	// Values set with "silta config set" are strings
+	store.Set(common.IdlePolicyMaxIdleDaysKey, "7")
+	store.Set(common.IdlePolicyExcludedBranchesKey, "main, release/*")
+	policy, err = common.IdlePolicyFromConfig(*store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := common.IdlePolicy{MaxIdleDays: 7, ExcludedBranches: []string{"main", "release/*"}}
+	if !reflect.DeepEqual(policy, expected) {
+		t.Errorf("Expected %v, got %v", expected, policy)
+	}
+	if !policy.ExcludesBranch("release/1.0") || policy.ExcludesBranch("feature/foo") {
+		t.Errorf("Unexpected branch exclusion")
+	}
+
+	store.Set(common.IdlePolicyMaxIdleDaysKey, "week")
+	if _, err = common.IdlePolicyFromConfig(*store); err == nil {
+		t.Errorf("Expected error for invalid max idle days")
+	}
+}
+
+func TestReleaseIdleReport(t *testing.T) {
+	now := time.Date(2024, 3, 20, 12, 0, 0, 0, time.UTC)
+	release := func(name string, branch string, deployed time.Time) *helmRelease.Release {
+		return &helmRelease.Release{
+			Name:      name,
+			Namespace: "project",
+			Config:    map[string]interface{}{"silta-release": map[string]interface{}{"branchName": branch}},
+			Info:      &helmRelease.Info{LastDeployed: helmTime.Time{Time: deployed}},
+		}
+	}
+	deployment := func(name string, release string, replicas int32, conditions ...appsv1.DeploymentCondition) *appsv1.Deployment {
+		return &appsv1.Deployment{
+			ObjectMeta: v1.ObjectMeta{Name: name, Namespace: "project", Labels: map[string]string{"release": release}},
+			Spec:       appsv1.DeploymentSpec{Replicas: &replicas},
+			Status:     appsv1.DeploymentStatus{Conditions: conditions},
+		}
+	}
+	rollout := func(updated time.Time) appsv1.DeploymentCondition {
+		return appsv1.DeploymentCondition{Type: appsv1.DeploymentProgressing, Reason: "NewReplicaSetAvailable", LastUpdateTime: v1.NewTime(updated)}
+	}
+	started := func(pod *v1core.Pod, start time.Time) *v1core.Pod {
+		pod.Namespace = "project"
+		pod.Status.StartTime = &v1.Time{Time: start}
+		return pod
+	}
+	old := now.AddDate(0, 0, -30)
+	recent := now.Add(-time.Hour)
+
+	clientset := fake.NewClientset(
+		deployment("main-drupal", "main", 1, rollout(old)),
+		deployment("stale-drupal", "stale", 1, rollout(old)),
+		deployment("scaled-drupal", "scaled", 1, rollout(now.AddDate(0, 0, -2))),
+		deployment("sleeping-drupal", "sleeping", 0, rollout(old)),
+		&networkingv1.Ingress{ObjectMeta: v1.ObjectMeta{Name: "fresh", Namespace: "project", Labels: map[string]string{"release": "fresh"},
+			CreationTimestamp: v1.NewTime(now.AddDate(0, 0, -1))}},
+		// Crash looping deployment keeps updating conditions other than a finished rollout
+		deployment("flapping-drupal", "flapping", 1, rollout(old),
+			appsv1.DeploymentCondition{Type: appsv1.DeploymentAvailable, Reason: "MinimumReplicasUnavailable", LastUpdateTime: v1.NewTime(recent)},
+			appsv1.DeploymentCondition{Type: appsv1.DeploymentProgressing, Reason: "ReplicaSetUpdated", LastUpdateTime: v1.NewTime(recent)}),
+		started(testPod("restarted-drupal-abc", map[string]string{"app.kubernetes.io/instance": "restarted"}).build(), now.AddDate(0, 0, -1)),
+		started(testPod("cron-cron-123", map[string]string{"release": "cron", "cronjob": "true"}).build(), recent),
+	)
+
+	releases := []*helmRelease.Release{
+		release("stale", "feature/stale", old),
+		release("main", "main", old),
+		release("scaled", "feature/scaled", old),
+		release("sleeping", "feature/sleeping", old),
+		release("fresh", "feature/fresh", old),
+		release("recent", "feature/recent", now.AddDate(0, 0, -3)),
+		release("flapping", "feature/flapping", old),
+		release("restarted", "feature/restarted", old),
+		release("cron", "feature/cron", old),
+	}
+	policy := common.IdlePolicy{MaxIdleDays: 14, ExcludedBranches: []string{"main"}}
+
+	reports, err := common.ReleaseIdleReport(context.Background(), clientset, releases, policy, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Finished rollouts, pod starts and ingress changes count as activity
+	expected := map[string]string{
+		"cron":      common.ReleaseIdle,
+		"flapping":  common.ReleaseIdle,
+		"restarted": common.ReleaseActive,
+		"fresh":     common.ReleaseActive,
+		"main":      common.ReleaseExcluded,
+		"recent":    common.ReleaseActive,
+		"scaled":    common.ReleaseActive,
+		"sleeping":  common.ReleaseDownscaled,
+		"stale":     common.ReleaseIdle,
+	}
+	states := map[string]string{}
+	for _, r := range reports {
+		states[r.Release.Name] = r.State
+	}
+	if !reflect.DeepEqual(states, expected) {
+		t.Errorf("Expected %v, got %v", expected, states)
+	}
+
+	out := &bytes.Buffer{}
+	common.PrintIdleReport(out, reports[8:])
+	expectedTable := `NAMESPACE  RELEASE  BRANCH         LAST DEPLOYED     LAST ACTIVITY     IDLE DAYS  STATE
+project    stale    feature/stale  2024-02-19 12:00  2024-02-19 12:00  30         idle
+`
+	if out.String() != expectedTable {
+		t.Errorf("Expected:\n%s\nReceived:\n%s", expectedTable, out.String())
+	}
+}
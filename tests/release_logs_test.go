@@ -0,0 +1,139 @@
+package cmd_test
+
+import (
+	"bytes"
+	"context"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wunderio/silta-cli/internal/common"
+	v1core "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestStreamReleaseLogs(t *testing.T) {
+	labels := map[string]string{"release": "test"}
+	waiting := testPod("test-drupal-new", labels).build()
+	waiting.Status.ContainerStatuses = []v1core.ContainerStatus{
+		{Name: "php", State: v1core.ContainerState{Waiting: &v1core.ContainerStateWaiting{Reason: "ContainerCreating"}}},
+	}
+	clientset := fake.NewClientset(
+		testPod("test-drupal-abc", labels).running("php", "nginx").build(),
+		testPod("test-shell-def", labels).running("shell").build(),
+		testPod("test-cron-drupal-123", map[string]string{"release": "test", "cronjob": "true"}).running("php").build(),
+		testPod("test-2-drupal-abc", map[string]string{"release": "test-2"}).running("php").build(),
+		waiting,
+	)
+
+	tests := []struct {
+		components []string
+		grep       string
+		expected   string
+	}{
+		{nil, "", "[test-cron-drupal-123/php] fake logs\n[test-drupal-abc/php] fake logs\n[test-drupal-abc/nginx] fake logs\n[test-shell-def/shell] fake logs\n"},
+		{[]string{"php"}, "", "[test-drupal-abc/php] fake logs\n"},
+		{[]string{"nginx", "shell"}, "", "[test-drupal-abc/nginx] fake logs\n[test-shell-def/shell] fake logs\n"},
+		{[]string{"cron"}, "", "[test-cron-drupal-123/php] fake logs\n"},
+		{nil, "error", ""},
+	}
+	for _, test := range tests {
+		opts := common.ReleaseLogOptions{Components: test.components}
+		if test.grep != "" {
+			opts.Grep = regexp.MustCompile(test.grep)
+		}
+		out := &bytes.Buffer{}
+		err := common.StreamReleaseLogs(context.Background(), clientset, "default", "test", opts, out)
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		if out.String() != test.expected {
+			t.Errorf("Components %v, grep %q\nExpected:\n'%s'\nReceived:\n'%s'", test.components, test.grep, test.expected, out.String())
+		}
+	}
+
+	// Previous logs only exist for restarted containers
+	restarted := testPod("test-drupal-xyz", labels).running("php").build()
+	restarted.Status.ContainerStatuses[0].RestartCount = 1
+	clientset = fake.NewClientset(testPod("test-drupal-abc", labels).running("php").build(), restarted)
+	out := &bytes.Buffer{}
+	common.StreamReleaseLogs(context.Background(), clientset, "default", "test", common.ReleaseLogOptions{Previous: true}, out)
+	if out.String() != "[test-drupal-xyz/php] fake logs\n" {
+		t.Errorf("Unexpected previous logs: %s", out.String())
+	}
+
+	// Pods are listed with release label selectors, pods with both release labels are printed once
+	clientset = fake.NewClientset(
+		testPod("test-drupal-abc", map[string]string{"release": "test", "app.kubernetes.io/instance": "test"}).running("php").build(),
+		testPod("test-mariadb-0", map[string]string{"app.kubernetes.io/instance": "test"}).running("mariadb").build(),
+		testPod("other-drupal-abc", map[string]string{"release": "other"}).running("php").build(),
+	)
+	out = &bytes.Buffer{}
+	common.StreamReleaseLogs(context.Background(), clientset, "default", "test", common.ReleaseLogOptions{}, out)
+	if out.String() != "[test-drupal-abc/php] fake logs\n[test-mariadb-0/mariadb] fake logs\n" {
+		t.Errorf("Unexpected logs of labeled pods: %s", out.String())
+	}
+	for _, action := range clientset.Actions() {
+		if list, ok := action.(k8stesting.ListAction); ok && list.GetListRestrictions().Labels.Empty() {
+			t.Errorf("Pods listed without a label selector")
+		}
+	}
+
+	// Colored prefix
+	out = &bytes.Buffer{}
+	common.StreamReleaseLogs(context.Background(), clientset, "default", "test", common.ReleaseLogOptions{Color: true, Components: []string{"php"}}, out)
+	if !regexp.MustCompile(`^\x1b\[\d+m\[test-drupal-abc/php\]\x1b\[0m fake logs\n`).MatchString(out.String()) {
+		t.Errorf("Unexpected colored output: %q", out.String())
+	}
+}
+
+func TestFollowReleaseLogs(t *testing.T) {
+	labels := map[string]string{"release": "test"}
+	clientset := fake.NewClientset(testPod("test-drupal-abc", labels).running("php").build())
+
+	out := &bytes.Buffer{}
+	ctx, cancel := context.WithCancel(context.Background())
+	result := make(chan error, 1)
+	go func() {
+		result <- common.StreamReleaseLogs(ctx, clientset, "default", "test", common.ReleaseLogOptions{Follow: true}, out)
+	}()
+
+	// Pod of a rollout, container starts later
+	time.Sleep(100 * time.Millisecond)
+	pod := testPod("test-drupal-def", labels).build()
+	pod.Status.ContainerStatuses = []v1core.ContainerStatus{
+		{Name: "php", State: v1core.ContainerState{Waiting: &v1core.ContainerStateWaiting{Reason: "ContainerCreating"}}},
+	}
+	clientset.CoreV1().Pods("default").Create(context.TODO(), pod, v1.CreateOptions{})
+	time.Sleep(100 * time.Millisecond)
+	pod.Status.ContainerStatuses[0].State = v1core.ContainerState{Running: &v1core.ContainerStateRunning{}}
+	clientset.CoreV1().Pods("default").UpdateStatus(context.TODO(), pod, v1.UpdateOptions{})
+	time.Sleep(100 * time.Millisecond)
+	// Pods labeled with the other release label, or with both, are streamed once. Other releases are left out.
+	clientset.CoreV1().Pods("default").Create(context.TODO(), testPod("test-mariadb-0", map[string]string{"app.kubernetes.io/instance": "test"}).running("mariadb").build(), v1.CreateOptions{})
+	clientset.CoreV1().Pods("default").Create(context.TODO(), testPod("test-varnish-abc", map[string]string{"release": "test", "app.kubernetes.io/instance": "test"}).running("varnish").build(), v1.CreateOptions{})
+	clientset.CoreV1().Pods("default").Create(context.TODO(), testPod("other-drupal-abc", map[string]string{"release": "other"}).running("php").build(), v1.CreateOptions{})
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+
+	if err := <-result; err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	sort.Strings(lines)
+	expected := "[test-drupal-abc/php] fake logs\n[test-drupal-def/php] fake logs\n[test-mariadb-0/mariadb] fake logs\n[test-varnish-abc/varnish] fake logs"
+	if strings.Join(lines, "\n") != expected {
+		t.Errorf("Expected:\n'%s'\nReceived:\n'%s'", expected, out.String())
+	}
+
+	// Pods are watched by release labels, not all pods of the namespace
+	for _, action := range clientset.Actions() {
+		if watch, ok := action.(k8stesting.WatchAction); ok && watch.GetWatchRestrictions().Labels.Empty() {
+			t.Errorf("Pods were watched without a label selector")
+		}
+	}
+}
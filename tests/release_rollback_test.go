@@ -0,0 +1,173 @@
+package cmd_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/wunderio/silta-cli/internal/common"
+	appsv1 "k8s.io/api/apps/v1"
+	v1core "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	helmAction "helm.sh/helm/v3/pkg/action"
+	helmChartutil "helm.sh/helm/v3/pkg/chartutil"
+	helmKubeFake "helm.sh/helm/v3/pkg/kube/fake"
+	helmRelease "helm.sh/helm/v3/pkg/release"
+	helmStorage "helm.sh/helm/v3/pkg/storage"
+	helmDriver "helm.sh/helm/v3/pkg/storage/driver"
+)
+
+func TestRollbackTargetRevision(t *testing.T) {
+	history := []*helmRelease.Release{
+		testRelease(1, "1.0.0", helmRelease.StatusSuperseded).build(),
+		testRelease(2, "1.0.1", helmRelease.StatusSuperseded).build(),
+		testRelease(3, "1.0.2", helmRelease.StatusFailed).build(),
+		testRelease(4, "1.0.3", helmRelease.StatusFailed).build(),
+	}
+
+	tests := []struct {
+		revision int
+		expected int
+		err      string
+	}{
+		{0, 2, ""},
+		{1, 1, ""},
+		{3, 3, ""},
+		{4, 0, "revision 4 is the current release revision"},
+		{5, 0, "release has no revision 5"},
+	}
+	for _, test := range tests {
+		revision, err := common.RollbackTargetRevision(history, test.revision)
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("Revision %d: expected error %q, received %v", test.revision, test.err, err)
+			}
+			continue
+		}
+		if err != nil || revision != test.expected {
+			t.Errorf("Revision %d: expected %d, received %d (%v)", test.revision, test.expected, revision, err)
+		}
+	}
+
+	_, err := common.RollbackTargetRevision(history[2:], 0)
+	if err == nil || err.Error() != "release has no successful revisions before revision 4" {
+		t.Errorf("Expected no successful revisions error, received %v", err)
+	}
+}
+
+func TestRollbackHelmRelease(t *testing.T) {
+	actionConfig := &helmAction.Configuration{
+		Releases:     helmStorage.Init(helmDriver.NewMemory()),
+		KubeClient:   &helmKubeFake.PrintingKubeClient{Out: io.Discard},
+		Capabilities: helmChartutil.DefaultCapabilities,
+		Log:          common.HelmQuietLog,
+	}
+	for _, r := range []*helmRelease.Release{
+		testRelease(1, "1.0.0", helmRelease.StatusSuperseded).build(),
+		testRelease(2, "1.0.1", helmRelease.StatusFailed).build(),
+		testRelease(3, "1.0.2", helmRelease.StatusFailed).build(),
+	} {
+		actionConfig.Releases.Create(r)
+	}
+
+	release, err := common.RollbackHelmRelease(context.TODO(), actionConfig, common.HelmReleaseRollback{ReleaseName: "test"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if release.Version != 4 || release.Info.Status != helmRelease.StatusDeployed {
+		t.Errorf("Expected deployed revision 4, received revision %d (%s)", release.Version, release.Info.Status)
+	}
+	if release.Chart.Metadata.Version != "1.0.0" || release.Info.Notes != "Notes for 1.0.0" {
+		t.Errorf("Expected rollback to chart 1.0.0, received %s", release.Chart.Metadata.Version)
+	}
+}
+
+func TestRollbackFromCrashLoopingRevision(t *testing.T) {
+	actionConfig := &helmAction.Configuration{
+		Releases:     helmStorage.Init(helmDriver.NewMemory()),
+		KubeClient:   &helmKubeFake.PrintingKubeClient{Out: io.Discard},
+		Capabilities: helmChartutil.DefaultCapabilities,
+		Log:          common.HelmQuietLog,
+	}
+	actionConfig.Releases.Create(testRelease(1, "1.0.0", helmRelease.StatusSuperseded).build())
+	actionConfig.Releases.Create(testRelease(2, "1.0.1", helmRelease.StatusDeployed).build())
+
+	// Pods of the current revision are crash-looping, deployment is rolled back to the previous revision
+	replicas := int32(1)
+	deployment := &appsv1.Deployment{
+		ObjectMeta: v1.ObjectMeta{Name: "test-nginx", Namespace: "default", Labels: map[string]string{"release": "test"}, Generation: 3},
+		Spec:       appsv1.DeploymentSpec{Replicas: &replicas},
+		Status:     appsv1.DeploymentStatus{ObservedGeneration: 3, Replicas: 2, UpdatedReplicas: 1, AvailableReplicas: 0},
+	}
+	crashing := testPod("test-nginx-crashing", map[string]string{"release": "test"}).
+		container("main", v1core.ContainerState{Waiting: &v1core.ContainerStateWaiting{Reason: "CrashLoopBackOff"}}).build()
+	clientset := fake.NewClientset(deployment, crashing)
+
+	existing, err := common.ListExistingPods(context.TODO(), clientset, "default", "test")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	_, err = common.RollbackHelmRelease(context.TODO(), actionConfig, common.HelmReleaseRollback{ReleaseName: "test"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	result := make(chan error, 1)
+	go func() {
+		result <- common.WaitForReleaseRollout(clientset, "default", "test", existing, 5*time.Second, &bytes.Buffer{})
+	}()
+	time.Sleep(100 * time.Millisecond)
+	rolledBack := deployment.DeepCopy()
+	rolledBack.Status = appsv1.DeploymentStatus{ObservedGeneration: 3, Replicas: 1, UpdatedReplicas: 1, AvailableReplicas: 1}
+	clientset.AppsV1().Deployments("default").UpdateStatus(context.TODO(), rolledBack, v1.UpdateOptions{})
+	clientset.CoreV1().Pods("default").Delete(context.TODO(), "test-nginx-crashing", v1.DeleteOptions{})
+	if err := <-result; err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+}
+
+func TestRunReleaseRollbackCrashLoopingPod(t *testing.T) {
+	// Helm waits for resources longer than the test runs
+	actionConfig := &helmAction.Configuration{
+		Releases:     helmStorage.Init(helmDriver.NewMemory()),
+		KubeClient:   &helmKubeFake.FailingKubeClient{PrintingKubeClient: helmKubeFake.PrintingKubeClient{Out: io.Discard}, WaitDuration: time.Minute},
+		Capabilities: helmChartutil.DefaultCapabilities,
+		Log:          common.HelmQuietLog,
+	}
+	actionConfig.Releases.Create(testRelease(1, "1.0.0", helmRelease.StatusSuperseded).build())
+	actionConfig.Releases.Create(testRelease(2, "1.0.1", helmRelease.StatusDeployed).build())
+	clientset := fake.NewClientset()
+
+	// Pod created by the rollback is crash-looping. API server clock is behind, pod creation time doesn't matter.
+	existing, err := common.ListExistingPods(context.TODO(), clientset, "default", "test")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	started := time.Now()
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		crashing := testPod("test-nginx-crashing", map[string]string{"release": "test"}).
+			container("main", v1core.ContainerState{Waiting: &v1core.ContainerStateWaiting{Reason: "CrashLoopBackOff"}}).build()
+		crashing.CreationTimestamp = v1.NewTime(time.Now().Add(-time.Hour))
+		clientset.CoreV1().Pods("default").Create(context.TODO(), crashing, v1.CreateOptions{})
+	}()
+
+	rollback := common.HelmReleaseRollback{ReleaseName: "test", Timeout: time.Minute, Wait: true}
+	_, err = common.RunReleaseRollback(context.TODO(), clientset, actionConfig, "default", rollback, existing, io.Discard)
+	var podFailure *common.PodFailureError
+	if !errors.As(err, &podFailure) || podFailure.Pod != "test-nginx-crashing" || podFailure.Reason != "CrashLoopBackOff" {
+		t.Fatalf("Expected pod failure, received %v", err)
+	}
+	if time.Since(started) > 10*time.Second {
+		t.Errorf("Rollback did not fail right away")
+	}
+	last, _ := actionConfig.Releases.Last("test")
+	if last.Version != 3 || last.Info.Status != helmRelease.StatusFailed {
+		t.Errorf("Expected failed revision 3, received revision %d (%s)", last.Version, last.Info.Status)
+	}
+}
@@ -0,0 +1,205 @@
+package cmd_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/wunderio/silta-cli/internal/common"
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestReleaseWorkloads(t *testing.T) {
+	labels := map[string]string{"release": "test"}
+	clientset := fake.NewClientset(
+		testDeployment("test-drupal", labels).replicas(2).containers("php", "nginx").build(),
+		testDeployment("test-shell", map[string]string{"app.kubernetes.io/instance": "test"}).replicas(1).containers("shell").build(),
+		testDeployment("test-2-drupal", map[string]string{"release": "test-2"}).replicas(1).containers("php").build(),
+		&appsv1.StatefulSet{ObjectMeta: v1.ObjectMeta{Name: "test-mariadb", Namespace: "default", Labels: labels}},
+	)
+	ctx := context.Background()
+
+	tests := map[string][]string{
+		"":        {"deployment/test-drupal", "deployment/test-shell", "statefulset/test-mariadb"},
+		"php":     {"deployment/test-drupal"},
+		"drupal":  {"deployment/test-drupal"},
+		"shell":   {"deployment/test-shell"},
+		"mariadb": {"statefulset/test-mariadb"},
+	}
+	for component, expected := range tests {
+		workloads, err := common.ReleaseWorkloads(ctx, clientset, "default", "test", component)
+		if err != nil {
+			t.Fatalf("Component %q: unexpected error: %s", component, err)
+		}
+		names := []string{}
+		for _, workload := range workloads {
+			switch r := workload.(type) {
+			case *appsv1.Deployment:
+				names = append(names, "deployment/"+r.Name)
+			case *appsv1.StatefulSet:
+				names = append(names, "statefulset/"+r.Name)
+			}
+		}
+		if len(names) != len(expected) {
+			t.Errorf("Component %q: expected %v, received %v", component, expected, names)
+			continue
+		}
+		for i := range names {
+			if names[i] != expected[i] {
+				t.Errorf("Component %q: expected %v, received %v", component, expected, names)
+			}
+		}
+	}
+
+	_, err := common.ReleaseWorkloads(ctx, clientset, "default", "test", "varnish")
+	if err == nil || err.Error() != "no deployments or statefulsets found for component varnish of release test" {
+		t.Errorf("Expected missing component error, received: %v", err)
+	}
+}
+
+func TestRestartReleaseWorkloads(t *testing.T) {
+	labels := map[string]string{"release": "test"}
+	clientset := fake.NewClientset(
+		testDeployment("test-drupal", labels).replicas(2).containers("php", "nginx").build(),
+		&appsv1.StatefulSet{ObjectMeta: v1.ObjectMeta{Name: "test-mariadb", Namespace: "default", Labels: labels}},
+	)
+	ctx := context.Background()
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	workloads, _ := common.ReleaseWorkloads(ctx, clientset, "default", "test", "")
+	out := &bytes.Buffer{}
+	if err := common.RestartReleaseWorkloads(ctx, clientset, workloads, now, out); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if out.String() != "Restarting deployment test-drupal\nRestarting statefulset test-mariadb\n" {
+		t.Errorf("Unexpected output: %s", out.String())
+	}
+
+	deployment, _ := clientset.AppsV1().Deployments("default").Get(ctx, "test-drupal", v1.GetOptions{})
+	if deployment.Spec.Template.Annotations[common.RestartedAtAnnotation] != "2024-05-01T12:00:00Z" {
+		t.Errorf("Deployment restart annotation not set: %v", deployment.Spec.Template.Annotations)
+	}
+	if len(deployment.Spec.Template.Spec.Containers) != 2 {
+		t.Errorf("Deployment pod template changed: %v", deployment.Spec.Template.Spec.Containers)
+	}
+	statefulset, _ := clientset.AppsV1().StatefulSets("default").Get(ctx, "test-mariadb", v1.GetOptions{})
+	if statefulset.Spec.Template.Annotations[common.RestartedAtAnnotation] != "2024-05-01T12:00:00Z" {
+		t.Errorf("Statefulset restart annotation not set: %v", statefulset.Spec.Template.Annotations)
+	}
+}
+
+func TestScaleReleaseWorkloads(t *testing.T) {
+	labels := map[string]string{"release": "test"}
+	clientset := fake.NewClientset(
+		testDeployment("test-drupal", labels).replicas(2).containers("php", "nginx").build(),
+		testDeployment("test-shell", labels).replicas(1).containers("shell").build(),
+	)
+	ctx := context.Background()
+
+	replicas := func() int32 {
+		deployment, _ := clientset.AppsV1().Deployments("default").Get(ctx, "test-drupal", v1.GetOptions{})
+		return *deployment.Spec.Replicas
+	}
+
+	// Original replica count is kept over repeated scaling
+	for _, target := range []int32{5, 3} {
+		workloads, _ := common.ReleaseWorkloads(ctx, clientset, "default", "test", "php")
+		out := &bytes.Buffer{}
+		scaled, err := common.ScaleReleaseWorkloads(ctx, clientset, workloads, &target, out)
+		if err != nil || len(scaled) != 1 {
+			t.Fatalf("Unexpected scale result: %v, %v", scaled, err)
+		}
+		if replicas() != target {
+			t.Errorf("Expected %d replicas, received %d", target, replicas())
+		}
+	}
+	deployment, _ := clientset.AppsV1().Deployments("default").Get(ctx, "test-drupal", v1.GetOptions{})
+	if deployment.Annotations[common.ScaleOriginalReplicasAnnotation] != "2" {
+		t.Errorf("Unexpected original replicas annotation: %v", deployment.Annotations)
+	}
+
+	// Only scaled workloads are reverted
+	workloads, _ := common.ReleaseWorkloads(ctx, clientset, "default", "test", "")
+	out := &bytes.Buffer{}
+	scaled, err := common.ScaleReleaseWorkloads(ctx, clientset, workloads, nil, out)
+	if err != nil || len(scaled) != 1 {
+		t.Fatalf("Unexpected revert result: %v, %v", scaled, err)
+	}
+	if out.String() != "Scaling deployment test-drupal to 2 replica(s)\n" {
+		t.Errorf("Unexpected output: %s", out.String())
+	}
+	deployment, _ = clientset.AppsV1().Deployments("default").Get(ctx, "test-drupal", v1.GetOptions{})
+	if *deployment.Spec.Replicas != 2 || deployment.Annotations[common.ScaleOriginalReplicasAnnotation] != "" {
+		t.Errorf("Deployment not reverted: %d, %v", *deployment.Spec.Replicas, deployment.Annotations)
+	}
+}
+
+func TestScaleReleaseWorkloadsChangedReplicas(t *testing.T) {
+	labels := map[string]string{"release": "test"}
+	clientset := fake.NewClientset(testDeployment("test-drupal", labels).replicas(2).containers("php").build())
+	ctx := context.Background()
+
+	target := int32(5)
+	workloads, _ := common.ReleaseWorkloads(ctx, clientset, "default", "test", "php")
+	if _, err := common.ScaleReleaseWorkloads(ctx, clientset, workloads, &target, &bytes.Buffer{}); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	// Release is deployed with a new replica count, annotations are kept by helm
+	deployment, _ := clientset.AppsV1().Deployments("default").Get(ctx, "test-drupal", v1.GetOptions{})
+	deployed := int32(3)
+	deployment.Spec.Replicas = &deployed
+	clientset.AppsV1().Deployments("default").Update(ctx, deployment, v1.UpdateOptions{})
+
+	// Revert doesn't restore the stale replica count
+	workloads, _ = common.ReleaseWorkloads(ctx, clientset, "default", "test", "php")
+	out := &bytes.Buffer{}
+	scaled, err := common.ScaleReleaseWorkloads(ctx, clientset, workloads, nil, out)
+	if err != nil || len(scaled) != 0 {
+		t.Fatalf("Unexpected revert result: %v, %v", scaled, err)
+	}
+	if out.String() != "Replica count of deployment/test-drupal was changed after it was scaled, original replica count was discarded\n" {
+		t.Errorf("Unexpected output: %s", out.String())
+	}
+	deployment, _ = clientset.AppsV1().Deployments("default").Get(ctx, "test-drupal", v1.GetOptions{})
+	if *deployment.Spec.Replicas != 3 || deployment.Annotations[common.ScaleOriginalReplicasAnnotation] != "" {
+		t.Errorf("Deployment reverted to a stale replica count: %d, %v", *deployment.Spec.Replicas, deployment.Annotations)
+	}
+
+	// Scaling again stores the deployed replica count
+	workloads, _ = common.ReleaseWorkloads(ctx, clientset, "default", "test", "php")
+	common.ScaleReleaseWorkloads(ctx, clientset, workloads, &target, &bytes.Buffer{})
+	deployment, _ = clientset.AppsV1().Deployments("default").Get(ctx, "test-drupal", v1.GetOptions{})
+	if deployment.Annotations[common.ScaleOriginalReplicasAnnotation] != "3" {
+		t.Errorf("Unexpected original replicas annotation: %v", deployment.Annotations)
+	}
+}
+
+func TestScaleReleaseWorkloadsAutoscaler(t *testing.T) {
+	labels := map[string]string{"release": "test"}
+	clientset := fake.NewClientset(
+		testDeployment("test-drupal", labels).replicas(2).containers("php").build(),
+		&autoscalingv1.HorizontalPodAutoscaler{
+			ObjectMeta: v1.ObjectMeta{Name: "test-drupal", Namespace: "default"},
+			Spec: autoscalingv1.HorizontalPodAutoscalerSpec{
+				ScaleTargetRef: autoscalingv1.CrossVersionObjectReference{Kind: "Deployment", Name: "test-drupal", APIVersion: "apps/v1"},
+			},
+		},
+	)
+	ctx := context.Background()
+
+	target := int32(5)
+	workloads, _ := common.ReleaseWorkloads(ctx, clientset, "default", "test", "php")
+	_, err := common.ScaleReleaseWorkloads(ctx, clientset, workloads, &target, &bytes.Buffer{})
+	if err == nil || err.Error() != "deployment/test-drupal is scaled by horizontal pod autoscaler test-drupal" {
+		t.Errorf("Expected autoscaler error, received %v", err)
+	}
+	deployment, _ := clientset.AppsV1().Deployments("default").Get(ctx, "test-drupal", v1.GetOptions{})
+	if *deployment.Spec.Replicas != 2 {
+		t.Errorf("Deployment scaled despite autoscaler: %d", *deployment.Spec.Replicas)
+	}
+}
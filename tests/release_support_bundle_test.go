@@ -0,0 +1,229 @@
+package cmd_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wunderio/silta-cli/internal/common"
+	helmChart "helm.sh/helm/v3/pkg/chart"
+	helmRelease "helm.sh/helm/v3/pkg/release"
+	helmTime "helm.sh/helm/v3/pkg/time"
+	v1apps "k8s.io/api/apps/v1"
+	v1core "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestRedactValues(t *testing.T) {
+	values := map[string]interface{}{
+		"php": map[string]interface{}{
+			"image":    "php:8",
+			"replicas": 1,
+			"env":      map[string]interface{}{"API_TOKEN": "abc", "APP_ENV": "test"},
+		},
+		"mariadb":         map[string]interface{}{"auth": map[string]interface{}{"rootPassword": "root"}},
+		"imagePullSecret": "c2VjcmV0",
+		"secrets":         map[string]interface{}{"mailer": map[string]interface{}{"dsn": "smtp://x"}},
+	}
+	expected := map[string]interface{}{
+		"php": map[string]interface{}{
+			"image":    "php:8",
+			"replicas": 1,
+			"env":      map[string]interface{}{"API_TOKEN": "(redacted)", "APP_ENV": "test"},
+		},
+		"mariadb":         map[string]interface{}{"auth": map[string]interface{}{"rootPassword": "(redacted)"}},
+		"imagePullSecret": "(redacted)",
+		"secrets":         map[string]interface{}{"mailer": map[string]interface{}{"dsn": "(redacted)"}},
+	}
+	if redacted := common.RedactValues(values); !reflect.DeepEqual(redacted, expected) {
+		t.Errorf("Unexpected redacted values: %v", redacted)
+	}
+}
+
+func TestSupportBundle(t *testing.T) {
+	ctx := context.Background()
+	labels := map[string]string{"release": "test"}
+	created := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	release := &helmRelease.Release{
+		Name:      "test",
+		Namespace: "default",
+		Version:   3,
+		Info:      &helmRelease.Info{Status: helmRelease.StatusFailed, LastDeployed: helmTime.Time{Time: created}},
+		Chart:     &helmChart.Chart{Metadata: &helmChart.Metadata{Name: "drupal", Version: "1.0.0"}},
+		Config:    map[string]interface{}{"mariadb": map[string]interface{}{"rootPassword": "root"}},
+		Manifest: `---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: test-secrets
+stringData:
+  password: hunter2
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: test-config
+data:
+  setting: value
+  SMTP_PASSWORD: mailer-password
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: test-drupal
+spec:
+  template:
+    spec:
+      containers:
+      - name: php
+        env:
+        - name: DB_PASS
+          value: db-password
+        - name: APP_ENV
+          value: production
+`,
+	}
+
+	clientset := fake.NewClientset(
+		&v1core.Pod{
+			ObjectMeta: v1.ObjectMeta{Name: "test-php", Namespace: "default", Labels: labels},
+			Status: v1core.PodStatus{ContainerStatuses: []v1core.ContainerStatus{
+				{Name: "php", RestartCount: 2, State: v1core.ContainerState{Waiting: &v1core.ContainerStateWaiting{Reason: "CrashLoopBackOff"}}},
+				{Name: "nginx", Ready: true, State: v1core.ContainerState{Running: &v1core.ContainerStateRunning{}}},
+			}},
+		},
+		&v1apps.Deployment{
+			ObjectMeta: v1.ObjectMeta{Name: "test-drupal", Namespace: "default", Labels: labels},
+			Spec: v1apps.DeploymentSpec{Template: v1core.PodTemplateSpec{Spec: v1core.PodSpec{
+				InitContainers: []v1core.Container{{Name: "init", Env: []v1core.EnvVar{{Name: "GITAUTH_PASSWORD", Value: "init-password"}}}},
+				Containers: []v1core.Container{{Name: "php", Env: []v1core.EnvVar{
+					{Name: "DB_PASS", Value: "db-password"},
+					{Name: "APP_ENV", Value: "production"},
+				}}},
+			}}},
+		},
+		&v1core.ConfigMap{
+			ObjectMeta: v1.ObjectMeta{Name: "test-config", Namespace: "default", Labels: labels},
+			Data:       map[string]string{"setting": "value", "SMTP_PASSWORD": "mailer-password"},
+		},
+		&v1core.Secret{
+			ObjectMeta: v1.ObjectMeta{Name: "test-secrets", Namespace: "default", Labels: labels},
+			Data:       map[string][]byte{"password": []byte("hunter2")},
+		},
+		&v1core.Event{
+			ObjectMeta:     v1.ObjectMeta{Name: "test-php.1", Namespace: "default"},
+			InvolvedObject: v1core.ObjectReference{Kind: "Pod", Name: "test-php"},
+			Type:           "Warning", Reason: "BackOff", Message: "Back-off restarting failed container",
+			LastTimestamp: v1.Time{Time: created},
+		},
+		&v1core.Event{
+			ObjectMeta:     v1.ObjectMeta{Name: "other.1", Namespace: "default"},
+			InvolvedObject: v1core.ObjectReference{Kind: "Pod", Name: "other"},
+			Type:           "Warning", Reason: "BackOff", Message: "Not part of release",
+		},
+	)
+
+	bundle := common.CollectSupportBundle(ctx, clientset, "default", "test", release, created)
+	archive := &bytes.Buffer{}
+	if err := bundle.WriteArchive(archive); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	// Read the archive back
+	files := map[string]string{}
+	gz, err := gzip.NewReader(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader := tar.NewReader(gz)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, _ := io.ReadAll(reader)
+		files[header.Name] = string(content)
+	}
+
+	names := []string{}
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	expected := []string{
+		"test-support-bundle/debug-failed.json",
+		"test-support-bundle/debug-failed.md",
+		"test-support-bundle/events.txt",
+		"test-support-bundle/helm/manifest.yaml",
+		"test-support-bundle/helm/values.yaml",
+		"test-support-bundle/index.json",
+		"test-support-bundle/logs/test-php/nginx.log",
+		"test-support-bundle/logs/test-php/php.log",
+		"test-support-bundle/logs/test-php/php.previous.log",
+		"test-support-bundle/resources/configmap/test-config.yaml",
+		"test-support-bundle/resources/deployment/test-drupal.yaml",
+		"test-support-bundle/resources/pod/test-php.yaml",
+		"test-support-bundle/resources/secret/test-secrets.yaml",
+	}
+	if !reflect.DeepEqual(names, expected) {
+		t.Fatalf("Unexpected bundle files:\n%s", strings.Join(names, "\n"))
+	}
+
+	index := common.SupportBundleIndex{}
+	if err := json.Unmarshal([]byte(files["test-support-bundle/index.json"]), &index); err != nil {
+		t.Fatalf("Invalid index: %s", err)
+	}
+	if index.Chart != "drupal-1.0.0" || index.Revision != 3 || index.Status != "failed" || len(index.Files) != 12 {
+		t.Errorf("Unexpected index: %+v", index)
+	}
+
+	for _, name := range []string{"helm/manifest.yaml", "helm/values.yaml", "resources/secret/test-secrets.yaml"} {
+		content := files["test-support-bundle/"+name]
+		if strings.Contains(content, "hunter2") || strings.Contains(content, "aHVudGVyMg") || strings.Contains(content, "root\n") {
+			t.Errorf("Secret values not redacted in %s:\n%s", name, content)
+		}
+		if !strings.Contains(content, "(redacted)") {
+			t.Errorf("Redacted values missing in %s:\n%s", name, content)
+		}
+	}
+	if !strings.Contains(files["test-support-bundle/helm/manifest.yaml"], "setting: value") {
+		t.Errorf("ConfigMap missing from manifest")
+	}
+
+	// Sensitive ConfigMap values and container environment values
+	for _, name := range []string{"helm/manifest.yaml", "resources/configmap/test-config.yaml", "resources/deployment/test-drupal.yaml"} {
+		content := files["test-support-bundle/"+name]
+		for _, value := range []string{"mailer-password", "db-password", "init-password"} {
+			if strings.Contains(content, value) {
+				t.Errorf("Sensitive value %s not redacted in %s:\n%s", value, name, content)
+			}
+		}
+		if !strings.Contains(content, "(redacted)") {
+			t.Errorf("Redacted values missing in %s:\n%s", name, content)
+		}
+	}
+	if !strings.Contains(files["test-support-bundle/resources/deployment/test-drupal.yaml"], "value: production") {
+		t.Errorf("Non-sensitive environment value missing:\n%s", files["test-support-bundle/resources/deployment/test-drupal.yaml"])
+	}
+	if !strings.Contains(files["test-support-bundle/resources/pod/test-php.yaml"], "kind: Pod") {
+		t.Errorf("Resource kind missing:\n%s", files["test-support-bundle/resources/pod/test-php.yaml"])
+	}
+
+	events := files["test-support-bundle/events.txt"]
+	if !strings.Contains(events, "2024-05-01T12:00:00Z Warning BackOff Pod/test-php: Back-off restarting failed container\n") || strings.Contains(events, "Not part of release") {
+		t.Errorf("Unexpected events:\n%s", events)
+	}
+}
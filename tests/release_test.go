@@ -143,68 +143,34 @@ func TestReleaseDeployCmd(t *testing.T) {
 		--debug`
 
 	environment = []string{}
-	testString = `
-			RELEASE_NAME='test'
-			CHART_NAME='drupal'
-			CHART_REPOSITORY='https://storage.googleapis.com/charts.wdr.io'
-			EXTRA_CHART_VERSION=''
-			SILTA_ENVIRONMENT_NAME=''
-			BRANCHNAME=''
-			PHP_IMAGE_URL='php-image'
-			NGINX_IMAGE_URL='nginx-image'
-			SHELL_IMAGE_URL='shell-image'
-			GIT_REPOSITORY_URL=''
-			GITAUTH_USERNAME=''
-			GITAUTH_PASSWORD=''
-			CLUSTER_DOMAIN=''
-			EXTRA_NOAUTHIPS=''
-			EXTRA_VPCNATIVE=''
-			EXTRA_CLUSTERTYPE=''
-			EXTRA_DB_ROOT_PASS=''
-			EXTRA_DB_USER_PASS=''
-			EXTRA_REFERENCE_DATA=''
-			NAMESPACE='default'
-			SILTA_CONFIG=''
-			EXTRA_HELM_FLAGS=''
-			DEPLOYMENT_TIMEOUT='15m'
-			DEPLOYMENT_TIMEOUT_SECONDS='900'
-
-			function deployment_failed() {
-				debug_failed_deployment
-				rm -f helm-output.log || true
-			}
-
-			function debug_failed_deployment() {
-				silta ci release debug-failed --release-name="${RELEASE_NAME}" --namespace="${NAMESPACE}"
-			}
-
-			trap deployment_failed ERR
-
-			helm upgrade --install "${RELEASE_NAME}" "${CHART_NAME}" \
-				--repo "${CHART_REPOSITORY}" \
-				${EXTRA_CHART_VERSION} \
-				--cleanup-on-fail \
-				--set environmentName="${SILTA_ENVIRONMENT_NAME}" \
-				--set silta-release.branchName="${BRANCHNAME}" \
-				--set php.image="${PHP_IMAGE_URL}" \
-				--set nginx.image="${NGINX_IMAGE_URL}" \
-				--set shell.image="${SHELL_IMAGE_URL}" \
-				--set shell.gitAuth.repositoryUrl="${GIT_REPOSITORY_URL}" \
-				--set shell.gitAuth.keyserver.username="${GITAUTH_USERNAME}" \
-				--set shell.gitAuth.keyserver.password="${GITAUTH_PASSWORD}" \
-				--set clusterDomain="${CLUSTER_DOMAIN}" \
-				${EXTRA_NOAUTHIPS} \
-				${EXTRA_VPCNATIVE} \
-				${EXTRA_CLUSTERTYPE} \
-				${EXTRA_DB_ROOT_PASS} \
-				${EXTRA_DB_USER_PASS} \
-				${EXTRA_REFERENCE_DATA} \
-				--namespace="${NAMESPACE}" \
-				--values "${SILTA_CONFIG}" \
-				${EXTRA_HELM_FLAGS} \
-				--wait \
-				--timeout "${DEPLOYMENT_TIMEOUT}" &> helm-output.log & pid=$!`
-	CliExecTest(t, command, environment, testString, false)
+	testString = `Deploying drupal helm release test in default namespace
+Helm release deployment (not executed):
+RELEASE_NAME: test
+NAMESPACE: default
+CHART_NAME: drupal
+CHART_REPOSITORY: https://storage.googleapis.com/charts.wdr.io
+CHART_VERSION: 
+VALUES_FILES: 
+HELM_FLAGS: 
+DEPLOYMENT_TIMEOUT: 15m0s
+VALUES:
+clusterDomain: ""
+environmentName: ""
+nginx:
+  image: nginx-image
+php:
+  image: php-image
+shell:
+  gitAuth:
+    keyserver:
+      password: ""
+      username: ""
+    repositoryUrl: ""
+  image: shell-image
+silta-release:
+  branchName: ""
+`
+	CliExecTest(t, command, environment, testString, true)
 
 	// Test all args (drupal chart)
 	command = `ci release deploy \
@@ -225,75 +191,49 @@ func TestReleaseDeployCmd(t *testing.T) {
 		--vpn-ip 14 \
 		--vpc-native 15 \
 		--cluster-type 16 \
-		--db-root-pass 17 \
+		--db-root-pass "17'quoted" \
 		--db-user-pass 18 \
 		--namespace 19 \
 		--silta-config 20 \
-		--helm-flags 21 \
+		--helm-flags "--set 21='foo bar'" \
 		--deployment-timeout 22m \
 		--debug`
 	environment = []string{}
-	testString = `
-			RELEASE_NAME='1'
-			CHART_NAME='drupal'
-			CHART_REPOSITORY='3'
-			EXTRA_CHART_VERSION='--version '4''
-			SILTA_ENVIRONMENT_NAME='5'
-			BRANCHNAME='6'
-			PHP_IMAGE_URL='7'
-			NGINX_IMAGE_URL='8'
-			SHELL_IMAGE_URL='9'
-			GIT_REPOSITORY_URL='10'
-			GITAUTH_USERNAME='11'
-			GITAUTH_PASSWORD='12'
-			CLUSTER_DOMAIN='13'
-			EXTRA_NOAUTHIPS='--set nginx.noauthips.vpn='14/32''
-			EXTRA_VPCNATIVE='--set cluster.vpcNative='15''
-			EXTRA_CLUSTERTYPE='--set cluster.type='16''
-			EXTRA_DB_ROOT_PASS='--set mariadb.rootUser.password='17''
-			EXTRA_DB_USER_PASS='--set mariadb.db.password='18''
-			EXTRA_REFERENCE_DATA=''
-			NAMESPACE='19'
-			SILTA_CONFIG='20'
-			EXTRA_HELM_FLAGS='21'
-			DEPLOYMENT_TIMEOUT='22m'
-			DEPLOYMENT_TIMEOUT_SECONDS='1320'
-
-			function deployment_failed() {
-				debug_failed_deployment
-				rm -f helm-output.log || true
-			}
-
-			function debug_failed_deployment() {
-				silta ci release debug-failed --release-name="${RELEASE_NAME}" --namespace="${NAMESPACE}"
-			}
-
-			trap deployment_failed ERR
-
-			helm upgrade --install "${RELEASE_NAME}" "${CHART_NAME}" \
-				--repo "${CHART_REPOSITORY}" \
-				${EXTRA_CHART_VERSION} \
-				--cleanup-on-fail \
-				--set environmentName="${SILTA_ENVIRONMENT_NAME}" \
-				--set silta-release.branchName="${BRANCHNAME}" \
-				--set php.image="${PHP_IMAGE_URL}" \
-				--set nginx.image="${NGINX_IMAGE_URL}" \
-				--set shell.image="${SHELL_IMAGE_URL}" \
-				--set shell.gitAuth.repositoryUrl="${GIT_REPOSITORY_URL}" \
-				--set shell.gitAuth.keyserver.username="${GITAUTH_USERNAME}" \
-				--set shell.gitAuth.keyserver.password="${GITAUTH_PASSWORD}" \
-				--set clusterDomain="${CLUSTER_DOMAIN}" \
-				${EXTRA_NOAUTHIPS} \
-				${EXTRA_VPCNATIVE} \
-				${EXTRA_CLUSTERTYPE} \
-				${EXTRA_DB_ROOT_PASS} \
-				${EXTRA_DB_USER_PASS} \
-				${EXTRA_REFERENCE_DATA} \
-				--namespace="${NAMESPACE}" \
-				--values "${SILTA_CONFIG}" \
-				${EXTRA_HELM_FLAGS} \
-				--wait \
-				--timeout "${DEPLOYMENT_TIMEOUT}" &> helm-output.log & pid=$!`
+	testString = `RELEASE_NAME: 1
+NAMESPACE: 19
+CHART_NAME: drupal
+CHART_REPOSITORY: 3
+CHART_VERSION: 4
+VALUES_FILES: 20
+HELM_FLAGS: --set 21='foo bar'
+DEPLOYMENT_TIMEOUT: 22m0s
+VALUES:
+cluster:
+  type: "16"
+  vpcNative: "15"
+clusterDomain: "13"
+environmentName: "5"
+mariadb:
+  db:
+    password: "18"
+  rootUser:
+    password: 17'quoted
+nginx:
+  image: "8"
+  noauthips:
+    vpn: 14/32
+php:
+  image: "7"
+shell:
+  gitAuth:
+    keyserver:
+      password: "12"
+      username: "11"
+    repositoryUrl: "10"
+  image: "9"
+silta-release:
+  branchName: "6"
+`
 	CliExecTest(t, command, environment, testString, false)
 
 	// Test all args (simple chart)
@@ -313,135 +253,800 @@ func TestReleaseDeployCmd(t *testing.T) {
 		--gitauth-password 12 \
 		--cluster-domain 13 \
 		--vpn-ip 14 \
-		--vpc-native 15 \
+		--vpc-native true \
 		--cluster-type 16 \
 		--db-root-pass 17 \
 		--db-user-pass 18 \
 		--namespace 19 \
-		--silta-config 20 \
+		--silta-config 20,21 \
 		--deployment-timeout 21m \
-		--helm-flags 22 \
+		--helm-flags "--values 22" \
 		--debug`
 	environment = []string{}
-	testString = `
-			RELEASE_NAME='1'
-			CHART_NAME='simple'
-			CHART_REPOSITORY='3'
-			EXTRA_CHART_VERSION='--version '4''
-			SILTA_ENVIRONMENT_NAME='5'
-			BRANCHNAME='6'
-			NGINX_IMAGE_URL='8'
-			CLUSTER_DOMAIN='13'
-			EXTRA_NOAUTHIPS='--set nginx.noauthips.vpn='14/32''
-			EXTRA_VPCNATIVE='--set cluster.vpcNative='15''
-			EXTRA_CLUSTERTYPE='--set cluster.type='16''
-			NAMESPACE='19'
-			SILTA_CONFIG='20'
-			EXTRA_HELM_FLAGS='22'
-			DEPLOYMENT_TIMEOUT='21m'
-
-			function deployment_failed() {
-				debug_failed_deployment
-				rm -f helm-output.log || true
-			}
-
-			function debug_failed_deployment() {
-				silta ci release debug-failed --release-name="${RELEASE_NAME}" --namespace="${NAMESPACE}"
-			}
-
-			trap deployment_failed ERR
-
-			helm upgrade --install "${RELEASE_NAME}" "${CHART_NAME}" \
-				--repo "${CHART_REPOSITORY}" \
-				${EXTRA_CHART_VERSION} \
-				--cleanup-on-fail \
-				--set environmentName="${SILTA_ENVIRONMENT_NAME}" \
-				--set silta-release.branchName="${BRANCHNAME}" \
-				--set nginx.image="${NGINX_IMAGE_URL}" \
-				--set clusterDomain="${CLUSTER_DOMAIN}" \
-				${EXTRA_NOAUTHIPS} \
-				${EXTRA_VPCNATIVE} \
-				${EXTRA_CLUSTERTYPE} \
-				--namespace="${NAMESPACE}" \
-				--values "${SILTA_CONFIG}" \
-				${EXTRA_HELM_FLAGS} \
-				--timeout "${DEPLOYMENT_TIMEOUT}" \
-				--wait`
+	testString = `RELEASE_NAME: 1
+NAMESPACE: 19
+CHART_NAME: simple
+CHART_REPOSITORY: 3
+CHART_VERSION: 4
+VALUES_FILES: 20,21
+HELM_FLAGS: --values 22
+DEPLOYMENT_TIMEOUT: 21m0s
+VALUES:
+cluster:
+  type: "16"
+  vpcNative: true
+clusterDomain: "13"
+environmentName: "5"
+nginx:
+  image: "8"
+  noauthips:
+    vpn: 14/32
+silta-release:
+  branchName: "6"
+`
 	CliExecTest(t, command, environment, testString, false)
 
-	// Test all args (simple chart)
+	// Invalid deployment timeout falls back to default
 	command = `ci release deploy \
 		--release-name 1 \
-		--release-suffix 2 \
 		--chart-name simple \
-		--chart-repository 3 \
-		--chart-version 4 \
-		--silta-environment-name 5 \
-		--branchname 6 \
-		--php-image-url 7 \
 		--nginx-image-url 8 \
-		--shell-image-url 9 \
+		--namespace 19 \
+		--deployment-timeout 21 \
+		--debug`
+	environment = []string{}
+	testString = `DEPLOYMENT_TIMEOUT: 15m0s`
+	CliExecTest(t, command, environment, testString, false)
+
+	// Supported helm flags
+	command = `ci release deploy \
+		--release-name 1 \
+		--chart-name simple \
+		--nginx-image-url 8 \
+		--namespace 19 \
+		--helm-flags "--atomic --history-max 5" \
+		--debug`
+	environment = []string{}
+	testString = `Deploying simple helm release 1 in 19 namespace
+Helm release deployment (not executed):`
+	CliExecTest(t, command, environment, testString, false)
+
+	// Unsupported helm flags are ignored
+	command = `ci release deploy \
+		--release-name 1 \
+		--chart-name simple \
+		--nginx-image-url 8 \
+		--namespace 19 \
+		--helm-flags "--skip-crds --description test" \
+		--debug`
+	environment = []string{}
+	testString = `Warning: helm flag --skip-crds is not supported and was ignored
+Warning: helm flag --description is not supported and was ignored`
+	CliExecTest(t, command, environment, testString, false)
+
+	// Helm flags selecting another cluster are rejected
+	command = `ci release deploy \
+		--release-name 1 \
+		--chart-name simple \
+		--nginx-image-url 8 \
+		--namespace 19 \
+		--helm-flags "--kube-context other" \
+		--debug`
+	environment = []string{}
+	testString = `Error: helm flag --kube-context is not supported`
+	CliExecTest(t, command, environment, testString, false)
+
+	// Helm timeout and version flags override deployment timeout and chart version
+	command = `ci release deploy \
+		--release-name 1 \
+		--chart-name simple \
+		--chart-version 1.0.0 \
+		--nginx-image-url 8 \
+		--namespace 19 \
+		--deployment-timeout 20m \
+		--helm-flags "--timeout 5m --version 2.0.0" \
+		--debug`
+	environment = []string{}
+	testString = `CHART_VERSION: 2.0.0
+VALUES_FILES: 
+HELM_FLAGS: --timeout 5m --version 2.0.0
+DEPLOYMENT_TIMEOUT: 5m0s`
+	CliExecTest(t, command, environment, testString, false)
+
+	// Unknown chart
+	command = `ci release deploy \
+		--release-name 1 \
+		--chart-name custom-app \
+		--namespace 19 \
+		--debug`
+	environment = []string{}
+	testString = `Chart name custom-app does not match registered chart profiles (drupal, frontend, simple), helm release step was skipped`
+	CliExecTest(t, command, environment, testString, false)
+
+	// Chart profile file
+	command = `ci release deploy \
+		--release-name 1 \
+		--chart-name wunderio/custom-app \
+		--chart-profile tests/assets/chart_profile_test/custom-app.yml \
+		--namespace 19 \
+		--debug`
+	environment = []string{}
+	testString = `App image url required (image-url app=<url>)`
+	CliExecTest(t, command, environment, testString, false)
+
+	command = `ci release deploy \
+		--release-name 1 \
+		--chart-name wunderio/custom-app \
+		--image-url app=7 \
 		--repository-url 10 \
-		--gitauth-username 11 \
-		--gitauth-password 12 \
-		--cluster-domain 13 \
-		--vpn-ip 14 \
-		--vpc-native 15 \
-		--cluster-type 16 \
-		--db-root-pass 17 \
 		--db-user-pass 18 \
 		--namespace 19 \
+		--debug`
+	environment = []string{"SILTA_CHART_PROFILES=tests/assets/chart_profile_test/custom-app.yml"}
+	testString = `Deploying wunderio/custom-app helm release 1 in 19 namespace
+Helm release deployment (not executed):
+RELEASE_NAME: 1
+NAMESPACE: 19
+CHART_NAME: wunderio/custom-app
+CHART_REPOSITORY: https://storage.googleapis.com/charts.wdr.io
+CHART_VERSION: 
+VALUES_FILES: 
+HELM_FLAGS: 
+DEPLOYMENT_TIMEOUT: 15m0s
+VALUES:
+app:
+  db:
+    password: "18"
+  image: "7"
+  repository: "10"
+clusterDomain: ""
+environmentName: ""
+silta-release:
+  branchName: ""
+`
+	CliExecTest(t, command, environment, testString, true)
+
+	// Image urls file
+	command = `ci release deploy \
+		--release-name 1 \
+		--chart-name wunderio/custom-app \
+		--image-urls-file tests/assets/image_build_test/image-urls.json \
+		--repository-url 10 \
+		--namespace 19 \
+		--debug`
+	environment = []string{"SILTA_CHART_PROFILES=tests/assets/chart_profile_test/custom-app.yml"}
+	testString = `image: foo.bar/silta/baz-app:qux`
+	CliExecTest(t, command, environment, testString, false)
+
+	// Change dir back to previous
+	os.Chdir(wd)
+}
+
+func TestReleaseRollbackCmd(t *testing.T) {
+
+	// Go to main directory
+	wd, _ := os.Getwd()
+	os.Chdir("..")
+
+	command := "ci release rollback"
+	environment := []string{}
+	testString := `Error: required flag(s)`
+	CliExecTest(t, command, environment, testString, false)
+
+	// Last successful revision
+	command = "ci release rollback --release-name test --namespace default --debug"
+	testString = `Helm release rollback (not executed):
+RELEASE_NAME: test
+NAMESPACE: default
+REVISION: last successful
+TIMEOUT: 15m0s
+`
+	CliExecTest(t, command, environment, testString, true)
+
+	// Specific revision
+	command = "ci release rollback --release-name test --namespace default --revision 3 --timeout 5m --debug"
+	testString = `Helm release rollback (not executed):
+RELEASE_NAME: test
+NAMESPACE: default
+REVISION: 3
+TIMEOUT: 5m0s
+`
+	CliExecTest(t, command, environment, testString, true)
+
+	// Change dir back to previous
+	os.Chdir(wd)
+}
+
+func TestReleaseHistoryCmd(t *testing.T) {
+
+	// Go to main directory
+	wd, _ := os.Getwd()
+	os.Chdir("..")
+
+	command := "ci release history"
+	environment := []string{}
+	testString := `Error: required flag(s)`
+	CliExecTest(t, command, environment, testString, false)
+
+	command = "ci release history --release-name test --namespace default --diff hooks"
+	testString = `Unknown diff type: hooks (supported: values, manifest)`
+	CliExecTest(t, command, environment, testString, false)
+
+	command = "ci release history --release-name test --namespace default --debug"
+	testString = `Helm release history (not executed):
+RELEASE_NAME: test
+NAMESPACE: default
+DIFF: none
+FROM_REVISION: -1
+TO_REVISION: 0`
+	CliExecTest(t, command, environment, testString, false)
+
+	command = "ci release history --release-name test --namespace default --diff manifest --from-revision 2 --to-revision 4 --debug"
+	testString = `Helm release history (not executed):
+RELEASE_NAME: test
+NAMESPACE: default
+DIFF: manifest
+FROM_REVISION: 2
+TO_REVISION: 4`
+	CliExecTest(t, command, environment, testString, false)
+
+	// Change dir back to previous
+	os.Chdir(wd)
+}
+
+func TestReleaseDebugFailedCmd(t *testing.T) {
+
+	// Go to main directory
+	wd, _ := os.Getwd()
+	os.Chdir("..")
+
+	command := "ci release debug-failed"
+	environment := []string{}
+	testString := `Error: required flag(s)`
+	CliExecTest(t, command, environment, testString, false)
+
+	command = "ci release debug-failed --release-name test --namespace default --output html"
+	testString = `Unknown output format: html (supported: text, json, markdown)`
+	CliExecTest(t, command, environment, testString, false)
+
+	// Change dir back to previous
+	os.Chdir(wd)
+}
+
+func TestReleaseSupportBundleCmd(t *testing.T) {
+
+	// Go to main directory
+	wd, _ := os.Getwd()
+	os.Chdir("..")
+
+	command := "ci release support-bundle"
+	environment := []string{}
+	testString := `Error: required flag(s)`
+	CliExecTest(t, command, environment, testString, false)
+
+	command = "ci release support-bundle --release-name test --namespace default --debug"
+	testString = `Release support bundle (not executed):
+RELEASE_NAME: test
+NAMESPACE: default
+OUTPUT_FILE: test-support-bundle.tar.gz
+`
+	CliExecTest(t, command, environment, testString, true)
+
+	// Change dir back to previous
+	os.Chdir(wd)
+}
+
+func TestReleaseEventsCmd(t *testing.T) {
+
+	// Go to main directory
+	wd, _ := os.Getwd()
+	os.Chdir("..")
+
+	command := "ci release events"
+	environment := []string{}
+	testString := `Error: required flag(s)`
+	CliExecTest(t, command, environment, testString, false)
+
+	command = "ci release events --release-name test --namespace default --since -5m"
+	testString = `Error: invalid --since value: -5m0s`
+	CliExecTest(t, command, environment, testString, false)
+
+	command = "ci release events --release-name test --namespace default --debug"
+	testString = `Release events (not executed):
+RELEASE_NAME: test
+NAMESPACE: default
+SINCE: all events
+FOLLOW: false`
+	CliExecTest(t, command, environment, testString, false)
+
+	command = "ci release events --release-name test --namespace default --since 30m --follow --debug"
+	testString = `Release events (not executed):
+RELEASE_NAME: test
+NAMESPACE: default
+SINCE: 30m0s
+FOLLOW: true`
+	CliExecTest(t, command, environment, testString, false)
+
+	// Change dir back to previous
+	os.Chdir(wd)
+}
+
+func TestReleaseLogsCmd(t *testing.T) {
+
+	// Go to main directory
+	wd, _ := os.Getwd()
+	os.Chdir("..")
+
+	command := "ci release logs"
+	environment := []string{}
+	testString := `Error: required flag(s)`
+	CliExecTest(t, command, environment, testString, false)
+
+	command = "ci release logs --release-name test --namespace default --grep '[a-'"
+	testString = `Error: invalid --grep pattern: error parsing regexp`
+	CliExecTest(t, command, environment, testString, false)
+
+	command = "ci release logs --release-name test --namespace default --previous --follow"
+	testString = `Error: --previous can't be used with --follow`
+	CliExecTest(t, command, environment, testString, false)
+
+	// Change dir back to previous
+	os.Chdir(wd)
+}
+
+func TestReleaseExecCmd(t *testing.T) {
+
+	// Go to main directory
+	wd, _ := os.Getwd()
+	os.Chdir("..")
+
+	command := "ci release exec"
+	environment := []string{}
+	testString := `Error: required flag(s)`
+	CliExecTest(t, command, environment, testString, false)
+
+	command = "ci release exec --release-name test --namespace default --debug -- drush status"
+	testString = `Release exec (not executed):
+RELEASE_NAME: test
+NAMESPACE: default
+COMPONENT: shell, php
+COMMAND: drush status
+STDIN: false
+`
+	CliExecTest(t, command, environment, testString, true)
+
+	command = "ci release exec --release-name test --namespace default -i --debug -- drush sqlc"
+	testString = `Release exec (not executed):
+RELEASE_NAME: test
+NAMESPACE: default
+COMPONENT: shell, php
+COMMAND: drush sqlc
+STDIN: true
+`
+	CliExecTest(t, command, environment, testString, true)
+
+	command = "ci release shell --release-name test --namespace default --component php --debug"
+	testString = `Release exec (not executed):
+RELEASE_NAME: test
+NAMESPACE: default
+COMPONENT: php
+COMMAND: /bin/sh -c command -v bash >/dev/null && exec bash || exec sh
+STDIN: false
+`
+	CliExecTest(t, command, environment, testString, true)
+
+	// Change dir back to previous
+	os.Chdir(wd)
+}
+
+func TestReleaseDbCmd(t *testing.T) {
+
+	// Go to main directory
+	wd, _ := os.Getwd()
+	os.Chdir("..")
+
+	command := "ci release db dump"
+	environment := []string{}
+	testString := `Error: required flag(s)`
+	CliExecTest(t, command, environment, testString, false)
+
+	command = "ci release db dump --release-name test --namespace default --debug"
+	testString = `Release database dump (not executed):
+RELEASE_NAME: test
+NAMESPACE: default
+OUTPUT_FILE: test.sql.gz
+`
+	CliExecTest(t, command, environment, testString, true)
+
+	command = "ci release db import --release-name test --namespace default"
+	testString = `Error: required flag(s) "input-file" not set`
+	CliExecTest(t, command, environment, testString, false)
+
+	command = "ci release db import --release-name test --namespace default --input-file dump.sql --debug"
+	testString = `Release database import (not executed):
+RELEASE_NAME: test
+NAMESPACE: default
+INPUT_FILE: dump.sql
+`
+	CliExecTest(t, command, environment, testString, true)
+
+	command = "ci release db copy --release-name test --namespace default --from-release test"
+	testString = `Error: --from-release can't be the same as --release-name`
+	CliExecTest(t, command, environment, testString, false)
+
+	command = "ci release db copy --release-name feature --namespace default --from-release main --debug"
+	testString = `Release database copy (not executed):
+FROM_RELEASE: main
+FROM_NAMESPACE: default
+RELEASE_NAME: feature
+NAMESPACE: default
+`
+	CliExecTest(t, command, environment, testString, true)
+
+	// Change dir back to previous
+	os.Chdir(wd)
+}
+
+func TestReleaseFilesCmd(t *testing.T) {
+
+	// Go to main directory
+	wd, _ := os.Getwd()
+	os.Chdir("..")
+
+	command := "ci release files pull --release-name test --namespace default"
+	environment := []string{}
+	testString := `Error: required flag(s) "local-path" not set`
+	CliExecTest(t, command, environment, testString, false)
+
+	command = "ci release files push --release-name test --namespace default --local-path files --exclude '['"
+	testString = `Error: invalid pattern "[": syntax error in pattern`
+	CliExecTest(t, command, environment, testString, false)
+
+	command = "ci release files push --release-name test --namespace default --local-path files --remote-path files"
+	testString = `Error: --remote-path must be absolute: files`
+	CliExecTest(t, command, environment, testString, false)
+
+	command = "ci release files pull --release-name test --namespace default --local-path reference --remote-path /app/reference-data --include '*.jpg' --exclude tmp --resume --debug"
+	testString = `Release files pull (not executed):
+RELEASE_NAME: test
+NAMESPACE: default
+REMOTE_PATH: /app/reference-data
+LOCAL_PATH: reference
+INCLUDE: *.jpg
+EXCLUDE: tmp
+RESUME: true
+`
+	CliExecTest(t, command, environment, testString, true)
+
+	// Change dir back to previous
+	os.Chdir(wd)
+}
+
+func TestReleaseRestartCmd(t *testing.T) {
+
+	// Go to main directory
+	wd, _ := os.Getwd()
+	os.Chdir("..")
+
+	command := "ci release restart"
+	environment := []string{}
+	testString := `Error: required flag(s)`
+	CliExecTest(t, command, environment, testString, false)
+
+	command = "ci release restart --release-name test --namespace default --component php --debug"
+	testString = `Release restart (not executed):
+RELEASE_NAME: test
+NAMESPACE: default
+COMPONENT: php
+`
+	CliExecTest(t, command, environment, testString, true)
+
+	// Change dir back to previous
+	os.Chdir(wd)
+}
+
+func TestReleaseScaleCmd(t *testing.T) {
+
+	// Go to main directory
+	wd, _ := os.Getwd()
+	os.Chdir("..")
+
+	command := "ci release scale --release-name test --namespace default"
+	environment := []string{}
+	testString := `Error: required flag(s) "component" not set`
+	CliExecTest(t, command, environment, testString, false)
+
+	command = "ci release scale --release-name test --namespace default --component php"
+	testString = `Error: either --replicas or --revert is required`
+	CliExecTest(t, command, environment, testString, false)
+
+	command = "ci release scale --release-name test --namespace default --component php --replicas 2 --revert"
+	testString = `Error: either --replicas or --revert is required`
+	CliExecTest(t, command, environment, testString, false)
+
+	command = "ci release scale --release-name test --namespace default --component php --replicas -1"
+	testString = `Error: invalid --replicas value: -1`
+	CliExecTest(t, command, environment, testString, false)
+
+	command = "ci release scale --release-name test --namespace default --component php --replicas 3 --debug"
+	testString = `Release scale (not executed):
+RELEASE_NAME: test
+NAMESPACE: default
+COMPONENT: php
+REPLICAS: 3
+`
+	CliExecTest(t, command, environment, testString, true)
+
+	command = "ci release scale --release-name test --namespace default --component php --revert --debug"
+	testString = `Release scale (not executed):
+RELEASE_NAME: test
+NAMESPACE: default
+COMPONENT: php
+REPLICAS: original
+`
+	CliExecTest(t, command, environment, testString, true)
+
+	// Change dir back to previous
+	os.Chdir(wd)
+}
+
+func TestReleaseCronRunCmd(t *testing.T) {
+
+	// Go to main directory
+	wd, _ := os.Getwd()
+	os.Chdir("..")
+
+	command := "ci release cron run"
+	environment := []string{}
+	testString := `Error: required flag(s)`
+	CliExecTest(t, command, environment, testString, false)
+
+	command = "ci release cron run --release-name test --namespace default --cronjob drupal --debug"
+	testString = `Release cronjob run (not executed):
+RELEASE_NAME: test
+NAMESPACE: default
+CRONJOB: drupal
+`
+	CliExecTest(t, command, environment, testString, true)
+
+	// Change dir back to previous
+	os.Chdir(wd)
+}
+
+func TestReleaseDiffCmd(t *testing.T) {
+
+	// Go to main directory
+	wd, _ := os.Getwd()
+	os.Chdir("..")
+
+	command := "ci release diff"
+	environment := []string{}
+	testString := `Error: required flag(s)`
+	CliExecTest(t, command, environment, testString, false)
+
+	command = `ci release diff \
+		--release-name 1 \
+		--chart-name simple \
+		--nginx-image-url 8 \
+		--namespace 19 \
 		--silta-config 20 \
-		--deployment-timeout 21 \
-		--helm-flags 22 \
+		--helm-flags "--set 21=foo" \
+		--debug`
+	testString = `Helm release diff (not executed):
+RELEASE_NAME: 1
+NAMESPACE: 19
+CHART_NAME: simple
+CHART_REPOSITORY: https://storage.googleapis.com/charts.wdr.io
+CHART_VERSION: 
+VALUES_FILES: 20
+HELM_FLAGS: --set 21=foo
+DEPLOYMENT_TIMEOUT: 15m0s
+VALUES:
+clusterDomain: ""
+environmentName: ""
+nginx:
+  image: "8"
+silta-release:
+  branchName: ""
+`
+	CliExecTest(t, command, environment, testString, true)
+
+	command = `ci release diff --release-name 1 --chart-name simple --nginx-image-url 8 --namespace 19 --output html --debug`
+	testString = `Unknown output format: html (supported: text, json, markdown)`
+	CliExecTest(t, command, environment, testString, false)
+
+	// Change dir back to previous
+	os.Chdir(wd)
+}
+
+func TestReleaseValidateCmd(t *testing.T) {
+
+	// Go to main directory
+	wd, _ := os.Getwd()
+	os.Chdir("..")
+
+	command := `ci release validate \
+		--release-name 1 \
+		--namespace 2 \
+		--chart-name app \
+		--chart-path tests/assets/validate_test/chart \
+		--chart-profile tests/assets/validate_test/profile.yml \
+		--silta-config tests/assets/validate_test/silta.yml \
 		--debug`
+	environment := []string{}
+	testString := `Helm release validation (not executed):
+RELEASE_NAME: 1
+NAMESPACE: 2
+CHART: tests/assets/validate_test/chart
+CHART_VERSION: 
+VALUE_FILES: tests/assets/validate_test/silta.yml
+OFFLINE: false
+STRICT: false
+`
+	CliExecTest(t, command, environment, testString, true)
+
+	// Offline validation requires a local chart
+	command = `ci release validate --release-name 1 --namespace 2 --chart-name wunderio/simple --offline`
+	testString = `Chart wunderio/simple is not available locally, offline validation requires a chart directory`
+	CliExecTest(t, command, environment, testString, false)
+
+	command = `ci release validate \
+		--release-name 1 \
+		--namespace 2 \
+		--chart-name app \
+		--chart-path tests/assets/validate_test/chart \
+		--chart-profile tests/assets/validate_test/profile.yml \
+		--silta-config tests/assets/validate_test/silta.yml \
+		--offline`
+	testString = `Validating tests/assets/validate_test/chart helm release 1 in 2 namespace
+Release configuration is valid
+`
+	CliExecTest(t, command, environment, testString, true)
+
+	// Errors point to configuration files, chart overrides are named after the environment variable
+	command = `ci release validate \
+		--release-name 1 \
+		--namespace 2 \
+		--chart-name app \
+		--chart-path tests/assets/validate_test/chart \
+		--chart-profile tests/assets/validate_test/profile.yml \
+		--silta-config tests/assets/validate_test/silta-invalid.yml \
+		--offline`
+	environment = []string{"SILTA_APP_CONFIG_VALUES=YXBwOgogIGVudjoKICAgIERFQlVHOiB0cnVlCg=="}
+	testString = `Error: values don't meet the specifications of the app chart schema:
+- SILTA_APP_CONFIG_VALUES:3:5: at '/app/env/DEBUG': got boolean, want string
+- tests/assets/validate_test/silta-invalid.yml:5:5: at '/app/env/RETRIES': got number, want string
+- tests/assets/validate_test/silta-invalid.yml:6:3: at '/app/imagee': additional properties 'imagee' not allowed
+- tests/assets/validate_test/silta-invalid.yml:2:3: at '/app/replicas': got string, want integer
+`
+	CliExecTest(t, command, environment, testString, false)
+
+	// Unknown keys are warnings unless validation is strict
+	command = `ci release validate \
+		--release-name 1 \
+		--namespace 2 \
+		--chart-name app \
+		--chart-path tests/assets/validate_test/chart \
+		--chart-profile tests/assets/validate_test/profile.yml \
+		--silta-config tests/assets/validate_test/silta-typo.yml \
+		--offline`
 	environment = []string{}
-	testString = `
-			RELEASE_NAME='1'
-			CHART_NAME='simple'
-			CHART_REPOSITORY='3'
-			EXTRA_CHART_VERSION='--version '4''
-			SILTA_ENVIRONMENT_NAME='5'
-			BRANCHNAME='6'
-			NGINX_IMAGE_URL='8'
-			CLUSTER_DOMAIN='13'
-			EXTRA_NOAUTHIPS='--set nginx.noauthips.vpn='14/32''
-			EXTRA_VPCNATIVE='--set cluster.vpcNative='15''
-			EXTRA_CLUSTERTYPE='--set cluster.type='16''
-			NAMESPACE='19'
-			SILTA_CONFIG='20'
-			EXTRA_HELM_FLAGS='22'
-			DEPLOYMENT_TIMEOUT='21'
-
-			function deployment_failed() {
-				debug_failed_deployment
-				rm -f helm-output.log || true
-			}
-
-			function debug_failed_deployment() {
-				silta ci release debug-failed --release-name="${RELEASE_NAME}" --namespace="${NAMESPACE}"
-			}
-
-			trap deployment_failed ERR
-
-			helm upgrade --install "${RELEASE_NAME}" "${CHART_NAME}" \
-				--repo "${CHART_REPOSITORY}" \
-				${EXTRA_CHART_VERSION} \
-				--cleanup-on-fail \
-				--set environmentName="${SILTA_ENVIRONMENT_NAME}" \
-				--set silta-release.branchName="${BRANCHNAME}" \
-				--set nginx.image="${NGINX_IMAGE_URL}" \
-				--set clusterDomain="${CLUSTER_DOMAIN}" \
-				${EXTRA_NOAUTHIPS} \
-				${EXTRA_VPCNATIVE} \
-				${EXTRA_CLUSTERTYPE} \
-				--namespace="${NAMESPACE}" \
-				--values "${SILTA_CONFIG}" \
-				${EXTRA_HELM_FLAGS} \
-				--timeout "${DEPLOYMENT_TIMEOUT}" \
-				--wait`
+	testString = `Warning: values contain keys unknown to the app chart:
+- tests/assets/validate_test/silta-typo.yml:1:1: at '/ap': unknown key, did you mean 'app'?
+- tests/assets/validate_test/silta-typo.yml:3:1: at '/enviromentName': unknown key, did you mean 'environmentName'?
+- tests/assets/validate_test/silta-typo.yml:6:3: at '/ingress/hots': unknown key, did you mean 'host'?
+- tests/assets/validate_test/silta-typo.yml:7:1: at '/extra': unknown key
+Release configuration is valid
+`
+	CliExecTest(t, command, environment, testString, false)
+
+	command += " --strict"
+	testString = `Error: values contain keys unknown to the app chart:
+- tests/assets/validate_test/silta-typo.yml:1:1: at '/ap': unknown key, did you mean 'app'?
+`
+	CliExecTest(t, command, environment, testString, false)
+
+	// Chart configuration overrides are checked too
+	command = `ci release validate \
+		--release-name 1 \
+		--namespace 2 \
+		--chart-name app \
+		--chart-path tests/assets/validate_test/chart \
+		--chart-profile tests/assets/validate_test/profile.yml \
+		--silta-config tests/assets/validate_test/silta.yml \
+		--offline`
+	environment = []string{"SILTA_APP_CONFIG_VALUES=YXA6CiAgcmVwbGljYXM6IDMK"}
+	testString = `- SILTA_APP_CONFIG_VALUES:1:1: at '/ap': unknown key, did you mean 'app'?`
+	CliExecTest(t, command, environment, testString, false)
+
+	// Change dir back to previous
+	os.Chdir(wd)
+}
+
+func TestReleaseDownscaleCmd(t *testing.T) {
+
+	// Go to main directory
+	wd, _ := os.Getwd()
+	os.Chdir("..")
+
+	command := "ci release downscale"
+	environment := []string{}
+	testString := `Error: at least one of the flags in the group`
+	CliExecTest(t, command, environment, testString, false)
+
+	command = "ci release downscale --release-name test --namespace default --placeholder-host placeholder.example.com --debug"
+	testString = `Release downscale (not executed):
+RELEASE_NAME: test
+NAMESPACE: default
+PLACEHOLDER_HOST: placeholder.example.com
+`
+	CliExecTest(t, command, environment, testString, true)
+
+	// Bulk mode
+	command = "ci release downscale --selector app=drupal --all-namespaces --concurrency 3 --debug"
+	testString = `Release downscale (not executed):
+NAMESPACE: (all namespaces)
+SELECTOR: app=drupal
+CONCURRENCY: 3
+`
+	CliExecTest(t, command, environment, testString, true)
+
+	command = "ci release downscale --all --release-name test --namespace default --debug"
+	testString = `Error: if any flags in the group [release-name all selector] are set none of the others can be`
+	CliExecTest(t, command, environment, testString, false)
+
+	// Change dir back to previous
+	os.Chdir(wd)
+}
+
+func TestReleaseWakeupCmd(t *testing.T) {
+
+	// Go to main directory
+	wd, _ := os.Getwd()
+	os.Chdir("..")
+
+	command := "ci release wakeup --namespace default"
+	environment := []string{}
+	testString := `Error: at least one of the flags in the group [release-name all selector] is required`
 	CliExecTest(t, command, environment, testString, false)
 
+	command = "ci release wakeup --all --namespace default --debug"
+	testString = `Release wakeup (not executed):
+NAMESPACE: default
+SELECTOR: 
+CONCURRENCY: 5
+`
+	CliExecTest(t, command, environment, testString, true)
+
+	command = "ci release wakeup --all --namespace default --verify-urls --expected-status 200-ok --debug"
+	testString = `Error: invalid status code range: 200-ok`
+	CliExecTest(t, command, environment, testString, false)
+
+	// Change dir back to previous
+	os.Chdir(wd)
+}
+
+func TestReleaseIdleReportCmd(t *testing.T) {
+
+	// Go to main directory
+	wd, _ := os.Getwd()
+	os.Chdir("..")
+
+	command := "ci release idle-report"
+	environment := []string{}
+	testString := `Error: at least one of the flags in the group [namespace all-namespaces] is required`
+	CliExecTest(t, command, environment, testString, false)
+
+	// Flags override the policy from configuration store
+	command = "ci release idle-report --all-namespaces --max-idle-days 5 --excluded-branches 'main, release/*' --downscale --debug"
+	testString = `Release idle report (not executed):
+NAMESPACE: (all namespaces)
+MAX_IDLE_DAYS: 5
+EXCLUDED_BRANCHES: main,release/*
+DOWNSCALE: true
+`
+	CliExecTest(t, command, environment, testString, true)
+
 	// Change dir back to previous
 	os.Chdir(wd)
 }
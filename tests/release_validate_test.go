@@ -0,0 +1,191 @@
+package cmd_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/wunderio/silta-cli/internal/common"
+
+	helmChart "helm.sh/helm/v3/pkg/chart"
+	helmLoader "helm.sh/helm/v3/pkg/chart/loader"
+	helmCli "helm.sh/helm/v3/pkg/cli"
+)
+
+func TestValidateChartValues(t *testing.T) {
+	chart, err := helmLoader.Load("assets/validate_test/chart")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	base := filepath.Join(dir, "silta.yml")
+	os.WriteFile(base, []byte("app:\n  image: nginx\n  replicas: 3\n"), 0644)
+	override := filepath.Join(dir, "silta-feature.yml")
+	os.WriteFile(override, []byte("defaults: &defaults\n  replicas: 0\napp:\n  <<: *defaults\n  image: nginx\n"), 0644)
+
+	baseSource, err := common.ValuesFileSource("silta.yml", base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	overrideSource, err := common.ValuesFileSource("silta-feature.yml", override)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sources := []common.ValuesSource{baseSource, overrideSource}
+
+	values, err := common.ComputeReleaseValues(helmCli.New(), []string{base, override}, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Value from the last file wins, merge keys are followed
+	violations, err := common.ValidateChartValues(chart, values, sources)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(violations) != 1 {
+		t.Fatalf("expected 1 violation, got %v", violations)
+	}
+	expected := "silta-feature.yml:2:3: at '/app/replicas': minimum: got 0, want 1"
+	if violations[0].String() != expected {
+		t.Errorf("expected %q, got %q", expected, violations[0].String())
+	}
+
+	// Structured values have no line information, missing values point to the closest defined parent
+	releaseSource, err := common.ValuesMapSource("release parameters", map[string]interface{}{"environmentName": 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	chart, _ = helmLoader.Load("assets/validate_test/chart")
+	violations, err = common.ValidateChartValues(chart, map[string]interface{}{"environmentName": 5, "app": map[string]interface{}{"image": nil}}, []common.ValuesSource{releaseSource})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(violations) != 2 {
+		t.Fatalf("expected 2 violations, got %v", violations)
+	}
+	expected = "app/values.yaml:5:1: at '/app': missing property 'image'"
+	if violations[0].String() != expected {
+		t.Errorf("expected %q, got %q", expected, violations[0].String())
+	}
+	expected = "release parameters: at '/environmentName': got number, want string"
+	if violations[1].String() != expected {
+		t.Errorf("expected %q, got %q", expected, violations[1].String())
+	}
+}
+
+func TestUnknownValueKeys(t *testing.T) {
+	chart := &helmChart.Chart{
+		Metadata: &helmChart.Metadata{Name: "app", Version: "0.1.0", APIVersion: "v2"},
+		Values: map[string]interface{}{
+			"nginx": map[string]interface{}{"image": "", "resources": map[string]interface{}{}},
+			"env":   map[string]interface{}{"LOG_LEVEL": "info"},
+		},
+		Schema: []byte(`{
+			"definitions": {"backup": {"type": "object", "properties": {"schedule": {"type": "string"}}}},
+			"properties": {
+				"backup": {"$ref": "#/definitions/backup"},
+				"env": {"type": "object", "additionalProperties": {"type": "string"}},
+				"nginx": {"type": "object", "patternProperties": {"^x-": {"type": "string"}}}
+			}
+		}`),
+	}
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "silta.yml")
+	os.WriteFile(file, []byte(`ngnix:
+  image: nginx
+nginx:
+  x-header: foo
+  resource: {}
+  resources:
+    limits: {}
+env:
+  DEBUG: "true"
+backup:
+  schedul: "0 1 * * *"
+`), 0644)
+	source, err := common.ValuesFileSource("silta.yml", file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unknown, err := common.UnknownValueKeys(chart, []common.ValuesSource{source}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"silta.yml:1:1: at '/ngnix': unknown key, did you mean 'nginx'?",
+		"silta.yml:5:3: at '/nginx/resource': unknown key, did you mean 'resources'?",
+		"silta.yml:11:3: at '/backup/schedul': unknown key, did you mean 'schedule'?",
+	}
+	if len(unknown) != len(expected) {
+		t.Fatalf("expected %d unknown keys, got %v", len(expected), unknown)
+	}
+	for i := range expected {
+		if unknown[i].String() != expected[i] {
+			t.Errorf("expected %q, got %q", expected[i], unknown[i].String())
+		}
+	}
+}
+
+func TestUnknownValueKeysOpenValues(t *testing.T) {
+	chart := &helmChart.Chart{
+		Metadata: &helmChart.Metadata{Name: "drupal", Version: "0.1.0", APIVersion: "v2"},
+		Values: map[string]interface{}{
+			"php": map[string]interface{}{
+				"cron": map[string]interface{}{"drupal": map[string]interface{}{"schedule": "*/15 * * * *", "command": "drush cron"}},
+				"env":  map[string]interface{}{"ENVIRONMENT_NAME": ""},
+			},
+			"mounts": map[string]interface{}{"public-files": map[string]interface{}{"enabled": true}},
+		},
+	}
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "silta.yml")
+	os.WriteFile(file, []byte(`php:
+  cron:
+    drupal:
+      schedul: "0 * * * *"
+    migrate:
+      schedule: "0 1 * * *"
+      command: drush migrate:import --all
+  env:
+    API_URL: https://example.com
+mounts:
+  private-files:
+    enabled: true
+  public-files:
+    enabld: false
+`), 0644)
+	source, err := common.ValuesFileSource("silta.yml", file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// New cron jobs, environment variables and mounts are allowed, keys of known items are still checked
+	profile := common.GetChartProfile("drupal")
+	unknown, err := common.UnknownValueKeys(chart, []common.ValuesSource{source}, profile.OpenValues())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"silta.yml:4:7: at '/php/cron/drupal/schedul': unknown key, did you mean 'schedule'?",
+		"silta.yml:14:5: at '/mounts/public-files/enabld': unknown key, did you mean 'enabled'?",
+	}
+	received := []string{}
+	for _, u := range unknown {
+		received = append(received, u.String())
+	}
+	if strings.Join(received, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Unexpected unknown keys:\n%s", strings.Join(received, "\n"))
+	}
+
+	// Without open values maps with defaults are closed
+	unknown, _ = common.UnknownValueKeys(chart, []common.ValuesSource{source}, nil)
+	if len(unknown) != 5 {
+		t.Errorf("Expected 5 unknown keys without open values, received %v", unknown)
+	}
+}
@@ -0,0 +1,104 @@
+package cmd_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/wunderio/silta-cli/internal/common"
+)
+
+func TestParseStatusCodes(t *testing.T) {
+	ranges, err := common.ParseStatusCodes("200-399, 401")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ranges, [][2]int{{200, 399}, {401, 401}}) {
+		t.Errorf("Unexpected ranges: %v", ranges)
+	}
+	for _, invalid := range []string{"", "ok", "399-200"} {
+		if _, err := common.ParseStatusCodes(invalid); err == nil {
+			t.Errorf("Expected error for %q", invalid)
+		}
+	}
+
+	urls := common.HostnameURLs([]string{"test.example.com", "*.test.example.com", ""})
+	if !reflect.DeepEqual(urls, []string{"https://test.example.com"}) {
+		t.Errorf("Unexpected urls: %v", urls)
+	}
+}
+
+func TestVerifyURLs(t *testing.T) {
+	// Site behind basic auth, answers after a couple of attempts
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		username, password, ok := r.BasicAuth()
+		if !ok || username != "silta" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	verification := common.URLVerification{
+		ExpectedStatus: "200-399",
+		Username:       "silta",
+		Password:       "secret",
+		Retries:        3,
+		Backoff:        10 * time.Millisecond,
+		Timeout:        time.Second,
+	}
+	out := &bytes.Buffer{}
+	results, err := common.VerifyURLs(context.Background(), []string{server.URL}, verification, out)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if results[0].Status != 200 || results[0].Attempts != 3 {
+		t.Errorf("Unexpected result: %+v", results[0])
+	}
+	if out.String() != server.URL+": 200 OK\n" {
+		t.Errorf("Unexpected output: %s", out.String())
+	}
+
+	// Wrong credentials, retries run out
+	verification.Password = "wrong"
+	verification.Retries = 1
+	out = &bytes.Buffer{}
+	results, err = common.VerifyURLs(context.Background(), []string{server.URL}, verification, out)
+	if err == nil || err.Error() != "1 of 1 urls did not answer as expected" {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if results[0].Attempts != 2 || results[0].Status != 401 {
+		t.Errorf("Unexpected result: %+v", results[0])
+	}
+	if !strings.Contains(out.String(), "unexpected status 401 Unauthorized (2 attempts)") {
+		t.Errorf("Unexpected output: %s", out.String())
+	}
+
+	// Unauthorized is fine when it's expected
+	verification.ExpectedStatus = "200,401"
+	verification.Retries = 0
+	_, err = common.VerifyURLs(context.Background(), []string{server.URL}, verification, &bytes.Buffer{})
+	if err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+
+	// Site does not answer
+	server.Close()
+	out = &bytes.Buffer{}
+	_, err = common.VerifyURLs(context.Background(), []string{server.URL}, verification, out)
+	if err == nil {
+		t.Errorf("Expected error for closed server")
+	}
+}
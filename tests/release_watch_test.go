@@ -0,0 +1,132 @@
+package cmd_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wunderio/silta-cli/internal/common"
+	appsv1 "k8s.io/api/apps/v1"
+	v1core "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestStreamPostReleaseLogs(t *testing.T) {
+
+	// Logs are streamed once the container runs
+	clientset := fake.NewClientset(testPod("test-post-release-abc", map[string]string{"job-name": "test-post-release"}).
+		container("main", v1core.ContainerState{Running: &v1core.ContainerStateRunning{}}).build())
+	out := &bytes.Buffer{}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := common.StreamPostReleaseLogs(ctx, clientset, "default", "test", out)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	expected := "Post-release job pod test-post-release-abc scheduled on node-1\n\nPost-release log:\nfake logs"
+	if out.String() != expected {
+		t.Errorf("Expected:\n'%s'\nReceived:\n'%s'", expected, out.String())
+	}
+
+	// Pod is created after watching started
+	clientset = fake.NewClientset()
+	out = &bytes.Buffer{}
+	result := make(chan error, 1)
+	go func() {
+		result <- common.StreamPostReleaseLogs(ctx, clientset, "default", "test", out)
+	}()
+	time.Sleep(100 * time.Millisecond)
+	clientset.CoreV1().Pods("default").Create(context.TODO(), testPod("test-post-release-def", map[string]string{"job-name": "test-post-release"}).
+		container("main", v1core.ContainerState{Waiting: &v1core.ContainerStateWaiting{Reason: "ImagePullBackOff", Message: "image not found"}}).build(), v1.CreateOptions{})
+	err = <-result
+	var podFailure *common.PodFailureError
+	if !errors.As(err, &podFailure) {
+		t.Fatalf("Expected pod failure, received: %v", err)
+	}
+	if err.Error() != "pod test-post-release-def container main: ImagePullBackOff (image not found)" {
+		t.Errorf("Unexpected error message: %s", err)
+	}
+}
+
+func TestWaitForReleaseRollout(t *testing.T) {
+
+	replicas := int32(1)
+	deployment := &appsv1.Deployment{
+		ObjectMeta: v1.ObjectMeta{Name: "test-nginx", Namespace: "default", Labels: map[string]string{"release": "test"}, Generation: 2},
+		Spec:       appsv1.DeploymentSpec{Replicas: &replicas},
+		Status:     appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 1, UpdatedReplicas: 1, AvailableReplicas: 1},
+	}
+
+	// Rolled out deployment
+	clientset := fake.NewClientset(deployment.DeepCopy())
+	out := &bytes.Buffer{}
+	err := common.WaitForReleaseRollout(clientset, "default", "test", nil, 5*time.Second, out)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if out.String() != "deployment \"test-nginx\" successfully rolled out\n" {
+		t.Errorf("Unexpected output: %s", out.String())
+	}
+
+	// Rollout progress is reported as it happens
+	progressing := deployment.DeepCopy()
+	progressing.Status.AvailableReplicas = 0
+	clientset = fake.NewClientset(progressing)
+	out = &bytes.Buffer{}
+	result := make(chan error, 1)
+	go func() {
+		result <- common.WaitForReleaseRollout(clientset, "default", "test", nil, 5*time.Second, out)
+	}()
+	time.Sleep(100 * time.Millisecond)
+	clientset.AppsV1().Deployments("default").UpdateStatus(context.TODO(), deployment.DeepCopy(), v1.UpdateOptions{})
+	err = <-result
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	expected := "Waiting for deployment \"test-nginx\" rollout to finish: 0 of 1 updated replicas are available...\ndeployment \"test-nginx\" successfully rolled out\n"
+	if out.String() != expected {
+		t.Errorf("Expected:\n'%s'\nReceived:\n'%s'", expected, out.String())
+	}
+
+	// Crashing pod fails rollout without waiting for timeout
+	clientset = fake.NewClientset(progressing.DeepCopy(), testPod("test-nginx-abc", map[string]string{"release": "test"}).
+		container("main", v1core.ContainerState{Waiting: &v1core.ContainerStateWaiting{Reason: "CrashLoopBackOff"}}).build())
+	start := time.Now()
+	err = common.WaitForReleaseRollout(clientset, "default", "test", nil, time.Minute, &bytes.Buffer{})
+	if err == nil || !strings.Contains(err.Error(), "pod test-nginx-abc container main: CrashLoopBackOff") {
+		t.Errorf("Expected pod failure, received: %v", err)
+	}
+	if time.Since(start) > 10*time.Second {
+		t.Errorf("Rollout failure was not detected right away")
+	}
+
+	// Crashing pod of the previous rollout is replaced by the rollout
+	oldPod := testPod("test-nginx-old", map[string]string{"release": "test"}).
+		container("main", v1core.ContainerState{Waiting: &v1core.ContainerStateWaiting{Reason: "CrashLoopBackOff"}}).build()
+	clientset = fake.NewClientset(progressing.DeepCopy(), oldPod)
+	existing, err := common.ListExistingPods(context.TODO(), clientset, "default", "test")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	result = make(chan error, 1)
+	go func() {
+		result <- common.WaitForReleaseRollout(clientset, "default", "test", existing, 5*time.Second, &bytes.Buffer{})
+	}()
+	time.Sleep(100 * time.Millisecond)
+	clientset.AppsV1().Deployments("default").UpdateStatus(context.TODO(), deployment.DeepCopy(), v1.UpdateOptions{})
+	clientset.CoreV1().Pods("default").Delete(context.TODO(), "test-nginx-old", v1.DeleteOptions{})
+	if err := <-result; err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+
+	// Timeout
+	clientset = fake.NewClientset(progressing.DeepCopy())
+	err = common.WaitForReleaseRollout(clientset, "default", "test", nil, 500*time.Millisecond, &bytes.Buffer{})
+	if err == nil || err.Error() != "deployment test-nginx: timed out waiting for the condition" {
+		t.Errorf("Expected timeout, received: %v", err)
+	}
+}